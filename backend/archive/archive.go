@@ -0,0 +1,567 @@
+// Package archive implements a backend which shows archives as
+// read only directories
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	libcache "github.com/rclone/rclone/lib/cache"
+)
+
+// Globals
+var (
+	errReadOnly = errors.New("can't modify the contents of an archive")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "archive",
+		Description: "Read archives as directories",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written
+for files which aren't in archives.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote containing the archives to read.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote string `config:"remote"`
+}
+
+// Fs represents a remote with archives shown as directories
+type Fs struct {
+	name     string          // name of this remote
+	root     string          // the path we are working on
+	opt      Options         // parsed options
+	base     fs.Fs           // the remote containing the archives
+	prefix   string          // path of root relative to the root of base
+	features *fs.Features    // optional features
+	wrapper  fs.Fs           // the Fs wrapping this one, if any
+	indexes  *libcache.Cache // cached indexes of the archives by path in base
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point archive remote at itself - check the value of the remote setting")
+	}
+
+	// Root the base at the directory above the first archive in the
+	// path as the archive is a file on the base.
+	baseRoot, prefix := splitRoot(rpath)
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, baseRoot))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name:    name,
+		root:    rpath,
+		opt:     *opt,
+		base:    base,
+		prefix:  prefix,
+		indexes: libcache.New(),
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		ReadMetadata:            true,
+		WriteMetadata:           true,
+		UserMetadata:            true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	cache.PinUntilFinalized(base, f)
+
+	if err == fs.ErrorIsFile {
+		if prefix == "" {
+			f.root = parentDir(rpath)
+			return f, fs.ErrorIsFile
+		}
+		// The base is rooted at the parent of baseRoot so the
+		// prefix needs to include it
+		f.prefix = path.Join(path.Base(baseRoot), prefix)
+	}
+
+	// If the root is a file in an archive then point the root at
+	// its directory
+	if f.prefix != "" {
+		idx, inner, err := f.locate(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		if e := idx.find(inner); e != nil && !e.dir {
+			f.root = parentDir(f.root)
+			f.prefix = parentDir(f.prefix)
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// splitRoot splits rpath into the path of the directory containing
+// the first component which could be an archive and the rest
+func splitRoot(rpath string) (baseRoot, prefix string) {
+	parts := strings.Split(rpath, "/")
+	for i, part := range parts {
+		if formatOf(part) == formatNone {
+			continue
+		}
+		baseRoot = strings.Join(parts[:i], "/")
+		if baseRoot == "" && strings.HasPrefix(rpath, "/") {
+			baseRoot = "/"
+		}
+		return baseRoot, strings.Join(parts[i:], "/")
+	}
+	return rpath, ""
+}
+
+// parentDir returns the parent directory of remote or "" if it has
+// none
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." {
+		parent = ""
+	}
+	return parent
+}
+
+// join returns the path of remote in the base
+func (f *Fs) join(remote string) string {
+	if f.prefix == "" {
+		return remote
+	}
+	if remote == "" {
+		return f.prefix
+	}
+	return f.prefix + "/" + remote
+}
+
+// strip returns the path in f of baseRemote, the inverse of join
+func (f *Fs) strip(baseRemote string) string {
+	if f.prefix == "" {
+		return baseRemote
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(baseRemote, f.prefix), "/")
+}
+
+// locate finds the archive containing remote returning its index
+// and the path of remote inside it.
+//
+// It returns a nil index if remote isn't inside an archive. Only the
+// path components which look like archives are looked up on the base
+// so this is cheap for other paths.
+func (f *Fs) locate(ctx context.Context, remote string) (idx *index, inner string, err error) {
+	full := f.join(remote)
+	if full == "" {
+		return nil, "", nil
+	}
+	parts := strings.Split(full, "/")
+	for i, part := range parts {
+		if formatOf(part) == formatNone {
+			continue
+		}
+		o, err := f.base.NewObject(ctx, strings.Join(parts[:i+1], "/"))
+		if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) || errors.Is(err, fs.ErrorNotAFile) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		idx, err = f.index(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return idx, strings.Join(parts[i+1:], "/"), nil
+	}
+	return nil, "", nil
+}
+
+// index returns the index of the archive o, reading it if it isn't
+// cached or the archive has changed
+func (f *Fs) index(ctx context.Context, o fs.Object) (*index, error) {
+	key := o.Remote()
+	if value, ok := f.indexes.GetMaybe(key); ok {
+		idx := value.(*index)
+		if idx.o.Size() == o.Size() && idx.modTime.Equal(o.ModTime(ctx)) {
+			return idx, nil
+		}
+	}
+	idx, err := newIndex(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %q: %w", key, err)
+	}
+	f.indexes.Put(key, idx)
+	return idx, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("archive root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+//
+// CRC-32 is stored for files in zip archives.
+func (f *Fs) Hashes() hash.Set {
+	hashes := f.base.Hashes()
+	hashes.Add(hash.CRC32)
+	return hashes
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	idx, inner, err := f.locate(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if idx != nil {
+		return f.listArchive(idx, dir, inner)
+	}
+	baseEntries, err := f.base.List(ctx, f.join(dir))
+	if err != nil {
+		return nil, err
+	}
+	entries = make(fs.DirEntries, 0, len(baseEntries))
+	for _, entry := range baseEntries {
+		remote := f.strip(entry.Remote())
+		switch x := entry.(type) {
+		case fs.Object:
+			if formatOf(path.Base(remote)) != formatNone {
+				// Show the archive as a directory
+				entries = append(entries, fs.NewDir(remote, x.ModTime(ctx)))
+			} else {
+				entries = append(entries, f.newObject(x, remote))
+			}
+		case fs.Directory:
+			if f.prefix != "" {
+				x = fs.NewDirCopy(ctx, x).SetRemote(remote)
+			}
+			entries = append(entries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// listArchive lists the directory inner of the archive idx which is
+// at dir in f
+func (f *Fs) listArchive(idx *index, dir, inner string) (entries fs.DirEntries, err error) {
+	e := idx.find(inner)
+	if e == nil || !e.dir {
+		return nil, fs.ErrorDirNotFound
+	}
+	children := idx.children[inner]
+	entries = make(fs.DirEntries, 0, len(children))
+	for _, child := range children {
+		remote := path.Join(dir, path.Base(child.name))
+		if child.dir {
+			entries = append(entries, fs.NewDir(remote, child.modTime))
+		} else {
+			entries = append(entries, &Member{f: f, remote: remote, idx: idx, e: child})
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	idx, inner, err := f.locate(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	if idx != nil {
+		e := idx.find(inner)
+		if e == nil {
+			return nil, fs.ErrorObjectNotFound
+		}
+		if e.dir {
+			return nil, fs.ErrorIsDir
+		}
+		return &Member{f: f, remote: remote, idx: idx, e: e}, nil
+	}
+	o, err := f.base.NewObject(ctx, f.join(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// checkWritable returns errReadOnly if remote is inside an archive
+func (f *Fs) checkWritable(ctx context.Context, remote string) error {
+	idx, _, err := f.locate(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if idx != nil {
+		return errReadOnly
+	}
+	return nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	remote := src.Remote()
+	if err := f.checkWritable(ctx, remote); err != nil {
+		return nil, err
+	}
+	o, err := f.base.Put(ctx, in, fs.NewOverrideRemote(src, f.join(remote)), options...)
+	if o == nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), err
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.base.Features().PutStream
+	if do == nil {
+		return nil, errors.New("can't PutStream: not supported by underlying remote")
+	}
+	remote := src.Remote()
+	if err := f.checkWritable(ctx, remote); err != nil {
+		return nil, err
+	}
+	o, err := do(ctx, in, fs.NewOverrideRemote(src, f.join(remote)), options...)
+	if o == nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), err
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Directories which already exist in archives are allowed.
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	idx, inner, err := f.locate(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if idx != nil {
+		if e := idx.find(inner); e != nil && e.dir {
+			return nil
+		}
+		return errReadOnly
+	}
+	return f.base.Mkdir(ctx, f.join(dir))
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if err := f.checkWritable(ctx, dir); err != nil {
+		return err
+	}
+	return f.base.Rmdir(ctx, f.join(dir))
+}
+
+// Purge all files in the directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.base.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	if err := f.checkWritable(ctx, dir); err != nil {
+		return err
+	}
+	return do(ctx, f.join(dir))
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.base.Features().Copy
+	srcObj, ok := src.(*Object)
+	if do == nil || !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.checkWritable(ctx, remote); err != nil {
+		return nil, err
+	}
+	o, err := do(ctx, srcObj.Object, f.join(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.base.Features().Move
+	srcObj, ok := src.(*Object)
+	if do == nil || !ok {
+		return nil, fs.ErrorCantMove
+	}
+	if err := f.checkWritable(ctx, remote); err != nil {
+		return nil, err
+	}
+	o, err := do(ctx, srcObj.Object, f.join(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.base.Features().DirMove
+	srcFs, ok := src.(*Fs)
+	if do == nil || !ok {
+		return fs.ErrorCantDirMove
+	}
+	idx, _, err := srcFs.locate(ctx, srcRemote)
+	if err != nil {
+		return err
+	}
+	if idx != nil {
+		return fs.ErrorCantDirMove
+	}
+	if err := f.checkWritable(ctx, dstRemote); err != nil {
+		return err
+	}
+	return do(ctx, srcFs.base, srcFs.join(srcRemote), f.join(dstRemote))
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	f.indexes.Clear()
+	if do := f.base.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	f.indexes.Clear()
+	if do := f.base.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
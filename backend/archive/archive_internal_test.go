@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testModTime = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+// testFiles are the files put in the test archives - big is bigger
+// than a chunk so it is skipped by seeking in tar archives
+var testFiles = map[string]string{
+	"hello.txt":       "hello world",
+	"dir/big.bin":     random.String(3 * initialChunkSize / 2),
+	"dir/sub/end.txt": "the end",
+}
+
+// sortedNames returns the names of the testFiles in order
+func sortedNames() []string {
+	var names []string
+	for name := range testFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func makeZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, name := range sortedNames() {
+		method := zip.Deflate
+		if i%2 == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: testModTime})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, testFiles[name])
+		require.NoError(t, err)
+	}
+	_, err := zw.Create("empty/")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func makeTar(t *testing.T, gzipped bool) []byte {
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "empty/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: testModTime}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "hello.txt", ModTime: testModTime}))
+	for _, name := range sortedNames() {
+		data := testFiles[name]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: testModTime}))
+		_, err := io.WriteString(tw, data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	if gz != nil {
+		require.NoError(t, gz.Close())
+	}
+	return buf.Bytes()
+}
+
+func readObject(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) string {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func listNames(ctx context.Context, t *testing.T, f fs.Fs, dir string) []string {
+	entries, err := f.List(ctx, dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		name := entry.Remote()
+		if _, ok := entry.(fs.Directory); ok {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check the files in an archive can be listed and read
+func (f *Fs) testArchive(t *testing.T, name string, data []byte) {
+	ctx := context.Background()
+	remote := "archives/" + name
+	item := fstest.Item{Path: remote, ModTime: testModTime}
+	_ = fstests.PutTestContents(ctx, t, f, &item, string(data), false)
+	defer func() {
+		// Remove the archive from the base as it is read only here
+		o, err := f.base.NewObject(ctx, remote)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+		require.NoError(t, f.base.Rmdir(ctx, "archives"))
+	}()
+
+	// The archive is shown as a directory
+	assert.Equal(t, []string{remote + "/"}, listNames(ctx, t, f, "archives"))
+	_, err := f.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorIsDir, err)
+	assert.Equal(t, []string{remote + "/dir/", remote + "/empty/", remote + "/hello.txt"}, listNames(ctx, t, f, remote))
+	assert.Equal(t, []string{remote + "/dir/big.bin", remote + "/dir/sub/"}, listNames(ctx, t, f, remote+"/dir"))
+	_, err = f.List(ctx, remote+"/potato")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	for _, file := range sortedNames() {
+		want := testFiles[file]
+		o, err := f.NewObject(ctx, remote+"/"+file)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(want)), o.Size())
+		assert.True(t, testModTime.Equal(o.ModTime(ctx)), o.ModTime(ctx))
+		assert.Equal(t, want, readObject(ctx, t, o))
+		assert.Equal(t, want[2:5], readObject(ctx, t, o, &fs.RangeOption{Start: 2, End: 4}))
+		assert.Equal(t, want[len(want)-3:], readObject(ctx, t, o, &fs.SeekOption{Offset: int64(len(want) - 3)}))
+		crc, err := o.Hash(ctx, hash.CRC32)
+		require.NoError(t, err)
+		if formatOf(name) == formatZip {
+			assert.Equal(t, fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(want))), crc)
+		} else {
+			assert.Equal(t, "", crc)
+		}
+	}
+	_, err = f.NewObject(ctx, remote+"/link")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// The archive can't be changed
+	o, err := f.NewObject(ctx, remote+"/hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, errReadOnly, o.Remove(ctx))
+	assert.Equal(t, errReadOnly, o.SetModTime(ctx, time.Now()))
+	src := object.NewStaticObjectInfo(remote+"/new.txt", testModTime, 3, true, nil, nil)
+	_, err = f.Put(ctx, bytes.NewBufferString("new"), src)
+	assert.Equal(t, errReadOnly, err)
+	assert.NoError(t, f.Mkdir(ctx, remote+"/dir"))
+	assert.Equal(t, errReadOnly, f.Mkdir(ctx, remote+"/newdir"))
+	assert.Equal(t, errReadOnly, f.Rmdir(ctx, remote+"/empty"))
+
+	// The root can be in the archive
+	rootFs, err := fs.NewFs(ctx, fmt.Sprintf("%s:%s", f.name, path.Join(f.root, remote, "dir")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big.bin", "sub/"}, listNames(ctx, t, rootFs, ""))
+	fileFs, err := fs.NewFs(ctx, fmt.Sprintf("%s:%s", f.name, path.Join(f.root, remote, "dir/sub/end.txt")))
+	require.Equal(t, fs.ErrorIsFile, err)
+	o, err = fileFs.NewObject(ctx, "end.txt")
+	require.NoError(t, err)
+	assert.Equal(t, testFiles["dir/sub/end.txt"], readObject(ctx, t, o))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Zip", func(t *testing.T) {
+		f.testArchive(t, "test.zip", makeZip(t))
+	})
+	t.Run("Tar", func(t *testing.T) {
+		f.testArchive(t, "test.tar", makeTar(t, false))
+	})
+	t.Run("TarGz", func(t *testing.T) {
+		f.testArchive(t, "test.tar.gz", makeTar(t, true))
+	})
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
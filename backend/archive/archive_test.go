@@ -0,0 +1,61 @@
+// Test Archive filesystem interface
+package archive
+
+import (
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestArchive:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"ListR",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"ID",
+		"GetTier",
+		"SetTier",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests archive wrapping the local filesystem
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestArchiveLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "archive"},
+		{Name: name, Key: "remote", Value: t.TempDir()},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
@@ -0,0 +1,442 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/chunkedreader"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+const (
+	initialChunkSize = 262144  // Initial and max sizes of chunks when reading parts of the archive. Currently
+	maxChunkSize     = 8388608 // at 256 KiB and 8 MiB.
+	chunkStreams     = 0       // Streams to use for reading
+)
+
+// format is the type of an archive
+type format int
+
+// Archive formats
+const (
+	formatNone format = iota
+	formatZip
+	formatTar
+	formatTarGz
+)
+
+// formatOf returns the format of the archive from its file name or
+// formatNone if it isn't an archive
+func formatOf(name string) format {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return formatZip
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz
+	}
+	return formatNone
+}
+
+// entry is a file or directory in an archive
+type entry struct {
+	name    string    // path in the archive, "" for the root
+	dir     bool      // set if this is a directory
+	size    int64     // size of the file
+	modTime time.Time // modification time
+	offset  int64     // offset of the data in a tar archive or in the decompressed tar.gz
+	crc     uint32    // CRC-32 of the data if hasCRC is set
+	hasCRC  bool      // set if the crc is known
+	zf      *zip.File // the file in zip archives
+}
+
+// index is the list of the files in an archive
+type index struct {
+	format   format
+	o        fs.Object           // the archive
+	modTime  time.Time           // modification time of the archive when it was read
+	entries  map[string]*entry   // the files and directories by path
+	children map[string][]*entry // the contents of each directory by path
+}
+
+// newIndex reads the list of files in the archive o
+func newIndex(ctx context.Context, o fs.Object) (*index, error) {
+	idx := &index{
+		format:  formatOf(o.Remote()),
+		o:       o,
+		modTime: o.ModTime(ctx),
+		entries: make(map[string]*entry),
+	}
+	var err error
+	switch idx.format {
+	case formatZip:
+		err = idx.readZip(ctx)
+	case formatTar, formatTarGz:
+		err = idx.readTar(ctx)
+	default:
+		err = errors.New("unknown archive format")
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx.link()
+	fs.Debugf(o, "Read archive with %d entries", len(idx.entries))
+	return idx, nil
+}
+
+// cleanName returns the path of name in the archive or false if it
+// is unusable
+func cleanName(name string) (string, bool) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// add adds e to the index, replacing any existing entry of the same
+// name as later entries in tar archives update earlier ones
+func (idx *index) add(e *entry) {
+	name, ok := cleanName(e.name)
+	if !ok {
+		return
+	}
+	e.name = name
+	idx.entries[name] = e
+}
+
+// link makes the directories which are only implied by the paths of
+// the entries and fills in the children
+func (idx *index) link() {
+	idx.entries[""] = &entry{dir: true, modTime: idx.modTime}
+	for name := range idx.entries {
+		for dir := parentDir(name); ; dir = parentDir(dir) {
+			parent, ok := idx.entries[dir]
+			if ok && parent.dir {
+				break
+			}
+			if ok {
+				fs.Debugf(idx.o, "Ignoring file %q as it is used as a directory", dir)
+			}
+			idx.entries[dir] = &entry{name: dir, dir: true, modTime: idx.modTime}
+		}
+	}
+	idx.children = make(map[string][]*entry)
+	for name, e := range idx.entries {
+		if name == "" {
+			continue
+		}
+		dir := parentDir(name)
+		idx.children[dir] = append(idx.children[dir], e)
+	}
+}
+
+// find returns the entry at name or nil if not found
+func (idx *index) find(name string) *entry {
+	if idx == nil {
+		return nil
+	}
+	return idx.entries[name]
+}
+
+// readZip reads the directory of a zip archive
+func (idx *index) readZip(ctx context.Context) error {
+	// The reader is kept for finding where the data starts when
+	// the files are opened so it mustn't be cancelled
+	ra := &readerAt{
+		ctx: context.WithoutCancel(ctx),
+		o:   idx.o,
+		cr:  chunkedreader.New(ctx, idx.o, initialChunkSize, maxChunkSize, chunkStreams),
+	}
+	defer ra.stopStreaming()
+	zr, err := zip.NewReader(ra, idx.o.Size())
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		fi := zf.FileInfo()
+		idx.add(&entry{
+			name:    zf.Name,
+			dir:     fi.IsDir(),
+			size:    int64(zf.UncompressedSize64),
+			modTime: zf.Modified,
+			crc:     zf.CRC32,
+			hasCRC:  !fi.IsDir(),
+			zf:      zf,
+		})
+	}
+	return nil
+}
+
+// readTar reads the headers of a tar or tar.gz archive
+//
+// Tar archives have no directory so the whole archive is scanned,
+// seeking over the file data if the archive isn't compressed.
+func (idx *index) readTar(ctx context.Context) (err error) {
+	cr := chunkedreader.New(ctx, idx.o, initialChunkSize, maxChunkSize, chunkStreams)
+	defer fs.CheckClose(cr, &err)
+	var (
+		pr = &positionReader{in: cr}
+		tr *tar.Reader
+	)
+	if idx.format == formatTarGz {
+		gz, err := gzip.NewReader(cr)
+		if err != nil {
+			return err
+		}
+		pr.in = gz
+		tr = tar.NewReader(pr)
+	} else {
+		tr = tar.NewReader(&seekingReader{positionReader: pr, ctx: ctx, cr: cr})
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fi := hdr.FileInfo()
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			fs.Debugf(idx.o, "Ignoring %q as it isn't a file or directory", hdr.Name)
+			continue
+		}
+		idx.add(&entry{
+			name:    hdr.Name,
+			dir:     fi.IsDir(),
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+			offset:  pr.pos,
+		})
+	}
+}
+
+// open returns a stream of limit bytes from offset of the file e
+func (idx *index) open(ctx context.Context, e *entry, offset, limit int64) (io.ReadCloser, error) {
+	if limit <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	switch idx.format {
+	case formatZip:
+		return idx.openZip(ctx, e, offset, limit)
+	case formatTar:
+		return idx.openRange(ctx, e.offset+offset, limit)
+	case formatTarGz:
+		rc, err := idx.openRange(ctx, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := readers.NewGzipReader(rc)
+		if err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+		return skip(gz, e.offset+offset, limit)
+	}
+	return nil, errors.New("unknown archive format")
+}
+
+// openRange returns a stream of limit bytes from offset of the
+// archive or to the end if limit is -1
+func (idx *index) openRange(ctx context.Context, offset, limit int64) (io.ReadCloser, error) {
+	cr := chunkedreader.New(ctx, idx.o, initialChunkSize, maxChunkSize, chunkStreams)
+	if offset > 0 {
+		if _, err := cr.RangeSeek(ctx, offset, io.SeekStart, -1); err != nil {
+			_ = cr.Close()
+			return nil, err
+		}
+	}
+	return readers.NewLimitedReadCloser(cr, limit), nil
+}
+
+// openZip returns a stream of limit bytes from offset of the file e
+// in a zip archive
+func (idx *index) openZip(ctx context.Context, e *entry, offset, limit int64) (io.ReadCloser, error) {
+	if e.zf.Flags&0x1 != 0 {
+		return nil, errors.New("encrypted files aren't supported")
+	}
+	start, err := e.zf.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	whole := offset == 0 && limit == e.size
+	var rc io.ReadCloser
+	switch e.zf.Method {
+	case zip.Store:
+		if !whole {
+			return idx.openRange(ctx, start+offset, limit)
+		}
+		rc, err = idx.openRange(ctx, start, e.size)
+	case zip.Deflate:
+		rc, err = idx.openRange(ctx, start, int64(e.zf.CompressedSize64))
+		if err != nil {
+			return nil, err
+		}
+		rc = &decompressor{ReadCloser: flate.NewReader(rc), in: rc}
+		if !whole {
+			return skip(rc, offset, limit)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d", e.zf.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Check the CRC-32 if the whole file is read
+	return &crcChecker{ReadCloser: rc, want: e.crc, hash: crc32.NewIEEE()}, nil
+}
+
+// skip discards offset bytes of rc then returns a stream of the next
+// limit bytes
+func skip(rc io.ReadCloser, offset, limit int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return readers.NewLimitedReadCloser(rc, limit), nil
+}
+
+// decompressor closes the compressed stream as well as the
+// decompressor when it is closed
+type decompressor struct {
+	io.ReadCloser
+	in io.Closer
+}
+
+// Close the decompressor and the stream it reads from
+func (d *decompressor) Close() error {
+	err := d.ReadCloser.Close()
+	if inErr := d.in.Close(); inErr != nil {
+		return inErr
+	}
+	return err
+}
+
+// crcChecker checks the CRC-32 of the stream when it has been read
+type crcChecker struct {
+	io.ReadCloser
+	want uint32
+	hash interface {
+		io.Writer
+		Sum32() uint32
+	}
+}
+
+// Read the stream, returning an error at the end if the CRC-32 is wrong
+func (c *crcChecker) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	_, _ = c.hash.Write(p[:n])
+	if err == io.EOF && c.hash.Sum32() != c.want {
+		return n, fmt.Errorf("corrupted file: CRC-32 is %08x but should be %08x", c.hash.Sum32(), c.want)
+	}
+	return n, err
+}
+
+// readerAt reads the archive at any offset
+//
+// Reading the directory of a zip archive is mostly sequential so
+// while the archive is being read the reads come from a chunked
+// reader. Afterwards each read is a separate ranged read.
+type readerAt struct {
+	ctx context.Context
+	o   fs.Object
+	mu  sync.Mutex
+	cr  chunkedreader.ChunkedReader // the stream, nil if not streaming
+	pos int64                       // position of cr
+}
+
+// ReadAt reads len(p) bytes from off
+func (r *readerAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cr != nil {
+		if off != r.pos {
+			if _, err = r.cr.RangeSeek(r.ctx, off, io.SeekStart, -1); err != nil {
+				return 0, err
+			}
+			r.pos = off
+		}
+		n, err = io.ReadFull(r.cr, p)
+		r.pos += int64(n)
+	} else {
+		var rc io.ReadCloser
+		rc, err = r.o.Open(r.ctx, &fs.RangeOption{Start: off, End: off + int64(len(p)) - 1})
+		if err != nil {
+			return 0, err
+		}
+		n, err = io.ReadFull(rc, p)
+		_ = rc.Close()
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// stopStreaming closes the stream so future reads are ranged reads
+func (r *readerAt) stopStreaming() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cr != nil {
+		_ = r.cr.Close()
+		r.cr = nil
+	}
+}
+
+// positionReader counts the bytes read from a stream
+type positionReader struct {
+	in  io.Reader
+	pos int64
+}
+
+// Read from the stream counting the bytes
+func (r *positionReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// seekingReader is a positionReader which the tar reader can seek
+// to skip over the file data
+type seekingReader struct {
+	*positionReader
+	ctx context.Context
+	cr  chunkedreader.ChunkedReader
+}
+
+// Seek relative to the current position
+//
+// Short skips are read as they are likely in the current chunk.
+func (r *seekingReader) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent || offset < 0 {
+		return r.pos, errors.New("archive: can only seek forwards")
+	}
+	if offset < initialChunkSize {
+		n, err := io.CopyN(io.Discard, r.cr, offset)
+		r.pos += n
+		return r.pos, err
+	}
+	if _, err := r.cr.RangeSeek(r.ctx, r.pos+offset, io.SeekStart, -1); err != nil {
+		return r.pos, err
+	}
+	r.pos += offset
+	return r.pos, nil
+}
@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Object is a file on the base which isn't an archive
+type Object struct {
+	fs.Object
+	f      *Fs
+	remote string
+}
+
+// newObject wraps o which is at remote in f
+func (f *Fs) newObject(o fs.Object, remote string) *Object {
+	return &Object{Object: o, f: f, remote: remote}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if !o.f.base.Hashes().Contains(ht) {
+		return "", nil
+	}
+	return o.Object.Hash(ctx, ht)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.Object.Update(ctx, in, fs.NewOverrideRemote(src, o.Object.Remote()), options...)
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Member is a file inside an archive
+type Member struct {
+	f      *Fs
+	remote string // path of the file in f
+	idx    *index // the archive the file is in
+	e      *entry // the file in the archive
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Member) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Member) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Member) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Member) Size() int64 {
+	return o.e.size
+}
+
+// ModTime returns the modification time of the file as stored in
+// the archive
+func (o *Member) ModTime(ctx context.Context) time.Time {
+	return o.e.modTime
+}
+
+// Storable returns whether the object is storable
+func (o *Member) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Member) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.CRC32 || !o.e.hasCRC {
+		return "", nil
+	}
+	return fmt.Sprintf("%08x", o.e.crc), nil
+}
+
+// SetModTime sets the modification time of the file
+func (o *Member) SetModTime(ctx context.Context, t time.Time) error {
+	return errReadOnly
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Member) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errReadOnly
+}
+
+// Remove an object
+func (o *Member) Remove(ctx context.Context) error {
+	return errReadOnly
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// Only the part of the archive holding the file is read, apart from
+// tar.gz archives which have to be decompressed from the start.
+func (o *Member) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.e.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > o.e.size {
+		offset = o.e.size
+	}
+	if limit < 0 || offset+limit > o.e.size {
+		limit = o.e.size - offset
+	}
+	return o.idx.open(ctx, o.e, offset, limit)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+	_ fs.Object          = (*Member)(nil)
+)
@@ -2040,6 +2040,13 @@ type azBlock struct {
 	id          string
 }
 
+// makeBlockID makes the block ID for chunkNumber
+func makeBlockID(chunkNumber uint64) string {
+	var binaryBlockID [8]byte // block counter as LSB first 8 bytes
+	binary.LittleEndian.PutUint64(binaryBlockID[:], chunkNumber)
+	return base64.StdEncoding.EncodeToString(binaryBlockID[:])
+}
+
 // Implements the fs.ChunkWriter interface
 type azChunkWriter struct {
 	chunkSize int64
@@ -2111,10 +2118,98 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		Concurrency: o.fs.opt.UploadConcurrency,
 		//LeavePartsOnError: o.fs.opt.LeavePartsOnError,
 	}
+
+	// Carry on with a previous upload if asked to
+	for _, option := range options {
+		if resume, ok := option.(*fs.ResumeChunkWriterOption); ok {
+			resumedChunks, err := chunkWriter.resume(ctx, resume.State)
+			if err != nil {
+				fs.Logf(o, "Not resuming multipart upload: %v", err)
+				continue
+			}
+			info.ChunkSize = chunkWriter.chunkSize
+			info.ResumedChunks = resumedChunks
+			return info, chunkWriter, nil
+		}
+	}
+
 	fs.Debugf(o, "open chunk writer: started multipart upload")
 	return info, chunkWriter, nil
 }
 
+// azChunkWriterState is the state of a multipart upload returned by
+// ChunkWriterState so it can be resumed
+type azChunkWriterState struct {
+	ChunkSize int64
+	Size      int64
+	Chunks    []uint64 // chunk numbers of the blocks staged
+}
+
+// ChunkWriterState returns the state of the upload so it can be
+// resumed with fs.ResumeChunkWriterOption
+func (w *azChunkWriter) ChunkWriterState() (string, error) {
+	state := azChunkWriterState{
+		ChunkSize: w.chunkSize,
+		Size:      w.size,
+	}
+	w.blocksMu.Lock()
+	for _, block := range w.blocks {
+		state.Chunks = append(state.Chunks, block.chunkNumber)
+	}
+	w.blocksMu.Unlock()
+	data, err := json.Marshal(&state)
+	return string(data), err
+}
+
+// resume the multipart upload described by state
+//
+// As blocks are staged on the blob itself there is no upload ID, so
+// this checks the blocks in state are still uncommitted on the blob
+// and returns the chunk numbers of those which are.
+func (w *azChunkWriter) resume(ctx context.Context, state string) (resumedChunks []int, err error) {
+	var s azChunkWriterState
+	err = json.Unmarshal([]byte(state), &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if s.ChunkSize <= 0 {
+		return nil, errors.New("invalid state")
+	}
+	if w.size < 0 || s.Size != w.size {
+		return nil, fmt.Errorf("size changed from %d to %d", s.Size, w.size)
+	}
+	var resp blockblob.GetBlockListResponse
+	err = w.f.pacer.Call(func() (bool, error) {
+		resp, err = w.ui.blb.GetBlockList(ctx, blockblob.BlockListTypeUncommitted, nil)
+		return w.f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uncommitted blocks: %w", err)
+	}
+	staged := make(map[string]int64, len(resp.UncommittedBlocks))
+	for _, block := range resp.UncommittedBlocks {
+		if block.Name != nil && block.Size != nil {
+			staged[*block.Name] = *block.Size
+		}
+	}
+	for _, chunkNumber := range s.Chunks {
+		blockID := makeBlockID(chunkNumber)
+		wantSize := min(s.ChunkSize, s.Size-int64(chunkNumber)*s.ChunkSize)
+		if size, ok := staged[blockID]; !ok || size != wantSize {
+			fs.Debugf(w.o, "multipart upload: uploading chunk %d again as it is missing or changed", chunkNumber+1)
+			continue
+		}
+		w.blocks = append(w.blocks, azBlock{
+			chunkNumber: chunkNumber,
+			id:          blockID,
+		})
+		resumedChunks = append(resumedChunks, int(chunkNumber))
+	}
+	w.chunkSize = s.ChunkSize
+	fs.Debugf(w.o, "Resuming multipart upload with %d blocks already staged", len(resumedChunks))
+	return resumedChunks, nil
+}
+
 // WriteChunk will write chunk number with reader bytes, where chunk number >= 0
 func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
 	if chunkNumber < 0 {
@@ -2135,9 +2230,7 @@ func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader
 	md5sum := m.Sum(nil)
 
 	// increment the blockID and save the blocks for finalize
-	var binaryBlockID [8]byte // block counter as LSB first 8 bytes
-	binary.LittleEndian.PutUint64(binaryBlockID[:], uint64(chunkNumber))
-	blockID := base64.StdEncoding.EncodeToString(binaryBlockID[:])
+	blockID := makeBlockID(uint64(chunkNumber))
 
 	// Save the blockID for the commit
 	w.blocksMu.Lock()
@@ -2502,4 +2595,6 @@ var (
 	_ fs.MimeTyper       = &Object{}
 	_ fs.GetTierer       = &Object{}
 	_ fs.SetTierer       = &Object{}
+
+	_ fs.ChunkWriterResumer = &azChunkWriter{}
 )
@@ -2185,8 +2185,28 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		Concurrency: o.fs.opt.UploadConcurrency,
 		//LeavePartsOnError: o.fs.opt.LeavePartsOnError,
 	}
+
+	// Carry on with a previous upload if asked to
+	for _, option := range options {
+		if resume, ok := option.(*fs.ResumeChunkWriterOption); ok {
+			up, resumedChunks, err := f.resumeLargeUpload(ctx, o, src, resume.State)
+			if err == nil {
+				info.ChunkSize = up.chunkSize
+				info.ResumedChunks = resumedChunks
+				return info, up, nil
+			}
+			fs.Logf(o, "Not resuming large file upload: %v", err)
+		}
+	}
+
 	up, err := f.newLargeUpload(ctx, o, nil, src, f.opt.ChunkSize, false, nil, options...)
-	return info, up, err
+	if err != nil {
+		return info, nil, err
+	}
+	// Use the chunk size of the upload as that is what is saved
+	// if the upload is resumed
+	info.ChunkSize = up.chunkSize
+	return info, up, nil
 }
 
 // Remove an object
@@ -2411,4 +2431,6 @@ var (
 	_ fs.Object          = &Object{}
 	_ fs.MimeTyper       = &Object{}
 	_ fs.IDer            = &Object{}
+
+	_ fs.ChunkWriterResumer = &largeUpload{}
 )
@@ -8,6 +8,8 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	gohash "hash"
 	"io"
@@ -179,6 +181,116 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 	return up, nil
 }
 
+// largeUploadState is the state of a large upload returned by
+// ChunkWriterState so it can be resumed
+type largeUploadState struct {
+	ID        string
+	ChunkSize int64
+	Size      int64
+	SHA1s     []string
+}
+
+// ChunkWriterState returns the state of the upload so it can be
+// resumed with fs.ResumeChunkWriterOption
+func (up *largeUpload) ChunkWriterState() (string, error) {
+	up.sha1smu.Lock()
+	state := largeUploadState{
+		ID:        up.id,
+		ChunkSize: up.chunkSize,
+		Size:      up.size,
+		SHA1s:     append([]string(nil), up.sha1s...),
+	}
+	up.sha1smu.Unlock()
+	data, err := json.Marshal(&state)
+	return string(data), err
+}
+
+// resumeLargeUpload carries on with the upload of object o described
+// by state
+//
+// This checks the parts in state are still in the upload and returns
+// the chunk numbers of those which are.
+func (f *Fs) resumeLargeUpload(ctx context.Context, o *Object, src fs.ObjectInfo, state string) (up *largeUpload, resumedChunks []int, err error) {
+	var s largeUploadState
+	err = json.Unmarshal([]byte(state), &s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if s.ID == "" || s.ChunkSize <= 0 {
+		return nil, nil, errors.New("invalid state")
+	}
+	size := src.Size()
+	if size < 0 || s.Size != size {
+		return nil, nil, fmt.Errorf("size changed from %d to %d", s.Size, size)
+	}
+	uploaded, err := f.listParts(ctx, s.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := int(size / s.ChunkSize)
+	if size%s.ChunkSize != 0 {
+		parts++
+	}
+	up = &largeUpload{
+		f:         f,
+		o:         o,
+		what:      "upload",
+		id:        s.ID,
+		size:      size,
+		parts:     parts,
+		sha1s:     make([]string, 0, 16),
+		chunkSize: s.ChunkSize,
+	}
+	up.in, up.wrap = accounting.UnWrap(nil)
+	for chunkNumber, sha1 := range s.SHA1s {
+		if sha1 == "" {
+			continue
+		}
+		wantSize := min(s.ChunkSize, size-int64(chunkNumber)*s.ChunkSize)
+		got, ok := uploaded[int64(chunkNumber+1)]
+		if !ok || got.SHA1 != sha1 || got.Size != wantSize {
+			fs.Debugf(o, "Uploading chunk %d of large file again as it is missing or changed", chunkNumber)
+			continue
+		}
+		up.addSha1(chunkNumber, sha1)
+		resumedChunks = append(resumedChunks, chunkNumber)
+	}
+	fs.Debugf(o, "Resuming large file upload %q with %d parts already uploaded", s.ID, len(resumedChunks))
+	return up, resumedChunks, nil
+}
+
+// listParts returns the parts uploaded so far to the large file id
+// indexed by part number
+func (f *Fs) listParts(ctx context.Context, id string) (parts map[int64]api.UploadPartResponse, err error) {
+	opts := rest.Opts{
+		Method: "POST",
+		Path:   "/b2_list_parts",
+	}
+	var request = api.ListPartsRequest{
+		ID:           id,
+		MaxPartCount: 1000,
+	}
+	parts = make(map[int64]api.UploadPartResponse)
+	for {
+		var response api.ListPartsResponse
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err := f.srv.CallJSON(ctx, &opts, &request, &response)
+			return f.shouldRetry(ctx, resp, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts of large file %q: %w", id, err)
+		}
+		for _, part := range response.Parts {
+			parts[part.PartNumber] = part
+		}
+		if response.NextPartNumber == nil {
+			break
+		}
+		request.StartPartNumber = *response.NextPartNumber
+	}
+	return parts, nil
+}
+
 // getUploadURL returns the upload info with the UploadURL and the AuthorizationToken
 //
 // This should be returned with returnUploadURL when finished
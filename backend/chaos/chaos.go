@@ -0,0 +1,634 @@
+// Package chaos implements a backend which injects faults into
+// another remote for testing
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Operations which have their own error rates
+const (
+	opPut   = "put"
+	opOpen  = "open"
+	opList  = "list"
+	opMove  = "move"
+	opOther = "other"
+)
+
+// Types of error which can be injected
+const (
+	errorTypeRetry      = "retry"
+	errorTypeError      = "error"
+	errorTypeNoRetry    = "no_retry"
+	errorTypeNoLowLevel = "no_low_level_retry"
+	errorTypeFatal      = "fatal"
+)
+
+// errInjected is wrapped by all the errors this backend injects
+var errInjected = errors.New("chaos: injected error")
+
+// rateHelp makes the help for the error rate of an operation
+func rateHelp(what string) string {
+	return fmt.Sprintf(`Chance of an error when %s.
+
+This is a number between 0 and 1. Set to -1 to use error_rate.`, what)
+}
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "chaos",
+		Description: "Inject errors into a remote for testing",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to inject errors into.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "error_rate",
+			Help: `Chance of an error in each operation.
+
+This is a number between 0 and 1, so 0.1 makes one operation in ten
+fail. It is used for operations which don't have their own rate set.`,
+			Default: 0.0,
+		}, {
+			Name:     "put_error_rate",
+			Help:     rateHelp("uploading a file"),
+			Default:  -1.0,
+			Advanced: true,
+		}, {
+			Name:     "open_error_rate",
+			Help:     rateHelp("opening a file to read"),
+			Default:  -1.0,
+			Advanced: true,
+		}, {
+			Name:     "list_error_rate",
+			Help:     rateHelp("listing a directory"),
+			Default:  -1.0,
+			Advanced: true,
+		}, {
+			Name:     "move_error_rate",
+			Help:     rateHelp("moving a file or directory"),
+			Default:  -1.0,
+			Advanced: true,
+		}, {
+			Name:    "error_type",
+			Help:    "Type of error to inject.",
+			Default: errorTypeRetry,
+			Examples: []fs.OptionExample{{
+				Value: errorTypeRetry,
+				Help:  "An error rclone retries with --low-level-retries and --retries.",
+			}, {
+				Value: errorTypeError,
+				Help:  "An error rclone retries with --retries only.",
+			}, {
+				Value: errorTypeNoRetry,
+				Help:  "An error which stops rclone retrying with --retries.",
+			}, {
+				Value: errorTypeNoLowLevel,
+				Help:  "An error rclone doesn't retry with --low-level-retries.",
+			}, {
+				Value: errorTypeFatal,
+				Help:  "An error which stops rclone straight away.",
+			}},
+		}, {
+			Name:    "latency",
+			Help:    `Delay added to each operation.`,
+			Default: fs.Duration(0),
+		}, {
+			Name:     "jitter",
+			Help:     `Maximum random delay added to each operation on top of latency.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "truncate_rate",
+			Help: `Chance of a file being cut short when read.
+
+The read ends early at a random point without an error, as if the
+connection was closed, so rclone should notice the file is the wrong
+size.`,
+			Default: 0.0,
+		}, {
+			Name: "corrupt_rate",
+			Help: `Chance of a byte in a file being changed when read.
+
+One byte at a random point is changed without an error, so rclone
+should notice the file has the wrong hash.`,
+			Default: 0.0,
+		}, {
+			Name: "seed",
+			Help: `Seed for the random numbers.
+
+Set this to make the same faults happen in the same order each time
+rclone is run with the same operations. 0 uses a different seed each
+time.`,
+			Default:  int64(0),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote        string      `config:"remote"`
+	ErrorRate     float64     `config:"error_rate"`
+	PutErrorRate  float64     `config:"put_error_rate"`
+	OpenErrorRate float64     `config:"open_error_rate"`
+	ListErrorRate float64     `config:"list_error_rate"`
+	MoveErrorRate float64     `config:"move_error_rate"`
+	ErrorType     string      `config:"error_type"`
+	Latency       fs.Duration `config:"latency"`
+	Jitter        fs.Duration `config:"jitter"`
+	TruncateRate  float64     `config:"truncate_rate"`
+	CorruptRate   float64     `config:"corrupt_rate"`
+	Seed          int64       `config:"seed"`
+}
+
+// Fs represents a remote with faults injected
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on
+	opt      Options      // parsed options
+	base     fs.Fs        // the remote being wrapped
+	features *fs.Features // optional features
+	wrapper  fs.Fs        // the Fs wrapping this one, if any
+	rates    map[string]float64
+	mu       sync.Mutex // protects rnd
+	rnd      *rand.Rand
+}
+
+// checkRate returns an error if rate isn't a valid chance
+func checkRate(name string, rate float64, allowDefault bool) error {
+	if allowDefault && rate == -1 {
+		return nil
+	}
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("%s must be between 0 and 1 but is %v", name, rate)
+	}
+	return nil
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point chaos remote at itself - check the value of the remote setting")
+	}
+	rates := map[string]float64{
+		opPut:   opt.PutErrorRate,
+		opOpen:  opt.OpenErrorRate,
+		opList:  opt.ListErrorRate,
+		opMove:  opt.MoveErrorRate,
+		opOther: opt.ErrorRate,
+	}
+	for op, rate := range rates {
+		if err := checkRate(op+"_error_rate", rate, op != opOther); err != nil {
+			return nil, err
+		}
+		if rate == -1 {
+			rates[op] = opt.ErrorRate
+		}
+	}
+	if err := checkRate("truncate_rate", opt.TruncateRate, false); err != nil {
+		return nil, err
+	}
+	if err := checkRate("corrupt_rate", opt.CorruptRate, false); err != nil {
+		return nil, err
+	}
+	switch opt.ErrorType {
+	case errorTypeRetry, errorTypeError, errorTypeNoRetry, errorTypeNoLowLevel, errorTypeFatal:
+	default:
+		return nil, fmt.Errorf("unknown error_type %q", opt.ErrorType)
+	}
+	seed := opt.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, rpath))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name:  name,
+		root:  rpath,
+		opt:   *opt,
+		base:  base,
+		rates: rates,
+		rnd:   rand.New(rand.NewSource(seed)),
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:          true,
+		DuplicateFiles:           true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		CanHaveEmptyDirectories:  true,
+		BucketBased:              true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+		SlowModTime:              true,
+		SlowHash:                 true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	cache.PinUntilFinalized(base, f)
+
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(strings.Trim(rpath, "/"))
+		if f.root == "." {
+			f.root = ""
+		}
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("chaos root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// chance returns true with probability rate
+func (f *Fs) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rnd.Float64() < rate
+}
+
+// int63n returns a random number in [0,n)
+func (f *Fs) int63n(n int64) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rnd.Int63n(n)
+}
+
+// delay waits for the latency and jitter
+func (f *Fs) delay(ctx context.Context) error {
+	d := time.Duration(f.opt.Latency)
+	if f.opt.Jitter > 0 {
+		d += time.Duration(f.int63n(int64(f.opt.Jitter)))
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newError makes an injected error of the configured type for op
+func (f *Fs) newError(op string, what fmt.Stringer) error {
+	err := fmt.Errorf("%w in %s of %q", errInjected, op, what)
+	switch f.opt.ErrorType {
+	case errorTypeRetry:
+		err = fserrors.RetryError(err)
+	case errorTypeNoRetry:
+		err = fserrors.NoRetryError(err)
+	case errorTypeNoLowLevel:
+		err = fserrors.NoLowLevelRetryError(err)
+	case errorTypeFatal:
+		err = fserrors.FatalError(err)
+	}
+	return err
+}
+
+// stringer adapts a string to a fmt.Stringer
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+// inject delays then returns an error for op on what if one should
+// happen
+func (f *Fs) inject(ctx context.Context, op string, what fmt.Stringer) error {
+	if err := f.delay(ctx); err != nil {
+		return err
+	}
+	rate, ok := f.rates[op]
+	if !ok {
+		rate = f.rates[opOther]
+	}
+	if !f.chance(rate) {
+		return nil
+	}
+	err := f.newError(op, what)
+	fs.Debugf(what, "Injecting error: %v", err)
+	return err
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if err := f.inject(ctx, opList, stringer(dir)); err != nil {
+		return nil, err
+	}
+	baseEntries, err := f.base.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	entries = make(fs.DirEntries, 0, len(baseEntries))
+	for _, entry := range baseEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			entries = append(entries, f.newObject(x))
+		case fs.Directory:
+			entries = append(entries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote. If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if err := f.inject(ctx, "new object", stringer(remote)); err != nil {
+		return nil, err
+	}
+	o, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// wrap wraps the object returned by a put or copy
+func (f *Fs) wrap(o fs.Object, err error) (fs.Object, error) {
+	if o != nil {
+		o = f.newObject(o)
+	}
+	return o, err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if err := f.inject(ctx, opPut, stringer(src.Remote())); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Put(ctx, in, src, options...))
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if err := f.inject(ctx, opPut, stringer(src.Remote())); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Features().PutStream(ctx, in, src, options...))
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if err := f.inject(ctx, "mkdir", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Mkdir(ctx, dir)
+}
+
+// MkdirMetadata makes the directory passed in as dir.
+//
+// It shouldn't return an error if it already exists.
+//
+// If the metadata is not nil it is set.
+//
+// It returns the directory that was created.
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	if err := f.inject(ctx, "mkdir", stringer(dir)); err != nil {
+		return nil, err
+	}
+	return f.base.Features().MkdirMetadata(ctx, dir, metadata)
+}
+
+// DirSetModTime sets the directory modtime for dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	if err := f.inject(ctx, "set modification time", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Features().DirSetModTime(ctx, dir, modTime)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if err := f.inject(ctx, "rmdir", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory specified
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	if err := f.inject(ctx, "purge", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Features().Purge(ctx, dir)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.inject(ctx, "copy", stringer(remote)); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Features().Copy(ctx, srcObj.Object, remote))
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	if err := f.inject(ctx, opMove, stringer(remote)); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Features().Move(ctx, srcObj.Object, remote))
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		return fs.ErrorCantDirMove
+	}
+	if err := f.inject(ctx, opMove, stringer(dstRemote)); err != nil {
+		return err
+	}
+	return f.base.Features().DirMove(ctx, srcFs.base, srcRemote, dstRemote)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	if err := f.inject(ctx, "about", stringer("")); err != nil {
+		return nil, err
+	}
+	return f.base.Features().About(ctx)
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	if err := f.inject(ctx, "cleanup", stringer("")); err != nil {
+		return err
+	}
+	return f.base.Features().CleanUp(ctx)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.base.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if do := f.base.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
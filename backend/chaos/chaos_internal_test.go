@@ -0,0 +1,168 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFsWith makes a new Fs on the same remote as f with extra options
+func (f *Fs) newFsWith(ctx context.Context, t *testing.T, m configmap.Simple) *Fs {
+	m["remote"] = f.opt.Remote
+	// configmap.Simple doesn't supply the defaults
+	for _, key := range []string{"put_error_rate", "open_error_rate", "list_error_rate", "move_error_rate"} {
+		if _, found := m[key]; !found {
+			m[key] = "-1"
+		}
+	}
+	if _, found := m["error_type"]; !found {
+		m["error_type"] = errorTypeRetry
+	}
+	newFs, err := NewFs(ctx, f.name, f.root, m)
+	require.NoError(t, err)
+	return newFs.(*Fs)
+}
+
+func readAll(ctx context.Context, t *testing.T, o fs.Object) []byte {
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+// Check errors of the right type are injected in the right places
+func (f *Fs) testErrors(t *testing.T) {
+	ctx := context.Background()
+	item := fstest.Item{Path: "chaos/errors.txt", ModTime: fstest.Time("2001-02-03T04:05:06Z")}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "contents", true)
+
+	for _, test := range []struct {
+		errorType string
+		check     func(error) bool
+	}{
+		{errorTypeRetry, fserrors.IsRetryError},
+		{errorTypeNoRetry, fserrors.IsNoRetryError},
+		{errorTypeNoLowLevel, fserrors.IsNoLowLevelRetryError},
+		{errorTypeFatal, fserrors.IsFatalError},
+		{errorTypeError, func(err error) bool {
+			return !fserrors.ShouldRetry(err) && !fserrors.IsNoRetryError(err) && !fserrors.IsFatalError(err)
+		}},
+	} {
+		t.Run(test.errorType, func(t *testing.T) {
+			cf := f.newFsWith(ctx, t, configmap.Simple{
+				"list_error_rate": "1",
+				"error_type":      test.errorType,
+			})
+			_, err := cf.List(ctx, "chaos")
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, errInjected), err)
+			assert.True(t, test.check(err), err)
+
+			// Other operations use error_rate
+			o, err := cf.NewObject(ctx, item.Path)
+			require.NoError(t, err)
+			assert.Equal(t, "contents", string(readAll(ctx, t, o)))
+		})
+	}
+
+	// Per operation rates override error_rate
+	cf := f.newFsWith(ctx, t, configmap.Simple{
+		"error_rate":      "1",
+		"open_error_rate": "0",
+	})
+	_, err := cf.NewObject(ctx, item.Path)
+	assert.True(t, errors.Is(err, errInjected), err)
+	o, err := f.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	o = cf.newObject(o.(*Object).Object)
+	assert.Equal(t, "contents", string(readAll(ctx, t, o)))
+	assert.True(t, errors.Is(o.Remove(ctx), errInjected))
+
+	// Bad options
+	for _, m := range []configmap.Simple{
+		{"error_rate": "1.5", "error_type": errorTypeRetry},
+		{"put_error_rate": "-0.5", "error_type": errorTypeRetry},
+		{"error_type": "potato"},
+	} {
+		m["remote"] = f.opt.Remote
+		_, err := NewFs(ctx, f.name, f.root, m)
+		assert.Error(t, err, m)
+	}
+
+	require.NoError(t, o.(*Object).Object.Remove(ctx))
+}
+
+// Check reads are truncated and corrupted
+func (f *Fs) testReads(t *testing.T) {
+	ctx := context.Background()
+	contents := random.String(1000)
+	item := fstest.Item{Path: "chaos/reads.txt", ModTime: fstest.Time("2001-02-03T04:05:06Z")}
+	_ = fstests.PutTestContents(ctx, t, f, &item, contents, true)
+
+	cf := f.newFsWith(ctx, t, configmap.Simple{"truncate_rate": "1"})
+	o, err := cf.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	data := readAll(ctx, t, o)
+	assert.Less(t, len(data), len(contents))
+	assert.Equal(t, contents[:len(data)], string(data))
+
+	cf = f.newFsWith(ctx, t, configmap.Simple{"corrupt_rate": "1"})
+	o, err = cf.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	data = readAll(ctx, t, o)
+	require.Equal(t, len(contents), len(data))
+	diffs := 0
+	for i := range data {
+		if data[i] != contents[i] {
+			diffs++
+		}
+	}
+	assert.Equal(t, 1, diffs)
+
+	require.NoError(t, o.Remove(ctx))
+}
+
+// Check the seed makes faults repeatable and latency is added
+func (f *Fs) testSeedAndLatency(t *testing.T) {
+	ctx := context.Background()
+	run := func() (failed []bool) {
+		cf := f.newFsWith(ctx, t, configmap.Simple{"error_rate": "0.5", "seed": "42"})
+		for i := 0; i < 20; i++ {
+			_, err := cf.List(ctx, "")
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	first := run()
+	assert.Equal(t, first, run())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+
+	cf := f.newFsWith(ctx, t, configmap.Simple{"latency": "50ms"})
+	start := time.Now()
+	_, err := cf.List(ctx, "")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Errors", f.testErrors)
+	t.Run("Reads", f.testReads)
+	t.Run("SeedAndLatency", f.testSeedAndLatency)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,57 @@
+// Test Chaos filesystem interface
+package chaos
+
+import (
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestChaos:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"PublicLink",
+		"ListR",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"GetTier",
+		"SetTier",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests chaos wrapping the local filesystem with no faults
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestChaosLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "chaos"},
+		{Name: name, Key: "remote", Value: t.TempDir()},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
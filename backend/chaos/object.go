@@ -0,0 +1,194 @@
+package chaos
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Object is a file with faults injected
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+// newObject wraps o
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{Object: o, f: f}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// faultyReader reads from in, cutting the data short or changing a
+// byte if asked
+type faultyReader struct {
+	in        io.ReadCloser
+	pos       int64 // bytes read so far
+	truncate  int64 // position to end the data at or -1
+	corruptAt int64 // position of the byte to change or -1
+}
+
+// Read bytes into p
+func (r *faultyReader) Read(p []byte) (n int, err error) {
+	if r.truncate >= 0 {
+		if r.pos >= r.truncate {
+			return 0, io.EOF
+		}
+		if left := r.truncate - r.pos; int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+	n, err = r.in.Read(p)
+	if r.corruptAt >= r.pos && r.corruptAt < r.pos+int64(n) {
+		p[r.corruptAt-r.pos] ^= 0xFF
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close the reader
+func (r *faultyReader) Close() error {
+	return r.in.Close()
+}
+
+// Open opens the file for read. Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	f := o.f
+	if err := f.inject(ctx, opOpen, o); err != nil {
+		return nil, err
+	}
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	size := o.Size()
+	if size <= 0 {
+		return in, nil
+	}
+	r := &faultyReader{in: in, truncate: -1, corruptAt: -1}
+	if f.chance(f.opt.TruncateRate) {
+		r.truncate = f.int63n(size)
+		fs.Debugf(o, "Truncating read at %d bytes", r.truncate)
+	}
+	if f.chance(f.opt.CorruptRate) {
+		r.corruptAt = f.int63n(size)
+		fs.Debugf(o, "Corrupting read at byte %d", r.corruptAt)
+	}
+	if r.truncate < 0 && r.corruptAt < 0 {
+		return in, nil
+	}
+	return r, nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	if err := o.f.inject(ctx, opPut, o); err != nil {
+		return err
+	}
+	return o.Object.Update(ctx, in, src, options...)
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	if err := o.f.inject(ctx, "remove", o); err != nil {
+		return err
+	}
+	return o.Object.Remove(ctx)
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if err := o.f.inject(ctx, "set modification time", o); err != nil {
+		return err
+	}
+	return o.Object.SetModTime(ctx, modTime)
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	if do, ok := o.Object.(fs.IDer); ok {
+		return do.ID()
+	}
+	return ""
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *Object) GetTier() string {
+	if do, ok := o.Object.(fs.GetTierer); ok {
+		return do.GetTier()
+	}
+	return ""
+}
+
+// SetTier performs changing storage tier of the Object if
+// multiple storage classes supported
+func (o *Object) SetTier(tier string) error {
+	if do, ok := o.Object.(fs.SetTierer); ok {
+		return do.SetTier(tier)
+	}
+	return fs.ErrorNotImplemented
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	if err := o.f.inject(ctx, "set metadata", o); err != nil {
+		return err
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.IDer            = (*Object)(nil)
+	_ fs.GetTierer       = (*Object)(nil)
+	_ fs.SetTierer       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,302 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/buengese/sgzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// The zstd and lz4 modes compress the data in blocks of blockSize
+// bytes, each of which is written as an independent frame. The
+// concatenated frames are a valid zstd or lz4 stream so the data
+// files can be decompressed with the standard tools.
+//
+// The compressed size of each block is recorded in the object
+// metadata using the same layout as the sgzip metadata. This allows
+// reads starting at an arbitrary offset to start decompressing at the
+// block containing the offset rather than at the start of the file.
+const blockSize = 1024 * 1024
+
+// blockCodec compresses and decompresses single blocks
+type blockCodec interface {
+	// encodeBlock appends the compressed src to dst[:0]
+	encodeBlock(dst, src []byte) ([]byte, error)
+	// decodeBlock appends the decompressed src to dst[:0]
+	decodeBlock(dst, src []byte) ([]byte, error)
+	// close releases any resources held by the codec
+	close()
+}
+
+// zstdCodec compresses blocks as zstd frames
+type zstdCodec struct {
+	level zstd.EncoderLevel
+	enc   *zstd.Encoder // made on first use
+	dec   *zstd.Decoder // made on first use
+}
+
+// newZstdCodec makes a zstd codec with the compression level passed in.
+//
+// Levels are the same as the zstd command line tool and <= 0 means
+// the default level.
+func newZstdCodec(level int) (*zstdCodec, error) {
+	c := &zstdCodec{
+		level: zstd.SpeedDefault,
+	}
+	if level > 22 {
+		return nil, fmt.Errorf("zstd compression level must be at most 22, got %d", level)
+	}
+	if level > 0 {
+		c.level = zstd.EncoderLevelFromZstd(level)
+	}
+	return c, nil
+}
+
+func (c *zstdCodec) encodeBlock(dst, src []byte) (_ []byte, err error) {
+	if c.enc == nil {
+		c.enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(c.level), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make zstd encoder: %w", err)
+		}
+	}
+	return c.enc.EncodeAll(src, dst[:0]), nil
+}
+
+func (c *zstdCodec) decodeBlock(dst, src []byte) (_ []byte, err error) {
+	if c.dec == nil {
+		c.dec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make zstd decoder: %w", err)
+		}
+	}
+	return c.dec.DecodeAll(src, dst[:0])
+}
+
+func (c *zstdCodec) close() {
+	if c.enc != nil {
+		_ = c.enc.Close()
+	}
+	if c.dec != nil {
+		c.dec.Close()
+	}
+}
+
+// lz4Codec compresses blocks as lz4 frames
+type lz4Codec struct {
+	level lz4.CompressionLevel
+	w     *lz4.Writer
+	r     *lz4.Reader
+}
+
+// newLz4Codec makes an lz4 codec with the compression level passed in.
+//
+// Levels run from 1 to 9 and <= 0 means the fastest level.
+func newLz4Codec(level int) (*lz4Codec, error) {
+	c := &lz4Codec{
+		level: lz4.Fast,
+		w:     lz4.NewWriter(nil),
+		r:     lz4.NewReader(nil),
+	}
+	if level > 9 {
+		return nil, fmt.Errorf("lz4 compression level must be at most 9, got %d", level)
+	}
+	if level > 0 {
+		c.level = lz4.Level1 << (level - 1)
+	}
+	return c, nil
+}
+
+func (c *lz4Codec) encodeBlock(dst, src []byte) ([]byte, error) {
+	out := bytes.NewBuffer(dst[:0])
+	c.w.Reset(out)
+	err := c.w.Apply(lz4.CompressionLevelOption(c.level), lz4.BlockSizeOption(lz4.Block1Mb), lz4.ConcurrencyOption(1))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = c.w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (c *lz4Codec) decodeBlock(dst, src []byte) ([]byte, error) {
+	c.r.Reset(bytes.NewReader(src))
+	out := bytes.NewBuffer(dst[:0])
+	if _, err := out.ReadFrom(c.r); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (c *lz4Codec) close() {}
+
+// blockWriter compresses the data written to it in independent blocks
+type blockWriter struct {
+	w     io.Writer
+	codec blockCodec
+	in    []byte             // uncompressed data not yet written
+	out   []byte             // buffer for compressed data
+	meta  sgzip.GzipMetadata // block index
+}
+
+func newBlockWriter(w io.Writer, codec blockCodec) *blockWriter {
+	return &blockWriter{
+		w:     w,
+		codec: codec,
+		in:    make([]byte, 0, blockSize),
+		meta: sgzip.GzipMetadata{
+			BlockSize: blockSize,
+		},
+	}
+}
+
+// Write compresses p writing out any full blocks
+func (bw *blockWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		i := copy(bw.in[len(bw.in):cap(bw.in)], p)
+		bw.in = bw.in[:len(bw.in)+i]
+		p = p[i:]
+		n += i
+		if len(bw.in) == cap(bw.in) {
+			if err = bw.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush compresses and writes out the pending data as a block
+func (bw *blockWriter) flush() (err error) {
+	bw.out, err = bw.codec.encodeBlock(bw.out, bw.in)
+	if err != nil {
+		return err
+	}
+	if _, err = bw.w.Write(bw.out); err != nil {
+		return err
+	}
+	bw.meta.BlockData = append(bw.meta.BlockData, uint32(len(bw.out)))
+	bw.meta.Size += int64(len(bw.in))
+	bw.in = bw.in[:0]
+	return nil
+}
+
+// Close writes out the final block
+//
+// An empty file is written as a single empty block so it is still a
+// valid compressed file.
+func (bw *blockWriter) Close() (err error) {
+	if len(bw.in) > 0 || len(bw.meta.BlockData) == 0 {
+		err = bw.flush()
+	}
+	bw.codec.close()
+	return err
+}
+
+// MetaData returns the block index of the compressed data
+func (bw *blockWriter) MetaData() sgzip.GzipMetadata {
+	return bw.meta
+}
+
+// blockReader decompresses data written by blockWriter
+type blockReader struct {
+	r     io.Reader
+	codec blockCodec
+	meta  *sgzip.GzipMetadata
+	block int    // index of the next block to read
+	in    []byte // buffer for compressed data
+	buf   []byte // buffer for decompressed data
+	out   []byte // decompressed data not yet returned
+	skip  int    // bytes to skip from the start of the next block
+}
+
+var errCorruptBlock = errors.New("compressed block decompressed to wrong size")
+
+// newBlockReaderAt returns a reader which decompresses the data in r
+// starting at the uncompressed offset pos.
+func newBlockReaderAt(r io.ReadSeeker, codec blockCodec, meta *sgzip.GzipMetadata, pos int64) (*blockReader, error) {
+	br := &blockReader{
+		r:     r,
+		codec: codec,
+		meta:  meta,
+	}
+	if pos >= meta.Size || meta.BlockSize <= 0 {
+		br.block = len(meta.BlockData)
+		return br, nil
+	}
+	br.block = int(pos / int64(meta.BlockSize))
+	br.skip = int(pos % int64(meta.BlockSize))
+	var start int64
+	for _, size := range meta.BlockData[:br.block] {
+		start += int64(size)
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// Read decompresses data into p
+func (br *blockReader) Read(p []byte) (n int, err error) {
+	for len(br.out) == 0 {
+		if br.block >= len(br.meta.BlockData) {
+			return 0, io.EOF
+		}
+		if err = br.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(p, br.out)
+	br.out = br.out[n:]
+	return n, nil
+}
+
+// readBlock reads and decompresses the next block
+func (br *blockReader) readBlock() (err error) {
+	size := int(br.meta.BlockData[br.block])
+	if cap(br.in) < size {
+		br.in = make([]byte, size)
+	}
+	br.in = br.in[:size]
+	if _, err = io.ReadFull(br.r, br.in); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	br.buf, err = br.codec.decodeBlock(br.buf, br.in)
+	if err != nil {
+		return err
+	}
+	br.out = br.buf
+	want := int64(br.meta.BlockSize)
+	if remaining := br.meta.Size - int64(br.block)*int64(br.meta.BlockSize); remaining < want {
+		want = remaining
+	}
+	if int64(len(br.out)) != want {
+		return errCorruptBlock
+	}
+	br.block++
+	if br.skip > 0 {
+		br.out = br.out[br.skip:]
+		br.skip = 0
+	}
+	return nil
+}
+
+// Close releases the resources held by the reader and closes the
+// underlying reader if it can be closed
+func (br *blockReader) Close() error {
+	br.codec.close()
+	if closer, ok := br.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockReadWrite(t *testing.T) {
+	for _, mode := range []int{Zstd, Lz4} {
+		for _, size := range []int{0, 1, blockSize - 1, blockSize, 2*blockSize + 17} {
+			t.Run(fmt.Sprintf("mode=%d,size=%d", mode, size), func(t *testing.T) {
+				data := []byte(random.String(size))
+
+				// Compress
+				var compressed bytes.Buffer
+				codec, err := newBlockCodec(mode, -1)
+				require.NoError(t, err)
+				bw := newBlockWriter(&compressed, codec)
+				_, err = io.Copy(bw, bytes.NewReader(data))
+				require.NoError(t, err)
+				require.NoError(t, bw.Close())
+				meta := bw.MetaData()
+				assert.Equal(t, int64(size), meta.Size)
+
+				// The output must be readable by the standard decoders
+				var std io.Reader
+				if mode == Zstd {
+					dec, err := zstd.NewReader(bytes.NewReader(compressed.Bytes()))
+					require.NoError(t, err)
+					defer dec.Close()
+					std = dec
+				} else {
+					std = lz4MultiFrameReader(compressed.Bytes(), meta.BlockData)
+				}
+				got, err := io.ReadAll(std)
+				require.NoError(t, err)
+				assert.Equal(t, data, got)
+
+				// Read from various offsets
+				for _, offset := range []int{0, 1, size / 2, blockSize, blockSize + 1, size} {
+					if offset > size {
+						continue
+					}
+					codec, err := newBlockCodec(mode, -1)
+					require.NoError(t, err)
+					br, err := newBlockReaderAt(bytes.NewReader(compressed.Bytes()), codec, &meta, int64(offset))
+					require.NoError(t, err)
+					got, err := io.ReadAll(br)
+					require.NoError(t, err)
+					assert.Equal(t, data[offset:], got, "offset %d", offset)
+					require.NoError(t, br.Close())
+				}
+			})
+		}
+	}
+}
+
+// lz4MultiFrameReader decodes each lz4 frame separately with the
+// standard reader
+func lz4MultiFrameReader(compressed []byte, blocks []uint32) io.Reader {
+	var readers []io.Reader
+	for _, size := range blocks {
+		readers = append(readers, lz4.NewReader(bytes.NewReader(compressed[:size])))
+		compressed = compressed[size:]
+	}
+	return io.MultiReader(readers...)
+}
+
+func TestCheckCompressionLevel(t *testing.T) {
+	for _, test := range []struct {
+		mode  int
+		level int
+		ok    bool
+	}{
+		{Gzip, -2, true},
+		{Gzip, 9, true},
+		{Gzip, -3, false},
+		{Gzip, 10, false},
+		{Zstd, -1, true},
+		{Zstd, 22, true},
+		{Zstd, 23, false},
+		{Lz4, -1, true},
+		{Lz4, 9, true},
+		{Lz4, 10, false},
+	} {
+		err := checkCompressionLevel(test.mode, test.level)
+		if test.ok {
+			assert.NoError(t, err, fmt.Sprint(test))
+		} else {
+			assert.Error(t, err, fmt.Sprint(test))
+		}
+	}
+}
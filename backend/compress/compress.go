@@ -45,6 +45,8 @@ const (
 	minCompressionRatio = 1.1
 
 	gzFileExt           = ".gz"
+	zstdFileExt         = ".zst"
+	lz4FileExt          = ".lz4"
 	metaFileExt         = ".json"
 	uncompressedFileExt = ".bin"
 )
@@ -53,6 +55,8 @@ const (
 const (
 	Uncompressed = 0
 	Gzip         = 2
+	Zstd         = 3
+	Lz4          = 4
 )
 
 var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
@@ -64,6 +68,12 @@ func init() {
 		{ // Default compression mode options {
 			Value: "gzip",
 			Help:  "Standard gzip compression with fastest parameters.",
+		}, {
+			Value: "zstd",
+			Help:  "Zstandard compression - better compression and faster than gzip.",
+		}, {
+			Value: "lz4",
+			Help:  "LZ4 compression - very fast with lower compression.",
 		},
 	}
 
@@ -86,7 +96,9 @@ func init() {
 			Examples: compressionModeOptions,
 		}, {
 			Name: "level",
-			Help: `GZIP compression level (-2 to 9).
+			Help: `Compression level.
+
+For gzip the level is -2 to 9.
 
 Generally -1 (default, equivalent to 5) is recommended.
 Levels 1 to 9 increase compression at the cost of speed. Going past 6 
@@ -94,7 +106,12 @@ generally offers very little return.
 
 Level -2 uses Huffman encoding only. Only use if you know what you
 are doing.
-Level 0 turns off compression.`,
+Level 0 turns off compression.
+
+For zstd the level is 1 to 22 as used by the zstd command line tool
+and -1 or 0 selects the default level (3).
+
+For lz4 the level is 1 to 9 and -1 or 0 selects the fastest level.`,
 			Default:  sgzip.DefaultCompression,
 			Advanced: true,
 		}, {
@@ -140,6 +157,14 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err != nil {
 		return nil, err
 	}
+	mode, err := compressionModeFromName(opt.CompressionMode)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCompressionLevel(mode, opt.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
 
 	remote := opt.Remote
 	if strings.HasPrefix(remote, name+":") {
@@ -172,7 +197,7 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		name: name,
 		root: rpath,
 		opt:  *opt,
-		mode: compressionModeFromName(opt.CompressionMode),
+		mode: mode,
 	}
 	// Correct root if definitely pointing to a file
 	if err == fs.ErrorIsFile {
@@ -212,13 +237,81 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	return f, err
 }
 
-func compressionModeFromName(name string) int {
+func compressionModeFromName(name string) (int, error) {
 	switch name {
 	case "gzip":
-		return Gzip
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	case "lz4":
+		return Lz4, nil
 	default:
-		return Uncompressed
+		return Uncompressed, fmt.Errorf("unknown compression mode %q", name)
+	}
+}
+
+// compressionModeExt returns the file extension used for data files
+// compressed with mode
+func compressionModeExt(mode int) string {
+	switch mode {
+	case Zstd:
+		return zstdFileExt
+	case Lz4:
+		return lz4FileExt
+	default:
+		return gzFileExt
+	}
+}
+
+// newBlockCodec returns the block codec for mode or nil if mode
+// doesn't use one
+func newBlockCodec(mode int, level int) (blockCodec, error) {
+	switch mode {
+	case Zstd:
+		return newZstdCodec(level)
+	case Lz4:
+		return newLz4Codec(level)
+	}
+	return nil, nil
+}
+
+// checkCompressionLevel returns an error if level can't be used with
+// mode, so a bad config is found when the remote is created rather
+// than on the first upload.
+func checkCompressionLevel(mode int, level int) error {
+	if mode == Gzip {
+		if level < sgzip.HuffmanOnly || level > sgzip.BestCompression {
+			return fmt.Errorf("gzip compression level must be %d to %d, got %d", sgzip.HuffmanOnly, sgzip.BestCompression, level)
+		}
+		return nil
+	}
+	codec, err := newBlockCodec(mode, level)
+	if err != nil {
+		return err
+	}
+	if codec != nil {
+		codec.close()
 	}
+	return nil
+}
+
+// compressor is implemented by the writers for each compression mode
+type compressor interface {
+	io.WriteCloser
+	MetaData() sgzip.GzipMetadata
+}
+
+// newCompressor returns a compressor for the compression mode of f
+// writing to w
+func (f *Fs) newCompressor(w io.Writer) (compressor, error) {
+	codec, err := newBlockCodec(f.mode, f.opt.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if codec != nil {
+		return newBlockWriter(w, codec), nil
+	}
+	return sgzip.NewWriterLevel(w, f.opt.CompressionLevel)
 }
 
 // Converts an int64 to base64
@@ -247,8 +340,12 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	}
 	extension = compressedFileName[extensionPos:]
 	nameWithSize := compressedFileName[:extensionPos]
-	if extension == uncompressedFileExt {
+	switch extension {
+	case uncompressedFileExt:
 		return nameWithSize, extension, -2, nil
+	case gzFileExt, zstdFileExt, lz4FileExt:
+	default:
+		return "", "", 0, errors.New("unknown extension")
 	}
 	match := nameRegexp.FindStringSubmatch(nameWithSize)
 	if match == nil || len(match) != 3 {
@@ -258,7 +355,7 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if err != nil {
 		return "", "", 0, errors.New("could not decode size")
 	}
-	return match[1], gzFileExt, size, nil
+	return match[1], extension, size, nil
 }
 
 // Generates the file name for a metadata file
@@ -284,7 +381,7 @@ func unwrapMetadataFile(filename string) (string, bool) {
 // makeDataName generates the file name for a data file with specified compression mode
 func makeDataName(remote string, size int64, mode int) (newRemote string) {
 	if mode != Uncompressed {
-		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
+		newRemote = remote + "." + int64ToBase64(size) + compressionModeExt(mode)
 	} else {
 		newRemote = remote + uncompressedFileExt
 	}
@@ -528,8 +625,9 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	pipeReader, pipeWriter := io.Pipe()
 	results := make(chan compressionResult)
 	go func() {
-		gz, err := sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+		gz, err := f.newCompressor(pipeWriter)
 		if err != nil {
+			_ = pipeWriter.CloseWithError(err)
 			results <- compressionResult{err: err, meta: sgzip.GzipMetadata{}}
 			return
 		}
@@ -1362,16 +1460,27 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
+	codec, err := newBlockCodec(o.meta.Mode, 0)
+	if err != nil {
+		return nil, err
+	}
 	// Get a chunkedreader for the wrapped object
 	chunkedReader := chunkedreader.New(ctx, o.Object, initialChunkSize, maxChunkSize, chunkStreams)
 	// Get file handle
 	var file io.Reader
-	if offset != 0 {
+	var closer io.Closer = chunkedReader
+	switch {
+	case codec != nil:
+		var br *blockReader
+		br, err = newBlockReaderAt(chunkedReader, codec, &o.meta.CompressionMetadata, offset)
+		file, closer = br, br
+	case offset != 0:
 		file, err = sgzip.NewReaderAt(chunkedReader, &o.meta.CompressionMetadata, offset)
-	} else {
+	default:
 		file, err = sgzip.NewReader(chunkedReader)
 	}
 	if err != nil {
+		_ = chunkedReader.Close()
 		return nil, err
 	}
 
@@ -1382,7 +1491,7 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		fileReader = file
 	}
 	// Return a ReadCloser
-	return ReadCloserWrapper{Reader: fileReader, Closer: chunkedReader}, nil
+	return ReadCloserWrapper{Reader: fileReader, Closer: closer}, nil
 }
 
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
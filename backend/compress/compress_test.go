@@ -2,16 +2,25 @@
 package compress
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/drive"
 	_ "github.com/rclone/rclone/backend/local"
 	_ "github.com/rclone/rclone/backend/s3"
 	_ "github.com/rclone/rclone/backend/swift"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var defaultOpt = fstests.Opt{
@@ -53,3 +62,131 @@ func TestRemoteGzip(t *testing.T) {
 	opt.QuickTestOK = true
 	fstests.Run(t, &opt)
 }
+
+// TestRemoteZstd tests Zstandard compression
+func TestRemoteZstd(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-compress-test-zstd")
+	name := "TestCompressZstd"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "compress"},
+		{Name: name, Key: "remote", Value: tempdir},
+		{Name: name, Key: "mode", Value: "zstd"},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
+
+// TestRemoteLz4 tests LZ4 compression
+func TestRemoteLz4(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-compress-test-lz4")
+	name := "TestCompressLz4"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "compress"},
+		{Name: name, Key: "remote", Value: tempdir},
+		{Name: name, Key: "mode", Value: "lz4"},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
+
+func TestProcessFileName(t *testing.T) {
+	size := int64ToBase64(1234)
+	for _, test := range []struct {
+		in       string
+		wantName string
+		wantExt  string
+		wantSize int64
+		wantErr  bool
+	}{
+		{"file.txt.bin", "file.txt", uncompressedFileExt, -2, false},
+		{"file.txt." + size + ".gz", "file.txt", gzFileExt, 1234, false},
+		{"file.txt." + size + ".zst", "file.txt", zstdFileExt, 1234, false},
+		{"file.txt." + size + ".lz4", "file.txt", lz4FileExt, 1234, false},
+		{"file.txt." + size + ".txt", "", "", 0, true},
+		{"file.txt.gz", "", "", 0, true},
+		{"file", "", "", 0, true},
+	} {
+		name, ext, size, err := processFileName(test.in)
+		if test.wantErr {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.wantName, name, test.in)
+		assert.Equal(t, test.wantExt, ext, test.in)
+		assert.Equal(t, test.wantSize, size, test.in)
+	}
+}
+
+// Check files written in gzip mode can be read and updated through a
+// remote using a different mode
+func TestModeChange(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []string{"zstd", "lz4"} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			newFs := func(mode string) fs.Fs {
+				f, err := NewFs(ctx, "TestCompressModeChange", "", configmap.Simple{
+					"remote": dir,
+					"mode":   mode,
+				})
+				require.NoError(t, err)
+				return f
+			}
+			read := func(o fs.Object) string {
+				in, err := o.Open(ctx)
+				require.NoError(t, err)
+				data, err := io.ReadAll(in)
+				require.NoError(t, err)
+				require.NoError(t, in.Close())
+				return string(data)
+			}
+			dataFiles := func() (names []string) {
+				entries, err := os.ReadDir(dir)
+				require.NoError(t, err)
+				for _, entry := range entries {
+					if !strings.HasSuffix(entry.Name(), metaFileExt) {
+						names = append(names, entry.Name())
+					}
+				}
+				return names
+			}
+			modTime := fstest.Time("2001-02-03T04:05:06Z")
+			contents := strings.Repeat("gzip contents ", 100)
+			src := object.NewStaticObjectInfo("file.txt", modTime, int64(len(contents)), true, nil, nil)
+			_, err := newFs("gzip").Put(ctx, bytes.NewBufferString(contents), src)
+			require.NoError(t, err)
+
+			f := newFs(mode)
+			o, err := f.NewObject(ctx, "file.txt")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(contents)), o.Size())
+			assert.Equal(t, contents, read(o))
+
+			newContents := strings.Repeat(mode+" contents ", 100)
+			src = object.NewStaticObjectInfo("file.txt", modTime, int64(len(newContents)), true, nil, nil)
+			require.NoError(t, o.Update(ctx, bytes.NewBufferString(newContents), src))
+			o, err = f.NewObject(ctx, "file.txt")
+			require.NoError(t, err)
+			assert.Equal(t, newContents, read(o))
+			files := dataFiles()
+			require.Len(t, files, 1)
+			assert.True(t, strings.HasSuffix(files[0], compressionModeExt(f.(*Fs).mode)), files[0])
+
+			// The gzip remote can read it back too
+			o, err = newFs("gzip").NewObject(ctx, "file.txt")
+			require.NoError(t, err)
+			assert.Equal(t, newContents, read(o))
+		})
+	}
+}
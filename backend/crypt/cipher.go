@@ -181,6 +181,10 @@ type Cipher struct {
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
 	encryptedSuffix string
+	headerSize      int                      // size of the file header
+	recipients      []*[envelopeKeySize]byte // public keys to wrap data keys for - set in envelope mode
+	maxRecipients   int                      // number of slots for wrapped data keys in the header
+	identity        *[envelopeKeySize]byte   // private key to unwrap data keys with - may be nil
 }
 
 // newCipher initialises the cipher.  If salt is "" then it uses a built in salt val
@@ -191,6 +195,7 @@ func newCipher(mode NameEncryptionMode, password, salt string, dirNameEncrypt bo
 		cryptoRand:      rand.Reader,
 		dirNameEncrypt:  dirNameEncrypt,
 		encryptedSuffix: ".bin",
+		headerSize:      fileHeaderSize,
 	}
 	c.buffers.New = func() interface{} {
 		return new([blockSize]byte)
@@ -683,6 +688,8 @@ type encrypter struct {
 	in       io.Reader
 	c        *Cipher
 	nonce    nonce
+	key      *[32]byte // key to encrypt the data with
+	env      *envelope // per file key if in envelope mode
 	buf      *[blockSize]byte
 	readBuf  *[blockSize]byte
 	bufIndex int
@@ -691,13 +698,17 @@ type encrypter struct {
 }
 
 // newEncrypter creates a new file handle encrypting on the fly
-func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+//
+// If nonce is nil a random nonce is used. In envelope mode if env is
+// nil a new data key is made for the file.
+func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce, env *envelope) (*encrypter, error) {
 	fh := &encrypter{
 		in:      in,
 		c:       c,
+		key:     &c.dataKey,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
-		bufSize: fileHeaderSize,
+		bufSize: c.headerSize,
 	}
 	// Initialise nonce
 	if nonce != nil {
@@ -708,8 +719,24 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 			return nil, err
 		}
 	}
-	// Copy magic into buffer
-	copy((*fh.buf)[:], fileMagicBytes)
+	if !c.envelopeMode() {
+		// Copy magic into buffer
+		copy((*fh.buf)[:], fileMagicBytes)
+	} else {
+		// Make or reuse the per file key
+		if env == nil {
+			var err error
+			env, err = c.newEnvelope(&fh.nonce)
+			if err != nil {
+				return nil, err
+			}
+		}
+		fh.env = env
+		fh.key = &env.key
+		// Copy magic and wrapped keys into buffer
+		copy((*fh.buf)[:], envelopeMagicBytes)
+		copy((*fh.buf)[fileHeaderSize:], env.wrapped)
+	}
 	// Copy nonce into buffer
 	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
 	return fh, nil
@@ -734,7 +761,7 @@ func (fh *encrypter) Read(p []byte) (n int, err error) {
 		// possibly err != nil here, but we will process the
 		// data and the next call to ReadFill will return 0, err
 		// Encrypt the block using the nonce
-		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), &fh.c.dataKey)
+		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), fh.key)
 		fh.bufIndex = 0
 		fh.bufSize = blockHeaderSize + n
 		fh.nonce.increment()
@@ -760,7 +787,7 @@ func (fh *encrypter) finish(err error) (int, error) {
 // Encrypt data encrypts the data stream
 func (c *Cipher) encryptData(in io.Reader) (io.Reader, *encrypter, error) {
 	in, wrap := accounting.UnWrap(in) // unwrap the accounting off the Reader
-	out, err := c.newEncrypter(in, nil)
+	out, err := c.newEncrypter(in, nil, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -780,6 +807,8 @@ type decrypter struct {
 	nonce        nonce
 	initialNonce nonce
 	c            *Cipher
+	key          *[32]byte // key to decrypt the data with
+	env          *envelope // per file key if in envelope mode
 	buf          *[blockSize]byte
 	readBuf      *[blockSize]byte
 	bufIndex     int
@@ -794,26 +823,44 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	fh := &decrypter{
 		rc:      rc,
 		c:       c,
+		key:     &c.dataKey,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
 		limit:   -1,
 	}
-	// Read file header (magic + nonce)
-	readBuf := (*fh.readBuf)[:fileHeaderSize]
+	// Read file header (magic + nonce + wrapped keys in envelope mode)
+	readBuf := (*fh.readBuf)[:c.headerSize]
 	n, err := readers.ReadFill(fh.rc, readBuf)
-	if n < fileHeaderSize && err == io.EOF {
-		// This read from 0..fileHeaderSize-1 bytes
+	if n < c.headerSize && err == io.EOF {
+		// This read from 0..headerSize-1 bytes
 		return nil, fh.finishAndClose(ErrorEncryptedFileTooShort)
 	} else if err != io.EOF && err != nil {
 		return nil, fh.finishAndClose(err)
 	}
 	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
+	magic, otherMagic, otherErr := fileMagicBytes, envelopeMagicBytes, ErrorEncryptedEnvelope
+	if c.envelopeMode() {
+		magic, otherMagic, otherErr = envelopeMagicBytes, fileMagicBytes, ErrorEncryptedNotEnvelope
+	}
+	if !bytes.Equal(readBuf[:fileMagicSize], magic) {
+		if bytes.Equal(readBuf[:fileMagicSize], otherMagic) {
+			return nil, fh.finishAndClose(otherErr)
+		}
 		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
 	}
 	// retrieve the nonce
 	fh.nonce.fromBuf(readBuf[fileMagicSize:])
 	fh.initialNonce = fh.nonce
+	// unwrap the data key
+	if c.envelopeMode() {
+		wrapped := make([]byte, c.headerSize-fileHeaderSize)
+		copy(wrapped, readBuf[fileHeaderSize:])
+		fh.env, err = c.openEnvelope(&fh.nonce, wrapped)
+		if err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+		fh.key = &fh.env.key
+	}
 	return fh, nil
 }
 
@@ -828,12 +875,12 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		rc, err = open(ctx, 0, -1)
 	} else if offset == 0 {
 		// If no offset open the header + limit worth of the file
-		_, underlyingLimit, _, _ := calculateUnderlying(offset, limit)
-		rc, err = open(ctx, 0, int64(fileHeaderSize)+underlyingLimit)
+		_, underlyingLimit, _, _ := c.calculateUnderlying(offset, limit)
+		rc, err = open(ctx, 0, int64(c.headerSize)+underlyingLimit)
 		setLimit = true
 	} else {
 		// Otherwise just read the header to start with
-		rc, err = open(ctx, 0, int64(fileHeaderSize))
+		rc, err = open(ctx, 0, int64(c.headerSize))
 		doRangeSeek = true
 	}
 	if err != nil {
@@ -877,7 +924,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), fh.key)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -932,12 +979,12 @@ func (fh *decrypter) Read(p []byte) (n int, err error) {
 // It also returns number of bytes to discard after reading the first
 // block and number of blocks this is from the start so the nonce can
 // be incremented.
-func calculateUnderlying(offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
+func (c *Cipher) calculateUnderlying(offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
 	// blocks we need to seek, plus bytes we need to discard
 	blocks, discard = offset/blockDataSize, offset%blockDataSize
 
 	// Offset in underlying stream we need to seek
-	underlyingOffset = int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	underlyingOffset = int64(c.headerSize) + blocks*(blockHeaderSize+blockDataSize)
 
 	// work out how many blocks we need to read
 	underlyingLimit = int64(-1)
@@ -987,7 +1034,7 @@ func (fh *decrypter) RangeSeek(ctx context.Context, offset int64, whence int, li
 		return 0, fh.err
 	}
 
-	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(offset, limit)
+	underlyingOffset, underlyingLimit, discard, blocks := fh.c.calculateUnderlying(offset, limit)
 
 	// Move the nonce on the correct number of blocks from the start
 	fh.nonce = fh.initialNonce
@@ -1120,7 +1167,7 @@ func (c *Cipher) DecryptDataSeek(ctx context.Context, open OpenRangeSeek, offset
 // EncryptedSize calculates the size of the data when encrypted
 func (c *Cipher) EncryptedSize(size int64) int64 {
 	blocks, residue := size/blockDataSize, size%blockDataSize
-	encryptedSize := int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	encryptedSize := int64(c.headerSize) + blocks*(blockHeaderSize+blockDataSize)
 	if residue != 0 {
 		encryptedSize += blockHeaderSize + residue
 	}
@@ -1129,7 +1176,7 @@ func (c *Cipher) EncryptedSize(size int64) int64 {
 
 // DecryptedSize calculates the size of the data when decrypted
 func (c *Cipher) DecryptedSize(size int64) (int64, error) {
-	size -= int64(fileHeaderSize)
+	size -= int64(c.headerSize)
 	if size < 0 {
 		return 0, ErrorEncryptedFileTooShort
 	}
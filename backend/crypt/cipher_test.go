@@ -3,6 +3,7 @@ package crypt
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/base32"
 	"encoding/base64"
 	"errors"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/Max-Sum/base32768"
 	"github.com/rclone/rclone/backend/crypt/pkcs7"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1083,7 +1085,7 @@ func testEncryptDecrypt(t *testing.T, bufSize int, copySize int64) {
 	c.cryptoRand = &zeroes{} // zero out the nonce
 	buf := make([]byte, bufSize)
 	source := newRandomSource(copySize)
-	encrypted, err := c.newEncrypter(source, nil)
+	encrypted, err := c.newEncrypter(source, nil, nil)
 	assert.NoError(t, err)
 	decrypted, err := c.newDecrypter(io.NopCloser(encrypted))
 	assert.NoError(t, err)
@@ -1177,14 +1179,14 @@ func TestNewEncrypter(t *testing.T) {
 
 	z := &zeroes{}
 
-	fh, err := c.newEncrypter(z, nil)
+	fh, err := c.newEncrypter(z, nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, nonce{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18}, fh.nonce)
 	assert.Equal(t, []byte{'R', 'C', 'L', 'O', 'N', 'E', 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18}, (*fh.buf)[:32])
 
 	// Test error path
 	c.cryptoRand = bytes.NewBufferString("123456789abcdefghijklmn")
-	fh, err = c.newEncrypter(z, nil)
+	fh, err = c.newEncrypter(z, nil, nil)
 	assert.Nil(t, fh)
 	assert.EqualError(t, err, "short read of nonce: EOF")
 }
@@ -1196,7 +1198,7 @@ func TestNewEncrypterErrUnexpectedEOF(t *testing.T) {
 	assert.NoError(t, err)
 
 	in := &readers.ErrorReader{Err: io.ErrUnexpectedEOF}
-	fh, err := c.newEncrypter(in, nil)
+	fh, err := c.newEncrypter(in, nil, nil)
 	assert.NoError(t, err)
 
 	n, err := io.CopyN(io.Discard, fh, 1e6)
@@ -1256,7 +1258,11 @@ func TestNewDecrypter(t *testing.T) {
 		cd := newCloseDetector(bytes.NewBuffer(file0copy))
 		fh, err := c.newDecrypter(cd)
 		assert.Nil(t, fh)
-		assert.EqualError(t, err, ErrorEncryptedBadMagic.Error())
+		if string(file0copy[:fileMagicSize]) == envelopeMagic {
+			assert.EqualError(t, err, ErrorEncryptedEnvelope.Error())
+		} else {
+			assert.EqualError(t, err, ErrorEncryptedBadMagic.Error())
+		}
 		file0copy[i] ^= 0x1
 		assert.Equal(t, 1, cd.closed)
 	}
@@ -1434,6 +1440,8 @@ func TestNewDecrypterSeekLimit(t *testing.T) {
 }
 
 func TestDecrypterCalculateUnderlying(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
 	for _, test := range []struct {
 		offset, limit           int64
 		wantOffset, wantLimit   int64
@@ -1477,7 +1485,7 @@ func TestDecrypterCalculateUnderlying(t *testing.T) {
 		{blockDataSize + 1, blockDataSize + 1, int64(fileHeaderSize) + blockSize, 2 * blockSize, 1, 1},
 	} {
 		what := fmt.Sprintf("offset = %d, limit = %d", test.offset, test.limit)
-		underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(test.offset, test.limit)
+		underlyingOffset, underlyingLimit, discard, blocks := c.calculateUnderlying(test.offset, test.limit)
 		assert.Equal(t, test.wantOffset, underlyingOffset, what)
 		assert.Equal(t, test.wantLimit, underlyingLimit, what)
 		assert.Equal(t, test.wantDiscard, discard, what)
@@ -1643,3 +1651,115 @@ func TestKey(t *testing.T) {
 	assert.Equal(t, [32]byte{}, c.nameKey)
 	assert.Equal(t, [16]byte{}, c.nameTweak)
 }
+
+func TestEnvelopeEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	public1, private1, err := GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	public2, private2, err := GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	public3, private3, err := GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+
+	public, err := PublicKey(private2)
+	require.NoError(t, err)
+	assert.Equal(t, public2, public)
+
+	newEnvelopeCipher := func(publicKeys []string, privateKey string) *Cipher {
+		c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+		require.NoError(t, err)
+		require.NoError(t, c.setEnvelope(publicKeys, privateKey, 4))
+		return c
+	}
+	writer := newEnvelopeCipher([]string{public1, public2}, "")
+	assert.Equal(t, fileHeaderSize+32+2+4*48, writer.headerSize)
+
+	plaintext := []byte(random.String(3*blockDataSize + 17))
+	in, err := writer.EncryptData(bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	encrypted, err := io.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, writer.EncryptedSize(int64(len(plaintext))), int64(len(encrypted)))
+	size, err := writer.DecryptedSize(int64(len(encrypted)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(plaintext)), size)
+	assert.Equal(t, envelopeMagic, string(encrypted[:fileMagicSize]))
+
+	open := func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+		end := len(encrypted)
+		if underlyingLimit >= 0 {
+			end = min(end, int(underlyingOffset+underlyingLimit))
+		}
+		return io.NopCloser(bytes.NewReader(encrypted[underlyingOffset:end])), nil
+	}
+
+	// Every recipient can read the file, including from an offset,
+	// whatever public keys the reader has configured
+	for _, reader := range []*Cipher{
+		newEnvelopeCipher([]string{public1, public2}, private1),
+		newEnvelopeCipher([]string{public1, public2}, private2),
+		newEnvelopeCipher([]string{public2}, private1),
+		newEnvelopeCipher([]string{public1, public2, public3}, private2),
+	} {
+		assert.Equal(t, writer.headerSize, reader.headerSize)
+		assert.Equal(t, writer.EncryptedSize(int64(len(plaintext))), reader.EncryptedSize(int64(len(plaintext))))
+		rc, err := reader.DecryptDataSeek(ctx, open, 0, -1)
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, got)
+		require.NoError(t, rc.Close())
+
+		offset := int64(blockDataSize + 100)
+		rc, err = reader.DecryptDataSeek(ctx, open, offset, 1000)
+		require.NoError(t, err)
+		got, err = io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext[offset:offset+1000], got)
+		require.NoError(t, rc.Close())
+	}
+
+	// Errors
+	for _, test := range []struct {
+		what       string
+		publicKeys []string
+		privateKey string
+		wantErr    error
+	}{
+		{"no private key", []string{public1, public2}, "", ErrorEnvelopeNoPrivateKey},
+		{"not a recipient", []string{public1, public2}, private3, ErrorEnvelopeNotRecipient},
+		{"added recipient", []string{public1, public2, public3}, private3, ErrorEnvelopeNotRecipient},
+	} {
+		reader := newEnvelopeCipher(test.publicKeys, test.privateKey)
+		_, err := reader.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+		assert.Equal(t, test.wantErr, err, test.what)
+	}
+
+	// A different max_recipients changes the header layout
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.setEnvelope([]string{public1, public2}, private1, 3))
+	_, err = c.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+	assert.Equal(t, ErrorEnvelopeRecipients, err)
+
+	// Password and envelope files can't be confused
+	c, err = newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	_, err = c.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+	assert.Equal(t, ErrorEncryptedEnvelope, err)
+	in, err = c.EncryptData(bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	passwordEncrypted, err := io.ReadAll(in)
+	require.NoError(t, err)
+	_, err = newEnvelopeCipher([]string{public1, public2}, private1).DecryptData(io.NopCloser(bytes.NewReader(passwordEncrypted)))
+	assert.Equal(t, ErrorEncryptedNotEnvelope, err)
+
+	// Bad keys
+	c, err = newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, c.setEnvelope([]string{"potato"}, "", 4), errorEnvelopeBadPublicKey)
+	assert.ErrorIs(t, c.setEnvelope([]string{public1}, "AAAA", 4), errorEnvelopeBadPrivateKey)
+	assert.Error(t, c.setEnvelope([]string{public1, public2}, "", 1))
+	assert.Error(t, c.setEnvelope([]string{public1}, "", 0))
+	assert.Error(t, c.setEnvelope([]string{public1}, "", 256))
+}
@@ -3,6 +3,7 @@ package crypt
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -76,6 +77,44 @@ NB If filename_encryption is "off" then this option will do nothing.`,
 			Name:       "password2",
 			Help:       "Password or pass phrase for salt.\n\nOptional but recommended.\nShould be different to the previous password.",
 			IsPassword: true,
+		}, {
+			Name: "public_keys",
+			Help: `Public keys to encrypt the file data for.
+
+If this is set then each file is encrypted with its own random key
+and that key is encrypted for each of the X25519 public keys in this
+comma separated list and stored in the file header. The file names are
+still encrypted with the password.
+
+Only holders of one of the corresponding private keys can read the
+file data, so a machine configured with just the public keys can
+write files it can't read back.
+
+Use "rclone backend keygen crypt:" to make a key pair.
+
+Public keys can be added or removed without affecting the files
+already written, up to the number set with max_recipients.`,
+			Default: fs.CommaSepList{},
+		}, {
+			Name: "private_key",
+			Help: `Private key to decrypt the file data with.
+
+This is only used if public_keys is set. It should be the private key
+for one of the public keys. If it isn't set then files can be written
+but not read.`,
+			IsPassword: true,
+		}, {
+			Name: "max_recipients",
+			Help: `Maximum number of public keys.
+
+The file header has room for this many wrapped keys whatever the
+number of public_keys, so the size of the files doesn't depend on the
+number of public keys in use.
+
+All the remotes reading or writing the files must have the same value
+for this as it is needed to work out the size of the files.`,
+			Default:  8,
+			Advanced: true,
 		}, {
 			Name:    "server_side_across_configs",
 			Default: false,
@@ -205,6 +244,22 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	if len(opt.PublicKeys) > 0 {
+		if opt.NoDataEncryption {
+			return nil, errors.New("can't use public_keys with no_data_encryption")
+		}
+		var privateKey string
+		if opt.PrivateKey != "" {
+			privateKey, err = obscure.Reveal(opt.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private_key: %w", err)
+			}
+		}
+		err = cipher.setEnvelope(opt.PublicKeys, privateKey, opt.MaxRecipients)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set public_keys: %w", err)
+		}
+	}
 	return cipher, nil
 }
 
@@ -298,18 +353,21 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote                  string `config:"remote"`
-	FilenameEncryption      string `config:"filename_encryption"`
-	DirectoryNameEncryption bool   `config:"directory_name_encryption"`
-	NoDataEncryption        bool   `config:"no_data_encryption"`
-	Password                string `config:"password"`
-	Password2               string `config:"password2"`
-	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
-	ShowMapping             bool   `config:"show_mapping"`
-	PassBadBlocks           bool   `config:"pass_bad_blocks"`
-	FilenameEncoding        string `config:"filename_encoding"`
-	Suffix                  string `config:"suffix"`
-	StrictNames             bool   `config:"strict_names"`
+	Remote                  string          `config:"remote"`
+	FilenameEncryption      string          `config:"filename_encryption"`
+	DirectoryNameEncryption bool            `config:"directory_name_encryption"`
+	NoDataEncryption        bool            `config:"no_data_encryption"`
+	Password                string          `config:"password"`
+	Password2               string          `config:"password2"`
+	ServerSideAcrossConfigs bool            `config:"server_side_across_configs"`
+	ShowMapping             bool            `config:"show_mapping"`
+	PassBadBlocks           bool            `config:"pass_bad_blocks"`
+	FilenameEncoding        string          `config:"filename_encoding"`
+	Suffix                  string          `config:"suffix"`
+	PublicKeys              fs.CommaSepList `config:"public_keys"`
+	PrivateKey              string          `config:"private_key"`
+	MaxRecipients           int             `config:"max_recipients"`
+	StrictNames             bool            `config:"strict_names"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -465,7 +523,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	ci := fs.GetConfig(ctx)
 
 	if f.opt.NoDataEncryption {
-		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}), options...)
+		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}, nil), options...)
 		if err == nil && o != nil {
 			o = f.newObject(o)
 		}
@@ -500,7 +558,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce, encrypter.env), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -625,6 +683,10 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
+	if !f.sameData(o.f) {
+		fs.Debugf(src, "Can't copy - crypt remotes have different data encryption")
+		return nil, fs.ErrorCantCopy
+	}
 	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
@@ -650,6 +712,10 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
+	if !f.sameData(o.f) {
+		fs.Debugf(src, "Can't move - crypt remotes have different data encryption")
+		return nil, fs.ErrorCantMove
+	}
 	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
@@ -675,9 +741,41 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 		fs.Debugf(srcFs, "Can't move directory - not same remote type")
 		return fs.ErrorCantDirMove
 	}
+	if !f.sameData(srcFs) || !f.sameNames(srcFs) {
+		fs.Debugf(srcFs, "Can't move directory - crypt remotes have different encryption")
+		return fs.ErrorCantDirMove
+	}
 	return do(ctx, srcFs.Fs, f.cipher.EncryptDirName(srcRemote), f.cipher.EncryptDirName(dstRemote))
 }
 
+// sameData returns true if data encrypted by src can be read by f
+//
+// If so the encrypted data can be copied or moved between the
+// remotes without re-encrypting it.
+func (f *Fs) sameData(src *Fs) bool {
+	if f.opt.NoDataEncryption || src.opt.NoDataEncryption {
+		return f.opt.NoDataEncryption == src.opt.NoDataEncryption
+	}
+	if f.cipher.envelopeMode() || src.cipher.envelopeMode() {
+		// The data keys are in the files so the header layout
+		// and the recipients the keys are wrapped for need to
+		// match
+		return f.cipher.sameEnvelope(src.cipher)
+	}
+	return f.cipher.dataKey == src.cipher.dataKey
+}
+
+// sameNames returns true if names encrypted by src can be read by f
+func (f *Fs) sameNames(src *Fs) bool {
+	c, srcC := f.cipher, src.cipher
+	return c.mode == srcC.mode &&
+		c.dirNameEncrypt == srcC.dirNameEncrypt &&
+		c.encryptedSuffix == srcC.encryptedSuffix &&
+		f.opt.FilenameEncoding == src.opt.FilenameEncoding &&
+		c.nameKey == srcC.nameKey &&
+		c.nameTweak == srcC.nameTweak
+}
+
 // PutUnchecked uploads the object
 //
 // This will create a duplicate if we upload a new file without
@@ -691,7 +789,7 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if err != nil {
 		return nil, err
 	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
+	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce, encrypter.env))
 	if err != nil {
 		return nil, err
 	}
@@ -747,8 +845,10 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 // computeHashWithNonce takes the nonce and encrypts the contents of
 // src with it, and calculates the hash given by HashType on the fly
 //
+// In envelope mode env must be the per file key of the file.
+//
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, env *envelope, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -757,7 +857,7 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	defer fs.CheckClose(in, &err)
 
 	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	out, err := f.cipher.newEncrypter(in, &nonce, env)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
@@ -786,7 +886,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 
 	// Read the nonce - opening the file is sufficient to read the nonce in
 	// use a limited read so we only read the header
-	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(f.cipher.headerSize) - 1})
 	if err != nil {
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
@@ -795,7 +895,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		_ = in.Close()
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
-	nonce := d.nonce
+	nonce, env := d.nonce, d.env
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
 	// Check nonce isn't all zeros
@@ -815,7 +915,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	return f.computeHashWithNonce(ctx, nonce, env, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -913,6 +1013,25 @@ Usage Example:
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
 `,
 	},
+	{
+		Name:  "keygen",
+		Short: "Make a key pair for public_keys and private_key",
+		Long: `This makes a new random X25519 key pair for use with the public_keys
+and private_key options, returning them base64 encoded.
+
+Usage Example:
+
+    rclone backend keygen crypt:
+
+If the private_key option is given then this returns the public key
+for it instead of making a new key pair.
+
+    rclone backend keygen crypt: -o private_key=KEY
+`,
+		Opts: map[string]string{
+			"private_key": "Show the public key for this private key",
+		},
+	},
 }
 
 // Command the backend to run a named command
@@ -943,6 +1062,20 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "keygen":
+		var publicKey, privateKey string
+		if privateKey = opt["private_key"]; privateKey != "" {
+			publicKey, err = PublicKey(privateKey)
+		} else {
+			publicKey, privateKey, err = GenerateKeyPair(rand.Reader)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{
+			"public_key":  publicKey,
+			"private_key": privateKey,
+		}, nil
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -1109,13 +1242,15 @@ type ObjectInfo struct {
 	fs.ObjectInfo
 	f     *Fs
 	nonce nonce
+	env   *envelope // per file key if in envelope mode
 }
 
-func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce, env *envelope) *ObjectInfo {
 	return &ObjectInfo{
 		ObjectInfo: src,
 		f:          f,
 		nonce:      nonce,
+		env:        env,
 	}
 }
 
@@ -1160,7 +1295,7 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 	if srcObj.Fs().Features().IsLocal {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		return o.f.computeHashWithNonce(ctx, o.nonce, o.env, srcObj, hash)
 	}
 	return "", nil
 }
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"fmt"
 	"io"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/lib/random"
@@ -59,9 +62,9 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	// encrypt the data
 	inBuf := bytes.NewBufferString(contents)
 	var outBuf bytes.Buffer
-	enc, err := f.cipher.newEncrypter(inBuf, nil)
+	enc, err := f.cipher.newEncrypter(inBuf, nil, nil)
 	require.NoError(t, err)
-	nonce := enc.nonce // read the nonce at the start
+	nonce, env := enc.nonce, enc.env // read the nonce at the start
 	_, err = io.Copy(&outBuf, enc)
 	require.NoError(t, err)
 
@@ -73,7 +76,7 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 
 	// wrap the object in a crypt for upload using the nonce we
 	// saved from the encrypter
-	src := f.newObjectInfo(oi, nonce)
+	src := f.newObjectInfo(oi, nonce, env)
 
 	// Test ObjectInfo methods
 	if !f.opt.NoDataEncryption {
@@ -119,6 +122,70 @@ func testComputeHash(t *testing.T, f *Fs) {
 	assert.Equal(t, remoteObjHash, computedHash)
 }
 
+// Test that server-side operations are only used between crypt
+// remotes which can read each other's encrypted data
+func TestSameEncryption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	newCrypt := func(name, password, filenameEncryption string) *Fs {
+		f, err := NewFs(ctx, name, "", configmap.Simple{
+			"remote":              dir,
+			"password":            obscure.MustObscure(password),
+			"filename_encryption": filenameEncryption,
+			"filename_encoding":   "base32",
+		})
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+	f := newCrypt("crypt1", "potato", "standard")
+	same := newCrypt("crypt2", "potato", "standard")
+	namesChanged := newCrypt("crypt3", "potato", "obfuscate")
+	keysChanged := newCrypt("crypt4", "sausage", "standard")
+
+	assert.True(t, same.sameData(f))
+	assert.True(t, same.sameNames(f))
+	assert.True(t, namesChanged.sameData(f))
+	assert.False(t, namesChanged.sameNames(f))
+	assert.False(t, keysChanged.sameData(f))
+	assert.False(t, keysChanged.sameNames(f))
+
+	obj := uploadFile(t, f, "file.txt", "hello world")
+	_, err := keysChanged.Copy(ctx, obj, "copy.txt")
+	assert.Equal(t, fs.ErrorCantCopy, err)
+	_, err = keysChanged.Move(ctx, obj, "moved.txt")
+	assert.Equal(t, fs.ErrorCantMove, err)
+	assert.Equal(t, fs.ErrorCantDirMove, namesChanged.DirMove(ctx, f, "", "moved"))
+}
+
+// Test that envelope mode data is only shared between crypt remotes
+// with the same public keys and max_recipients
+func TestSameEncryptionEnvelope(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	public1, _, err := GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	public2, _, err := GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	newCrypt := func(name, publicKeys, maxRecipients string) *Fs {
+		f, err := NewFs(ctx, name, "", configmap.Simple{
+			"remote":              dir,
+			"password":            obscure.MustObscure("potato"),
+			"filename_encryption": "standard",
+			"filename_encoding":   "base32",
+			"public_keys":         publicKeys,
+			"max_recipients":      maxRecipients,
+		})
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+	f := newCrypt("crypt1", public1+","+public2, "8")
+	assert.True(t, newCrypt("crypt2", public2+","+public1, "8").sameData(f))
+	assert.False(t, newCrypt("crypt3", public1, "8").sameData(f))
+	assert.False(t, newCrypt("crypt4", public1+","+public1, "8").sameData(f))
+	assert.False(t, newCrypt("crypt5", public1+","+public2, "4").sameData(f))
+	assert.False(t, newCrypt("crypt6", "", "8").sameData(f))
+}
+
 // InternalTest is called by fstests.Run to extra tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfo", func(t *testing.T) { testObjectInfo(t, f, false) })
@@ -2,6 +2,7 @@
 package crypt_test
 
 import (
+	"crypto/rand"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,6 +15,7 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/require"
 )
 
 // TestIntegration runs integration tests against the remote
@@ -169,3 +171,31 @@ func TestNoDataObfuscate(t *testing.T) {
 		QuickTestOK:                  true,
 	})
 }
+
+// TestEnvelope runs integration tests against the remote
+func TestEnvelope(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	publicKey1, _, err := crypt.GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	publicKey2, privateKey2, err := crypt.GenerateKeyPair(rand.Reader)
+	require.NoError(t, err)
+	tempdir := filepath.Join(os.TempDir(), "rclone-crypt-test-envelope")
+	name := "TestCrypt5"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*crypt.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "crypt"},
+			{Name: name, Key: "remote", Value: tempdir},
+			{Name: name, Key: "password", Value: obscure.MustObscure("potato")},
+			{Name: name, Key: "filename_encryption", Value: "standard"},
+			{Name: name, Key: "public_keys", Value: publicKey1 + "," + publicKey2},
+			{Name: name, Key: "private_key", Value: obscure.MustObscure(privateKey2)},
+		},
+		UnimplementableFsMethods:     []string{"OpenWriterAt", "OpenChunkWriter"},
+		UnimplementableObjectMethods: []string{"MimeType"},
+		QuickTestOK:                  true,
+	})
+}
@@ -0,0 +1,233 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// In envelope mode each file is encrypted with its own random data
+// key. The data key is encrypted (wrapped) with NaCl box for each of
+// the recipient public keys using an ephemeral key pair made for the
+// file and stored in the file header.
+//
+// This means a file can be written by anyone with the public keys but
+// can only be read by someone with one of the private keys.
+//
+// The header is
+//
+//	magic                   8 bytes "RCLONE\x00\x01"
+//	nonce                  24 bytes
+//	ephemeral public key   32 bytes
+//	number of slots         1 byte
+//	number of recipients    1 byte
+//	wrapped data keys      48 bytes per slot
+//
+// There is a slot for each of max_recipients so the size of the
+// header doesn't change when recipients are added or removed. The
+// slots not used by a recipient are filled with random data.
+//
+// The wrapped data keys are sealed with the nonce from the header.
+// The file data is encrypted in blocks exactly as it is with a
+// password, but using the data key for the file.
+
+// Constants
+const (
+	envelopeMagic         = "RCLONE\x00\x01"
+	envelopeKeySize       = 32
+	envelopeWrappedSize   = envelopeKeySize + box.Overhead
+	envelopeMaxRecipients = 255
+	envelopeCountsSize    = 2 // number of slots and recipients
+)
+
+// Errors returned in envelope mode
+var (
+	ErrorEnvelopeNoPrivateKey  = errors.New("can't decrypt file - private_key is not set")
+	ErrorEnvelopeNotRecipient  = errors.New("can't decrypt file - private_key is not one of the recipients")
+	ErrorEnvelopeRecipients    = errors.New("file was written with a different max_recipients")
+	ErrorEnvelopeBadHeader     = errors.New("bad envelope header")
+	ErrorEncryptedEnvelope     = errors.New("file is encrypted with public keys - set public_keys to read it")
+	ErrorEncryptedNotEnvelope  = errors.New("file is encrypted with a password - unset public_keys to read it")
+	envelopeMagicBytes         = []byte(envelopeMagic)
+	errorEnvelopeBadPublicKey  = errors.New("bad public key")
+	errorEnvelopeBadPrivateKey = errors.New("bad private key")
+)
+
+// envelope is the per file key material for a file encrypted in
+// envelope mode
+type envelope struct {
+	key     [envelopeKeySize]byte // the data key for the file
+	wrapped []byte                // ephemeral public key, counts and wrapped data keys
+}
+
+// envelopeHeaderSize returns the size of the file header for a file
+// with n slots for recipients
+func envelopeHeaderSize(n int) int {
+	return fileHeaderSize + envelopeKeySize + envelopeCountsSize + n*envelopeWrappedSize
+}
+
+// decodeKey decodes a base64 encoded X25519 key
+func decodeKey(in string, badKey error) (*[envelopeKeySize]byte, error) {
+	buf, err := base64.StdEncoding.DecodeString(in)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", badKey, in, err)
+	}
+	if len(buf) != envelopeKeySize {
+		return nil, fmt.Errorf("%w %q: need %d bytes but got %d", badKey, in, envelopeKeySize, len(buf))
+	}
+	var key [envelopeKeySize]byte
+	copy(key[:], buf)
+	return &key, nil
+}
+
+// encodeKey encodes an X25519 key as base64
+func encodeKey(key *[envelopeKeySize]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// setEnvelope puts the cipher into envelope mode with the recipient
+// public keys and optional private key passed in.
+//
+// maxRecipients is the number of slots for recipients in the header.
+func (c *Cipher) setEnvelope(publicKeys []string, privateKey string, maxRecipients int) error {
+	if len(publicKeys) == 0 {
+		return errors.New("need at least one public key for envelope encryption")
+	}
+	if maxRecipients < 1 || maxRecipients > envelopeMaxRecipients {
+		return fmt.Errorf("max_recipients must be 1 to %d, got %d", envelopeMaxRecipients, maxRecipients)
+	}
+	if len(publicKeys) > maxRecipients {
+		return fmt.Errorf("too many public keys: maximum is max_recipients = %d", maxRecipients)
+	}
+	c.recipients = c.recipients[:0]
+	for _, publicKey := range publicKeys {
+		key, err := decodeKey(publicKey, errorEnvelopeBadPublicKey)
+		if err != nil {
+			return err
+		}
+		c.recipients = append(c.recipients, key)
+	}
+	c.identity = nil
+	if privateKey != "" {
+		key, err := decodeKey(privateKey, errorEnvelopeBadPrivateKey)
+		if err != nil {
+			return err
+		}
+		c.identity = key
+	}
+	c.maxRecipients = maxRecipients
+	c.headerSize = envelopeHeaderSize(maxRecipients)
+	return nil
+}
+
+// envelopeMode returns true if the cipher is in envelope mode
+func (c *Cipher) envelopeMode() bool {
+	return len(c.recipients) > 0
+}
+
+// sameEnvelope returns true if c and other are in envelope mode with
+// the same header layout and recipients, so data written by one is
+// readable by the same keys as data written by the other.
+func (c *Cipher) sameEnvelope(other *Cipher) bool {
+	if !c.envelopeMode() || !other.envelopeMode() || c.maxRecipients != other.maxRecipients {
+		return false
+	}
+	keys := make(map[[envelopeKeySize]byte]struct{}, len(c.recipients))
+	for _, recipient := range c.recipients {
+		keys[*recipient] = struct{}{}
+	}
+	otherKeys := make(map[[envelopeKeySize]byte]struct{}, len(other.recipients))
+	for _, recipient := range other.recipients {
+		if _, ok := keys[*recipient]; !ok {
+			return false
+		}
+		otherKeys[*recipient] = struct{}{}
+	}
+	return len(keys) == len(otherKeys)
+}
+
+// newEnvelope makes a random data key for a file and wraps it for
+// each of the recipients, filling the unused slots with random data.
+func (c *Cipher) newEnvelope(nonce *nonce) (*envelope, error) {
+	env := &envelope{
+		wrapped: make([]byte, 0, c.headerSize-fileHeaderSize),
+	}
+	if _, err := io.ReadFull(c.cryptoRand, env.key[:]); err != nil {
+		return nil, fmt.Errorf("failed to make data key: %w", err)
+	}
+	ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(c.cryptoRand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make ephemeral key: %w", err)
+	}
+	env.wrapped = append(env.wrapped, ephemeralPublic[:]...)
+	env.wrapped = append(env.wrapped, byte(c.maxRecipients), byte(len(c.recipients)))
+	for _, recipient := range c.recipients {
+		env.wrapped = box.Seal(env.wrapped, env.key[:], nonce.pointer(), recipient, ephemeralPrivate)
+	}
+	unused := make([]byte, (c.maxRecipients-len(c.recipients))*envelopeWrappedSize)
+	if _, err := io.ReadFull(c.cryptoRand, unused); err != nil {
+		return nil, fmt.Errorf("failed to fill unused slots: %w", err)
+	}
+	env.wrapped = append(env.wrapped, unused...)
+	return env, nil
+}
+
+// openEnvelope unwraps the data key from the header of a file using
+// the private key.
+//
+// The number of recipients is read from the header so files can be
+// read whatever recipients they were written for.
+func (c *Cipher) openEnvelope(nonce *nonce, wrapped []byte) (*envelope, error) {
+	var ephemeralPublic [envelopeKeySize]byte
+	copy(ephemeralPublic[:], wrapped)
+	slots, n := int(wrapped[envelopeKeySize]), int(wrapped[envelopeKeySize+1])
+	if slots != c.maxRecipients {
+		return nil, ErrorEnvelopeRecipients
+	}
+	if n == 0 || n > slots {
+		return nil, ErrorEnvelopeBadHeader
+	}
+	if c.identity == nil {
+		return nil, ErrorEnvelopeNoPrivateKey
+	}
+	env := &envelope{
+		wrapped: wrapped,
+	}
+	keys := wrapped[envelopeKeySize+envelopeCountsSize:]
+	for i := 0; i < n; i++ {
+		slot := keys[i*envelopeWrappedSize : (i+1)*envelopeWrappedSize]
+		key, ok := box.Open(env.key[:0], slot, nonce.pointer(), &ephemeralPublic, c.identity)
+		if ok && len(key) == envelopeKeySize {
+			return env, nil
+		}
+	}
+	return nil, ErrorEnvelopeNotRecipient
+}
+
+// GenerateKeyPair makes a new random X25519 key pair for envelope
+// encryption returning them base64 encoded.
+func GenerateKeyPair(rand io.Reader) (publicKey, privateKey string, err error) {
+	public, private, err := box.GenerateKey(rand)
+	if err != nil {
+		return "", "", err
+	}
+	return encodeKey(public), encodeKey(private), nil
+}
+
+// PublicKey returns the base64 encoded public key for the base64
+// encoded private key passed in.
+func PublicKey(privateKey string) (string, error) {
+	private, err := decodeKey(privateKey, errorEnvelopeBadPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	public, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(public), nil
+}
@@ -0,0 +1,180 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "gc":
+		minAge := time.Hour
+		if s, ok := opt["min-age"]; ok {
+			minAge, err = fs.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("bad min-age: %w", err)
+			}
+		}
+		return f.gc(ctx, minAge)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "gc",
+	Short: "Remove chunks which are no longer used by any file",
+	Long: `This reads every manifest in the dedup remote, whatever the path
+given, and deletes the chunks which none of them refer to. Where an
+interrupted upload has left more than one manifest for a file the older
+ones are deleted too.
+
+Chunks younger than min-age are kept even if they aren't used as they
+may belong to uploads in progress. Uploads which find a chunk is stored
+already reset its age so it is kept too. Don't run gc while uploads
+which started more than min-age ago are still running, and don't set
+min-age shorter than 10 minutes while anything is uploading.
+
+Usage Example:
+
+    rclone backend gc dedup:
+    rclone backend gc dedup: -o min-age=24h
+
+Use --dry-run to see what would be deleted.
+`,
+	Opts: map[string]string{
+		"min-age": "Only delete unused chunks older than this (default 1h)",
+	},
+}}
+
+// gcStats is returned by the gc command
+type gcStats struct {
+	Manifests      int   `json:"manifests"`      // number of manifests read
+	Chunks         int   `json:"chunks"`         // number of chunks found
+	ChunkBytes     int64 `json:"chunkBytes"`     // size of the chunks found
+	Deleted        int   `json:"deleted"`        // number of chunks deleted
+	DeletedBytes   int64 `json:"deletedBytes"`   // size of the chunks deleted
+	StaleManifests int   `json:"staleManifests"` // number of old manifests deleted
+}
+
+// gc deletes unreferenced chunks older than minAge
+func (f *Fs) gc(ctx context.Context, minAge time.Duration) (*gcStats, error) {
+	var stats gcStats
+
+	// Find the manifests, keeping only the newest for each file
+	latest := make(map[string]fs.Object)
+	var stale []fs.Object
+	err := walk.ListR(ctx, f.manifests, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			remote, _, ok := parseManifestName(o.Remote())
+			if !ok {
+				continue
+			}
+			if old, found := latest[remote]; found {
+				if newerManifest(ctx, old, o) {
+					stale = append(stale, o)
+					continue
+				}
+				stale = append(stale, old)
+			}
+			latest[remote] = o
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return nil, fmt.Errorf("failed to list manifests: %w", err)
+	}
+
+	// Read the manifests to find the chunks in use. Any error here
+	// stops the gc as otherwise chunks in use might be deleted.
+	var (
+		mu   sync.Mutex
+		used = make(map[string]struct{})
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for _, mo := range latest {
+		mo := mo
+		g.Go(func() error {
+			m, err := readManifest(gCtx, mo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", mo.Remote(), err)
+			}
+			mu.Lock()
+			for _, chunk := range m.Chunks {
+				used[chunk.Hash] = struct{}{}
+			}
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+	stats.Manifests = len(latest)
+
+	for _, mo := range stale {
+		fs.Infof(mo, "Removing stale manifest")
+		if err = operations.DeleteFile(ctx, mo); err != nil {
+			return nil, err
+		}
+		stats.StaleManifests++
+	}
+
+	// Delete the unused chunks
+	cutoff := time.Now().Add(-minAge)
+	err = walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			stats.Chunks++
+			stats.ChunkBytes += o.Size()
+			if _, found := used[path.Base(o.Remote())]; found {
+				continue
+			}
+			if o.ModTime(ctx).After(cutoff) {
+				fs.Debugf(o, "Keeping unused chunk as it is younger than min-age")
+				continue
+			}
+			if err := operations.DeleteFile(ctx, o); err != nil {
+				return err
+			}
+			stats.Deleted++
+			stats.DeletedBytes += o.Size()
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return nil, fmt.Errorf("failed to remove chunks: %w", err)
+	}
+
+	// Forget the deleted chunks
+	f.knownMu.Lock()
+	f.known = make(map[string]knownChunk)
+	f.knownMu.Unlock()
+
+	return &stats, nil
+}
@@ -0,0 +1,837 @@
+// Package dedup provides a wrapper which deduplicates file data by
+// splitting it into content defined chunks.
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+// Layout of the wrapped remote
+//
+// Each file is stored as a manifest under filesDir with the size of
+// the file encoded in its name so listings don't need to read the
+// manifests. The manifest lists the chunks which make up the file.
+//
+// Chunks are stored under chunksDir named by the SHA-256 of their
+// contents so identical chunks are only stored once.
+const (
+	filesDir        = "files"
+	chunksDir       = "chunks"
+	manifestExt     = ".dedup"
+	manifestVersion = 1
+)
+
+var manifestRegexp = regexp.MustCompile(`^(.+)\.([A-Za-z0-9-_]{11})` + regexp.QuoteMeta(manifestExt) + `$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "dedup",
+		Description: "Deduplicate a remote using content defined chunking",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to store the deduplicated data in.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "min_chunk_size",
+			Help: `Minimum size of a chunk.
+
+Chunk boundaries are never placed closer together than this, except
+at the end of a file.
+
+Changing the chunk sizes means new files won't share chunks with
+files uploaded before the change.`,
+			Default:  fs.SizeSuffix(256 * 1024),
+			Advanced: true,
+		}, {
+			Name: "avg_chunk_size",
+			Help: `Average size of a chunk.
+
+This must be a power of 2. Smaller chunks find more duplicate data
+but need more objects and longer manifests to store it.`,
+			Default:  fs.SizeSuffix(1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "max_chunk_size",
+			Help: `Maximum size of a chunk.
+
+A chunk boundary is forced after this many bytes if the data didn't
+provide one.`,
+			Default:  fs.SizeSuffix(4 * 1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "upload_concurrency",
+			Help: `Number of chunks of a file to upload concurrently.
+
+Each chunk being uploaded is held in memory so this uses up to
+upload_concurrency * max_chunk_size of memory per transfer.`,
+			Default:  4,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote            string        `config:"remote"`
+	MinChunkSize      fs.SizeSuffix `config:"min_chunk_size"`
+	AvgChunkSize      fs.SizeSuffix `config:"avg_chunk_size"`
+	MaxChunkSize      fs.SizeSuffix `config:"max_chunk_size"`
+	UploadConcurrency int           `config:"upload_concurrency"`
+}
+
+// Fs represents a deduplicated remote
+type Fs struct {
+	fs.Fs                           // the manifests for this root
+	wrapper   fs.Fs                 // wrapper is used by SetWrapper
+	name      string                // name of this remote
+	root      string                // the path we are working on
+	opt       Options               // parsed options
+	features  *fs.Features          // optional features
+	manifests fs.Fs                 // the root of all the manifests
+	chunks    fs.Fs                 // the root of all the chunks
+	knownMu   sync.Mutex            // protects known
+	known     map[string]knownChunk // chunks known to exist by hash
+}
+
+// knownChunk is a chunk known to be stored
+type knownChunk struct {
+	size    int64     // size of the chunk
+	touched time.Time // when the chunk was stored or its age was reset
+}
+
+// knownTTL is how long a chunk is known to be stored without checking
+// again and resetting its age. The gc min-age must be longer than this.
+const knownTTL = 10 * time.Minute
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkChunkSizes(int(opt.MinChunkSize), int(opt.AvgChunkSize), int(opt.MaxChunkSize)); err != nil {
+		return nil, err
+	}
+	if opt.UploadConcurrency < 1 {
+		opt.UploadConcurrency = 1
+	}
+
+	remote := opt.Remote
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point dedup remote at itself - check the value of the remote setting")
+	}
+	wInfo, wName, wPath, wConfig, err := fs.ConfigFs(remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote %q to wrap: %w", remote, err)
+	}
+	newWrappedFs := func(remotePath string) (fs.Fs, error) {
+		f, err := wInfo.NewFs(ctx, wName, remotePath, wConfig)
+		if err != nil && err != fs.ErrorIsFile {
+			return nil, fmt.Errorf("failed to make remote %s:%q to wrap: %w", wName, remotePath, err)
+		}
+		return f, nil
+	}
+
+	// Strip trailing slashes if they exist in rpath
+	rpath = strings.Trim(rpath, "\\/")
+
+	f := &Fs{
+		name:  name,
+		root:  rpath,
+		opt:   *opt,
+		known: make(map[string]knownChunk),
+	}
+	if f.manifests, err = newWrappedFs(fspath.JoinRootPath(wPath, filesDir)); err != nil {
+		return nil, err
+	}
+	if f.chunks, err = newWrappedFs(fspath.JoinRootPath(wPath, chunksDir)); err != nil {
+		return nil, err
+	}
+	if f.Fs, err = newWrappedFs(fspath.JoinRootPath(wPath, path.Join(filesDir, rpath))); err != nil {
+		return nil, err
+	}
+
+	// If the root doesn't exist as a directory check to see if it
+	// is a file
+	isFile := false
+	if rpath != "" {
+		_, listErr := f.Fs.List(ctx, "")
+		if listErr == fs.ErrorDirNotFound {
+			dir, leaf := path.Split(rpath)
+			parent, err := newWrappedFs(fspath.JoinRootPath(wPath, path.Join(filesDir, dir)))
+			if err != nil {
+				return nil, err
+			}
+			if _, err = findManifest(ctx, parent, leaf); err == nil {
+				f.Fs = parent
+				f.root = strings.Trim(dir, "/")
+				isFile = true
+			}
+		}
+	}
+
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from the wrapped fs
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+		PartialUploads:          true,
+	}).Fill(ctx, f).Mask(ctx, f.Fs).WrapsFs(f, f.Fs)
+	// We can always copy a file by writing a new manifest and we
+	// never need to know the size in advance
+	f.features.Copy = f.Copy
+	f.features.PutStream = f.PutStream
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// manifest describes how to reassemble a file from its chunks
+type manifest struct {
+	Version int        `json:"ver"`
+	Size    int64      `json:"size"`
+	Written int64      `json:"written,omitempty"` // when the manifest was written in Unix nanoseconds
+	MD5     string     `json:"md5,omitempty"`
+	SHA1    string     `json:"sha1,omitempty"`
+	Chunks  []chunkRef `json:"chunks"`
+}
+
+// chunkRef is a reference to a chunk from a manifest
+type chunkRef struct {
+	Hash string `json:"h"` // hex SHA-256 of the chunk
+	Size int64  `json:"n"` // size of the chunk
+}
+
+// chunkPath returns the path of the chunk with the hash passed in
+func chunkPath(hash string) string {
+	return hash[:2] + "/" + hash
+}
+
+// Converts an int64 to base64
+func int64ToBase64(number int64) string {
+	intBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(intBytes, uint64(number))
+	return base64.RawURLEncoding.EncodeToString(intBytes)
+}
+
+// Converts base64 to int64
+func base64ToInt64(str string) (int64, error) {
+	intBytes, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(intBytes)), nil
+}
+
+// makeManifestName returns the name of the manifest for the file
+// remote with the size given
+func makeManifestName(remote string, size int64) string {
+	return remote + "." + int64ToBase64(size) + manifestExt
+}
+
+// parseManifestName returns the name and size of the file that the
+// manifest describes
+func parseManifestName(manifestName string) (remote string, size int64, ok bool) {
+	match := manifestRegexp.FindStringSubmatch(manifestName)
+	if match == nil {
+		return "", 0, false
+	}
+	size, err := base64ToInt64(match[2])
+	if err != nil || size < 0 {
+		return "", 0, false
+	}
+	return match[1], size, true
+}
+
+// readManifest reads and decodes the manifest in mo
+func readManifest(ctx context.Context, mo fs.Object) (*manifest, error) {
+	rc, err := mo.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer fs.CheckClose(rc, &err)
+	m := new(manifest)
+	if err = json.NewDecoder(rc).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	var size int64
+	for _, chunk := range m.Chunks {
+		if len(chunk.Hash) != 2*sha256.Size {
+			return nil, fmt.Errorf("invalid chunk hash %q in manifest", chunk.Hash)
+		}
+		size += chunk.Size
+	}
+	if size != m.Size {
+		return nil, fmt.Errorf("manifest chunks total %d bytes but file is %d bytes", size, m.Size)
+	}
+	return m, nil
+}
+
+// newerManifest returns true if a should be used in preference to b
+// when there are several manifests for the same file.
+//
+// The modification time of a manifest is the modification time of the
+// file so this reads the manifests to find which was written last. If
+// one of the manifests can't be read the other is used.
+func newerManifest(ctx context.Context, a, b fs.Object) bool {
+	ma, err := readManifest(ctx, a)
+	if err != nil {
+		fs.Debugf(a, "Ignoring manifest: %v", err)
+		return false
+	}
+	mb, err := readManifest(ctx, b)
+	if err != nil {
+		fs.Debugf(b, "Ignoring manifest: %v", err)
+		return true
+	}
+	if ma.Written != mb.Written {
+		return ma.Written > mb.Written
+	}
+	return a.ModTime(ctx).After(b.ModTime(ctx))
+}
+
+// findManifests finds all the manifests for the file remote in base
+func findManifests(ctx context.Context, base fs.Fs, remote string) (mos []fs.Object, err error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := base.List(ctx, dir)
+	if err == fs.ErrorDirNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		name, _, ok := parseManifestName(o.Remote())
+		if !ok || name != remote {
+			continue
+		}
+		mos = append(mos, o)
+	}
+	return mos, nil
+}
+
+// findManifest finds the manifest for the file remote in base
+func findManifest(ctx context.Context, base fs.Fs, remote string) (mo fs.Object, err error) {
+	mos, err := findManifests(ctx, base, remote)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range mos {
+		if mo == nil || newerManifest(ctx, o, mo) {
+			mo = o
+		}
+	}
+	if mo == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return mo, nil
+}
+
+// processEntries converts the manifests in entries into Objects
+//
+// If there is more than one manifest for a file, which can happen if
+// an upload was interrupted, then the newest is used.
+func (f *Fs) processEntries(ctx context.Context, entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+	newEntries = entries[:0] // in place filter
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			remote, size, ok := parseManifestName(x.Remote())
+			if !ok {
+				fs.Debugf(x, "Ignoring file which isn't a manifest")
+				continue
+			}
+			if i, found := seen[remote]; found {
+				old := newEntries[i].(*Object)
+				fs.Debugf(old, "Found more than one manifest - using the newest")
+				if newerManifest(ctx, x, old.Object) {
+					newEntries[i] = f.newObject(x, remote, size)
+				}
+				continue
+			}
+			seen[remote] = len(newEntries)
+			newEntries = append(newEntries, f.newObject(x, remote, size))
+		case fs.Directory:
+			newEntries = append(newEntries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.Fs.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return f.processEntries(ctx, entries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	do := f.Fs.Features().ListR
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, func(entries fs.DirEntries) error {
+		newEntries, err := f.processEntries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	mo, err := findManifest(ctx, f.Fs, remote)
+	if err != nil {
+		return nil, err
+	}
+	_, size, _ := parseManifestName(mo.Remote())
+	return f.newObject(mo, remote, size), nil
+}
+
+// haveChunk returns true if the chunk is known to be stored already
+//
+// If the chunk was stored by an earlier upload then its modification
+// time is reset so gc treats it as new and keeps it until the
+// manifest using it has been written.
+func (f *Fs) haveChunk(ctx context.Context, ref chunkRef) bool {
+	f.knownMu.Lock()
+	k, found := f.known[ref.Hash]
+	f.knownMu.Unlock()
+	if found && time.Since(k.touched) < knownTTL {
+		return k.size == ref.Size
+	}
+	o, err := f.chunks.NewObject(ctx, chunkPath(ref.Hash))
+	if err != nil || o.Size() != ref.Size {
+		return false
+	}
+	if err = o.SetModTime(ctx, time.Now()); err != nil {
+		fs.Debugf(o, "Uploading chunk again as can't reset its age: %v", err)
+		return false
+	}
+	f.addKnown(ref)
+	return true
+}
+
+// addKnown records that the chunk is stored
+func (f *Fs) addKnown(ref chunkRef) {
+	f.knownMu.Lock()
+	f.known[ref.Hash] = knownChunk{size: ref.Size, touched: time.Now()}
+	f.knownMu.Unlock()
+}
+
+// putChunk stores the chunk if it isn't stored already
+func (f *Fs) putChunk(ctx context.Context, ref chunkRef, data []byte) error {
+	if f.haveChunk(ctx, ref) {
+		return nil
+	}
+	info := object.NewStaticObjectInfo(chunkPath(ref.Hash), time.Now(), ref.Size, true, nil, nil)
+	_, err := f.chunks.Put(ctx, bytes.NewReader(data), info)
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk %s: %w", ref.Hash, err)
+	}
+	f.addKnown(ref)
+	return nil
+}
+
+// upload splits the data read from in into chunks, stores any chunks
+// which aren't stored already and returns the manifest for it.
+func (f *Fs) upload(ctx context.Context, in io.Reader, src fs.ObjectInfo) (*manifest, error) {
+	hasher, err := hash.NewMultiHasherTypes(f.Hashes())
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCDC(io.TeeReader(in, hasher), int(f.opt.MinChunkSize), int(f.opt.AvgChunkSize), int(f.opt.MaxChunkSize))
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{
+		Version: manifestVersion,
+	}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.opt.UploadConcurrency)
+	queued := make(map[string]struct{})
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = g.Wait()
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		ref := chunkRef{
+			Hash: hex.EncodeToString(sum[:]),
+			Size: int64(len(data)),
+		}
+		m.Chunks = append(m.Chunks, ref)
+		m.Size += ref.Size
+		if _, found := queued[ref.Hash]; found {
+			continue
+		}
+		queued[ref.Hash] = struct{}{}
+		data = bytes.Clone(data)
+		g.Go(func() error {
+			return f.putChunk(gCtx, ref, data)
+		})
+		if gCtx.Err() != nil {
+			break
+		}
+	}
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Check the data arrived intact
+	if src.Size() >= 0 && src.Size() != m.Size {
+		return nil, fmt.Errorf("read %d bytes but expecting %d", m.Size, src.Size())
+	}
+	sums := hasher.Sums()
+	for ht, sum := range sums {
+		srcSum, err := src.Hash(ctx, ht)
+		if err == nil && !hash.Equals(srcSum, sum) {
+			return nil, fmt.Errorf("corrupted on transfer: %v hash differ src %q vs dst %q", ht, srcSum, sum)
+		}
+	}
+	m.MD5 = sums[hash.MD5]
+	m.SHA1 = sums[hash.SHA1]
+	return m, nil
+}
+
+// putManifest writes the manifest m for the file remote.
+//
+// The time it is written is recorded in the manifest so the newest
+// can be found if there is more than one.
+//
+// If old is set it is the manifest being replaced.
+func (f *Fs) putManifest(ctx context.Context, remote string, modTime time.Time, m *manifest, old fs.Object, options []fs.OpenOption) (fs.Object, error) {
+	written := *m
+	written.Written = time.Now().UnixNano()
+	data, err := json.Marshal(&written)
+	if err != nil {
+		return nil, err
+	}
+	name := makeManifestName(remote, m.Size)
+	info := object.NewStaticObjectInfo(name, modTime, int64(len(data)), true, nil, f.Fs)
+	if old != nil && old.Remote() == name {
+		err = old.Update(ctx, bytes.NewReader(data), info, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update manifest: %w", err)
+		}
+		return old, nil
+	}
+	mo, err := f.Fs.Put(ctx, bytes.NewReader(data), info, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	if old != nil {
+		if err = old.Remove(ctx); err != nil {
+			return nil, fmt.Errorf("failed to remove old manifest: %w", err)
+		}
+	}
+	return mo, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	m, err := f.upload(ctx, in, src)
+	if err != nil {
+		return nil, err
+	}
+	mo, err := f.putManifest(ctx, src.Remote(), src.ModTime(ctx), m, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	// Remove any manifests for the file with a different size
+	if err = f.removeExisting(ctx, src.Remote(), mo.Remote()); err != nil {
+		return nil, fmt.Errorf("failed to remove old manifest: %w", err)
+	}
+	o := f.newObject(mo, src.Remote(), m.Size)
+	o.m = m
+	return o, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(ctx, in, src, options...)
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Dedup '%s:%s'", f.name, f.root)
+}
+
+// Precision returns the precision of this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.Fs.Precision()
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.NewHashSet(hash.MD5, hash.SHA1)
+}
+
+// sameStore returns true if src stores its chunks in the same place
+// as f so manifests can be shared between them.
+func (f *Fs) sameStore(src *Fs) bool {
+	return fs.ConfigString(f.chunks) == fs.ConfigString(src.chunks)
+}
+
+// removeExisting removes any manifests for the file at remote with a
+// different manifest name to name
+func (f *Fs) removeExisting(ctx context.Context, remote string, name string) error {
+	mos, err := findManifests(ctx, f.Fs, remote)
+	if err != nil {
+		return err
+	}
+	for _, mo := range mos {
+		if mo.Remote() == name {
+			continue
+		}
+		if err = mo.Remove(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This only writes a new manifest as the chunks are shared.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || !f.sameStore(srcObj.f) {
+		fs.Debugf(src, "Can't copy - not same dedup store")
+		return nil, fs.ErrorCantCopy
+	}
+	name := makeManifestName(remote, srcObj.size)
+	if err := f.removeExisting(ctx, remote, name); err != nil {
+		return nil, err
+	}
+	if do := f.Fs.Features().Copy; do != nil {
+		mo, err := do(ctx, srcObj.Object, name)
+		if err == nil {
+			return f.newObject(mo, remote, srcObj.size), nil
+		}
+		if err != fs.ErrorCantCopy {
+			return nil, err
+		}
+	}
+	m, err := srcObj.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mo, err := f.putManifest(ctx, remote, srcObj.ModTime(ctx), m, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(mo, remote, m.Size)
+	o.m = m
+	return o, nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	srcObj, ok := src.(*Object)
+	if !ok || !f.sameStore(srcObj.f) {
+		fs.Debugf(src, "Can't move - not same dedup store")
+		return nil, fs.ErrorCantMove
+	}
+	name := makeManifestName(remote, srcObj.size)
+	if err := f.removeExisting(ctx, remote, name); err != nil {
+		return nil, err
+	}
+	mo, err := do(ctx, srcObj.Object, name)
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(mo, remote, srcObj.size)
+	o.m = srcObj.m
+	return o, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok || !f.sameStore(srcFs) {
+		fs.Debugf(src, "Can't move directory - not same dedup store")
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.Fs, srcRemote, dstRemote)
+}
+
+// Purge all files in the directory specified
+//
+// This only removes the manifests. Use the gc command to remove the
+// chunks which are no longer used.
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do(ctx, dir)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.Fs.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.ListRer     = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.Wrapper     = (*Fs)(nil)
+	_ fs.Commander   = (*Fs)(nil)
+)
@@ -0,0 +1,225 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countChunks returns the number of chunks stored
+func (f *Fs) countChunks(ctx context.Context, t *testing.T) (n int) {
+	err := operations.ListFn(ctx, f.chunks, func(o fs.Object) {
+		n++
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func putFile(ctx context.Context, t *testing.T, f fs.Fs, name string, data []byte) fs.Object {
+	item := fstest.Item{Path: name, ModTime: fstest.Time("2001-02-03T04:05:06.499999999Z")}
+	o := fstests.PutTestContents(ctx, t, f, &item, string(data), true)
+	require.NotNil(t, o)
+	return o
+}
+
+func readAll(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) []byte {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+// Check that files with shared data share chunks and that gc only
+// removes unused chunks
+func (f *Fs) testDedupAndGC(t *testing.T) {
+	ctx := context.Background()
+	// Other tests may have left files so count chunks from here
+	_, err := f.gc(ctx, 0)
+	require.NoError(t, err)
+	n0 := f.countChunks(ctx, t)
+
+	data := make([]byte, 16*int(f.opt.MaxChunkSize))
+	rand.New(rand.NewSource(1)).Read(data)
+	modified := append([]byte("prefix"), data...)
+
+	o1 := putFile(ctx, t, f, "dedup/file1", data)
+	n1 := f.countChunks(ctx, t)
+	assert.Greater(t, n1-n0, 1)
+	o2 := putFile(ctx, t, f, "dedup/file2", modified)
+	n2 := f.countChunks(ctx, t)
+	assert.Less(t, n2-n1, (n1-n0)/2, "expecting most chunks to be shared")
+
+	// Read back whole and in part
+	assert.Equal(t, modified, readAll(ctx, t, o2))
+	start := int64(f.opt.MaxChunkSize) + 17
+	assert.Equal(t, data[start:start+1000], readAll(ctx, t, o1, &fs.RangeOption{Start: start, End: start + 999}))
+
+	// Nothing unused yet
+	stats, err := f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, n2, stats.Chunks)
+	assert.Equal(t, 0, stats.Deleted)
+
+	// Removing a file leaves its chunks until gc
+	require.NoError(t, o2.Remove(ctx))
+	assert.Equal(t, n2, f.countChunks(ctx, t))
+	stats, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, n2-n1, stats.Deleted)
+	assert.Equal(t, n1, f.countChunks(ctx, t))
+
+	// The remaining file is intact
+	o1, err = f.NewObject(ctx, "dedup/file1")
+	require.NoError(t, err)
+	assert.Equal(t, data, readAll(ctx, t, o1))
+
+	require.NoError(t, o1.Remove(ctx))
+	_, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, n0, f.countChunks(ctx, t))
+	require.NoError(t, f.Rmdir(ctx, "dedup"))
+}
+
+// Check that corrupted chunks are detected
+func (f *Fs) testCorruptChunk(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("corrupt "), 1000)
+	o := putFile(ctx, t, f, "corrupt", data)
+	m, err := o.(*Object).manifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, m.Chunks, 1)
+
+	// Overwrite the chunk with the same sized data
+	chunk, err := f.chunks.NewObject(ctx, chunkPath(m.Chunks[0].Hash))
+	require.NoError(t, err)
+	bad := bytes.Repeat([]byte("CORRUPT "), 1000)
+	_ = putFile(ctx, t, f.chunks, chunk.Remote(), bad)
+
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(in)
+	assert.ErrorContains(t, err, "corrupted")
+	require.NoError(t, in.Close())
+
+	require.NoError(t, o.Remove(ctx))
+	_, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+}
+
+// Check that the manifest written last is used whatever the
+// modification times of the files
+func (f *Fs) testStaleManifest(t *testing.T) {
+	ctx := context.Background()
+	later := fstest.Time("2030-01-01T00:00:00Z")
+	earlier := fstest.Time("2001-02-03T04:05:06Z")
+	countManifests := func(remote string) int {
+		mos, err := findManifests(ctx, f.Fs, remote)
+		require.NoError(t, err)
+		return len(mos)
+	}
+
+	// Putting a file with a different size replaces the old manifest
+	item := fstest.Item{Path: "stale", ModTime: later}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "old contents", true)
+	item = fstest.Item{Path: "stale", ModTime: earlier}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "new contents which are longer", true)
+	assert.Equal(t, 1, countManifests("stale"))
+	o, err := f.NewObject(ctx, "stale")
+	require.NoError(t, err)
+	assert.Equal(t, "new contents which are longer", string(readAll(ctx, t, o)))
+
+	// If there are several manifests the last written is used
+	item = fstest.Item{Path: "stale", ModTime: later}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "old contents", true)
+	data := []byte("new contents which are longer")
+	m, err := f.upload(ctx, bytes.NewReader(data), object.NewStaticObjectInfo("stale", earlier, int64(len(data)), true, nil, nil))
+	require.NoError(t, err)
+	_, err = f.putManifest(ctx, "stale", earlier, m, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, countManifests("stale"))
+	o, err = f.NewObject(ctx, "stale")
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(readAll(ctx, t, o)))
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if entry.Remote() == "stale" {
+			assert.Equal(t, int64(len(data)), entry.Size())
+		}
+	}
+
+	// gc removes the stale manifest
+	stats, err := f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.StaleManifests)
+	assert.Equal(t, 1, countManifests("stale"))
+
+	require.NoError(t, o.Remove(ctx))
+	_, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+}
+
+// Check that gc doesn't remove old unused chunks which an upload in
+// progress is using again
+func (f *Fs) testReusedChunk(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 4*int(f.opt.MaxChunkSize))
+	rand.New(rand.NewSource(2)).Read(data)
+	o := putFile(ctx, t, f, "reuse/file1", data)
+	m, err := o.(*Object).manifest(ctx)
+	require.NoError(t, err)
+
+	// Leave the chunks unused and older than min-age
+	require.NoError(t, o.Remove(ctx))
+	old := time.Now().Add(-2 * time.Hour)
+	for _, chunk := range m.Chunks {
+		co, err := f.chunks.NewObject(ctx, chunkPath(chunk.Hash))
+		require.NoError(t, err)
+		require.NoError(t, co.SetModTime(ctx, old))
+	}
+	f.knownMu.Lock()
+	f.known = make(map[string]knownChunk)
+	f.knownMu.Unlock()
+
+	// gc runs between uploading the chunks and writing the manifest
+	modTime := fstest.Time("2001-02-03T04:05:06Z")
+	src := object.NewStaticObjectInfo("reuse/file2", modTime, int64(len(data)), true, nil, nil)
+	m, err = f.upload(ctx, bytes.NewReader(data), src)
+	require.NoError(t, err)
+	_, err = f.gc(ctx, time.Hour)
+	require.NoError(t, err)
+	_, err = f.putManifest(ctx, src.Remote(), modTime, m, nil, nil)
+	require.NoError(t, err)
+
+	o, err = f.NewObject(ctx, "reuse/file2")
+	require.NoError(t, err)
+	assert.Equal(t, data, readAll(ctx, t, o))
+
+	require.NoError(t, o.Remove(ctx))
+	_, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Rmdir(ctx, "reuse"))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("DedupAndGC", f.testDedupAndGC)
+	t.Run("CorruptChunk", f.testCorruptChunk)
+	t.Run("StaleManifest", f.testStaleManifest)
+	t.Run("ReusedChunk", f.testReusedChunk)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,66 @@
+// Test Dedup filesystem interface
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestDedup:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"DirCacheFlush",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"Shutdown",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"MimeType",
+		"ID",
+		"GetTier",
+		"SetTier",
+		"Metadata",
+		"SetMetadata",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	fstests.Run(t, &defaultOpt)
+}
+
+// TestRemoteLocal tests dedup on the local filesystem with small chunks
+func TestRemoteLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-dedup-test")
+	name := "TestDedupLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "dedup"},
+		{Name: name, Key: "remote", Value: tempdir},
+		{Name: name, Key: "min_chunk_size", Value: "1k"},
+		{Name: name, Key: "avg_chunk_size", Value: "4k"},
+		{Name: name, Key: "max_chunk_size", Value: "16k"},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
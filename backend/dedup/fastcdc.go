@@ -0,0 +1,147 @@
+package dedup
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// gear is the table of random values for the gear rolling hash.
+//
+// It is generated from a fixed seed as the chunk boundaries, and so
+// how well data is deduplicated, depend on it. It must never change.
+var gear = func() (table [256]uint64) {
+	// splitmix64
+	x := uint64(0x5eed_dedb_ca11_ab1e)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cdc splits a stream into content defined chunks using FastCDC
+// with normalized chunking.
+//
+// The chunk boundaries depend only on the data near them, so data
+// inserted or removed in one place only changes the chunks around
+// it. This means files which share most of their data share most of
+// their chunks.
+type cdc struct {
+	in      io.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // mask used before avgSize - harder to match
+	maskL   uint64 // mask used after avgSize - easier to match
+	buf     []byte // buffered data
+	start   int    // start of unreturned data in buf
+	end     int    // end of data in buf
+	err     error  // error from reading in, returned once buf is empty
+}
+
+// checkChunkSizes checks the chunk sizes are usable
+//
+// avgSize must be a power of 2 and minSize <= avgSize <= maxSize.
+func checkChunkSizes(minSize, avgSize, maxSize int) error {
+	if minSize <= 0 || avgSize <= 0 || maxSize <= 0 {
+		return errors.New("chunk sizes must be positive")
+	}
+	if avgSize&(avgSize-1) != 0 {
+		return errors.New("average chunk size must be a power of 2")
+	}
+	if minSize > avgSize || avgSize > maxSize {
+		return errors.New("chunk sizes must satisfy min <= avg <= max")
+	}
+	return nil
+}
+
+// newCDC makes a new content defined chunker reading from in
+func newCDC(in io.Reader, minSize, avgSize, maxSize int) (*cdc, error) {
+	if err := checkChunkSizes(minSize, avgSize, maxSize); err != nil {
+		return nil, err
+	}
+	avgBits := bits.TrailingZeros(uint(avgSize))
+	return &cdc{
+		in:      in,
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   topBits(avgBits + 1),
+		maskL:   topBits(avgBits - 1),
+		buf:     make([]byte, 2*maxSize),
+	}, nil
+}
+
+// topBits returns a mask with the top n bits set
+//
+// The top bits of the gear hash depend on the previous 64 bytes
+// whereas the bottom bits depend only on the last few.
+func topBits(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// cut returns the length of the first chunk in data
+func (c *cdc) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	normal := c.avgSize
+	if n < normal {
+		normal = n
+	}
+	var fp uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i
+		}
+	}
+	return n
+}
+
+// next returns the next chunk of data or io.EOF if there are no more
+//
+// The returned slice is only valid until the next call.
+func (c *cdc) next() ([]byte, error) {
+	// Make sure there is a maximum sized chunk in the buffer if possible
+	if c.end-c.start < c.maxSize && c.err == nil {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+		var n int
+		n, c.err = readers.ReadFill(c.in, c.buf[c.end:])
+		c.end += n
+	}
+	if c.start == c.end {
+		if c.err == nil || c.err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, c.err
+	}
+	if c.err != nil && c.err != io.EOF {
+		return nil, c.err
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
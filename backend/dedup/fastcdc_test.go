@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkAll splits data into chunks returning copies of them
+func chunkAll(t *testing.T, data []byte, minSize, avgSize, maxSize int) (chunks [][]byte) {
+	c, err := newCDC(bytes.NewReader(data), minSize, avgSize, maxSize)
+	require.NoError(t, err)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+	return chunks
+}
+
+func TestCheckChunkSizes(t *testing.T) {
+	for _, test := range []struct {
+		min, avg, max int
+		ok            bool
+	}{
+		{1024, 4096, 16384, true},
+		{4096, 4096, 4096, true},
+		{0, 4096, 16384, false},
+		{1024, 3000, 16384, false},
+		{8192, 4096, 16384, false},
+		{1024, 4096, 2048, false},
+	} {
+		err := checkChunkSizes(test.min, test.avg, test.max)
+		assert.Equal(t, test.ok, err == nil, "%+v: %v", test, err)
+	}
+}
+
+func TestCDC(t *testing.T) {
+	const minSize, avgSize, maxSize = 1024, 4096, 16384
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := chunkAll(t, data, minSize, avgSize, maxSize)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), maxSize)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), minSize)
+		}
+	}
+	// The average should be roughly right
+	avg := len(data) / len(chunks)
+	assert.Greater(t, avg, avgSize/2)
+	assert.Less(t, avg, avgSize*2)
+
+	// Chunking is deterministic
+	assert.Equal(t, chunks, chunkAll(t, data, minSize, avgSize, maxSize))
+
+	// Inserting data near the start only changes the chunks near it
+	shifted := append([]byte("inserted"), data...)
+	seen := make(map[string]struct{}, len(chunks))
+	for _, chunk := range chunks {
+		seen[string(chunk)] = struct{}{}
+	}
+	shared := 0
+	for _, chunk := range chunkAll(t, shifted, minSize, avgSize, maxSize) {
+		if _, found := seen[string(chunk)]; found {
+			shared++
+		}
+	}
+	assert.Greater(t, shared, len(chunks)-3)
+}
+
+func TestCDCSmall(t *testing.T) {
+	assert.Empty(t, chunkAll(t, nil, 1024, 4096, 16384))
+	assert.Equal(t, [][]byte{[]byte("hello")}, chunkAll(t, []byte("hello"), 1024, 4096, 16384))
+
+	// Data with no boundaries is cut at the maximum size
+	chunks := chunkAll(t, make([]byte, 40000), 1024, 4096, 16384)
+	require.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 16384)
+	assert.Len(t, chunks[1], 16384)
+	assert.Len(t, chunks[2], 40000-2*16384)
+}
@@ -0,0 +1,263 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// Object represents a file stored as a manifest and chunks
+type Object struct {
+	fs.Object            // the manifest
+	f         *Fs        // the Fs this object is part of
+	remote    string     // the path of the file
+	size      int64      // size of the file
+	mu        sync.Mutex // protects m
+	m         *manifest  // the manifest, read on demand
+}
+
+// newObject makes an Object from the manifest object mo
+func (f *Fs) newObject(mo fs.Object, remote string, size int64) *Object {
+	return &Object{
+		Object: mo,
+		f:      f,
+		remote: remote,
+		size:   size,
+	}
+}
+
+// manifest returns the manifest for the object reading it if necessary
+func (o *Object) manifest(ctx context.Context) (*manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.m != nil {
+		return o.m, nil
+	}
+	m, err := readManifest(ctx, o.Object)
+	if err != nil {
+		return nil, err
+	}
+	if m.Size != o.size {
+		return nil, fmt.Errorf("manifest is for a file of %d bytes but expecting %d", m.Size, o.size)
+	}
+	o.m = m
+	return m, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.MD5 && ht != hash.SHA1 {
+		return "", hash.ErrUnsupported
+	}
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ht == hash.MD5 {
+		return m.MD5, nil
+	}
+	return m.SHA1, nil
+}
+
+// UnWrap returns the manifest Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readers.NewLimitedReadCloser(newChunkReader(ctx, o.f, m.Chunks, offset), limit), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	m, err := o.f.upload(ctx, in, src)
+	if err != nil {
+		return err
+	}
+	mo, err := o.f.putManifest(ctx, o.remote, src.ModTime(ctx), m, o.Object, options)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.Object = mo
+	o.size = m.Size
+	o.m = m
+	o.mu.Unlock()
+	return nil
+}
+
+var errReaderClosed = errors.New("read on closed file")
+
+// chunkReader reads the data of a file from its chunks
+type chunkReader struct {
+	ctx    context.Context
+	f      *Fs
+	chunks []chunkRef    // chunks still to read
+	skip   int64         // bytes to skip at the start of the first chunk
+	ref    chunkRef      // the chunk being read
+	rc     io.ReadCloser // the chunk being read or nil
+	n      int64         // bytes read from the current chunk
+	hasher gohash.Hash   // SHA-256 of the current chunk if reading all of it
+	err    error         // sticky error
+	closed bool          // set if Close has been called
+}
+
+// newChunkReader returns a reader for the data in chunks starting at
+// offset
+func newChunkReader(ctx context.Context, f *Fs, chunks []chunkRef, offset int64) *chunkReader {
+	for len(chunks) > 0 && offset >= chunks[0].Size {
+		offset -= chunks[0].Size
+		chunks = chunks[1:]
+	}
+	return &chunkReader{
+		ctx:    ctx,
+		f:      f,
+		chunks: chunks,
+		skip:   offset,
+	}
+}
+
+// openChunk opens the next chunk for reading
+func (cr *chunkReader) openChunk() error {
+	cr.ref, cr.chunks = cr.chunks[0], cr.chunks[1:]
+	o, err := cr.f.chunks.NewObject(cr.ctx, chunkPath(cr.ref.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to find chunk %s: %w", cr.ref.Hash, err)
+	}
+	var options []fs.OpenOption
+	cr.hasher = nil
+	if cr.skip > 0 {
+		options = append(options, &fs.SeekOption{Offset: cr.skip})
+	} else {
+		cr.hasher = sha256.New()
+	}
+	cr.rc, err = o.Open(cr.ctx, options...)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk %s: %w", cr.ref.Hash, err)
+	}
+	cr.n = cr.skip
+	cr.skip = 0
+	return nil
+}
+
+// finishChunk closes the current chunk checking it was read correctly
+func (cr *chunkReader) finishChunk() error {
+	err := cr.rc.Close()
+	cr.rc = nil
+	if err != nil {
+		return err
+	}
+	if cr.n != cr.ref.Size {
+		return fmt.Errorf("chunk %s is corrupted: read %d bytes but expecting %d", cr.ref.Hash, cr.n, cr.ref.Size)
+	}
+	if cr.hasher != nil {
+		if sum := hex.EncodeToString(cr.hasher.Sum(nil)); sum != cr.ref.Hash {
+			return fmt.Errorf("chunk %s is corrupted: SHA-256 is %s", cr.ref.Hash, sum)
+		}
+	}
+	return nil
+}
+
+// Read reads data from the chunks into p
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	for cr.err == nil {
+		if cr.rc == nil {
+			if len(cr.chunks) == 0 {
+				cr.err = io.EOF
+				break
+			}
+			if cr.err = cr.openChunk(); cr.err != nil {
+				break
+			}
+		}
+		n, err = cr.rc.Read(p)
+		cr.n += int64(n)
+		if cr.hasher != nil {
+			_, _ = cr.hasher.Write(p[:n])
+		}
+		if err == io.EOF {
+			cr.err = cr.finishChunk()
+			err = nil
+		} else if err != nil {
+			cr.err = err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, cr.err
+}
+
+// Close closes the chunk being read
+func (cr *chunkReader) Close() error {
+	if cr.closed {
+		return nil
+	}
+	cr.closed = true
+	if cr.err == nil {
+		cr.err = errReaderClosed
+	}
+	if cr.rc != nil {
+		err := cr.rc.Close()
+		cr.rc = nil
+		return err
+	}
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
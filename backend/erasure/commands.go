@@ -0,0 +1,206 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "heal":
+		_, verify := opt["verify"]
+		return f.heal(ctx, verify)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "heal",
+	Short: "Rebuild missing or damaged shards",
+	Long: `This checks every file under the path given and rebuilds any shards
+which are missing or the wrong size from the other shards. Use it after
+replacing a failed upstream with an empty one or after an upload was
+interrupted.
+
+With the verify option every shard is read in full and any with blocks
+which fail their checksum are rebuilt too. This reads all the data so
+may take a long time.
+
+Sets of shards left behind by interrupted uploads which aren't used
+are deleted.
+
+Usage Example:
+
+    rclone backend heal erasure:
+    rclone backend heal erasure:path/to/dir -o verify
+
+Use --dry-run to see what would be rebuilt and deleted.
+`,
+	Opts: map[string]string{
+		"verify": "Read all the shards to find corrupted blocks",
+	},
+}}
+
+// healStats is returned by the heal command
+type healStats struct {
+	Files    int `json:"files"`    // number of files checked
+	Healed   int `json:"healed"`   // number of files with shards rebuilt
+	Shards   int `json:"shards"`   // number of shards rebuilt
+	Stale    int `json:"stale"`    // number of stale shards deleted
+	Failed   int `json:"failed"`   // number of files which couldn't be healed
+	Degraded int `json:"degraded"` // number of files still missing shards
+}
+
+// heal rebuilds the missing shards of all the files under the root
+func (f *Fs) heal(ctx context.Context, verify bool) (*healStats, error) {
+	var (
+		stats healStats
+		mu    sync.Mutex
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	var walkDir func(dir string) error
+	walkDir = func(dir string) error {
+		entries, stale, err := f.list(ctx, dir)
+		if err != nil {
+			return err
+		}
+		for _, o := range stale {
+			for _, shard := range o.shards {
+				if shard == nil {
+					continue
+				}
+				if err := operations.DeleteFile(ctx, shard); err != nil {
+					return err
+				}
+				mu.Lock()
+				stats.Stale++
+				mu.Unlock()
+			}
+		}
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case *Object:
+				o := x
+				g.Go(func() error {
+					rebuilt, err := f.healObject(gCtx, o, verify)
+					mu.Lock()
+					defer mu.Unlock()
+					stats.Files++
+					if rebuilt > 0 {
+						stats.Healed++
+						stats.Shards += rebuilt
+					}
+					if err != nil {
+						fs.Errorf(o, "Failed to heal: %v", err)
+						stats.Failed++
+					}
+					if o.present() < len(f.upstreams) {
+						stats.Degraded++
+					}
+					return nil
+				})
+			case fs.Directory:
+				if err := walkDir(x.Remote()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walkDir("")
+	if waitErr := g.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stats.Failed > 0 {
+		return &stats, fmt.Errorf("failed to heal %d files", stats.Failed)
+	}
+	return &stats, nil
+}
+
+// healObject rebuilds the shards of o which are missing or damaged
+// returning the number rebuilt
+func (f *Fs) healObject(ctx context.Context, o *Object, verify bool) (rebuilt int, err error) {
+	h, err := o.readHeader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if h.n() != len(f.upstreams) {
+		return 0, fmt.Errorf("file has %d shards but there are %d upstreams", h.n(), len(f.upstreams))
+	}
+	exclude := make([]bool, h.n())
+	var indices []int
+	for i, shard := range o.shards {
+		switch {
+		case shard == nil:
+			fs.Infof(o, "Shard %d is missing", i+1)
+		case shard.Size() != h.shardSize():
+			fs.Infof(o, "Shard %d is %d bytes but expecting %d", i+1, shard.Size(), h.shardSize())
+		case verify:
+			if err := verifyShard(ctx, shard, h, i); err != nil {
+				fs.Infof(o, "Shard %d is corrupted: %v", i+1, err)
+			} else {
+				continue
+			}
+		default:
+			continue
+		}
+		if f.upstreams[i] == nil {
+			fs.Errorf(o, "Can't rebuild shard %d as its upstream is unavailable", i+1)
+			continue
+		}
+		exclude[i] = true
+		indices = append(indices, i)
+	}
+	if len(indices) == 0 {
+		fs.Debugf(o, "All shards OK")
+		return 0, nil
+	}
+	if operations.SkipDestructive(ctx, o, fmt.Sprintf("rebuild %d shards", len(indices))) {
+		return 0, nil
+	}
+
+	footer, err := o.readFooter(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sr, err := newStripeReader(ctx, o, h, 0, -1, exclude)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(sr, &err)
+	shards, hashes, err := f.putShards(ctx, sr, o.remote, h, o.ModTime(ctx), indices, o.shards, nil)
+	if err != nil {
+		return 0, err
+	}
+	if hashes[hash.MD5] != footer.md5 || hashes[hash.SHA1] != footer.sha1 {
+		return 0, errors.New("rebuilt data doesn't match the hashes of the file")
+	}
+	o.mu.Lock()
+	for _, i := range indices {
+		o.shards[i] = shards[i]
+	}
+	o.mu.Unlock()
+	fs.Infof(o, "Rebuilt %d shards", len(indices))
+	return len(indices), nil
+}
@@ -0,0 +1,815 @@
+// Package erasure provides an Fs which erasure codes files across
+// several upstream remotes.
+package erasure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+// shardExt is the extension of the shard files. The shards have the
+// size of the file base64 encoded before this, so listings don't need
+// to read the shards.
+const shardExt = ".ec"
+
+var shardNameRegexp = regexp.MustCompile(`^(.+)\.([A-Za-z0-9-_]{11})` + regexp.QuoteMeta(shardExt) + `$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "erasure",
+		Description: "Erasure code files across several remotes",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `List of space separated upstreams.
+
+Each file is split into shards with one shard stored on each upstream.
+
+Can be 'remotea:dir remoteb:dir remotec:dir', '"remotea:dir with space" remoteb:', etc.
+
+The order of the upstreams matters - don't change it once files
+have been written. An upstream may be replaced with an empty one which
+can then be filled with the heal command.`,
+			Required: true,
+			Default:  fs.SpaceSepList(nil),
+		}, {
+			Name: "parity_shards",
+			Help: `Number of parity shards.
+
+This is the number of upstreams which can be lost or corrupted
+without losing data. The remaining upstreams hold the data shards.
+
+Any number of data shards can be read back whatever this is set to,
+as the shard counts are stored in each shard.`,
+			Default: 1,
+		}, {
+			Name: "block_size",
+			Help: `Size of the blocks the shards are written in.
+
+Files are encoded in stripes of this size times the number of data
+shards. Each block is checksummed so corruption is detected at this
+granularity.`,
+			Default:  fs.SizeSuffix(256 * 1024),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams    fs.SpaceSepList `config:"upstreams"`
+	ParityShards int             `config:"parity_shards"`
+	BlockSize    fs.SizeSuffix   `config:"block_size"`
+}
+
+// Fs represents an erasure coded remote
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	opt       Options      // parsed options
+	features  *fs.Features // optional features
+	upstreams []fs.Fs      // one for each shard, nil if not available
+	k         int          // number of data shards
+	m         int          // number of parity shards
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(opt.Upstreams)
+	if opt.ParityShards < 1 {
+		return nil, errors.New("erasure needs at least 1 parity shard - check the value of parity_shards")
+	}
+	if n <= opt.ParityShards {
+		return nil, fmt.Errorf("erasure needs more than %d upstreams for %d parity shards - check the value of the upstreams setting", opt.ParityShards, opt.ParityShards)
+	}
+	if n > maxShards {
+		return nil, fmt.Errorf("erasure can't use more than %d upstreams", maxShards)
+	}
+	if opt.BlockSize < 4096 || opt.BlockSize > 64*1024*1024 {
+		return nil, errors.New("block_size must be between 4 KiB and 64 MiB")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the upstreams setting")
+		}
+	}
+
+	f := &Fs{
+		name: name,
+		root: strings.Trim(root, "/"),
+		opt:  *opt,
+		k:    n - opt.ParityShards,
+		m:    opt.ParityShards,
+	}
+	// If the root is a file then use its parent as the root
+	isFile := false
+	if f.root != "" {
+		dir, leaf := path.Split(f.root)
+		if err = f.setRoot(ctx, strings.Trim(dir, "/")); err != nil {
+			return nil, err
+		}
+		_, err = f.NewObject(ctx, leaf)
+		isFile = err == nil
+	}
+	if !isFile {
+		if err = f.setRoot(ctx, strings.Trim(root, "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from the upstreams
+	features := (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+		PartialUploads:          true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		if u != nil {
+			features = features.Mask(ctx, u)
+		}
+	}
+	f.features = features
+
+	// Keep the upstreams in the cache while this Fs is in use
+	for _, u := range f.upstreams {
+		if u != nil {
+			cache.Pin(u)
+		}
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			if u != nil {
+				cache.Unpin(u)
+			}
+		}
+	})
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// setRoot makes the upstreams for root
+//
+// Upstreams which can't be made are logged and left as nil as long
+// as there are enough left to read the files.
+func (f *Fs) setRoot(ctx context.Context, root string) error {
+	f.root = root
+	f.upstreams = make([]fs.Fs, len(f.opt.Upstreams))
+	errs := make([]error, len(f.opt.Upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.opt.Upstreams {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			remote := fspath.JoinRootPath(u, root)
+			uFs, err := cache.Get(ctx, remote)
+			if err == fs.ErrorIsFile {
+				err = fmt.Errorf("upstream %q is a file", remote)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to create upstream %q: %w", remote, err)
+				return
+			}
+			f.upstreams[i] = uFs
+		}(i, u)
+	}
+	wg.Wait()
+	return f.checkErrors(errs, "")
+}
+
+// checkErrors logs the errors from the upstreams returning an error
+// if there are too many to read files.
+func (f *Fs) checkErrors(errs []error, what string) error {
+	failed := 0
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			lastErr = err
+			fs.Errorf(f, "upstream %d %s: %v", i+1, what, err)
+		}
+	}
+	if failed > f.m {
+		return fmt.Errorf("%d upstreams failed which is more than the %d parity shards: %w", failed, f.m, lastErr)
+	}
+	return nil
+}
+
+// forEach calls fn for each upstream concurrently, returning an error
+// for each one. Missing upstreams return an error.
+func (f *Fs) forEach(ctx context.Context, fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		if u == nil {
+			errs[i] = errUpstreamUnavailable
+			continue
+		}
+		wg.Add(1)
+		go func(i int, u fs.Fs) {
+			defer wg.Done()
+			errs[i] = fn(i, u)
+		}(i, u)
+	}
+	wg.Wait()
+	return errs
+}
+
+// errUpstreamUnavailable is returned for upstreams which couldn't be created
+var errUpstreamUnavailable = errors.New("upstream unavailable")
+
+// firstError returns the first error in errs with the upstream number
+func firstError(errs []error) error {
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("upstream %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Converts an int64 to base64
+func int64ToBase64(number int64) string {
+	intBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(intBytes, uint64(number))
+	return base64.RawURLEncoding.EncodeToString(intBytes)
+}
+
+// Converts base64 to int64
+func base64ToInt64(str string) (int64, error) {
+	intBytes, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(intBytes)), nil
+}
+
+// makeShardName returns the name of the shards for the file remote
+// with the size given
+func makeShardName(remote string, size int64) string {
+	return remote + "." + int64ToBase64(size) + shardExt
+}
+
+// parseShardName returns the name and size of the file that the shard
+// is part of
+func parseShardName(shardName string) (remote string, size int64, ok bool) {
+	match := shardNameRegexp.FindStringSubmatch(shardName)
+	if match == nil {
+		return "", 0, false
+	}
+	size, err := base64ToInt64(match[2])
+	if err != nil || size < 0 {
+		return "", 0, false
+	}
+	return match[1], size, true
+}
+
+// merge combines the entries listed from each upstream into the
+// entries for this Fs
+//
+// If a file has more than one set of shards, which can happen if an
+// upload was interrupted, the set with most shards is used, then the
+// newest. The other sets are returned as stale.
+func (f *Fs) merge(ctx context.Context, entries []fs.DirEntries) (out fs.DirEntries, stale []*Object, err error) {
+	var (
+		objects = make(map[string]*Object) // by shard name
+		files   = make(map[string]*Object) // by remote
+		dirs    = make(map[string]struct{})
+	)
+	for i, upstreamEntries := range entries {
+		for _, entry := range upstreamEntries {
+			switch x := entry.(type) {
+			case fs.Object:
+				remote, size, ok := parseShardName(x.Remote())
+				if !ok {
+					fs.Debugf(x, "Ignoring file which isn't a shard")
+					continue
+				}
+				o := objects[x.Remote()]
+				if o == nil {
+					o = f.newObject(remote, size)
+					objects[x.Remote()] = o
+				}
+				o.shards[i] = x
+			case fs.Directory:
+				if _, found := dirs[x.Remote()]; !found {
+					dirs[x.Remote()] = struct{}{}
+					out = append(out, x)
+				}
+			default:
+				return nil, nil, fmt.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	for _, o := range objects {
+		old := files[o.remote]
+		switch {
+		case old == nil:
+			files[o.remote] = o
+		case o.better(ctx, old):
+			files[o.remote] = o
+			stale = append(stale, old)
+		default:
+			stale = append(stale, o)
+		}
+	}
+	for _, o := range files {
+		out = append(out, o)
+	}
+	return out, stale, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	entries, stale, err := f.list(ctx, dir)
+	for _, o := range stale {
+		fs.Debugf(o, "Ignoring incomplete or older set of shards - run the heal command to remove")
+	}
+	return entries, err
+}
+
+// list the directory returning the files and any stale sets of shards
+func (f *Fs) list(ctx context.Context, dir string) (fs.DirEntries, []*Object, error) {
+	entries := make([]fs.DirEntries, len(f.upstreams))
+	found := false
+	var mu sync.Mutex
+	errs := f.forEach(ctx, func(i int, u fs.Fs) (err error) {
+		entries[i], err = u.List(ctx, dir)
+		if err == fs.ErrorDirNotFound {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			found = true
+			mu.Unlock()
+		}
+		return err
+	})
+	if err := f.checkErrors(errs, "list"); err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fs.ErrorDirNotFound
+	}
+	return f.merge(ctx, entries)
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.List(ctx, dir)
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if o, ok := entry.(*Object); ok && o.remote == remote {
+			return o, nil
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// newHeader makes the header for a new upload of a file of size bytes
+func (f *Fs) newHeader(size int64) (*shardHeader, error) {
+	h := &shardHeader{
+		layout: layout{
+			k:         f.k,
+			m:         f.m,
+			blockSize: int64(f.opt.BlockSize),
+			size:      size,
+		},
+	}
+	if _, err := io.ReadFull(rand.Reader, h.id[:]); err != nil {
+		return nil, fmt.Errorf("failed to make upload ID: %w", err)
+	}
+	return h, nil
+}
+
+// putShards encodes the data from in and uploads the shards in
+// indices for the file remote.
+//
+// old are the existing shards of the file, if any, indexed by shard
+// number. Shards with the same name as the new ones are updated
+// rather than uploaded.
+//
+// It returns the shards written and the hashes of the data.
+func (f *Fs) putShards(ctx context.Context, in io.Reader, remote string, h *shardHeader, modTime time.Time, indices []int, old []fs.Object, options []fs.OpenOption) (shards []fs.Object, hashes map[hash.Type]string, err error) {
+	name := makeShardName(remote, h.size)
+	shards = make([]fs.Object, h.n())
+	writers := make([]io.Writer, h.n())
+	var pipes []*io.PipeWriter
+	isUpdate := func(i int) bool {
+		return old != nil && old[i] != nil && old[i].Remote() == name
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	for _, i := range indices {
+		u := f.upstreams[i]
+		if u == nil {
+			return nil, nil, fmt.Errorf("upstream %d: %w", i+1, errUpstreamUnavailable)
+		}
+		i := i
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		pipes = append(pipes, pw)
+		info := object.NewStaticObjectInfo(name, modTime, h.shardSize(), true, nil, u)
+		g.Go(func() (err error) {
+			if isUpdate(i) {
+				err = old[i].Update(gCtx, pr, info, options...)
+				if err == nil {
+					shards[i] = old[i]
+				}
+			} else {
+				shards[i], err = u.Put(gCtx, pr, info, options...)
+			}
+			if err != nil {
+				err = fmt.Errorf("upstream %d: %w", i+1, err)
+			}
+			// Make sure the encoder doesn't block if we stopped reading
+			_ = pr.CloseWithError(err)
+			return err
+		})
+	}
+	hashes, encodeErr := h.encode(in, writers)
+	for _, pw := range pipes {
+		_ = pw.CloseWithError(encodeErr)
+	}
+	err = g.Wait()
+	if err == nil {
+		err = encodeErr
+	}
+	if err != nil {
+		// Remove any new shards so they don't get mixed up with others
+		for _, i := range indices {
+			if shards[i] != nil && !isUpdate(i) {
+				if removeErr := shards[i].Remove(ctx); removeErr != nil && removeErr != fs.ErrorObjectNotFound {
+					fs.Errorf(shards[i], "Failed to remove shard after failed upload: %v", removeErr)
+				}
+			}
+		}
+		return nil, nil, err
+	}
+	return shards, hashes, nil
+}
+
+// put uploads all the shards of a file, replacing the shards in old
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, old []fs.Object, options []fs.OpenOption) (*Object, error) {
+	size := src.Size()
+	if size < 0 {
+		return nil, errors.New("erasure can't upload files of unknown size")
+	}
+	h, err := f.newHeader(size)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]int, h.n())
+	for i := range indices {
+		indices[i] = i
+	}
+	shards, hashes, err := f.putShards(ctx, in, remote, h, src.ModTime(ctx), indices, old, options)
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(remote, size)
+	o.shards = shards
+	o.header = h
+	o.footer = &shardFooter{
+		md5:  hashes[hash.MD5],
+		sha1: hashes[hash.SHA1],
+	}
+
+	// Check the data arrived intact
+	for ht, sum := range hashes {
+		srcSum, err := src.Hash(ctx, ht)
+		if err == nil && !hash.Equals(srcSum, sum) {
+			removeErr := o.Remove(ctx)
+			if removeErr != nil {
+				fs.Errorf(o, "Failed to remove corrupted file: %v", removeErr)
+			}
+			return nil, fmt.Errorf("corrupted on transfer: %v hash differ src %q vs dst %q", ht, srcSum, sum)
+		}
+	}
+
+	// Remove the old shards if they had a different name
+	name := makeShardName(remote, size)
+	for _, shard := range old {
+		if shard != nil && shard.Remote() != name {
+			if err := shard.Remove(ctx); err != nil {
+				fs.Errorf(shard, "Failed to remove old shard: %v", err)
+			}
+		}
+	}
+	return o, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, src.Remote(), nil, options)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return firstError(f.forEach(ctx, func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	}))
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	found := false
+	var mu sync.Mutex
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		err := u.Rmdir(ctx, dir)
+		if err == fs.ErrorDirNotFound {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			found = true
+			mu.Unlock()
+		}
+		return err
+	})
+	if err := firstError(errs); err != nil {
+		return err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Purge all files in the directory specified
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	found := false
+	var mu sync.Mutex
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		err := u.Features().Purge(ctx, dir)
+		if err == fs.ErrorDirNotFound {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			found = true
+			mu.Unlock()
+		}
+		return err
+	})
+	if err := firstError(errs); err != nil {
+		return err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// transferShards copies or moves the shards of src to remote using
+// do on each upstream.
+//
+// If any fail then undo is called on the ones which succeeded.
+func (f *Fs) transferShards(ctx context.Context, src *Object, remote string, do func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error), undo func(dst fs.Object, i int) error) (*Object, error) {
+	name := makeShardName(remote, src.size)
+	dst := f.newObject(remote, src.size)
+	errs := f.forEach(ctx, func(i int, u fs.Fs) (err error) {
+		if src.shards[i] == nil {
+			return nil
+		}
+		dst.shards[i], err = do(u)(ctx, src.shards[i], name)
+		return err
+	})
+	err := firstError(errs)
+	if err != nil {
+		for i, shard := range dst.shards {
+			if shard != nil {
+				if undoErr := undo(shard, i); undoErr != nil {
+					fs.Errorf(shard, "Failed to undo after failed transfer: %v", undoErr)
+				}
+			}
+		}
+		return nil, err
+	}
+	dst.header, dst.footer = src.header, src.footer
+	return dst, nil
+}
+
+// removeExisting removes the file at remote if it has a different
+// size to size so its shards don't get mixed up with the new ones
+func (f *Fs) removeExisting(ctx context.Context, remote string, size int64) error {
+	o, err := f.NewObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if o.Size() == size {
+		return nil
+	}
+	return o.Remove(ctx)
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || len(srcObj.shards) != len(f.upstreams) {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.removeExisting(ctx, remote, srcObj.size); err != nil {
+		return nil, err
+	}
+	return f.transferShards(ctx, srcObj, remote, func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error) {
+		return u.Features().Copy
+	}, func(dst fs.Object, i int) error {
+		return dst.Remove(ctx)
+	})
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || len(srcObj.shards) != len(f.upstreams) {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	if err := f.removeExisting(ctx, remote, srcObj.size); err != nil {
+		return nil, err
+	}
+	return f.transferShards(ctx, srcObj, remote, func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error) {
+		return u.Features().Move
+	}, func(dst fs.Object, i int) error {
+		// Put the shard back so the source is still complete
+		do := srcObj.f.upstreams[i].Features().Move
+		_, err := do(ctx, dst, srcObj.shards[i].Remote())
+		return err
+	})
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || len(srcFs.upstreams) != len(f.upstreams) {
+		fs.Debugf(src, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	// Check the destination doesn't exist before moving anything
+	_, err := f.List(ctx, dstRemote)
+	if err == nil {
+		return fs.ErrorDirExists
+	} else if err != fs.ErrorDirNotFound {
+		return err
+	}
+	found := false
+	var mu sync.Mutex
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		if srcFs.upstreams[i] == nil {
+			return errUpstreamUnavailable
+		}
+		err := u.Features().DirMove(ctx, srcFs.upstreams[i], srcRemote, dstRemote)
+		if err == fs.ErrorDirNotFound {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			found = true
+			mu.Unlock()
+		}
+		return err
+	})
+	if err := firstError(errs); err != nil {
+		return err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("erasure root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatest time.Duration
+	for _, u := range f.upstreams {
+		if u != nil && u.Precision() > greatest {
+			greatest = u.Precision()
+		}
+	}
+	return greatest
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.NewHashSet(hash.MD5, hash.SHA1)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.Purger    = (*Fs)(nil)
+	_ fs.Copier    = (*Fs)(nil)
+	_ fs.Mover     = (*Fs)(nil)
+	_ fs.DirMover  = (*Fs)(nil)
+	_ fs.Commander = (*Fs)(nil)
+)
@@ -0,0 +1,152 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putFile(ctx context.Context, t *testing.T, f fs.Fs, name string, data []byte) fs.Object {
+	item := fstest.Item{Path: name, ModTime: fstest.Time("2001-02-03T04:05:06.499999999Z")}
+	o := fstests.PutTestContents(ctx, t, f, &item, string(data), true)
+	require.NotNil(t, o)
+	return o
+}
+
+func readAll(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) []byte {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+// corruptShard flips a bit in the first block of shard i of o
+func (f *Fs) corruptShard(ctx context.Context, t *testing.T, o *Object, i int) {
+	shard := o.shards[i]
+	data := readAll(ctx, t, shard)
+	data[shardHeaderSize] ^= 1
+	_ = putFile(ctx, t, f.upstreams[i], shard.Remote(), data)
+}
+
+// reopen finds the object again so the shards are listed afresh
+func (f *Fs) reopen(ctx context.Context, t *testing.T, remote string) *Object {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	return o.(*Object)
+}
+
+// Check files can be read with shards missing or corrupted and that
+// heal rebuilds them
+func (f *Fs) testDegradedAndHeal(t *testing.T) {
+	ctx := context.Background()
+	const remote = "heal/file"
+	stripe := int(f.opt.BlockSize) * f.k
+	data := make([]byte, 3*stripe+stripe/3)
+	rand.New(rand.NewSource(1)).Read(data)
+	o := putFile(ctx, t, f, remote, data).(*Object)
+	assert.Equal(t, len(f.upstreams), o.present())
+
+	// Lose a data shard
+	require.NoError(t, o.shards[0].Remove(ctx))
+	o = f.reopen(ctx, t, remote)
+	assert.Nil(t, o.shards[0])
+	assert.Equal(t, data, readAll(ctx, t, o))
+	start := int64(stripe) + 17
+	end := start + int64(stripe)
+	assert.Equal(t, data[start:end+1], readAll(ctx, t, o, &fs.RangeOption{Start: start, End: end}))
+	md5sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.NotEqual(t, "", md5sum)
+
+	// Heal it
+	stats, err := f.heal(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Healed)
+	assert.Equal(t, 1, stats.Shards)
+	assert.Equal(t, 0, stats.Degraded)
+	o = f.reopen(ctx, t, remote)
+	require.NotNil(t, o.shards[0])
+	h, err := o.readHeader(ctx)
+	require.NoError(t, err)
+	require.NoError(t, verifyShard(ctx, o.shards[0], h, 0))
+
+	// Corrupt a data shard - this is only found by reading
+	f.corruptShard(ctx, t, o, 1)
+	o = f.reopen(ctx, t, remote)
+	assert.Equal(t, data, readAll(ctx, t, o))
+	stats, err = f.heal(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Healed)
+	stats, err = f.heal(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Healed)
+	o = f.reopen(ctx, t, remote)
+	h, err = o.readHeader(ctx)
+	require.NoError(t, err)
+	for i, shard := range o.shards {
+		assert.NoError(t, verifyShard(ctx, shard, h, i))
+	}
+
+	// Losing more shards than there is parity for fails
+	for i := 0; i <= f.m; i++ {
+		require.NoError(t, o.shards[i].Remove(ctx))
+	}
+	o = f.reopen(ctx, t, remote)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(in)
+	assert.ErrorContains(t, err, "shards could be read")
+	require.NoError(t, in.Close())
+	_, err = f.heal(ctx, false)
+	assert.Error(t, err)
+
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.Rmdir(ctx, "heal"))
+}
+
+// Check that an incomplete set of shards is ignored and removed by heal
+func (f *Fs) testStaleShards(t *testing.T) {
+	ctx := context.Background()
+	const remote = "stale"
+	data := bytes.Repeat([]byte("stale "), 1000)
+	old := putFile(ctx, t, f, remote, data).(*Object)
+	oldShard := old.shards[1].Remote()
+	oldData := readAll(ctx, t, old.shards[1])
+
+	// Overwriting with a different size removes the old shards, so
+	// put one back as if the removal had been interrupted
+	src := object.NewStaticObjectInfo(remote, old.ModTime(ctx), 100, true, nil, nil)
+	require.NoError(t, old.Update(ctx, bytes.NewReader(data[:100]), src))
+	_ = putFile(ctx, t, f.upstreams[1], oldShard, oldData)
+
+	o := f.reopen(ctx, t, remote)
+	assert.Equal(t, int64(100), o.Size())
+	assert.Equal(t, data[:100], readAll(ctx, t, o))
+
+	stats, err := f.heal(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Stale)
+	_, err = f.upstreams[1].NewObject(ctx, oldShard)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	require.NoError(t, o.Remove(ctx))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("DegradedAndHeal", f.testDegradedAndHeal)
+	t.Run("StaleShards", f.testStaleShards)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,76 @@
+// Test Erasure filesystem interface
+package erasure
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestErasure:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"UnWrap",
+		"WrapFs",
+		"SetWrapper",
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"DirCacheFlush",
+		"PutUnchecked",
+		"PutStream",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"About",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"Shutdown",
+		"ListR",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"MimeType",
+		"ID",
+		"GetTier",
+		"SetTier",
+		"UnWrap",
+		"Metadata",
+		"SetMetadata",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests erasure with 2 data and 1 parity shard on the local
+// filesystem using a small block size
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	upstreams := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	name := "TestErasureLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "erasure"},
+		{Name: name, Key: "upstreams", Value: strings.Join(upstreams, " ")},
+		{Name: name, Key: "block_size", Value: "4k"},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
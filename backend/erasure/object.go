@@ -0,0 +1,511 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
+	"storj.io/infectious"
+)
+
+// Object represents a file stored as shards on the upstreams
+type Object struct {
+	f      *Fs          // the Fs this object is part of
+	remote string       // the path of the file
+	size   int64        // size of the file
+	shards []fs.Object  // the shards indexed by shard number, nil if missing
+	mu     sync.Mutex   // protects header and footer
+	header *shardHeader // the header, read on demand
+	footer *shardFooter // the footer, read on demand
+}
+
+// newObject makes an Object with no shards
+func (f *Fs) newObject(remote string, size int64) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		size:   size,
+		shards: make([]fs.Object, len(f.upstreams)),
+	}
+}
+
+// present returns the number of shards found
+func (o *Object) present() (n int) {
+	for _, shard := range o.shards {
+		if shard != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// first returns the first shard found
+func (o *Object) first() fs.Object {
+	for _, shard := range o.shards {
+		if shard != nil {
+			return shard
+		}
+	}
+	return nil
+}
+
+// better returns true if o is a better set of shards than old
+func (o *Object) better(ctx context.Context, old *Object) bool {
+	if o.present() != old.present() {
+		return o.present() > old.present()
+	}
+	return o.first().ModTime(ctx).After(old.first().ModTime(ctx))
+}
+
+// readHeader returns the header of the file, reading it from the
+// first shard which has a valid one if necessary
+func (o *Object) readHeader(ctx context.Context) (*shardHeader, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.header != nil {
+		return o.header, nil
+	}
+	err := errors.New("no shards found")
+	for i, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		var h *shardHeader
+		h, err = readShardHeader(ctx, shard)
+		if err == nil && (h.index != i || h.size != o.size) {
+			err = errWrongShard
+		}
+		if err != nil {
+			fs.Errorf(shard, "Failed to read shard header: %v", err)
+			continue
+		}
+		o.header = h
+		return h, nil
+	}
+	return nil, fmt.Errorf("failed to read header: %w", err)
+}
+
+// readFooter returns the footer of the file, reading it from the
+// first shard which has a valid one if necessary
+func (o *Object) readFooter(ctx context.Context) (*shardFooter, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.footer != nil {
+		return o.footer, nil
+	}
+	err := errors.New("no shards found")
+	for _, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		var footer *shardFooter
+		footer, err = readShardFooter(ctx, shard)
+		if err != nil {
+			fs.Errorf(shard, "Failed to read shard footer: %v", err)
+			continue
+		}
+		o.footer = footer
+		return footer, nil
+	}
+	return nil, fmt.Errorf("failed to read footer: %w", err)
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.first().ModTime(ctx)
+}
+
+// SetModTime sets the modification time of all the shards
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	return o.forEach(ctx, func(shard fs.Object) error {
+		return shard.SetModTime(ctx, t)
+	})
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.MD5 && ht != hash.SHA1 {
+		return "", hash.ErrUnsupported
+	}
+	footer, err := o.readFooter(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ht == hash.MD5 {
+		return footer.md5, nil
+	}
+	return footer.sha1, nil
+}
+
+// forEach calls fn on each shard which is present concurrently
+// returning the first error
+func (o *Object) forEach(ctx context.Context, fn func(shard fs.Object) error) error {
+	errs := make([]error, len(o.shards))
+	var wg sync.WaitGroup
+	for i, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, shard fs.Object) {
+			defer wg.Done()
+			errs[i] = fn(shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	return firstError(errs)
+}
+
+// Remove all the shards of the object
+func (o *Object) Remove(ctx context.Context) error {
+	return o.forEach(ctx, func(shard fs.Object) error {
+		return shard.Remove(ctx)
+	})
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(ctx, in, src, o.remote, o.shards, options)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.size = newO.size
+	o.shards = newO.shards
+	o.header = newO.header
+	o.footer = newO.footer
+	o.mu.Unlock()
+	return nil
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	// Reading the whole file finds the header in the first block
+	// read so only read it separately for partial reads
+	var h *shardHeader
+	if offset != 0 || limit >= 0 {
+		h, err = o.readHeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sr, err := newStripeReader(ctx, o, h, offset, limit, nil)
+	if err != nil {
+		return nil, err
+	}
+	return readers.NewLimitedReadCloser(sr, limit), nil
+}
+
+var errReaderClosed = errors.New("read on closed file")
+
+// shardStream is a shard being read by the stripeReader
+type shardStream struct {
+	rc     io.ReadCloser // open stream or nil
+	stripe int64         // stripe rc is positioned at
+	bad    bool          // set if the shard can't be used
+	buf    []byte        // buffer for reading blocks
+}
+
+// stripeReader reads the file data by reading k good blocks for each
+// stripe, reconstructing the data from the parity blocks where a data
+// block is missing or corrupted.
+type stripeReader struct {
+	ctx    context.Context
+	o      *Object
+	h      *shardHeader       // the header, nil until the first shard is read
+	fec    *infectious.FEC    // decoder
+	stripe int64              // next stripe to read
+	end    int64              // stripe to stop reading at, -1 for the end of the file
+	skip   int64              // bytes to skip at the start of the first stripe
+	shards []shardStream      // indexed by shard number
+	shares []infectious.Share // blocks read for the current stripe
+	buf    []byte             // buffer for the stripe data
+	out    []byte             // stripe data not yet returned
+	err    error              // sticky error
+	closed bool               // set if Close has been called
+}
+
+// newStripeReader makes a reader for the data of o from offset
+//
+// h may be nil if offset is 0 and limit is -1 in which case the header
+// is read from the first shard. Shards which are set in exclude aren't
+// read.
+func newStripeReader(ctx context.Context, o *Object, h *shardHeader, offset, limit int64, exclude []bool) (*stripeReader, error) {
+	sr := &stripeReader{
+		ctx:    ctx,
+		o:      o,
+		end:    -1,
+		shards: make([]shardStream, len(o.shards)),
+	}
+	for i, shard := range o.shards {
+		sr.shards[i].bad = shard == nil || (exclude != nil && exclude[i])
+	}
+	if h != nil {
+		stripeSize := h.stripeSize()
+		sr.stripe = offset / stripeSize
+		sr.skip = offset - sr.stripe*stripeSize
+		if limit >= 0 {
+			sr.end = (offset + limit + stripeSize - 1) / stripeSize
+		}
+		if err := sr.setHeader(h); err != nil {
+			return nil, err
+		}
+	}
+	return sr, nil
+}
+
+// setHeader sets the layout used to read the file
+func (sr *stripeReader) setHeader(h *shardHeader) (err error) {
+	if h.n() != len(sr.shards) {
+		return fmt.Errorf("file has %d shards but there are %d upstreams", h.n(), len(sr.shards))
+	}
+	sr.fec, err = h.newFEC()
+	if err != nil {
+		return err
+	}
+	sr.h = h
+	sr.buf = make([]byte, h.stripeSize())
+	if sr.end < 0 || sr.end > h.stripes() {
+		sr.end = h.stripes()
+	}
+	return nil
+}
+
+// fail marks shard i as unusable
+func (sr *stripeReader) fail(i int, err error) {
+	fs.Errorf(sr.o, "Shard %d failed, reading from the other shards: %v", i+1, err)
+	ss := &sr.shards[i]
+	ss.bad = true
+	if ss.rc != nil {
+		_ = ss.rc.Close()
+		ss.rc = nil
+	}
+}
+
+// open opens shard i at the current stripe
+func (sr *stripeReader) open(i int) (err error) {
+	ss := &sr.shards[i]
+	shard := sr.o.shards[i]
+	if sr.stripe == 0 {
+		// Read the header inline
+		var options []fs.OpenOption
+		if sr.h != nil {
+			options = append(options, &fs.RangeOption{Start: 0, End: sr.h.blockOffset(sr.end) - 1})
+		}
+		ss.rc, err = shard.Open(sr.ctx, options...)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, shardHeaderSize)
+		if _, err = io.ReadFull(ss.rc, buf); err != nil {
+			return fmt.Errorf("%w: %v", errBadShardHeader, err)
+		}
+		h, err := parseShardHeader(buf)
+		if err != nil {
+			return err
+		}
+		if sr.h == nil {
+			if h.index != i || h.size != sr.o.size {
+				return errWrongShard
+			}
+			if err = sr.setHeader(h); err != nil {
+				return err
+			}
+		}
+		if err = h.check(sr.h, i); err != nil {
+			return err
+		}
+	} else {
+		h, err := readShardHeader(sr.ctx, shard)
+		if err != nil {
+			return err
+		}
+		if err = h.check(sr.h, i); err != nil {
+			return err
+		}
+		ss.rc, err = shard.Open(sr.ctx, &fs.RangeOption{Start: sr.h.blockOffset(sr.stripe), End: sr.h.blockOffset(sr.end) - 1})
+		if err != nil {
+			return err
+		}
+	}
+	if shard.Size() != sr.h.shardSize() {
+		return fmt.Errorf("shard is %d bytes but expecting %d", shard.Size(), sr.h.shardSize())
+	}
+	ss.stripe = sr.stripe
+	ss.buf = make([]byte, sr.h.blockSize+crcSize)
+	return nil
+}
+
+// readShard reads the block of the current stripe from shard i
+func (sr *stripeReader) readShard(i int) ([]byte, error) {
+	ss := &sr.shards[i]
+	if ss.rc == nil {
+		if err := sr.open(i); err != nil {
+			return nil, err
+		}
+	}
+	if ss.stripe != sr.stripe {
+		return nil, errors.New("shard out of sync")
+	}
+	block, err := readBlock(ss.rc, ss.buf, sr.h.blockLen(sr.stripe))
+	if err != nil {
+		return nil, err
+	}
+	ss.stripe++
+	return block, nil
+}
+
+// findHeader opens the shards in turn until one has a valid header
+func (sr *stripeReader) findHeader() error {
+	for i := range sr.shards {
+		if sr.shards[i].bad {
+			continue
+		}
+		if err := sr.open(i); err != nil {
+			sr.fail(i, err)
+			continue
+		}
+		return nil
+	}
+	return errors.New("no shards could be read")
+}
+
+// readStripe reads the next stripe into sr.out
+func (sr *stripeReader) readStripe() error {
+	sr.shares = sr.shares[:0]
+	// Data shards come first so are preferred
+	for i := range sr.shards {
+		if sr.shards[i].bad {
+			continue
+		}
+		block, err := sr.readShard(i)
+		if err != nil {
+			sr.fail(i, err)
+			continue
+		}
+		sr.shares = append(sr.shares, infectious.Share{Number: i, Data: block})
+		if len(sr.shares) == sr.h.k {
+			break
+		}
+	}
+	if len(sr.shares) < sr.h.k {
+		return fmt.Errorf("stripe %d: only %d shards could be read but need %d", sr.stripe, len(sr.shares), sr.h.k)
+	}
+	blockLen := sr.h.blockLen(sr.stripe)
+	data := sr.buf[:blockLen*int64(sr.h.k)]
+	if sr.shares[sr.h.k-1].Number == sr.h.k-1 {
+		// All data shards
+		for _, share := range sr.shares {
+			copy(data[int64(share.Number)*blockLen:], share.Data)
+		}
+	} else {
+		err := sr.fec.Rebuild(sr.shares, func(share infectious.Share) {
+			copy(data[int64(share.Number)*blockLen:], share.Data)
+		})
+		if err != nil {
+			return fmt.Errorf("stripe %d: failed to reconstruct: %w", sr.stripe, err)
+		}
+	}
+	sr.out = data[:sr.h.stripeLen(sr.stripe)]
+	sr.stripe++
+	if sr.skip > 0 {
+		if sr.skip > int64(len(sr.out)) {
+			sr.skip = int64(len(sr.out))
+		}
+		sr.out = sr.out[sr.skip:]
+		sr.skip = 0
+	}
+	return nil
+}
+
+// Read reads the file data into p
+func (sr *stripeReader) Read(p []byte) (n int, err error) {
+	for len(sr.out) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if sr.h == nil {
+			sr.err = sr.findHeader()
+		} else if sr.stripe >= sr.end {
+			sr.err = io.EOF
+		} else {
+			sr.err = sr.readStripe()
+		}
+	}
+	n = copy(p, sr.out)
+	sr.out = sr.out[n:]
+	return n, nil
+}
+
+// Close closes the shards being read
+func (sr *stripeReader) Close() (err error) {
+	if sr.closed {
+		return nil
+	}
+	sr.closed = true
+	if sr.err == nil {
+		sr.err = errReaderClosed
+	}
+	sr.out = nil
+	for i := range sr.shards {
+		ss := &sr.shards[i]
+		if ss.rc != nil {
+			fs.CheckClose(ss.rc, &err)
+			ss.rc = nil
+		}
+	}
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object = (*Object)(nil)
+)
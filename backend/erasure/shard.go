@@ -0,0 +1,364 @@
+package erasure
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
+	"storj.io/infectious"
+)
+
+// Each file is Reed-Solomon encoded into k data and m parity shards
+// and shard i is stored on upstream i.
+//
+// The file is encoded in stripes of k*blockSize bytes. Each stripe is
+// split into k blocks, one for each data shard, and m parity blocks
+// are calculated from them. The last stripe is padded with zeros to a
+// multiple of k bytes and split into smaller blocks.
+//
+// Each shard is
+//
+//	header    32 bytes
+//	blocks    one per stripe, each followed by its CRC-32C
+//	footer    40 bytes
+//
+// The header is
+//
+//	magic      8 bytes "RCLONEEC"
+//	version    1 byte
+//	k          1 byte
+//	m          1 byte
+//	index      1 byte
+//	blockSize  4 bytes little endian
+//	size       8 bytes little endian - size of the file
+//	id         8 bytes - random, the same for all shards of an upload
+//
+// The footer is the MD5 and SHA-1 of the file followed by the CRC-32C
+// of those.
+const (
+	shardMagic      = "RCLONEEC"
+	shardVersion    = 1
+	shardHeaderSize = 32
+	shardFooterSize = md5.Size + sha1.Size + crcSize
+	crcSize         = 4
+	idSize          = 8
+	maxShards       = 256
+)
+
+// Errors returned when reading shards
+var (
+	errBadShardHeader = errors.New("bad shard header")
+	errBadShardFooter = errors.New("bad shard footer")
+	errCorruptBlock   = errors.New("shard block failed CRC check")
+	errWrongShard     = errors.New("shard doesn't belong with the other shards")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// layout describes how a file is split into shards
+type layout struct {
+	k         int   // number of data shards
+	m         int   // number of parity shards
+	blockSize int64 // size of a block in a full stripe
+	size      int64 // size of the file
+}
+
+// n returns the total number of shards
+func (l *layout) n() int {
+	return l.k + l.m
+}
+
+// stripeSize returns the amount of file data in a full stripe
+func (l *layout) stripeSize() int64 {
+	return int64(l.k) * l.blockSize
+}
+
+// stripes returns the number of stripes in the file
+func (l *layout) stripes() int64 {
+	return (l.size + l.stripeSize() - 1) / l.stripeSize()
+}
+
+// stripeLen returns the amount of file data in stripe i
+func (l *layout) stripeLen(i int64) int64 {
+	n := l.size - i*l.stripeSize()
+	if n > l.stripeSize() {
+		n = l.stripeSize()
+	}
+	return n
+}
+
+// blockLen returns the size of each block of stripe i
+func (l *layout) blockLen(i int64) int64 {
+	return (l.stripeLen(i) + int64(l.k) - 1) / int64(l.k)
+}
+
+// blockOffset returns the offset in the shard of the block for stripe
+// i. This is also the offset of the footer if i is the number of
+// stripes.
+func (l *layout) blockOffset(i int64) int64 {
+	full := l.size / l.stripeSize()
+	if i <= full {
+		return shardHeaderSize + i*(l.blockSize+crcSize)
+	}
+	return shardHeaderSize + full*(l.blockSize+crcSize) + l.blockLen(full) + crcSize
+}
+
+// shardSize returns the size of each shard
+func (l *layout) shardSize() int64 {
+	return l.blockOffset(l.stripes()) + shardFooterSize
+}
+
+// newFEC makes the Reed-Solomon encoder for the layout
+func (l *layout) newFEC() (*infectious.FEC, error) {
+	return infectious.NewFEC(l.k, l.n())
+}
+
+// shardHeader is the decoded header of a shard
+type shardHeader struct {
+	layout
+	index int          // which shard this is
+	id    [idSize]byte // identifies the upload
+}
+
+// marshal the header
+func (h *shardHeader) marshal() []byte {
+	buf := make([]byte, shardHeaderSize)
+	copy(buf, shardMagic)
+	buf[8] = shardVersion
+	buf[9] = byte(h.k)
+	buf[10] = byte(h.m)
+	buf[11] = byte(h.index)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.blockSize))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(h.size))
+	copy(buf[24:], h.id[:])
+	return buf
+}
+
+// parseShardHeader decodes the shard header in buf
+func parseShardHeader(buf []byte) (*shardHeader, error) {
+	if len(buf) < shardHeaderSize || string(buf[:8]) != shardMagic {
+		return nil, errBadShardHeader
+	}
+	if buf[8] != shardVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", errBadShardHeader, buf[8])
+	}
+	h := &shardHeader{
+		layout: layout{
+			k:         int(buf[9]),
+			m:         int(buf[10]),
+			blockSize: int64(binary.LittleEndian.Uint32(buf[12:])),
+			size:      int64(binary.LittleEndian.Uint64(buf[16:])),
+		},
+		index: int(buf[11]),
+	}
+	copy(h.id[:], buf[24:])
+	if h.k < 1 || h.n() > maxShards || h.index >= h.n() || h.blockSize <= 0 || h.size < 0 {
+		return nil, errBadShardHeader
+	}
+	return h, nil
+}
+
+// check the header h is for shard index of the file with the header
+// want
+func (h *shardHeader) check(want *shardHeader, index int) error {
+	if h.index != index || h.layout != want.layout || h.id != want.id {
+		return errWrongShard
+	}
+	return nil
+}
+
+// readShardHeader reads the header of the shard o
+func readShardHeader(ctx context.Context, o fs.Object) (h *shardHeader, err error) {
+	rc, err := o.Open(ctx, &fs.RangeOption{Start: 0, End: shardHeaderSize - 1})
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(rc, &err)
+	buf := make([]byte, shardHeaderSize)
+	if _, err = io.ReadFull(rc, buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadShardHeader, err)
+	}
+	return parseShardHeader(buf)
+}
+
+// shardFooter is the decoded footer of a shard
+type shardFooter struct {
+	md5  string
+	sha1 string
+}
+
+// marshalFooter makes the footer from the hashes of the file
+func marshalFooter(md5sum, sha1sum []byte) []byte {
+	buf := make([]byte, 0, shardFooterSize)
+	buf = append(buf, md5sum...)
+	buf = append(buf, sha1sum...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable))
+}
+
+// parseShardFooter decodes the shard footer in buf
+func parseShardFooter(buf []byte) (*shardFooter, error) {
+	if len(buf) != shardFooterSize {
+		return nil, errBadShardFooter
+	}
+	n := shardFooterSize - crcSize
+	if crc32.Checksum(buf[:n], crcTable) != binary.LittleEndian.Uint32(buf[n:]) {
+		return nil, errBadShardFooter
+	}
+	return &shardFooter{
+		md5:  fmt.Sprintf("%x", buf[:md5.Size]),
+		sha1: fmt.Sprintf("%x", buf[md5.Size:n]),
+	}, nil
+}
+
+// readShardFooter reads the footer of the shard o
+func readShardFooter(ctx context.Context, o fs.Object) (footer *shardFooter, err error) {
+	start := o.Size() - shardFooterSize
+	if start < shardHeaderSize {
+		return nil, errBadShardFooter
+	}
+	rc, err := o.Open(ctx, &fs.RangeOption{Start: start, End: o.Size() - 1})
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(rc, &err)
+	buf := make([]byte, shardFooterSize)
+	if _, err = io.ReadFull(rc, buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadShardFooter, err)
+	}
+	return parseShardFooter(buf)
+}
+
+// readBlock reads a block of n bytes and its CRC from in into buf
+// returning the block
+func readBlock(in io.Reader, buf []byte, n int64) ([]byte, error) {
+	buf = buf[:n+crcSize]
+	if _, err := io.ReadFull(in, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	block := buf[:n]
+	if crc32.Checksum(block, crcTable) != binary.LittleEndian.Uint32(buf[n:]) {
+		return nil, errCorruptBlock
+	}
+	return block, nil
+}
+
+// encode reads the file from in and writes the shards to the writers
+// indexed by shard number. Shards with a nil writer aren't written.
+//
+// It returns the hashes of the data read.
+func (h *shardHeader) encode(in io.Reader, writers []io.Writer) (hashes map[hash.Type]string, err error) {
+	fec, err := h.newFEC()
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(hash.MD5, hash.SHA1))
+	if err != nil {
+		return nil, err
+	}
+	in = io.TeeReader(in, hasher)
+	write := func(i int, p []byte) {
+		if err == nil && writers[i] != nil {
+			_, err = writers[i].Write(p)
+		}
+	}
+
+	for i := range writers {
+		header := *h
+		header.index = i
+		write(i, header.marshal())
+	}
+	stripe := make([]byte, h.stripeSize())
+	crc := make([]byte, crcSize)
+	for s := int64(0); s < h.stripes() && err == nil; s++ {
+		n := h.stripeLen(s)
+		blockLen := h.blockLen(s)
+		data := stripe[:blockLen*int64(h.k)]
+		if _, err = io.ReadFull(in, data[:n]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		clear(data[n:])
+		encodeErr := fec.Encode(data, func(share infectious.Share) {
+			write(share.Number, share.Data)
+			binary.LittleEndian.PutUint32(crc, crc32.Checksum(share.Data, crcTable))
+			write(share.Number, crc)
+		})
+		if err == nil {
+			err = encodeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check there is no more data
+	if n, _ := readers.ReadFill(in, crc[:1]); n != 0 {
+		return nil, fmt.Errorf("source is longer than %d bytes", h.size)
+	}
+
+	hashes = hasher.Sums()
+	md5sum, _ := hasher.Sum(hash.MD5)
+	sha1sum, _ := hasher.Sum(hash.SHA1)
+	footer := marshalFooter(md5sum, sha1sum)
+	for i := range writers {
+		write(i, footer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// verifyShard reads all of the shard o checking it is shard index of
+// the file with header want
+func verifyShard(ctx context.Context, o fs.Object, want *shardHeader, index int) (err error) {
+	if o.Size() != want.shardSize() {
+		return fmt.Errorf("shard is %d bytes but expecting %d", o.Size(), want.shardSize())
+	}
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(rc, &err)
+	header := make([]byte, shardHeaderSize)
+	if _, err = io.ReadFull(rc, header); err != nil {
+		return err
+	}
+	h, err := parseShardHeader(header)
+	if err != nil {
+		return err
+	}
+	if err = h.check(want, index); err != nil {
+		return err
+	}
+	buf := make([]byte, want.blockSize+crcSize)
+	for s := int64(0); s < want.stripes(); s++ {
+		if _, err = readBlock(rc, buf, want.blockLen(s)); err != nil {
+			return fmt.Errorf("stripe %d: %w", s, err)
+		}
+	}
+	footer := make([]byte, shardFooterSize)
+	if _, err = io.ReadFull(rc, footer); err != nil {
+		return err
+	}
+	if _, err = parseShardFooter(footer); err != nil {
+		return err
+	}
+	if n, _ := readers.ReadFill(rc, footer[:1]); n != 0 {
+		return errors.New("shard has extra data at the end")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package erasure
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+	for _, test := range []struct {
+		size      int64
+		stripes   int64
+		lastBlock int64
+		shardSize int64
+	}{
+		{size: 0, stripes: 0, lastBlock: 0, shardSize: 32 + 40},
+		{size: 1, stripes: 1, lastBlock: 1, shardSize: 32 + 1 + 4 + 40},
+		{size: 30, stripes: 1, lastBlock: 10, shardSize: 32 + 10 + 4 + 40},
+		{size: 31, stripes: 1, lastBlock: 11, shardSize: 32 + 11 + 4 + 40},
+		{size: 48, stripes: 1, lastBlock: 16, shardSize: 32 + 16 + 4 + 40},
+		{size: 49, stripes: 2, lastBlock: 1, shardSize: 32 + 16 + 4 + 1 + 4 + 40},
+		{size: 96, stripes: 2, lastBlock: 16, shardSize: 32 + 2*(16+4) + 40},
+	} {
+		t.Run(fmt.Sprint(test.size), func(t *testing.T) {
+			l := layout{k: 3, m: 2, blockSize: 16, size: test.size}
+			assert.Equal(t, test.stripes, l.stripes())
+			if test.stripes > 0 {
+				assert.Equal(t, test.lastBlock, l.blockLen(test.stripes-1))
+			}
+			assert.Equal(t, test.shardSize, l.shardSize())
+			assert.Equal(t, l.shardSize()-shardFooterSize, l.blockOffset(l.stripes()))
+		})
+	}
+}
+
+func TestShardHeader(t *testing.T) {
+	h := &shardHeader{
+		layout: layout{k: 10, m: 4, blockSize: 1 << 20, size: 1<<40 + 1},
+		index:  13,
+		id:     [idSize]byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	buf := h.marshal()
+	require.Len(t, buf, shardHeaderSize)
+	got, err := parseShardHeader(buf)
+	require.NoError(t, err)
+	assert.Equal(t, h, got)
+	assert.NoError(t, got.check(h, 13))
+	assert.Equal(t, errWrongShard, got.check(h, 12))
+
+	buf[0] ^= 1
+	_, err = parseShardHeader(buf)
+	assert.ErrorIs(t, err, errBadShardHeader)
+	buf[0] ^= 1
+	buf[11] = 14 // index too big
+	_, err = parseShardHeader(buf)
+	assert.ErrorIs(t, err, errBadShardHeader)
+}
+
+func TestShardFooter(t *testing.T) {
+	md5sum := md5.Sum([]byte("hello"))
+	sha1sum := sha1.Sum([]byte("hello"))
+	buf := marshalFooter(md5sum[:], sha1sum[:])
+	require.Len(t, buf, shardFooterSize)
+	footer, err := parseShardFooter(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", footer.md5)
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", footer.sha1)
+	buf[3] ^= 1
+	_, err = parseShardFooter(buf)
+	assert.Equal(t, errBadShardFooter, err)
+}
+
+func TestEncode(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	data = data[:len(data)-7]
+	h := &shardHeader{layout: layout{k: 3, m: 2, blockSize: 16, size: int64(len(data))}}
+	bufs := make([]bytes.Buffer, h.n())
+	writers := make([]io.Writer, h.n())
+	for i := range bufs {
+		writers[i] = &bufs[i]
+	}
+	// Don't write the last shard
+	writers[h.n()-1] = nil
+	hashes, err := h.encode(bytes.NewReader(data), writers)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(data)), hashes[hash.MD5])
+	assert.Equal(t, 0, bufs[h.n()-1].Len())
+
+	// The data shards contain the data
+	var got []byte
+	for s := int64(0); s < h.stripes(); s++ {
+		for i := 0; i < h.k; i++ {
+			shard := bufs[i].Bytes()
+			block, err := readBlock(bytes.NewReader(shard[h.blockOffset(s):]), make([]byte, h.blockSize+crcSize), h.blockLen(s))
+			require.NoError(t, err)
+			got = append(got, block...)
+		}
+		got = got[:h.stripeSize()*s+h.stripeLen(s)]
+	}
+	assert.Equal(t, data, got)
+
+	for i := 0; i < h.n()-1; i++ {
+		shard := bufs[i].Bytes()
+		require.Equal(t, h.shardSize(), int64(len(shard)))
+		header, err := parseShardHeader(shard)
+		require.NoError(t, err)
+		assert.NoError(t, header.check(h, i))
+		_, err = parseShardFooter(shard[h.blockOffset(h.stripes()):])
+		assert.NoError(t, err)
+	}
+
+	// Too much or too little data
+	_, err = h.encode(bytes.NewReader(append(data, 'x')), writers)
+	assert.ErrorContains(t, err, "longer")
+	_, err = h.encode(bytes.NewReader(data[1:]), writers)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,454 @@
+// Package guard implements a backend which stops files on another
+// remote being changed or deleted
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Modes the remote can be guarded with
+const (
+	modeReadOnly   = "read_only"
+	modeAppendOnly = "append_only"
+)
+
+// Errors returned when an operation isn't allowed
+var (
+	errReadOnly   = errors.New("remote is read only")
+	errAppendOnly = errors.New("remote is append only")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "guard",
+		Description: "Stop files on a remote being changed or deleted",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to guard.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name:    "mode",
+			Help:    "What changes to allow.",
+			Default: modeReadOnly,
+			Examples: []fs.OptionExample{{
+				Value: modeReadOnly,
+				Help:  "Don't allow any changes.",
+			}, {
+				Value: modeAppendOnly,
+				Help:  "Allow new files and directories to be made but not changed or deleted.",
+			}},
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote string `config:"remote"`
+	Mode   string `config:"mode"`
+}
+
+// Fs represents a remote which can't be changed
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on
+	opt      Options      // parsed options
+	base     fs.Fs        // the remote being wrapped
+	features *fs.Features // optional features
+	wrapper  fs.Fs        // the Fs wrapping this one, if any
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point guard remote at itself - check the value of the remote setting")
+	}
+	switch opt.Mode {
+	case modeReadOnly, modeAppendOnly:
+	default:
+		return nil, fmt.Errorf("unknown mode %q", opt.Mode)
+	}
+
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, rpath))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name: name,
+		root: rpath,
+		opt:  *opt,
+		base: base,
+	}
+	// PartialUploads isn't set as renaming partial uploads into
+	// place would be a move
+	f.features = (&fs.Features{
+		CaseInsensitive:          true,
+		DuplicateFiles:           true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		CanHaveEmptyDirectories:  true,
+		BucketBased:              true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		SlowModTime:              true,
+		SlowHash:                 true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	cache.PinUntilFinalized(base, f)
+
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(strings.Trim(rpath, "/"))
+		if f.root == "." {
+			f.root = ""
+		}
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("guard root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// deny returns the error for op on what not being allowed
+//
+// The error stops rclone retrying as it would fail again.
+func (f *Fs) deny(op string, what fmt.Stringer) error {
+	reason := errReadOnly
+	if f.opt.Mode == modeAppendOnly {
+		reason = errAppendOnly
+	}
+	return fserrors.NoRetryError(fmt.Errorf("guard: can't %s %q: %w", op, what, reason))
+}
+
+// allowCreate returns nil if it is allowed to do op which creates
+// what, otherwise an error
+func (f *Fs) allowCreate(op string, what fmt.Stringer) error {
+	if f.opt.Mode == modeAppendOnly {
+		return nil
+	}
+	return f.deny(op, what)
+}
+
+// allowCreateFile returns nil if it is allowed to upload a file to
+// remote, otherwise an error
+//
+// In append only mode this checks the file doesn't exist already.
+func (f *Fs) allowCreateFile(ctx context.Context, op string, remote string) error {
+	if err := f.allowCreate(op, stringer(remote)); err != nil {
+		return err
+	}
+	_, err := f.base.NewObject(ctx, remote)
+	switch err {
+	case nil:
+		return f.deny("overwrite", stringer(remote))
+	case fs.ErrorObjectNotFound, fs.ErrorIsDir:
+		return nil
+	}
+	return err
+}
+
+// stringer adapts a string to a fmt.Stringer
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+// wrapEntries wraps the objects in baseEntries
+func (f *Fs) wrapEntries(baseEntries fs.DirEntries) (fs.DirEntries, error) {
+	entries := make(fs.DirEntries, 0, len(baseEntries))
+	for _, entry := range baseEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			entries = append(entries, f.newObject(x))
+		case fs.Directory:
+			entries = append(entries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	baseEntries, err := f.base.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrapEntries(baseEntries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	return f.base.Features().ListR(ctx, dir, func(baseEntries fs.DirEntries) error {
+		entries, err := f.wrapEntries(baseEntries)
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	})
+}
+
+// NewObject finds the Object at remote. If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// wrap wraps the object returned by a put or copy
+func (f *Fs) wrap(o fs.Object, err error) (fs.Object, error) {
+	if o != nil {
+		o = f.newObject(o)
+	}
+	return o, err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if err := f.allowCreateFile(ctx, "upload", src.Remote()); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Put(ctx, in, src, options...))
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if err := f.allowCreateFile(ctx, "upload", src.Remote()); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Features().PutStream(ctx, in, src, options...))
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if err := f.allowCreate("make directory", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Mkdir(ctx, dir)
+}
+
+// MkdirMetadata makes the directory passed in as dir.
+//
+// It shouldn't return an error if it already exists.
+//
+// If the metadata is not nil it is set.
+//
+// It returns the directory that was created.
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	if err := f.allowCreate("make directory", stringer(dir)); err != nil {
+		return nil, err
+	}
+	return f.base.Features().MkdirMetadata(ctx, dir, metadata)
+}
+
+// DirSetModTime sets the directory modtime for dir
+//
+// This is allowed in append only mode so new directories can be
+// given the modification time of their source.
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	if err := f.allowCreate("set modification time of directory", stringer(dir)); err != nil {
+		return err
+	}
+	return f.base.Features().DirSetModTime(ctx, dir, modTime)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.deny("remove directory", stringer(dir))
+}
+
+// Purge all files in the directory specified
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	return f.deny("purge", stringer(dir))
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.allowCreateFile(ctx, "copy to", remote); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.base.Features().Copy(ctx, srcObj.Object, remote))
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return nil, f.deny("move", src)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	return f.deny("move directory", stringer(srcRemote))
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	return f.base.Features().About(ctx)
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	return f.deny("clean up", stringer(""))
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.base.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if do := f.base.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
@@ -0,0 +1,138 @@
+// Test Guard filesystem interface
+package guard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t1 = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+// newGuard makes a guard Fs in mode on a directory holding file.txt
+func newGuard(t *testing.T, mode string) *Fs {
+	ctx := context.Background()
+	dir := t.TempDir()
+	base, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	_, err = upload(t, base, "file.txt", "hello")
+	require.NoError(t, err)
+	f, err := NewFs(ctx, "TestGuard", "", configmap.Simple{
+		"remote": dir,
+		"mode":   mode,
+	})
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// upload contents to remote on f
+func upload(t *testing.T, f fs.Fs, remote, contents string) (fs.Object, error) {
+	src := object.NewStaticObjectInfo(remote, t1, int64(len(contents)), true, nil, nil)
+	return f.Put(context.Background(), bytes.NewBufferString(contents), src)
+}
+
+// assertDenied checks err is the reason given and stops retries
+func assertDenied(t *testing.T, err, reason error) {
+	t.Helper()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, reason), err)
+	assert.True(t, fserrors.IsNoRetryError(err), err)
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	f := newGuard(t, modeReadOnly)
+
+	// Reading is allowed
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	data, err := operations.ReadFile(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Everything else isn't
+	_, err = upload(t, f, "new.txt", "new")
+	assertDenied(t, err, errReadOnly)
+	assertDenied(t, o.Update(ctx, bytes.NewBufferString("x"), o), errReadOnly)
+	assertDenied(t, o.Remove(ctx), errReadOnly)
+	assertDenied(t, o.SetModTime(ctx, time.Now()), errReadOnly)
+	_, err = f.Copy(ctx, o, "copy.txt")
+	assertDenied(t, err, errReadOnly)
+	_, err = f.Move(ctx, o, "moved.txt")
+	assertDenied(t, err, errReadOnly)
+	assertDenied(t, f.Mkdir(ctx, "dir"), errReadOnly)
+	assertDenied(t, f.Rmdir(ctx, ""), errReadOnly)
+	assertDenied(t, f.Purge(ctx, ""), errReadOnly)
+
+	// Check nothing changed
+	o, err = f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+	assert.True(t, o.ModTime(ctx).Equal(t1))
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	f := newGuard(t, modeAppendOnly)
+
+	// New files and directories can be made
+	newObj, err := upload(t, f, "dir/new.txt", "new")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/new.txt", newObj.Remote())
+	require.NoError(t, f.Mkdir(ctx, "empty"))
+	if f.Features().Copy != nil {
+		_, err = f.Copy(ctx, newObj, "dir/copy.txt")
+		require.NoError(t, err)
+	}
+
+	// Existing files can't be changed or deleted
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	_, err = upload(t, f, "file.txt", "overwritten")
+	assertDenied(t, err, errAppendOnly)
+	assertDenied(t, o.Update(ctx, bytes.NewBufferString("x"), o), errAppendOnly)
+	assertDenied(t, o.Remove(ctx), errAppendOnly)
+	assertDenied(t, o.SetModTime(ctx, time.Now()), errAppendOnly)
+	_, err = f.Move(ctx, o, "moved.txt")
+	assertDenied(t, err, errAppendOnly)
+	assertDenied(t, f.Rmdir(ctx, "empty"), errAppendOnly)
+	assertDenied(t, f.Purge(ctx, "dir"), errAppendOnly)
+	if f.Features().Copy != nil {
+		_, err = f.Copy(ctx, newObj, "file.txt")
+		assertDenied(t, err, errAppendOnly)
+	}
+
+	// Check nothing changed
+	o, err = f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	data, err := operations.ReadFile(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	_, err = f.NewObject(ctx, "dir/new.txt")
+	require.NoError(t, err)
+}
+
+func TestBadMode(t *testing.T) {
+	_, err := NewFs(context.Background(), "TestGuard", "", configmap.Simple{
+		"remote": t.TempDir(),
+		"mode":   "potato",
+	})
+	assert.ErrorContains(t, err, "unknown mode")
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
@@ -25,6 +28,12 @@ import (
 // If it is a string or a []string it will be shown to the user
 // otherwise it will be JSON encoded and shown to the user like that
 func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "drop", "dump", "fulldump":
+		if f.opt.Store != storeDB {
+			return nil, fmt.Errorf("%s is only supported with store = %s", name, storeDB)
+		}
+	}
 	switch name {
 	case "drop":
 		return nil, f.db.Stop(true)
@@ -36,6 +45,9 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("please provide checksum type and path to sum file")
 		}
 		return nil, f.dbImport(ctx, arg[0], arg[1], sticky)
+	case "scrub":
+		_, refresh := opt["refresh"]
+		return f.scrub(ctx, refresh)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -70,6 +82,33 @@ Usage Example:
 Usage Example:
     rclone backend stickyimport hasher:subdir md5 remote:path/to/sum.md5
 `,
+}, {
+	Name:  "scrub",
+	Short: "Check files against their stored checksums",
+	Long: `Read every file in full and check it against its stored checksums
+and the checksum from the underlying remote if it has one.
+
+Files which don't match are reported as errors. Files with no stored
+checksums or with checksums older than max_age are reported too.
+Usage Example:
+    rclone backend scrub hasher:path/to/data [-o refresh]
+
+With the refresh option the missing and stale checksums are replaced
+with the ones worked out while reading.
+
+The result is a summary like this:
+
+    {
+        "checked": 1000,
+        "missing": 10,
+        "stale": 5,
+        "refreshed": 15,
+        "corrupted": ["path/to/file"]
+    }
+`,
+	Opts: map[string]string{
+		"refresh": "Store checksums for files with missing or stale ones",
+	},
 }}
 
 func (f *Fs) dbDump(ctx context.Context, full bool, root string) error {
@@ -142,11 +181,9 @@ func (f *Fs) dbImport(ctx context.Context, hashName, sumRemote string, sticky bo
 	}
 
 	if sticky {
-		rootPath := f.Fs.Root()
 		for remote, hashVal := range hashes {
-			key := path.Join(rootPath, remote)
 			hashSums := operations.HashSums{hashName: hashVal}
-			if err := f.putRawHashes(ctx, key, anyFingerprint, hashSums); err != nil {
+			if err := f.putRawHashes(ctx, remote, nil, anyFingerprint, hashSums); err != nil {
 				fs.Errorf(nil, "%s: failed to import: %v", remote, err)
 			}
 		}
@@ -186,3 +223,129 @@ func (f *Fs) dbImport(ctx context.Context, hashName, sumRemote string, sticky bo
 	fs.Infof(nil, "Summary: %d imported, %d skipped", doneCount, skipCount)
 	return err
 }
+
+// Ways a file can be found by scrub
+const (
+	scrubOK      = "ok"
+	scrubMissing = "missing"
+	scrubStale   = "stale"
+)
+
+// scrubResult is the summary returned by the scrub command
+type scrubResult struct {
+	Checked   int      `json:"checked"`
+	Missing   int      `json:"missing"`
+	Stale     int      `json:"stale"`
+	Refreshed int      `json:"refreshed"`
+	Corrupted []string `json:"corrupted"`
+}
+
+// scrub reads every object and checks it against its stored checksums
+func (f *Fs) scrub(ctx context.Context, refresh bool) (*scrubResult, error) {
+	if f.opt.MaxAge <= 0 {
+		return nil, errors.New("checksums are not stored with max_age = 0")
+	}
+	var mu sync.Mutex
+	res := &scrubResult{Corrupted: []string{}}
+	err := operations.ListFn(ctx, f, func(obj fs.Object) {
+		o, ok := obj.(*Object)
+		if !ok {
+			return
+		}
+		tr := accounting.Stats(ctx).NewCheckingTransfer(obj, "scrubbing")
+		status, refreshed, err := o.scrub(ctx, refresh)
+		tr.Done(ctx, err)
+		mu.Lock()
+		defer mu.Unlock()
+		res.Checked++
+		switch {
+		case errors.Is(err, errCorrupted):
+			res.Corrupted = append(res.Corrupted, obj.Remote())
+		case err != nil:
+			fs.Errorf(obj, "Scrub failed: %v", err)
+		}
+		switch status {
+		case scrubMissing:
+			res.Missing++
+		case scrubStale:
+			res.Stale++
+		}
+		if refreshed {
+			res.Refreshed++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(nil, "Summary: %d checked, %d corrupted, %d missing, %d stale, %d refreshed",
+		res.Checked, len(res.Corrupted), res.Missing, res.Stale, res.Refreshed)
+	return res, nil
+}
+
+// scrub reads o in full and checks it against its stored checksums
+//
+// It returns the state of the stored checksums and whether they were
+// refreshed.
+func (o *Object) scrub(ctx context.Context, refresh bool) (status string, refreshed bool, err error) {
+	f := o.f
+	fp := o.fingerprint(ctx)
+	if fp == "" {
+		return "", false, errors.New("fingerprint failed")
+	}
+	want := hashMap{}
+	r, err := f.store.get(ctx, o.Remote(), o.Object)
+	switch {
+	case err != nil || (r.Fp != fp && r.Fp != anyFingerprint):
+		status = scrubMissing
+		fs.Infof(o, "No stored checksums")
+	default:
+		status = scrubOK
+		if time.Since(r.Created) > time.Duration(f.opt.MaxAge) {
+			status = scrubStale
+			fs.Infof(o, "Stored checksums are stale")
+		}
+		for _, hashType := range f.keepHashes.Array() {
+			if hashVal := r.Hashes[hashType.String()]; hashVal != "" {
+				want[hashType] = hashVal
+			}
+		}
+	}
+	if hashType := f.fpHash; hashType != hash.None {
+		if hashVal, err := o.Object.Hash(ctx, hashType); err == nil && hashVal != "" {
+			want[hashType] = hashVal
+		}
+	}
+	got, err := o.readHashes(ctx)
+	if err != nil {
+		return status, false, err
+	}
+	if err := checkHashes(want, got); err != nil {
+		fs.Errorf(o, "Scrub found corruption: %v", err)
+		return status, false, err
+	}
+	if !refresh || status == scrubOK {
+		return status, false, nil
+	}
+	if err := o.putHashes(ctx, f.keptHashes(got)); err != nil {
+		return status, false, err
+	}
+	return status, true, nil
+}
+
+// readHashes reads o in full from the underlying remote and returns
+// its checksums
+func (o *Object) readHashes(ctx context.Context) (sums hashMap, err error) {
+	hasher, err := hash.NewMultiHasherTypes(o.f.verifyHashes())
+	if err != nil {
+		return nil, err
+	}
+	in, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	if _, err = io.Copy(hasher, in); err != nil {
+		return nil, err
+	}
+	return hasher.Sums(), nil
+}
@@ -50,16 +50,62 @@ func init() {
 			Advanced: true,
 			Default:  fs.SizeSuffix(0),
 			Help:     "Auto-update checksum for files smaller than this size (disabled by default).",
+		}, {
+			Name:    "store",
+			Default: storeDB,
+			Help:    "Where to keep the checksums.",
+			Examples: []fs.OptionExample{{
+				Value: storeDB,
+				Help:  "In a database in the rclone cache directory.",
+			}, {
+				Value: storeMetadata,
+				Help:  "In the metadata of each file, e.g. extended attributes on local disks.",
+			}, {
+				Value: storeSidecar,
+				Help:  "In a file next to each file named with sidecar_suffix added.",
+			}, {
+				Value: storeRemote,
+				Help:  "In a file called store_file at the root of the remote.",
+			}},
+		}, {
+			Name:     "sidecar_suffix",
+			Advanced: true,
+			Default:  ".hashes",
+			Help: `Suffix added to the names of files to make the names of their sidecar files.
+
+This is used with store = sidecar. Files with names ending in this
+suffix are hidden and can't be uploaded.`,
+		}, {
+			Name:     "store_file",
+			Advanced: true,
+			Default:  ".hasher.json",
+			Help: `Name of the file at the root of the remote to keep checksums in.
+
+This is used with store = remote.`,
+		}, {
+			Name:     "verify",
+			Advanced: true,
+			Default:  false,
+			Help: `Verify checksums of files when they are read in full.
+
+If set, the checksums of files read in full are worked out as they
+are read and checked against the stored checksums and the checksum
+from the underlying remote if it has one. If they differ the read
+fails with an error rather than returning bad data.`,
 		}},
 	})
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote   string          `config:"remote"`
-	Hashes   fs.CommaSepList `config:"hashes"`
-	AutoSize fs.SizeSuffix   `config:"auto_size"`
-	MaxAge   fs.Duration     `config:"max_age"`
+	Remote        string          `config:"remote"`
+	Hashes        fs.CommaSepList `config:"hashes"`
+	AutoSize      fs.SizeSuffix   `config:"auto_size"`
+	MaxAge        fs.Duration     `config:"max_age"`
+	Store         string          `config:"store"`
+	SidecarSuffix string          `config:"sidecar_suffix"`
+	StoreFile     string          `config:"store_file"`
+	Verify        bool            `config:"verify"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -70,7 +116,8 @@ type Fs struct {
 	wrapper  fs.Fs
 	features *fs.Features
 	opt      *Options
-	db       *kv.DB
+	db       *kv.DB    // database used by the db store
+	store    hashStore // where the checksums are kept
 	// fingerprinting
 	fpTime bool      // true if using time in fingerprints
 	fpHash hash.Type // hash type to use in fingerprints or None
@@ -86,18 +133,17 @@ var warnExperimental sync.Once
 
 // NewFs constructs an Fs from the remote:path string
 func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs.Fs, error) {
-	if !kv.Supported() {
-		return nil, errors.New("hasher is not supported on this OS")
-	}
-	warnExperimental.Do(func() {
-		fs.Infof(nil, "Hasher is EXPERIMENTAL!")
-	})
-
 	opt := &Options{}
 	err := configstruct.Set(cmap, opt)
 	if err != nil {
 		return nil, err
 	}
+	if opt.Store == storeDB && !kv.Supported() {
+		return nil, errors.New("hasher is not supported on this OS")
+	}
+	warnExperimental.Do(func() {
+		fs.Infof(nil, "Hasher is EXPERIMENTAL!")
+	})
 
 	if strings.HasPrefix(opt.Remote, fsname+":") {
 		return nil, errors.New("can't point remote at itself")
@@ -154,13 +200,10 @@ func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs
 		return nil, errors.New("configured hash_names have nothing to keep in cache")
 	}
 
-	if f.opt.MaxAge > 0 {
-		gob.Register(hashRecord{})
-		db, err := kv.Start(ctx, "hasher", f.Fs)
-		if err != nil {
-			return nil, err
-		}
-		f.db = db
+	gob.Register(hashRecord{})
+	var storeErr error
+	if f.store, storeErr = f.newStore(ctx); storeErr != nil {
+		return nil, storeErr
 	}
 
 	stubFeatures := &fs.Features{
@@ -223,6 +266,9 @@ func (f *Fs) wrapEntries(baseEntries fs.DirEntries) (hashEntries fs.DirEntries,
 	for _, entry := range baseEntries {
 		switch x := entry.(type) {
 		case fs.Object:
+			if f.store.isStoreFile(x.Remote()) {
+				continue
+			}
 			obj, err := f.wrapObject(x, nil)
 			if err != nil {
 				return nil, err
@@ -260,9 +306,7 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 		if err := do(ctx, dir); err != nil {
 			return err
 		}
-		err := f.db.Do(true, &kvPurge{
-			dir: path.Join(f.Fs.Root(), dir),
-		})
+		err := f.store.purge(ctx, dir)
 		if err != nil {
 			fs.Errorf(f, "Failed to purge some hashes: %v", err)
 		}
@@ -274,7 +318,10 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 // PutStream uploads to the remote path with undeterminate size.
 func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	if do := f.Fs.Features().PutStream; do != nil {
-		_ = f.pruneHash(src.Remote())
+		if err := f.checkRemote(src.Remote()); err != nil {
+			return nil, err
+		}
+		_ = f.pruneHash(ctx, src.Remote(), nil)
 		oResult, err := do(ctx, in, src, options...)
 		return f.wrapObject(oResult, err)
 	}
@@ -284,7 +331,10 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 // PutUnchecked uploads the object, allowing duplicates.
 func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	if do := f.Fs.Features().PutUnchecked; do != nil {
-		_ = f.pruneHash(src.Remote())
+		if err := f.checkRemote(src.Remote()); err != nil {
+			return nil, err
+		}
+		_ = f.pruneHash(ctx, src.Remote(), nil)
 		oResult, err := do(ctx, in, src, options...)
 		return f.wrapObject(oResult, err)
 	}
@@ -292,10 +342,19 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 }
 
 // pruneHash deletes hash for a path
-func (f *Fs) pruneHash(remote string) error {
-	return f.db.Do(true, &kvPrune{
-		key: path.Join(f.Fs.Root(), remote),
-	})
+//
+// o is the object on the underlying remote if known, otherwise nil
+func (f *Fs) pruneHash(ctx context.Context, remote string, o fs.Object) error {
+	return f.store.prune(ctx, remote, o)
+}
+
+// checkRemote returns an error if remote can't be uploaded as it is
+// used by the store
+func (f *Fs) checkRemote(remote string) error {
+	if f.store.isStoreFile(remote) {
+		return fmt.Errorf("can't upload %q as the name is used to store checksums", remote)
+	}
+	return nil
 }
 
 // CleanUp the trash in the Fs
@@ -388,6 +447,9 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, remote)
 	return f.wrapObject(oResult, err)
 }
@@ -402,16 +464,16 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, remote)
 	if err != nil {
 		return nil, err
 	}
-	_ = f.db.Do(true, &kvMove{
-		src: path.Join(f.Fs.Root(), src.Remote()),
-		dst: path.Join(f.Fs.Root(), remote),
-		dir: false,
-		fs:  f,
-	})
+	if err := f.store.move(ctx, o.f, src.Remote(), remote, false); err != nil {
+		fs.Debugf(f, "Failed to move cached hash %s to %s: %v", src.Remote(), remote, err)
+	}
 	return f.wrapObject(oResult, nil)
 }
 
@@ -427,21 +489,14 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 	}
 	err := do(ctx, srcFs.Fs, srcRemote, dstRemote)
 	if err == nil {
-		_ = f.db.Do(true, &kvMove{
-			src: path.Join(srcFs.Fs.Root(), srcRemote),
-			dst: path.Join(f.Fs.Root(), dstRemote),
-			dir: true,
-			fs:  f,
-		})
+		_ = f.store.move(ctx, srcFs, srcRemote, dstRemote, true)
 	}
 	return err
 }
 
 // Shutdown the backend, closing any background tasks and any cached connections.
 func (f *Fs) Shutdown(ctx context.Context) (err error) {
-	if f.db != nil && !f.db.IsStopped() {
-		err = f.db.Stop(false)
-	}
+	err = f.store.stop(ctx)
 	if do := f.Fs.Features().Shutdown; do != nil {
 		if err2 := do(ctx); err2 != nil {
 			err = err2
@@ -452,6 +507,9 @@ func (f *Fs) Shutdown(ctx context.Context) (err error) {
 
 // NewObject finds the Object at remote.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.store.isStoreFile(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
 	o, err := f.Fs.NewObject(ctx, remote)
 	return f.wrapObject(o, err)
 }
@@ -3,6 +3,7 @@ package hasher
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -46,9 +47,9 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	src := putFile(ctx, t, cryptFs, fileName, "doggy froggy")
 
 	// ensure that hash does not exist yet
-	_ = f.pruneHash(fileName)
+	_ = f.pruneHash(ctx, fileName, nil)
 	hashType := f.keepHashes.GetOne()
-	hash, err := f.getRawHash(ctx, hashType, fileName, anyFingerprint, longTime)
+	hash, err := f.getRawHash(ctx, hashType, fileName, nil, anyFingerprint, longTime)
 	assert.Error(t, err)
 	assert.Empty(t, hash)
 
@@ -61,7 +62,7 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 
 	// check that hash was created
 	if f.opt.MaxAge > 0 {
-		hash, err = f.getRawHash(ctx, hashType, fileName, anyFingerprint, longTime)
+		hash, err = f.getRawHash(ctx, hashType, fileName, nil, anyFingerprint, longTime)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, hash)
 	}
@@ -69,12 +70,55 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	_ = operations.Purge(ctx, f, dirName)
 }
 
+func (f *Fs) testScrub(t *testing.T) {
+	if f.opt.MaxAge <= 0 {
+		t.Skip("checksums are not stored with max_age = 0")
+	}
+	ctx := context.Background()
+	const fileName = "scrub_1/file_1"
+	obj := putFile(ctx, t, f, fileName, "scrub me")
+	defer func() {
+		_ = operations.Purge(ctx, f, "scrub_1")
+	}()
+	o, ok := obj.(*Object)
+	require.True(t, ok)
+
+	res, err := f.scrub(ctx, false)
+	require.NoError(t, err)
+	assert.NotZero(t, res.Checked)
+	assert.Empty(t, res.Corrupted)
+
+	// replace the stored checksum with a wrong one
+	hashType := f.keepHashes.GetOne()
+	fp := o.fingerprint(ctx)
+	require.NotEmpty(t, fp)
+	require.NoError(t, f.putRawHashes(ctx, fileName, o.Object, fp, operations.HashSums{
+		hashType.String(): "0123456789abcdef",
+	}))
+
+	res, err = f.scrub(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{fileName}, res.Corrupted)
+
+	// reading in full should fail if verifying
+	f.opt.Verify = true
+	defer func() {
+		f.opt.Verify = false
+	}()
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(in)
+	assert.ErrorIs(t, err, errCorrupted)
+	require.NoError(t, in.Close())
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	if !kv.Supported() {
 		t.Skip("hasher is not supported on this OS")
 	}
 	t.Run("UploadFromCrypt", f.testUploadFromCrypt)
+	t.Run("Scrub", f.testScrub)
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
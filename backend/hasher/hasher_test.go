@@ -37,6 +37,15 @@ func TestIntegration(t *testing.T) {
 		opt.QuickTestOK = true
 	}
 	fstests.Run(t, &opt)
+	if *fstest.RemoteName == "" {
+		// test again with the other stores
+		extraConfig := opt.ExtraConfig
+		for _, store := range []string{"metadata", "sidecar", "remote"} {
+			opt.ExtraConfig = append(extraConfig, fstests.ExtraConfigItem{Name: "TestHasher", Key: "store", Value: store})
+			fstests.Run(t, &opt)
+		}
+		opt.ExtraConfig = extraConfig
+	}
 	// test again with MaxAge = 0
 	if *fstest.RemoteName == "" {
 		opt.ExtraConfig = append(opt.ExtraConfig, fstests.ExtraConfigItem{Name: "TestHasher", Key: "max_age", Value: "0"})
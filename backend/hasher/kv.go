@@ -23,9 +23,9 @@ const (
 type hashMap map[hash.Type]string
 
 type hashRecord struct {
-	Fp      string // fingerprint
-	Hashes  operations.HashSums
-	Created time.Time
+	Fp      string              `json:"fingerprint"`
+	Hashes  operations.HashSums `json:"hashes"`
+	Created time.Time           `json:"created"`
 }
 
 func (r *hashRecord) encode(key string) ([]byte, error) {
@@ -45,6 +45,37 @@ func (r *hashRecord) decode(key string, data []byte) error {
 	return nil
 }
 
+// lookup returns the hash called hashName from the record if it is
+// for fingerprint fp and no older than age
+func (r *hashRecord) lookup(fp, hashName string, age time.Duration) (string, error) {
+	if !(r.Fp == anyFingerprint || fp == anyFingerprint || r.Fp == fp) {
+		return "", errors.New("fingerprint changed")
+	}
+	if time.Since(r.Created) > age {
+		return "", errors.New("record timed out")
+	}
+	if r.Hashes == nil {
+		return "", nil
+	}
+	return r.Hashes[hashName], nil
+}
+
+// merge adds hashes for fingerprint fp to the record, starting a new
+// record if it is for a different fingerprint or older than age
+func (r *hashRecord) merge(fp string, hashes operations.HashSums, age time.Duration) {
+	if r.Fp != fp || time.Since(r.Created) > age {
+		r.Hashes = nil
+	}
+	if len(r.Hashes) == 0 {
+		r.Created = time.Now()
+		r.Hashes = operations.HashSums{}
+		r.Fp = fp
+	}
+	for hashType, hashVal := range hashes {
+		r.Hashes[hashType] = hashVal
+	}
+}
+
 // kvPrune: prune a single hash
 type kvPrune struct {
 	key string
@@ -142,32 +173,19 @@ func moveHash(b kv.Bucket, src, dst string) error {
 	return b.Put([]byte(dst), data)
 }
 
-// kvGet: get single hash from database
+// kvGet: get the hash record for a key from database
 type kvGet struct {
-	key  string
-	fp   string
-	hash string
-	val  string
-	age  time.Duration
+	key string
+	r   hashRecord
 }
 
 func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
 	data := b.Get([]byte(op.key))
 	if len(data) == 0 {
-		return errors.New("no record")
-	}
-	var r hashRecord
-	if err := r.decode(op.key, data); err != nil {
-		return errors.New("invalid record")
-	}
-	if !(r.Fp == anyFingerprint || op.fp == anyFingerprint || r.Fp == op.fp) {
-		return errors.New("fingerprint changed")
+		return errNoRecord
 	}
-	if time.Since(r.Created) > op.age {
-		return errors.New("record timed out")
-	}
-	if r.Hashes != nil {
-		op.val = r.Hashes[op.hash]
+	if err := op.r.decode(op.key, data); err != nil {
+		return errInvalidRecord
 	}
 	return nil
 }
@@ -183,21 +201,10 @@ type kvPut struct {
 func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 	data := b.Get([]byte(op.key))
 	var r hashRecord
-	if len(data) > 0 {
-		err = r.decode(op.key, data)
-		if err != nil || r.Fp != op.fp || time.Since(r.Created) > op.age {
-			r.Hashes = nil
-		}
-	}
-	if len(r.Hashes) == 0 {
-		r.Created = time.Now()
-		r.Hashes = operations.HashSums{}
-		r.Fp = op.fp
-	}
-
-	for hashType, hashVal := range op.hashes {
-		r.Hashes[hashType] = hashVal
+	if len(data) > 0 && r.decode(op.key, data) != nil {
+		r = hashRecord{}
 	}
+	r.merge(op.fp, op.hashes, op.age)
 	if data, err = r.encode(op.key); err != nil {
 		return fmt.Errorf("marshal failed: %w", err)
 	}
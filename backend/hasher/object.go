@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"path"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -13,6 +12,9 @@ import (
 	"github.com/rclone/rclone/fs/operations"
 )
 
+// errCorrupted is returned when the data read doesn't match its checksums
+var errCorrupted = errors.New("corrupted on read")
+
 // obtain hash for an object
 func (o *Object) getHash(ctx context.Context, hashType hash.Type) (string, error) {
 	maxAge := time.Duration(o.f.opt.MaxAge)
@@ -23,20 +25,18 @@ func (o *Object) getHash(ctx context.Context, hashType hash.Type) (string, error
 	if fp == "" {
 		return "", errors.New("fingerprint failed")
 	}
-	return o.f.getRawHash(ctx, hashType, o.Remote(), fp, maxAge)
+	return o.f.getRawHash(ctx, hashType, o.Remote(), o.Object, fp, maxAge)
 }
 
 // obtain hash for a path
-func (f *Fs) getRawHash(ctx context.Context, hashType hash.Type, remote, fp string, age time.Duration) (string, error) {
-	key := path.Join(f.Fs.Root(), remote)
-	op := &kvGet{
-		key:  key,
-		fp:   fp,
-		hash: hashType.String(),
-		age:  age,
-	}
-	err := f.db.Do(false, op)
-	return op.val, err
+//
+// o is the object on the underlying remote if known, otherwise nil
+func (f *Fs) getRawHash(ctx context.Context, hashType hash.Type, remote string, o fs.Object, fp string, age time.Duration) (string, error) {
+	r, err := f.store.get(ctx, remote, o)
+	if err != nil {
+		return "", err
+	}
+	return r.lookup(fp, hashType.String(), age)
 }
 
 // put new hashes for an object
@@ -48,22 +48,18 @@ func (o *Object) putHashes(ctx context.Context, rawHashes hashMap) error {
 	if fp == "" {
 		return nil
 	}
-	key := path.Join(o.f.Fs.Root(), o.Remote())
 	hashes := operations.HashSums{}
 	for hashType, hashVal := range rawHashes {
 		hashes[hashType.String()] = hashVal
 	}
-	return o.f.putRawHashes(ctx, key, fp, hashes)
+	return o.f.putRawHashes(ctx, o.Remote(), o.Object, fp, hashes)
 }
 
 // set hashes for a path without any validation
-func (f *Fs) putRawHashes(ctx context.Context, key, fp string, hashes operations.HashSums) error {
-	return f.db.Do(true, &kvPut{
-		key:    key,
-		fp:     fp,
-		hashes: hashes,
-		age:    time.Duration(f.opt.MaxAge),
-	})
+//
+// o is the object on the underlying remote if known, otherwise nil
+func (f *Fs) putRawHashes(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error {
+	return f.store.put(ctx, remote, o, fp, hashes)
 }
 
 // Hash returns the selected checksum of the file or "" if unavailable.
@@ -133,13 +129,13 @@ func (o *Object) updateHashes(ctx context.Context) error {
 
 // Update the object with the given data, time and size.
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
-	_ = o.f.pruneHash(src.Remote())
+	_ = o.f.pruneHash(ctx, src.Remote(), o.Object)
 	return o.Object.Update(ctx, in, src, options...)
 }
 
 // Remove an object.
 func (o *Object) Remove(ctx context.Context) error {
-	_ = o.f.pruneHash(o.Remote())
+	_ = o.f.store.remove(ctx, o.Remote())
 	return o.Object.Remove(ctx)
 }
 
@@ -149,7 +145,7 @@ func (o *Object) Remove(ctx context.Context) error {
 // on backends that don't provide modTime with fingerprint.
 func (o *Object) SetModTime(ctx context.Context, mtime time.Time) error {
 	if mtime != o.Object.ModTime(ctx) {
-		_ = o.f.pruneHash(o.Remote())
+		_ = o.f.pruneHash(ctx, o.Remote(), o.Object)
 	}
 	return o.Object.SetModTime(ctx, mtime)
 }
@@ -180,11 +176,81 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (r io.ReadC
 		// It's a partial read
 		return r, err
 	}
-	return o.f.newHashingReader(ctx, r, func(sums hashMap) {
-		if err := o.putHashes(ctx, sums); err != nil {
+	if !o.f.opt.Verify {
+		return o.f.newHashingReader(ctx, r, o.f.keepHashes, func(sums hashMap) {
+			if err := o.putHashes(ctx, sums); err != nil {
+				fs.Infof(o, "auto hashing error: %v", err)
+			}
+		})
+	}
+	want := o.wantHashes(ctx)
+	hr, err := o.f.newHashingReader(ctx, r, o.f.verifyHashes(), func(sums hashMap) {
+		if err := o.putHashes(ctx, o.f.keptHashes(sums)); err != nil {
 			fs.Infof(o, "auto hashing error: %v", err)
 		}
 	})
+	if err != nil {
+		return nil, err
+	}
+	hr.check = func(sums hashMap) error {
+		err := checkHashes(want, sums)
+		if err != nil {
+			fs.Errorf(o, "Verify failed: %v", err)
+		}
+		return err
+	}
+	return hr, nil
+}
+
+// verifyHashes returns the checksums to work out when verifying a
+// read, which are the ones kept in the store and the fast one from
+// the underlying remote used in fingerprints
+func (f *Fs) verifyHashes() hash.Set {
+	hashes := f.keepHashes
+	if f.fpHash != hash.None {
+		hashes.Add(f.fpHash)
+	}
+	return hashes
+}
+
+// keptHashes returns the checksums from sums which are kept in the store
+func (f *Fs) keptHashes(sums hashMap) hashMap {
+	kept := hashMap{}
+	for hashType, hashVal := range sums {
+		if f.keepHashes.Contains(hashType) {
+			kept[hashType] = hashVal
+		}
+	}
+	return kept
+}
+
+// wantHashes returns the checksums a full read of the object should
+// have from the store and the underlying remote
+func (o *Object) wantHashes(ctx context.Context) hashMap {
+	want := hashMap{}
+	for _, hashType := range o.f.keepHashes.Array() {
+		if hashVal, err := o.getHash(ctx, hashType); err == nil && hashVal != "" {
+			want[hashType] = hashVal
+		}
+	}
+	if hashType := o.f.fpHash; hashType != hash.None {
+		if hashVal, err := o.Object.Hash(ctx, hashType); err == nil && hashVal != "" {
+			want[hashType] = hashVal
+		}
+	}
+	return want
+}
+
+// checkHashes returns errCorrupted if any of the checksums in got
+// differ from the ones in want
+func checkHashes(want, got hashMap) error {
+	for _, hashType := range hash.Supported().Array() {
+		wantVal, gotVal := want[hashType], got[hashType]
+		if wantVal != "" && gotVal != "" && !hash.Equals(wantVal, gotVal) {
+			return fmt.Errorf("%w: %v differ %q vs %q", errCorrupted, hashType, wantVal, gotVal)
+		}
+	}
+	return nil
 }
 
 // Put data into the remote path with given modTime and size
@@ -195,6 +261,9 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 		rehash bool
 		hashes hashMap
 	)
+	if err := f.checkRemote(src.Remote()); err != nil {
+		return nil, err
+	}
 	if fsrc := src.Fs(); fsrc != nil {
 		common = fsrc.Hashes().Overlap(f.keepHashes)
 		// Rehash if source does not have all required hashes or hashing is slow
@@ -203,7 +272,7 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 
 	wrapIn := in
 	if rehash {
-		r, err := f.newHashingReader(ctx, in, func(sums hashMap) {
+		r, err := f.newHashingReader(ctx, in, f.keepHashes, func(sums hashMap) {
 			hashes = sums
 		})
 		fs.Debugf(src, "Rehash in-fly due to incomplete or slow source set %v (err: %v)", common, err)
@@ -214,7 +283,7 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 		}
 	}
 
-	_ = f.pruneHash(src.Remote())
+	_ = f.pruneHash(ctx, src.Remote(), nil)
 	oResult, err := f.Fs.Put(ctx, wrapIn, src, options...)
 	o, err = f.wrapObject(oResult, err)
 	if err != nil {
@@ -240,10 +309,11 @@ type hashingReader struct {
 	rd     io.Reader
 	hasher *hash.MultiHasher
 	fun    func(hashMap)
+	check  func(hashMap) error // if set, called before fun and fails the read on error
 }
 
-func (f *Fs) newHashingReader(ctx context.Context, rd io.Reader, fun func(hashMap)) (*hashingReader, error) {
-	hasher, err := hash.NewMultiHasherTypes(f.keepHashes)
+func (f *Fs) newHashingReader(ctx context.Context, rd io.Reader, hashes hash.Set, fun func(hashMap)) (*hashingReader, error) {
+	hasher, err := hash.NewMultiHasherTypes(hashes)
 	if err != nil {
 		return nil, err
 	}
@@ -267,8 +337,14 @@ func (r *hashingReader) Read(p []byte) (n int, err error) {
 		}
 	}
 	if err == io.EOF && r.hasher != nil {
-		r.fun(r.hasher.Sums())
+		sums := r.hasher.Sums()
 		r.hasher = nil
+		if r.check != nil {
+			if errCheck := r.check(sums); errCheck != nil {
+				return n, errCheck
+			}
+		}
+		r.fun(sums)
 	}
 	return
 }
@@ -0,0 +1,380 @@
+package hasher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// Places the checksums can be kept
+const (
+	storeDB       = "db"
+	storeMetadata = "metadata"
+	storeSidecar  = "sidecar"
+	storeRemote   = "remote"
+)
+
+// Errors returned when there is no usable record
+var (
+	errNoRecord      = errors.New("no record")
+	errInvalidRecord = errors.New("invalid record")
+)
+
+// hashStore keeps the checksums of the objects of a hasher remote
+//
+// The paths passed in are relative to the root of the remote. The
+// object from the underlying remote is passed in if known, otherwise
+// it is nil.
+type hashStore interface {
+	// get returns the record for remote
+	get(ctx context.Context, remote string, o fs.Object) (*hashRecord, error)
+	// put merges hashes for fingerprint fp into the record for remote
+	put(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error
+	// prune deletes the record for remote as it is about to change
+	prune(ctx context.Context, remote string, o fs.Object) error
+	// remove deletes the record for remote as it is being deleted
+	remove(ctx context.Context, remote string) error
+	// purge deletes the records for everything in dir
+	purge(ctx context.Context, dir string) error
+	// move moves the record for src in srcFs to dst, or all the
+	// records in src if dir is set
+	move(ctx context.Context, srcFs *Fs, src, dst string, dir bool) error
+	// isStoreFile returns true if remote is used by the store so
+	// should be hidden
+	isStoreFile(remote string) bool
+	// stop saves any changes and stops the store
+	stop(ctx context.Context) error
+}
+
+// newStore makes the hashStore configured for f
+func (f *Fs) newStore(ctx context.Context) (hashStore, error) {
+	if f.opt.MaxAge <= 0 {
+		// The db isn't started so everything returns kv.ErrInactive
+		return &dbStore{f: f}, nil
+	}
+	switch f.opt.Store {
+	case storeDB:
+		db, err := kv.Start(ctx, "hasher", f.Fs)
+		if err != nil {
+			return nil, err
+		}
+		f.db = db
+		return &dbStore{f: f}, nil
+	case storeMetadata:
+		features := f.Fs.Features()
+		if !features.UserMetadata || !features.WriteMetadata {
+			return nil, fmt.Errorf("store = %s needs a remote which can write user metadata", storeMetadata)
+		}
+		return &metadataStore{f: f}, nil
+	case storeSidecar:
+		suffix := f.opt.SidecarSuffix
+		if suffix == "" || strings.Contains(suffix, "/") {
+			return nil, fmt.Errorf("invalid sidecar_suffix %q", suffix)
+		}
+		return &sidecarStore{f: f, suffix: suffix}, nil
+	case storeRemote:
+		return newRemoteStore(ctx, f)
+	}
+	return nil, fmt.Errorf("unknown store %q", f.opt.Store)
+}
+
+// readFile reads the contents of remote on f
+//
+// It returns fs.ErrorObjectNotFound if remote doesn't exist.
+func readFile(ctx context.Context, f fs.Fs, remote string) ([]byte, error) {
+	o, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return operations.ReadFile(ctx, o)
+}
+
+// writeFile writes data to remote on f, replacing it if it exists
+func writeFile(ctx context.Context, f fs.Fs, remote string, data []byte) error {
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, f)
+	o, err := f.NewObject(ctx, remote)
+	if err == nil {
+		return o.Update(ctx, bytes.NewReader(data), src)
+	}
+	_, err = f.Put(ctx, bytes.NewReader(data), src)
+	return err
+}
+
+// dbStore keeps the checksums in a bolt database in the rclone cache
+// directory
+type dbStore struct {
+	f *Fs
+}
+
+// key returns the database key for remote
+func (s *dbStore) key(f *Fs, remote string) string {
+	return path.Join(f.Fs.Root(), remote)
+}
+
+func (s *dbStore) get(ctx context.Context, remote string, o fs.Object) (*hashRecord, error) {
+	op := &kvGet{key: s.key(s.f, remote)}
+	if err := s.f.db.Do(false, op); err != nil {
+		return nil, err
+	}
+	return &op.r, nil
+}
+
+func (s *dbStore) put(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error {
+	return s.f.db.Do(true, &kvPut{
+		key:    s.key(s.f, remote),
+		fp:     fp,
+		hashes: hashes,
+		age:    time.Duration(s.f.opt.MaxAge),
+	})
+}
+
+func (s *dbStore) prune(ctx context.Context, remote string, o fs.Object) error {
+	return s.f.db.Do(true, &kvPrune{
+		key: s.key(s.f, remote),
+	})
+}
+
+func (s *dbStore) remove(ctx context.Context, remote string) error {
+	return s.prune(ctx, remote, nil)
+}
+
+func (s *dbStore) purge(ctx context.Context, dir string) error {
+	return s.f.db.Do(true, &kvPurge{
+		dir: s.key(s.f, dir),
+	})
+}
+
+func (s *dbStore) move(ctx context.Context, srcFs *Fs, src, dst string, dir bool) error {
+	return s.f.db.Do(true, &kvMove{
+		src: s.key(srcFs, src),
+		dst: s.key(s.f, dst),
+		dir: dir,
+		fs:  s.f,
+	})
+}
+
+func (s *dbStore) isStoreFile(remote string) bool {
+	return false
+}
+
+func (s *dbStore) stop(ctx context.Context) error {
+	if s.f.db != nil && !s.f.db.IsStopped() {
+		return s.f.db.Stop(false)
+	}
+	return nil
+}
+
+// Metadata keys used by the metadata store. The checksums are kept
+// in metadataPrefix followed by the hash name.
+const (
+	metadataPrefix      = "rclone."
+	metadataFingerprint = metadataPrefix + "fingerprint"
+	metadataCreated     = metadataPrefix + "hashed"
+)
+
+// metadataStore keeps the checksums in the metadata of each object,
+// which is extended attributes on the local backend
+type metadataStore struct {
+	f *Fs
+}
+
+// object returns o or finds the object at remote if o is nil
+func (s *metadataStore) object(ctx context.Context, remote string, o fs.Object) (fs.Object, error) {
+	if o != nil {
+		return o, nil
+	}
+	return s.f.Fs.NewObject(ctx, remote)
+}
+
+func (s *metadataStore) get(ctx context.Context, remote string, o fs.Object) (*hashRecord, error) {
+	o, err := s.object(ctx, remote, o)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := fs.GetMetadata(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	r := &hashRecord{
+		Fp:     metadata[metadataFingerprint],
+		Hashes: operations.HashSums{},
+	}
+	if r.Fp == "" {
+		return nil, errNoRecord
+	}
+	if r.Created, err = time.Parse(time.RFC3339Nano, metadata[metadataCreated]); err != nil {
+		return nil, errInvalidRecord
+	}
+	for _, hashType := range s.f.keepHashes.Array() {
+		if hashVal := metadata[metadataPrefix+hashType.String()]; hashVal != "" {
+			r.Hashes[hashType.String()] = hashVal
+		}
+	}
+	return r, nil
+}
+
+// set writes the metadata to o
+func (s *metadataStore) set(ctx context.Context, o fs.Object, metadata fs.Metadata) error {
+	do, ok := o.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+func (s *metadataStore) put(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error {
+	o, err := s.object(ctx, remote, o)
+	if err != nil {
+		return err
+	}
+	r, err := s.get(ctx, remote, o)
+	if err != nil {
+		r = &hashRecord{}
+	}
+	r.merge(fp, hashes, time.Duration(s.f.opt.MaxAge))
+	metadata := fs.Metadata{
+		metadataFingerprint: r.Fp,
+		metadataCreated:     r.Created.Format(time.RFC3339Nano),
+	}
+	// Blank any checksums not in the record so stale ones aren't read back
+	for _, hashType := range s.f.keepHashes.Array() {
+		metadata[metadataPrefix+hashType.String()] = r.Hashes[hashType.String()]
+	}
+	return s.set(ctx, o, metadata)
+}
+
+func (s *metadataStore) prune(ctx context.Context, remote string, o fs.Object) error {
+	o, err := s.object(ctx, remote, o)
+	if err == fs.ErrorObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.set(ctx, o, fs.Metadata{metadataFingerprint: ""})
+}
+
+func (s *metadataStore) remove(ctx context.Context, remote string) error {
+	// The metadata is deleted with the object
+	return nil
+}
+
+func (s *metadataStore) purge(ctx context.Context, dir string) error {
+	return nil
+}
+
+func (s *metadataStore) move(ctx context.Context, srcFs *Fs, src, dst string, dir bool) error {
+	// The metadata moves with the object
+	return nil
+}
+
+func (s *metadataStore) isStoreFile(remote string) bool {
+	return false
+}
+
+func (s *metadataStore) stop(ctx context.Context) error {
+	return nil
+}
+
+// sidecarStore keeps the checksums of each object in a file next to
+// it with the suffix added
+type sidecarStore struct {
+	f      *Fs
+	suffix string
+}
+
+// sidecar returns the path of the sidecar file for remote
+func (s *sidecarStore) sidecar(remote string) string {
+	return remote + s.suffix
+}
+
+func (s *sidecarStore) get(ctx context.Context, remote string, o fs.Object) (*hashRecord, error) {
+	data, err := readFile(ctx, s.f.Fs, s.sidecar(remote))
+	if err == fs.ErrorObjectNotFound {
+		return nil, errNoRecord
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &hashRecord{}
+	if err := json.Unmarshal(data, r); err != nil {
+		fs.Debugf(s.sidecar(remote), "hasher decoding failed: %v", err)
+		return nil, errInvalidRecord
+	}
+	return r, nil
+}
+
+func (s *sidecarStore) put(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error {
+	r, err := s.get(ctx, remote, o)
+	if err != nil {
+		r = &hashRecord{}
+	}
+	r.merge(fp, hashes, time.Duration(s.f.opt.MaxAge))
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	return writeFile(ctx, s.f.Fs, s.sidecar(remote), data)
+}
+
+func (s *sidecarStore) prune(ctx context.Context, remote string, o fs.Object) error {
+	sidecar, err := s.f.Fs.NewObject(ctx, s.sidecar(remote))
+	if err == fs.ErrorObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return sidecar.Remove(ctx)
+}
+
+func (s *sidecarStore) remove(ctx context.Context, remote string) error {
+	return s.prune(ctx, remote, nil)
+}
+
+func (s *sidecarStore) purge(ctx context.Context, dir string) error {
+	// The sidecars are purged with the directory
+	return nil
+}
+
+func (s *sidecarStore) move(ctx context.Context, srcFs *Fs, src, dst string, dir bool) error {
+	if dir {
+		// The sidecars move with the directory
+		return nil
+	}
+	srcStore, ok := srcFs.store.(*sidecarStore)
+	if !ok {
+		return nil
+	}
+	sidecar, err := srcFs.Fs.NewObject(ctx, srcStore.sidecar(src))
+	if err == fs.ErrorObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	do := s.f.Fs.Features().Move
+	if do == nil {
+		return fs.ErrorCantMove
+	}
+	_, err = do(ctx, sidecar, s.sidecar(dst))
+	return err
+}
+
+func (s *sidecarStore) isStoreFile(remote string) bool {
+	return strings.HasSuffix(remote, s.suffix)
+}
+
+func (s *sidecarStore) stop(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,267 @@
+package hasher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+// hashFileVersion is the version of the format of the hash file
+const hashFileVersion = 1
+
+// The hash files in use so all the Fs using the same file share the
+// records
+var (
+	hashFilesMu sync.Mutex
+	hashFiles   = make(map[string]*hashFile)
+)
+
+// hashFileContents is the format of the hash file
+type hashFileContents struct {
+	Version int                    `json:"version"`
+	Records map[string]*hashRecord `json:"records"`
+}
+
+// hashFile is a file on a remote holding the checksums for the files
+// under it, which can be shared by several rclone processes
+type hashFile struct {
+	f       fs.Fs  // the remote the file is on
+	name    string // the name of the file
+	handle  atexit.FnHandle
+	mu      sync.Mutex
+	records map[string]*hashRecord // the records as last read plus changes
+	changed map[string]*hashRecord // records changed since last saved - nil if deleted
+}
+
+// getHashFile returns the hash file called name on f, reading it if
+// it isn't in use yet
+func getHashFile(ctx context.Context, f fs.Fs, name string) (*hashFile, error) {
+	hashFilesMu.Lock()
+	defer hashFilesMu.Unlock()
+	key := path.Join(fs.ConfigString(f), name)
+	if h := hashFiles[key]; h != nil {
+		return h, nil
+	}
+	h := &hashFile{
+		f:       f,
+		name:    name,
+		changed: make(map[string]*hashRecord),
+	}
+	var err error
+	h.records, err = h.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.handle = atexit.Register(func() {
+		if err := h.save(context.Background()); err != nil {
+			fs.Errorf(h, "Failed to save checksums: %v", err)
+		}
+	})
+	hashFiles[key] = h
+	return h, nil
+}
+
+// String returns a description of the hash file for logging
+func (h *hashFile) String() string {
+	return path.Join(fs.ConfigString(h.f), h.name)
+}
+
+// read the records from the file
+func (h *hashFile) read(ctx context.Context) (map[string]*hashRecord, error) {
+	data, err := readFile(ctx, h.f, h.name)
+	if err == fs.ErrorObjectNotFound {
+		return make(map[string]*hashRecord), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksums from %v: %w", h, err)
+	}
+	var contents hashFileContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("failed to decode checksums from %v: %w", h, err)
+	}
+	if contents.Version > hashFileVersion {
+		return nil, fmt.Errorf("checksums in %v are version %d but this rclone only understands up to version %d", h, contents.Version, hashFileVersion)
+	}
+	if contents.Records == nil {
+		contents.Records = make(map[string]*hashRecord)
+	}
+	return contents.Records, nil
+}
+
+// save the changes made since the file was read
+//
+// The file is read again first and the changes applied to it so
+// changes saved by other rclone processes are kept.
+func (h *hashFile) save(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.changed) == 0 {
+		return nil
+	}
+	records, err := h.read(ctx)
+	if err != nil {
+		return err
+	}
+	for key, r := range h.changed {
+		if r == nil {
+			delete(records, key)
+		} else {
+			records[key] = r
+		}
+	}
+	data, err := json.Marshal(hashFileContents{
+		Version: hashFileVersion,
+		Records: records,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err := writeFile(ctx, h.f, h.name, data); err != nil {
+		return fmt.Errorf("failed to write checksums to %v: %w", h, err)
+	}
+	fs.Debugf(h, "Saved %d changed checksum records", len(h.changed))
+	h.records = records
+	h.changed = make(map[string]*hashRecord)
+	return nil
+}
+
+// set the record for key, deleting it if r is nil
+//
+// Call with mu held.
+func (h *hashFile) set(key string, r *hashRecord) {
+	if r == nil {
+		delete(h.records, key)
+	} else {
+		h.records[key] = r
+	}
+	h.changed[key] = r
+}
+
+// remoteStore keeps the checksums in a file at the root of the remote
+// being wrapped
+type remoteStore struct {
+	f *Fs
+	h *hashFile
+}
+
+// newRemoteStore makes a remoteStore for f
+func newRemoteStore(ctx context.Context, f *Fs) (*remoteStore, error) {
+	name := f.opt.StoreFile
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid store_file %q", name)
+	}
+	rootFs, err := cache.Get(ctx, f.opt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to keep checksums on: %w", f.opt.Remote, err)
+	}
+	h, err := getHashFile(ctx, rootFs, name)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteStore{f: f, h: h}, nil
+}
+
+// key returns the key of remote in the hash file
+func (s *remoteStore) key(f *Fs, remote string) string {
+	return strings.Trim(path.Join(f.root, remote), "/")
+}
+
+func (s *remoteStore) get(ctx context.Context, remote string, o fs.Object) (*hashRecord, error) {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	r := s.h.records[s.key(s.f, remote)]
+	if r == nil {
+		return nil, errNoRecord
+	}
+	rCopy := *r
+	return &rCopy, nil
+}
+
+func (s *remoteStore) put(ctx context.Context, remote string, o fs.Object, fp string, hashes operations.HashSums) error {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	key := s.key(s.f, remote)
+	r := &hashRecord{}
+	if old := s.h.records[key]; old != nil {
+		*r = *old
+		r.Hashes = make(operations.HashSums, len(old.Hashes))
+		for hashType, hashVal := range old.Hashes {
+			r.Hashes[hashType] = hashVal
+		}
+	}
+	r.merge(fp, hashes, time.Duration(s.f.opt.MaxAge))
+	s.h.set(key, r)
+	return nil
+}
+
+func (s *remoteStore) prune(ctx context.Context, remote string, o fs.Object) error {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	key := s.key(s.f, remote)
+	if _, found := s.h.records[key]; found {
+		s.h.set(key, nil)
+	}
+	return nil
+}
+
+// keysIn returns the keys of the records in dir
+//
+// Call with mu held.
+func (s *remoteStore) keysIn(dir string) (keys []string) {
+	prefix := dir + "/"
+	for key := range s.h.records {
+		if dir == "" || strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (s *remoteStore) remove(ctx context.Context, remote string) error {
+	return s.prune(ctx, remote, nil)
+}
+
+func (s *remoteStore) purge(ctx context.Context, dir string) error {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	for _, key := range s.keysIn(s.key(s.f, dir)) {
+		s.h.set(key, nil)
+	}
+	return nil
+}
+
+func (s *remoteStore) move(ctx context.Context, srcFs *Fs, src, dst string, dir bool) error {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	srcKey, dstKey := s.key(srcFs, src), s.key(s.f, dst)
+	if !dir {
+		if r := s.h.records[srcKey]; r != nil {
+			s.h.set(srcKey, nil)
+			s.h.set(dstKey, r)
+		}
+		return nil
+	}
+	for _, key := range s.keysIn(srcKey) {
+		r := s.h.records[key]
+		s.h.set(key, nil)
+		s.h.set(dstKey+strings.TrimPrefix(key, srcKey), r)
+	}
+	return nil
+}
+
+func (s *remoteStore) isStoreFile(remote string) bool {
+	return s.key(s.f, remote) == s.h.name
+}
+
+func (s *remoteStore) stop(ctx context.Context) error {
+	return s.h.save(ctx)
+}
@@ -0,0 +1,373 @@
+//go:build linux
+
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/sys/unix"
+)
+
+// The inotify events we are interested in
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// changedSlack is how long before the watcher started a directory
+// can be modified and still be counted as changed while adding the
+// watches, as directory modification times are coarse.
+const changedSlack = time.Second
+
+// watchedDir is a directory with an inotify watch on it
+type watchedDir struct {
+	localPath string // the local path (OS path)
+	remote    string // the remote path (standard path)
+}
+
+// watcher watches a directory tree recursively with inotify and
+// accumulates the changed paths until they are collected.
+type watcher struct {
+	ctx         context.Context    // stops adding watches when cancelled
+	cancel      context.CancelFunc // cancels ctx
+	f           *Fs
+	started     time.Time               // directories modified after this are changed
+	fd          int                     // inotify file descriptor
+	file        *os.File                // fd wrapped so reads can be interrupted by Close
+	wg          sync.WaitGroup          // for the reading goroutine
+	walkWg      sync.WaitGroup          // for the goroutine adding the watches
+	mu          sync.Mutex              // protects the items below
+	dirs        map[int]watchedDir      // watch descriptor to directory
+	changes     map[string]fs.EntryType // changes seen since the last drain
+	warned      bool                    // set if we've warned about running out of watches
+	rootWatched bool                    // set if the root has a watch on it
+	walking     bool                    // set while the watches are being added
+}
+
+// ChangeNotify calls the passed function with a path that has had
+// changes. The changes are detected with inotify on the whole
+// directory tree under the root and are delivered in batches every
+// poll interval.
+//
+// Sending a poll interval of 0 on the channel stops watching the
+// tree and closing the channel stops the notifications altogether.
+//
+// Adding the watches means walking the whole tree which can take a
+// long time, so this is done in the background and stopped if ctx is
+// cancelled. If the root doesn't exist yet then watching it is retried
+// every poll interval.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	go func() {
+		var (
+			w       *watcher
+			err     error
+			ticker  *time.Ticker
+			tickerC <-chan time.Time
+		)
+		stopWatcher := func() {
+			if w != nil {
+				w.close()
+				w = nil
+			}
+		}
+		for {
+			select {
+			case pollInterval, ok := <-pollIntervalChan:
+				if !ok {
+					if ticker != nil {
+						ticker.Stop()
+					}
+					stopWatcher()
+					return
+				}
+				if ticker != nil {
+					ticker.Stop()
+					ticker, tickerC = nil, nil
+				}
+				if pollInterval == 0 {
+					stopWatcher()
+					continue
+				}
+				if w == nil {
+					w, err = f.newWatcher(ctx)
+					if err != nil {
+						fs.Errorf(f, "Failed to start change notify: %v", err)
+						continue
+					}
+				}
+				ticker = time.NewTicker(pollInterval)
+				tickerC = ticker.C
+			case <-tickerC:
+				w.watchRoot(true)
+				for _, c := range w.drain() {
+					notifyFunc(c.path, c.entryType)
+				}
+			}
+		}
+	}()
+}
+
+// newWatcher creates an inotify instance and starts adding watches
+// for every directory under the root in the background.
+//
+// Adding the watches stops if ctx is cancelled or the watcher is
+// closed.
+func (f *Fs) newWatcher(ctx context.Context) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{
+		ctx:     ctx,
+		cancel:  cancel,
+		f:       f,
+		started: time.Now().Add(-changedSlack),
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		dirs:    make(map[int]watchedDir),
+		changes: make(map[string]fs.EntryType),
+	}
+	w.wg.Add(1)
+	go w.run()
+	w.watchRoot(false)
+	return w, nil
+}
+
+// watchRoot starts adding the watches for the tree under the root in
+// the background if the root isn't watched and this isn't in progress
+// already.
+//
+// If report is set then everything found is recorded as changed. This
+// is used if the root didn't exist when the watcher was started.
+func (w *watcher) watchRoot(report bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rootWatched || w.walking || w.ctx.Err() != nil {
+		return
+	}
+	w.walking = true
+	w.walkWg.Add(1)
+	go func() {
+		defer w.walkWg.Done()
+		added := w.addDir(w.f.root, "", report)
+		w.mu.Lock()
+		w.rootWatched = w.rootWatched || added
+		w.walking = false
+		w.mu.Unlock()
+	}()
+}
+
+// addDir adds a watch to the directory and all the directories
+// beneath it, returning true if the directory itself was watched.
+//
+// If report is set then everything found in the directories is
+// recorded as changed. This is used for new directories as their
+// contents may have been created before the watch was in place. It
+// is set for directories modified since the watcher started too, as
+// the watches are added in the background.
+func (w *watcher) addDir(localPath, remote string, report bool) bool {
+	if w.ctx.Err() != nil {
+		return false
+	}
+	wd, err := unix.InotifyAddWatch(w.fd, localPath, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			w.mu.Lock()
+			if !w.warned {
+				fs.Errorf(w.f, "Ran out of inotify watches - increase fs.inotify.max_user_watches to see all changes")
+				w.warned = true
+			}
+			w.mu.Unlock()
+		} else if !os.IsNotExist(err) {
+			fs.Debugf(w.f, "Failed to watch directory %q: %v", localPath, err)
+		}
+		return false
+	}
+	w.mu.Lock()
+	w.dirs[wd] = watchedDir{localPath: localPath, remote: remote}
+	w.mu.Unlock()
+	if !report {
+		if fi, err := os.Stat(localPath); err == nil && fi.ModTime().After(w.started) {
+			w.record(remote, fs.EntryDirectory)
+			report = true
+		}
+	}
+
+	entries, err := os.ReadDir(localPath)
+	if err != nil {
+		fs.Debugf(w.f, "Failed to read directory %q for watching: %v", localPath, err)
+		return true
+	}
+	for _, entry := range entries {
+		// Symlinks to directories are not followed here, just as in List
+		if !entry.IsDir() {
+			if report {
+				remote := w.f.cleanRemote(remote, entry.Name())
+				if w.f.opt.TranslateSymlinks && entry.Type()&os.ModeSymlink != 0 {
+					remote += linkSuffix
+				}
+				w.record(remote, fs.EntryObject)
+			}
+			continue
+		}
+		if w.f.opt.OneFileSystem {
+			fi, err := entry.Info()
+			if err != nil || readDevice(fi, true) != w.f.dev {
+				continue
+			}
+		}
+		subRemote := w.f.cleanRemote(remote, entry.Name())
+		if report {
+			w.record(subRemote, fs.EntryDirectory)
+		}
+		w.addDir(filepath.Join(localPath, entry.Name()), subRemote, report)
+	}
+	return true
+}
+
+// removeDir removes the watches on the directory with the remote
+// passed in and all the directories beneath it.
+func (w *watcher) removeDir(remote string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for wd, dir := range w.dirs {
+		if dir.remote == remote || strings.HasPrefix(dir.remote, remote+"/") {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// record notes that the remote has changed
+func (w *watcher) record(remote string, entryType fs.EntryType) {
+	w.mu.Lock()
+	w.changes[remote] = entryType
+	w.mu.Unlock()
+}
+
+// run reads events from inotify until the watcher is closed
+func (w *watcher) run() {
+	defer w.wg.Done()
+	var buf [unix.SizeofInotifyEvent * 4096]byte
+	for {
+		n, err := w.file.Read(buf[:])
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				fs.Errorf(w.f, "Failed to read inotify events: %v", err)
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			w.handle(int(event.Wd), event.Mask, name)
+			offset = nameEnd
+		}
+	}
+}
+
+// handle a single inotify event
+func (w *watcher) handle(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost so invalidate everything
+		fs.Debugf(w.f, "inotify event queue overflowed")
+		w.record("", fs.EntryDirectory)
+		return
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if ok && mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		if dir.remote == "" {
+			// The root has gone so watch it again if it comes back
+			w.rootWatched = false
+		}
+	}
+	w.mu.Unlock()
+	if !ok || mask&unix.IN_IGNORED != 0 {
+		return
+	}
+
+	// Event on the watched directory itself
+	if name == "" {
+		w.record(dir.remote, fs.EntryDirectory)
+		return
+	}
+
+	localPath := filepath.Join(dir.localPath, name)
+	remote := w.f.cleanRemote(dir.remote, name)
+	if mask&unix.IN_ISDIR == 0 {
+		if w.f.opt.TranslateSymlinks {
+			if fi, err := os.Lstat(localPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				remote += linkSuffix
+			}
+		}
+		w.record(remote, fs.EntryObject)
+		return
+	}
+
+	switch {
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		// The watches have the wrong path now so drop them
+		w.removeDir(remote)
+	case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		if w.f.opt.OneFileSystem {
+			fi, err := os.Lstat(localPath)
+			if err != nil || readDevice(fi, true) != w.f.dev {
+				break
+			}
+		}
+		w.addDir(localPath, remote, true)
+	}
+	w.record(remote, fs.EntryDirectory)
+}
+
+// change is a pending change notification
+type change struct {
+	path      string
+	entryType fs.EntryType
+}
+
+// drain returns the changes seen since the last call, sorted by path
+func (w *watcher) drain() (changes []change) {
+	w.mu.Lock()
+	for remote, entryType := range w.changes {
+		changes = append(changes, change{path: remote, entryType: entryType})
+	}
+	w.changes = make(map[string]fs.EntryType)
+	w.mu.Unlock()
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	return changes
+}
+
+// close stops the watcher, removing all the watches
+func (w *watcher) close() {
+	w.cancel()
+	w.walkWg.Wait()
+	err := w.file.Close()
+	if err != nil {
+		fs.Debugf(w.f, "Failed to close inotify: %v", err)
+	}
+	w.wg.Wait()
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.ChangeNotifier = &Fs{}
+)
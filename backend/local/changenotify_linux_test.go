@@ -0,0 +1,140 @@
+//go:build linux
+
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeNotify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "existing"), 0777))
+
+	f, err := NewFs(ctx, "local", dir, configmap.Simple{})
+	require.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		changes = map[string]fs.EntryType{}
+	)
+	notifyFunc := func(remote string, entryType fs.EntryType) {
+		mu.Lock()
+		changes[remote] = entryType
+		mu.Unlock()
+	}
+	seen := func(remote string, entryType fs.EntryType) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			got, ok := changes[remote]
+			return ok && got == entryType
+		}
+	}
+
+	pollInterval := make(chan time.Duration)
+	f.Features().ChangeNotify(ctx, notifyFunc, pollInterval)
+	defer close(pollInterval)
+	pollInterval <- 10 * time.Millisecond
+
+	// Files in existing directories - keep writing them as the
+	// watches are added in the background
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666)
+		_ = os.WriteFile(filepath.Join(dir, "existing", "file2.txt"), []byte("hello"), 0666)
+		return seen("file.txt", fs.EntryObject)() && seen("existing/file2.txt", fs.EntryObject)()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// New directories are watched too
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "new"), 0777))
+	assert.Eventually(t, seen("new", fs.EntryDirectory), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(filepath.Join(dir, "new", "file3.txt"), []byte("hello"), 0666)
+		return seen("new/file3.txt", fs.EntryObject)()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Renamed directories report their new paths
+	require.NoError(t, os.Rename(filepath.Join(dir, "new"), filepath.Join(dir, "renamed")))
+	assert.Eventually(t, seen("renamed", fs.EntryDirectory), 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.Remove(filepath.Join(dir, "renamed", "file3.txt")))
+	assert.Eventually(t, seen("renamed/file3.txt", fs.EntryObject), 5*time.Second, 10*time.Millisecond)
+
+	// Stopping the watcher stops the notifications
+	pollInterval <- 0
+	mu.Lock()
+	changes = map[string]fs.EntryType{}
+	mu.Unlock()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("hello"), 0666))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, seen("ignored.txt", fs.EntryObject)())
+}
+
+func TestChangeNotifyMissingRoot(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "root")
+
+	f, err := NewFs(ctx, "local", dir, configmap.Simple{})
+	require.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		changes = map[string]fs.EntryType{}
+	)
+	notifyFunc := func(remote string, entryType fs.EntryType) {
+		mu.Lock()
+		changes[remote] = entryType
+		mu.Unlock()
+	}
+	seen := func(remote string, entryType fs.EntryType) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			got, ok := changes[remote]
+			return ok && got == entryType
+		}
+	}
+
+	pollInterval := make(chan time.Duration)
+	f.Features().ChangeNotify(ctx, notifyFunc, pollInterval)
+	defer close(pollInterval)
+	pollInterval <- 10 * time.Millisecond
+	time.Sleep(50 * time.Millisecond)
+
+	// The root is watched once it has been made and the changes
+	// made before then are reported
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dir", "file.txt"), []byte("hello"), 0666))
+	assert.Eventually(t, seen("dir", fs.EntryDirectory), 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, seen("dir/file.txt", fs.EntryObject), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(filepath.Join(dir, "file2.txt"), []byte("hello"), 0666)
+		return seen("file2.txt", fs.EntryObject)()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestChangeNotifyCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "existing"), 0777))
+
+	f, err := NewFs(ctx, "local", dir, configmap.Simple{})
+	require.NoError(t, err)
+
+	// No watches are added if the context is cancelled
+	cancel()
+	w, err := f.(*Fs).newWatcher(ctx)
+	require.NoError(t, err)
+	w.close()
+	assert.Empty(t, w.dirs)
+	assert.False(t, w.rootWatched)
+}
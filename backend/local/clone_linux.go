@@ -0,0 +1,168 @@
+//go:build linux
+
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/random"
+	"golang.org/x/sys/unix"
+)
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	if f.opt.NoClone {
+		return nil, fs.ErrorCantCopy
+	}
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't clone - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	if f.opt.TranslateSymlinks && srcObj.translatedLink { // in --links mode, use cloning only for regular files
+		return nil, fs.ErrorCantCopy
+	}
+
+	// Fetch metadata if --metadata is in use
+	meta, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("copy: failed to read metadata: %w", err)
+	}
+
+	// Create destination
+	dstObj := f.newObject(remote)
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	srcPath := srcObj.path
+	if f.opt.FollowSymlinks { // in --copy-links mode, find the real file being pointed to and pass that in instead
+		srcPath, err = filepath.EvalSymlinks(srcPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = Clone(srcPath, dstObj.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the mtime
+	err = dstObj.SetModTime(ctx, src.ModTime(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// Set metadata if --metadata is in use
+	if meta != nil {
+		err = dstObj.writeMetadata(meta)
+		if err != nil {
+			return nil, fmt.Errorf("copy: failed to set metadata: %w", err)
+		}
+	}
+
+	return f.NewObject(ctx, remote)
+}
+
+// Clone copies src to dst without passing the data through userspace.
+//
+// It makes a reflink with FICLONE if the filesystem supports it (e.g.
+// btrfs, xfs) and otherwise copies the data in the kernel with
+// copy_file_range(2).
+//
+// The data is written to a temporary file next to dst which is
+// renamed over dst when complete, so an existing dst is left alone if
+// the copy fails. If neither method is possible it returns
+// fs.ErrorCantCopy so the caller can fall back to a streamed copy.
+func Clone(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmpPath := dst + "-rclone-clone-" + random.String(8)
+	out, err := file.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if removeErr := os.Remove(tmpPath); removeErr != nil && !os.IsNotExist(removeErr) {
+				fs.Errorf(dst, "Failed to remove partially copied file: %v", removeErr)
+			}
+		}
+	}()
+
+	inFd, outFd := int(in.Fd()), int(out.Fd())
+	err = unix.IoctlFileClone(outFd, inFd)
+	if err == nil {
+		fs.Debugf(dst, "Cloned with FICLONE")
+	} else {
+		fs.Debugf(dst, "Can't clone with FICLONE, trying copy_file_range: %v", err)
+		err = copyFileRange(inFd, outFd, fi.Size())
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// copyFileRange copies size bytes from inFd to outFd with
+// copy_file_range(2).
+//
+// It returns fs.ErrorCantCopy if nothing could be copied.
+func copyFileRange(inFd, outFd int, size int64) error {
+	var copied int64
+	for copied < size {
+		n, err := unix.CopyFileRange(inFd, nil, outFd, nil, int(min(size-copied, 1<<30)), 0)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			if copied == 0 {
+				fs.Debugf(nil, "Can't copy with copy_file_range: %v", err)
+				return fs.ErrorCantCopy
+			}
+			return fmt.Errorf("copy_file_range failed: %w", err)
+		}
+		if n == 0 {
+			if copied == 0 {
+				// Some filesystems return 0 rather than an error
+				fs.Debugf(nil, "Can't copy with copy_file_range: no data copied")
+				return fs.ErrorCantCopy
+			}
+			return fmt.Errorf("copy_file_range: source file changed size: copied %d of %d bytes", copied, size)
+		}
+		copied += int64(n)
+	}
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Copier = &Fs{}
+)
@@ -0,0 +1,55 @@
+//go:build linux
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	dir := t.TempDir()
+	for _, size := range []int{0, 1, 4096, 1024*1024 + 17} {
+		src := filepath.Join(dir, "src")
+		dst := filepath.Join(dir, "dst")
+		want := []byte(random.String(size))
+		require.NoError(t, os.WriteFile(src, want, 0666))
+
+		err := Clone(src, dst)
+		require.NoError(t, err)
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		// The copy must be independent of the original
+		require.NoError(t, os.WriteFile(src, []byte("changed"), 0666))
+		got, err = os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestCloneFailureKeepsDst(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	require.NoError(t, os.WriteFile(dst, []byte("existing"), 0666))
+
+	// A failed clone must leave the existing file alone
+	err := Clone(filepath.Join(dir, "notfound"), dst)
+	require.Error(t, err)
+	err = Clone(dir, dst)
+	require.Error(t, err)
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(got))
+
+	// And not leave any temporary files behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+}
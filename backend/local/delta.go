@@ -0,0 +1,122 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/delta"
+	"github.com/rclone/rclone/lib/file"
+)
+
+// DeltaSignature returns the block checksums of the object for --delta
+func (o *Object) DeltaSignature(ctx context.Context, blockSize int) (sig *delta.Signature, err error) {
+	if o.translatedLink {
+		return nil, fs.ErrorNotImplemented
+	}
+	in, err := file.Open(o.path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	return delta.Sign(in, blockSize)
+}
+
+// DeltaUpdate updates the object for --delta
+//
+// The new file is made next to the old one using the partial suffix
+// then renamed over it when complete.
+func (o *Object) DeltaUpdate(ctx context.Context, src fs.ObjectInfo, fn func(w delta.Writer) error, options ...fs.OpenOption) (err error) {
+	if o.translatedLink {
+		return fs.ErrorNotImplemented
+	}
+	var hasher *hash.MultiHasher
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.HashesOption:
+			if x.Hashes.Count() > 0 {
+				hasher, err = hash.NewMultiHasherTypes(x.Hashes)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	old, err := file.Open(o.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = old.Close()
+	}()
+	info, err := old.Stat()
+	if err != nil {
+		return err
+	}
+
+	suffix := fs.GetConfig(ctx).PartialSuffix
+	if suffix == "" {
+		suffix = ".partial"
+	}
+	tmpPath := o.path + suffix
+	f, err := file.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if !o.fs.opt.NoPreAllocate {
+		// Pre-allocate the file for performance reasons
+		err = file.PreAllocate(src.Size(), f)
+		if err != nil {
+			fs.Debugf(o, "Failed to pre-allocate: %v", err)
+			if err == file.ErrDiskFull {
+				_ = f.Close()
+				_ = os.Remove(tmpPath)
+				return err
+			}
+		}
+	}
+	var out io.Writer = f
+	if hasher != nil {
+		out = io.MultiWriter(f, hasher)
+	}
+
+	err = fn(delta.NewPatcher(old, out))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Close the old file so it can be replaced on Windows
+		err = old.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, o.path)
+	}
+	if err != nil {
+		if removeErr := os.Remove(tmpPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			fs.Errorf(o, "Failed to remove partially written file: %v", removeErr)
+		}
+		return fmt.Errorf("delta update failed: %w", err)
+	}
+
+	// All successful so update the hashes
+	o.clearHashCache()
+	if hasher != nil {
+		o.fs.objectMetaMu.Lock()
+		o.hashes = hasher.Sums()
+		o.fs.objectMetaMu.Unlock()
+	}
+
+	// Set the mtime
+	err = o.SetModTime(ctx, src.ModTime(ctx))
+	if err != nil {
+		return err
+	}
+
+	// ReRead info now that we have finished
+	return o.lstat()
+}
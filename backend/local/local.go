@@ -231,8 +231,11 @@ deduplicated by default (i.e. having two identical files does not consume more
 storage than having just one.)  However, for use cases where data redundancy is
 preferable, --local-no-clone can be used to disable cloning and force "deep" copies.
 
-Currently, cloning is only supported when using APFS on macOS (support for other
-platforms may be added in the future.)`,
+Currently, cloning is only supported when using APFS on macOS and on
+Linux filesystems which support reflinks (e.g. btrfs and xfs). On other
+Linux filesystems rclone will copy the data within the kernel using
+copy_file_range instead, which is still faster than a normal copy.
+Setting this flag disables both.`,
 				Default:  false,
 				Advanced: true,
 			},
@@ -1701,6 +1704,7 @@ var (
 	_ fs.Object          = &Object{}
 	_ fs.Metadataer      = &Object{}
 	_ fs.SetMetadataer   = &Object{}
+	_ fs.DeltaUpdater    = &Object{}
 	_ fs.Directory       = &Directory{}
 	_ fs.SetModTimer     = &Directory{}
 	_ fs.SetMetadataer   = &Directory{}
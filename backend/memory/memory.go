@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"path"
@@ -14,11 +15,15 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/lib/bucket"
+	"github.com/rclone/rclone/lib/encoder"
+	"github.com/rclone/rclone/lib/env"
 )
 
 var (
@@ -33,12 +38,94 @@ func init() {
 		Name:        "memory",
 		Description: "In memory object storage system.",
 		NewFs:       NewFs,
-		Options:     []fs.Option{},
+		MetadataInfo: &fs.MetadataInfo{
+			System: map[string]fs.MetadataHelp{
+				"mtime": {
+					Help:    "Time of last modification",
+					Type:    "RFC 3339",
+					Example: "2006-01-02T15:04:05.999999999Z07:00",
+				},
+				"content-type": {
+					Help:    "MIME type, also known as media type",
+					Type:    "string",
+					Example: "text/plain",
+				},
+			},
+			Help: `User metadata is stored with the objects as given.`,
+		},
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "snapshot",
+			Help: `Path of a local file to keep the contents in between runs.
+
+If set, the contents of all the memory remotes are loaded from this
+file when the remote is first used, if it exists, and saved to it
+when rclone exits.`,
+			Advanced: true,
+		}, {
+			Name: "case_insensitive",
+			Help: `Treat object names as case insensitive.
+
+Objects keep the case of the name they were written with but can be
+read, overwritten and deleted using any case, like a provider with
+case insensitive names.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "no_modtime",
+			Help: `Don't store modification times.
+
+Objects get the time they were written as their modification time,
+which can't be changed, like a provider which doesn't support
+modification times.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "list_delay",
+			Help: `Delay before new objects appear in listings.
+
+This makes listings eventually consistent like some providers. New
+objects can still be read using their names straight away.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}, {
+			Name: "max_size",
+			Help: `Maximum size of an object.
+
+Uploads of objects bigger than this fail.`,
+			Default:  fs.SizeSuffix(-1),
+			Advanced: true,
+		}, {
+			Name: "disable_features",
+			Help: `Comma separated list of optional features to disable.
+
+This makes the remote behave like a provider without them, for
+example "Copy" for one without server-side copy. See the --disable
+flag for the names of the features.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name:     config.ConfigEncoding,
+			Help:     config.ConfigEncodingHelp,
+			Advanced: true,
+			// The names are stored in the standard encoding by
+			// default, but this can be set to emulate the
+			// restricted characters of a provider.
+			Default: encoder.Standard,
+		}},
 	})
 }
 
 // Options defines the configuration for this backend
-type Options struct{}
+type Options struct {
+	Snapshot        string               `config:"snapshot"`
+	CaseInsensitive bool                 `config:"case_insensitive"`
+	NoModTime       bool                 `config:"no_modtime"`
+	ListDelay       fs.Duration          `config:"list_delay"`
+	MaxSize         fs.SizeSuffix        `config:"max_size"`
+	DisableFeatures fs.CommaSepList      `config:"disable_features"`
+	Enc             encoder.MultiEncoder `config:"encoding"`
+}
 
 // Fs represents a remote memory server
 type Fs struct {
@@ -163,7 +250,9 @@ type objectData struct {
 	modTime  time.Time
 	hash     string
 	mimeType string
+	metadata fs.Metadata
 	data     []byte
+	written  time.Time // when the object was written
 }
 
 // Object describes a memory object
@@ -204,7 +293,31 @@ func parsePath(path string) (root string) {
 // split returns bucket and bucketPath from the rootRelativePath
 // relative to f.root
 func (f *Fs) split(rootRelativePath string) (bucketName, bucketPath string) {
-	return bucket.Split(path.Join(f.root, rootRelativePath))
+	bucketName, bucketPath = bucket.Split(path.Join(f.root, rootRelativePath))
+	return f.opt.Enc.FromStandardName(bucketName), f.opt.Enc.FromStandardPath(bucketPath)
+}
+
+// getObjectData gets an object from (bucketName, bucketPath) or nil
+//
+// It returns the path the object is stored under, which may differ
+// in case from bucketPath if the remote is case insensitive.
+func (f *Fs) getObjectData(bucketName, bucketPath string) (od *objectData, foundPath string) {
+	b := buckets.getBucket(bucketName)
+	if b == nil {
+		return nil, bucketPath
+	}
+	od = b.getObjectData(bucketPath)
+	if od != nil || !f.opt.CaseInsensitive {
+		return od, bucketPath
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for objectPath, od := range b.objects {
+		if strings.EqualFold(objectPath, bucketPath) {
+			return od, objectPath
+		}
+	}
+	return nil, bucketPath
 }
 
 // split returns bucket and bucketPath from the object
@@ -226,6 +339,11 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if err != nil {
 		return nil, err
 	}
+	if opt.Snapshot != "" {
+		if err := useSnapshot(opt.Snapshot); err != nil {
+			return nil, err
+		}
+	}
 	root = strings.Trim(root, "/")
 	f := &Fs{
 		name: name,
@@ -234,13 +352,18 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	}
 	f.setRoot(root)
 	f.features = (&fs.Features{
+		CaseInsensitive:   opt.CaseInsensitive,
 		ReadMimeType:      true,
 		WriteMimeType:     true,
+		ReadMetadata:      true,
+		WriteMetadata:     true,
+		UserMetadata:      true,
 		BucketBased:       true,
 		BucketBasedRootOK: true,
 	}).Fill(ctx, f)
+	f.features.DisableList(opt.DisableFeatures)
 	if f.rootBucket != "" && f.rootDirectory != "" {
-		od := buckets.getObjectData(f.rootBucket, f.rootDirectory)
+		od, _ := f.getObjectData(f.split(""))
 		if od != nil {
 			newRoot := path.Dir(f.root)
 			if newRoot == "." {
@@ -263,10 +386,18 @@ func (f *Fs) newObject(remote string, od *objectData) *Object {
 // it returns the error fs.ErrorObjectNotFound.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	bucket, bucketPath := f.split(remote)
-	od := buckets.getObjectData(bucket, bucketPath)
+	od, foundPath := f.getObjectData(bucket, bucketPath)
 	if od == nil {
 		return nil, fs.ErrorObjectNotFound
 	}
+	if foundPath != bucketPath {
+		// Use the case the object was stored with in the end of remote
+		want, found := f.opt.Enc.ToStandardPath(bucketPath), f.opt.Enc.ToStandardPath(foundPath)
+		if len(want) == len(found) {
+			n := min(len(remote), len(want))
+			remote = remote[:len(remote)-n] + found[len(found)-n:]
+		}
+	}
 	return f.newObject(remote, od), nil
 }
 
@@ -287,18 +418,23 @@ func (f *Fs) list(ctx context.Context, bucket, directory, prefix string, addBuck
 	}
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	stdBucket, stdDirectory := f.opt.Enc.ToStandardName(bucket), f.opt.Enc.ToStandardPath(directory)
 	dirs := make(map[string]struct{})
 	for absPath, od := range b.objects {
 		if strings.HasPrefix(absPath, directory) {
-			remote := absPath[len(prefix):]
+			if f.opt.ListDelay > 0 && time.Since(od.written) < time.Duration(f.opt.ListDelay) {
+				continue // not in listings yet
+			}
+			stdPath := f.opt.Enc.ToStandardPath(absPath)
+			remote := stdPath[len(prefix):]
 			if !recurse {
-				localPath := absPath[len(directory):]
+				localPath := stdPath[len(stdDirectory):]
 				slash := strings.IndexRune(localPath, '/')
 				if slash >= 0 {
 					// send a directory if have a slash
-					dir := strings.TrimPrefix(directory, f.rootDirectory+"/") + localPath[:slash]
+					dir := strings.TrimPrefix(stdDirectory, f.rootDirectory+"/") + localPath[:slash]
 					if addBucket {
-						dir = path.Join(bucket, dir)
+						dir = path.Join(stdBucket, dir)
 					}
 					_, found := dirs[dir]
 					if !found {
@@ -313,7 +449,7 @@ func (f *Fs) list(ctx context.Context, bucket, directory, prefix string, addBuck
 			}
 			// send an object
 			if addBucket {
-				remote = path.Join(bucket, remote)
+				remote = path.Join(stdBucket, remote)
 			}
 			err = fn(remote, f.newObject(remote, od), false)
 			if err != nil {
@@ -339,7 +475,7 @@ func (f *Fs) listBuckets(ctx context.Context) (entries fs.DirEntries, err error)
 	buckets.mu.RLock()
 	defer buckets.mu.RUnlock()
 	for name := range buckets.buckets {
-		entries = append(entries, fs.NewDir(name, time.Time{}))
+		entries = append(entries, fs.NewDir(f.opt.Enc.ToStandardName(name), time.Time{}))
 	}
 	return entries, nil
 }
@@ -411,7 +547,7 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 			if err != nil {
 				return err
 			}
-			bucket := entry.Remote()
+			bucket := f.opt.Enc.FromStandardName(entry.Remote())
 			err = listR(bucket, "", f.rootDirectory, true)
 			if err != nil {
 				return err
@@ -468,6 +604,9 @@ func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 
 // Precision of the remote
 func (f *Fs) Precision() time.Duration {
+	if f.opt.NoModTime {
+		return fs.ModTimeNotSupported
+	}
 	return time.Nanosecond
 }
 
@@ -488,12 +627,26 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		fs.Debugf(src, "Can't copy - not same remote type")
 		return nil, fs.ErrorCantCopy
 	}
-	srcBucket, srcPath := srcObj.split()
-	od := buckets.getObjectData(srcBucket, srcPath)
+	od, _ := srcObj.fs.getObjectData(srcObj.split())
 	if od == nil {
 		return nil, fs.ErrorObjectNotFound
 	}
 	odCopy := *od
+	odCopy.written = time.Now()
+	if f.opt.NoModTime {
+		odCopy.modTime = odCopy.written
+	}
+	meta, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	if meta != nil {
+		odCopy.metadata = nil
+		if err = f.setMetadata(&odCopy, meta); err != nil {
+			return nil, err
+		}
+	}
+	_, dstPath = f.getObjectData(dstBucket, dstPath)
 	buckets.updateObjectData(dstBucket, dstPath, &odCopy)
 	return f.NewObject(ctx, remote)
 }
@@ -552,6 +705,9 @@ func (o *Object) ModTime(ctx context.Context) (result time.Time) {
 
 // SetModTime sets the modification time of the local fs object
 func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if o.fs.opt.NoModTime {
+		return fs.ErrorCantSetModTime
+	}
 	o.od.modTime = modTime
 	return nil
 }
@@ -593,17 +749,38 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (in io.Read
 //
 // The new object may have been created if an error is returned
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (err error) {
+	f := o.fs
 	bucket, bucketPath := o.split()
+	maxSize := int64(f.opt.MaxSize)
+	if maxSize >= 0 && src.Size() > maxSize {
+		return fserrors.NoRetryError(fmt.Errorf("object too big: size %d is more than max_size %v", src.Size(), f.opt.MaxSize))
+	}
 	data, err := io.ReadAll(in)
 	if err != nil {
 		return fmt.Errorf("failed to update memory object: %w", err)
 	}
-	o.od = &objectData{
+	if maxSize >= 0 && int64(len(data)) > maxSize {
+		return fserrors.NoRetryError(fmt.Errorf("object too big: size %d is more than max_size %v", len(data), f.opt.MaxSize))
+	}
+	meta, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	od := &objectData{
 		data:     data,
 		hash:     "",
 		modTime:  src.ModTime(ctx),
 		mimeType: fs.MimeType(ctx, src),
+		written:  time.Now(),
+	}
+	if f.opt.NoModTime {
+		od.modTime = od.written
 	}
+	if err = f.setMetadata(od, meta); err != nil {
+		return err
+	}
+	o.od = od
+	_, bucketPath = f.getObjectData(bucket, bucketPath)
 	buckets.updateObjectData(bucket, bucketPath, o.od)
 	return nil
 }
@@ -611,6 +788,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 // Remove an object
 func (o *Object) Remove(ctx context.Context) error {
 	bucket, bucketPath := o.split()
+	_, bucketPath = o.fs.getObjectData(bucket, bucketPath)
 	removed := buckets.removeObjectData(bucket, bucketPath)
 	if !removed {
 		return fs.ErrorObjectNotFound
@@ -623,12 +801,120 @@ func (o *Object) MimeType(ctx context.Context) string {
 	return o.od.mimeType
 }
 
+// copyMetadata returns a copy of m or nil if m is empty
+func copyMetadata(m fs.Metadata) fs.Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	mCopy := make(fs.Metadata, len(m))
+	for k, v := range m {
+		mCopy[k] = v
+	}
+	return mCopy
+}
+
+// setMetadata merges metadata into the object data
+//
+// The system metadata sets the modification time and mime type and
+// the rest is kept as user metadata.
+func (f *Fs) setMetadata(od *objectData, metadata fs.Metadata) error {
+	// Replace rather than change the user metadata as copies share it
+	newMetadata := copyMetadata(od.metadata)
+	for k, v := range metadata {
+		switch k {
+		case "mtime":
+			if f.opt.NoModTime {
+				continue
+			}
+			modTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fmt.Errorf("failed to parse metadata %s: %w", k, err)
+			}
+			od.modTime = modTime
+		case "content-type":
+			od.mimeType = v
+		default:
+			newMetadata.Set(k, v)
+		}
+	}
+	od.metadata = newMetadata
+	return nil
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	metadata := copyMetadata(o.od.metadata)
+	metadata.Set("mtime", o.od.modTime.Format(time.RFC3339Nano))
+	if o.od.mimeType != "" {
+		metadata.Set("content-type", o.od.mimeType)
+	}
+	return metadata, nil
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	return o.fs.setMetadata(o.od, metadata)
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "save",
+	Short: "Save the contents to a snapshot file",
+	Long: `This saves the contents of all the memory remotes, including
+modification times, hashes, mime types and metadata, to a local file.
+
+    rclone backend save :memory: /path/to/snapshot.json
+
+As the memory remote is empty when rclone starts this is most useful
+via the remote control or from tests.
+`,
+}, {
+	Name:  "load",
+	Short: "Load the contents from a snapshot file",
+	Long: `This replaces the contents of all the memory remotes with those
+in a local file written by the save command.
+
+    rclone backend load :memory: /path/to/snapshot.json
+`,
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "save", "load":
+		if len(arg) != 1 {
+			return nil, errors.New("need exactly 1 argument: the path of the snapshot file")
+		}
+		snapshotPath := env.ShellExpand(arg[0])
+		if name == "save" {
+			return nil, buckets.save(snapshotPath)
+		}
+		return nil, buckets.load(snapshotPath)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs            = &Fs{}
+	_ fs.Commander     = &Fs{}
+	_ fs.Copier        = &Fs{}
+	_ fs.PutStreamer   = &Fs{}
+	_ fs.ListRer       = &Fs{}
+	_ fs.Object        = &Object{}
+	_ fs.MimeTyper     = &Object{}
+	_ fs.Metadataer    = &Object{}
+	_ fs.SetMetadataer = &Object{}
 )
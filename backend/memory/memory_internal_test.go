@@ -3,12 +3,18 @@ package memory
 import (
 	"context"
 	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +25,15 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PurgeListDeadlock", func(t *testing.T) {
 		testPurgeListDeadlock(t)
 	})
+	t.Run("Snapshot", func(t *testing.T) {
+		testSnapshot(t)
+	})
+	t.Run("ListDelay", func(t *testing.T) {
+		testListDelay(t)
+	})
+	t.Run("MaxSize", func(t *testing.T) {
+		testMaxSize(t)
+	})
 }
 
 // test that Purge fallback does not result in deadlock from concurrently listing and removing
@@ -37,4 +52,78 @@ func testPurgeListDeadlock(t *testing.T) {
 	require.NoError(t, operations.Purge(ctx, r.Fremote, ""))
 }
 
+// test that save and load restore the objects
+func testSnapshot(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRunIndividual(t)
+	r.Mkdir(ctx, r.Fremote)
+	file1 := r.WriteObject(ctx, "snapshot/file1.txt", "hello", t1)
+	o, err := r.Fremote.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+	require.NoError(t, o.(*Object).SetMetadata(ctx, fs.Metadata{
+		"content-type": "text/x-snapshot",
+		"potato":       "jersey",
+	}))
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	do := r.Fremote.Features().Command
+	_, err = do(ctx, "save", []string{snapshotPath}, nil)
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	_, err = do(ctx, "load", []string{snapshotPath}, nil)
+	require.NoError(t, err)
+
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, nil, fs.GetModifyWindow(ctx, r.Fremote))
+	o, err = r.Fremote.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "text/x-snapshot", fs.MimeType(ctx, o))
+	metadata, err := fs.GetMetadata(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "jersey", metadata["potato"])
+	hash, err := o.Hash(ctx, hashType)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", hash)
+
+	_, err = do(ctx, "load", []string{filepath.Join(t.TempDir(), "missing.json")}, nil)
+	assert.Error(t, err)
+}
+
+// test that new objects don't appear in listings until list_delay has passed
+func testListDelay(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, ":memory,list_delay=100ms:list-delay")
+	require.NoError(t, err)
+	defer func() {
+		_ = operations.Purge(ctx, f, "")
+	}()
+	file1 := fstest.NewItem("file1.txt", "hello", t1)
+	_ = fstests.PutTestContents(ctx, t, f, &file1, "hello", false)
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = f.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+
+	time.Sleep(150 * time.Millisecond)
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// test that objects bigger than max_size can't be uploaded
+func testMaxSize(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, ":memory,max_size=5B:max-size")
+	require.NoError(t, err)
+	defer func() {
+		_ = operations.Purge(ctx, f, "")
+	}()
+	_, err = operations.Rcat(ctx, f, "small.txt", io.NopCloser(strings.NewReader("hello")), t1, nil)
+	require.NoError(t, err)
+	_, err = operations.Rcat(ctx, f, "big.txt", io.NopCloser(strings.NewReader("hello!")), t1, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "object too big")
+}
+
 var _ fstests.InternalTester = (*Fs)(nil)
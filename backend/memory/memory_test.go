@@ -15,3 +15,13 @@ func TestIntegration(t *testing.T) {
 		QuickTestOK: true,
 	})
 }
+
+// TestIntegrationEmulation runs integration tests against the remote
+// behaving like a more restricted provider
+func TestIntegrationEmulation(t *testing.T) {
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:  ":memory,case_insensitive,no_modtime,disable_features=Copy,encoding='Slash,Colon,Question,Asterisk,Dot':",
+		NilObject:   (*Object)(nil),
+		QuickTestOK: true,
+	})
+}
@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/env"
+)
+
+// snapshotVersion is the version of the snapshot file format
+const snapshotVersion = 1
+
+// snapshot is the format of a snapshot file
+type snapshot struct {
+	Version int                                   `json:"version"`
+	Buckets map[string]map[string]*snapshotObject `json:"buckets"`
+}
+
+// snapshotObject is an object in a snapshot file
+type snapshotObject struct {
+	ModTime  time.Time   `json:"modtime"`
+	Hash     string      `json:"md5"`
+	MimeType string      `json:"mime_type,omitempty"`
+	Metadata fs.Metadata `json:"metadata,omitempty"`
+	Data     []byte      `json:"data"`
+}
+
+// save writes all the buckets to the local file at snapshotPath
+func (bi *bucketsInfo) save(snapshotPath string) error {
+	snap := snapshot{
+		Version: snapshotVersion,
+		Buckets: make(map[string]map[string]*snapshotObject),
+	}
+	bi.mu.RLock()
+	for name, b := range bi.buckets {
+		objects := make(map[string]*snapshotObject)
+		b.mu.RLock()
+		for bucketPath, od := range b.objects {
+			hash := od.hash
+			if hash == "" {
+				sum := md5.Sum(od.data)
+				hash = hex.EncodeToString(sum[:])
+			}
+			objects[bucketPath] = &snapshotObject{
+				ModTime:  od.modTime,
+				Hash:     hash,
+				MimeType: od.mimeType,
+				Metadata: od.metadata,
+				Data:     od.data,
+			}
+		}
+		b.mu.RUnlock()
+		snap.Buckets[name] = objects
+	}
+	bi.mu.RUnlock()
+	data, err := json.MarshalIndent(&snap, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	// Write to a temporary file and rename it so a failed save
+	// doesn't lose the previous snapshot
+	tmpPath := snapshotPath + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err = os.Rename(tmpPath, snapshotPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// load replaces all the buckets with the ones in the local file at
+// snapshotPath
+func (bi *bucketsInfo) load(snapshotPath string) error {
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var snap snapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot %q: %w", snapshotPath, err)
+	}
+	if snap.Version > snapshotVersion {
+		return fmt.Errorf("snapshot %q is version %d but this rclone only understands up to version %d", snapshotPath, snap.Version, snapshotVersion)
+	}
+	newBuckets := make(map[string]*bucketInfo, len(snap.Buckets))
+	for name, objects := range snap.Buckets {
+		b := newBucketInfo()
+		for bucketPath, so := range objects {
+			b.objects[bucketPath] = &objectData{
+				modTime:  so.ModTime,
+				hash:     so.Hash,
+				mimeType: so.MimeType,
+				metadata: so.Metadata,
+				data:     so.Data,
+			}
+		}
+		newBuckets[name] = b
+	}
+	bi.mu.Lock()
+	bi.buckets = newBuckets
+	bi.mu.Unlock()
+	return nil
+}
+
+// The snapshot files given in the config which have been loaded
+var (
+	snapshotsMu sync.Mutex
+	snapshots   = make(map[string]struct{})
+)
+
+// useSnapshot loads the snapshot file the first time it is used, if
+// it exists, and saves it when rclone exits
+func useSnapshot(snapshotPath string) error {
+	snapshotPath, err := filepath.Abs(env.ShellExpand(snapshotPath))
+	if err != nil {
+		return err
+	}
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	if _, found := snapshots[snapshotPath]; found {
+		return nil
+	}
+	err = buckets.load(snapshotPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		fs.Debugf(nil, "memory: loaded snapshot %q", snapshotPath)
+	}
+	atexit.Register(func() {
+		if err := buckets.save(snapshotPath); err != nil {
+			fs.Errorf(nil, "memory: failed to save snapshot: %v", err)
+		} else {
+			fs.Debugf(nil, "memory: saved snapshot %q", snapshotPath)
+		}
+	})
+	snapshots[snapshotPath] = struct{}{}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -100,29 +102,124 @@ func (f *Fs) OpenChunkWriter(
 		chunkSize = chunksize.Calculator(src, size, uploadParts, chunkSize)
 	}
 
-	uploadID, existingParts, err := o.createMultipartUpload(ctx, ui.req)
-	if err != nil {
-		return info, nil, fmt.Errorf("create multipart upload request failed: %w", err)
-	}
 	bucketName, bucketPath := o.split()
 	chunkWriter := &objectChunkWriter{
-		chunkSize:     int64(chunkSize),
-		size:          size,
-		f:             f,
-		bucket:        &bucketName,
-		key:           &bucketPath,
-		uploadID:      &uploadID,
-		existingParts: existingParts,
-		ui:            ui,
-		o:             o,
+		chunkSize: int64(chunkSize),
+		size:      size,
+		f:         f,
+		bucket:    &bucketName,
+		key:       &bucketPath,
+		ui:        ui,
+		o:         o,
+	}
+
+	// Carry on with a previous upload if asked to
+	var resumedChunks []int
+	for _, option := range options {
+		if resume, ok := option.(*fs.ResumeChunkWriterOption); ok {
+			resumedChunks, err = chunkWriter.resume(ctx, resume.State)
+			if err != nil {
+				fs.Logf(o, "Not resuming multipart upload: %v", err)
+			}
+		}
+	}
+
+	if chunkWriter.uploadID == nil {
+		uploadID, existingParts, err := o.createMultipartUpload(ctx, ui.req)
+		if err != nil {
+			return info, nil, fmt.Errorf("create multipart upload request failed: %w", err)
+		}
+		chunkWriter.uploadID = &uploadID
+		chunkWriter.existingParts = existingParts
+		fs.Debugf(o, "open chunk writer: started multipart upload: %v", uploadID)
 	}
 	info = fs.ChunkWriterInfo{
-		ChunkSize:         int64(chunkSize),
+		ChunkSize:         chunkWriter.chunkSize,
 		Concurrency:       o.fs.opt.UploadConcurrency,
 		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
+		ResumedChunks:     resumedChunks,
 	}
-	fs.Debugf(o, "open chunk writer: started multipart upload: %v", uploadID)
-	return info, chunkWriter, err
+	return info, chunkWriter, nil
+}
+
+// objectChunkWriterState is the state of a multipart upload returned
+// by ChunkWriterState so it can be resumed
+type objectChunkWriterState struct {
+	UploadID  string
+	ChunkSize int64
+	Size      int64
+	Parts     []objectChunkWriterStatePart
+}
+
+// objectChunkWriterStatePart is a part in objectChunkWriterState
+type objectChunkWriterStatePart struct {
+	PartNumber int
+	ETag       string
+}
+
+// ChunkWriterState returns the state of the upload so it can be
+// resumed with fs.ResumeChunkWriterOption
+func (w *objectChunkWriter) ChunkWriterState() (string, error) {
+	state := objectChunkWriterState{
+		UploadID:  *w.uploadID,
+		ChunkSize: w.chunkSize,
+		Size:      w.size,
+	}
+	w.partsToCommitMu.Lock()
+	for _, part := range w.partsToCommit {
+		if part.PartNum != nil && part.Etag != nil {
+			state.Parts = append(state.Parts, objectChunkWriterStatePart{
+				PartNumber: *part.PartNum,
+				ETag:       *part.Etag,
+			})
+		}
+	}
+	w.partsToCommitMu.Unlock()
+	data, err := json.Marshal(&state)
+	return string(data), err
+}
+
+// resume the multipart upload described by state
+//
+// This checks the parts in state are still in the upload and returns
+// the chunk numbers of those which are.
+func (w *objectChunkWriter) resume(ctx context.Context, state string) (resumedChunks []int, err error) {
+	var s objectChunkWriterState
+	err = json.Unmarshal([]byte(state), &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if s.UploadID == "" || s.ChunkSize <= 0 {
+		return nil, errors.New("invalid state")
+	}
+	if w.size < 0 || s.Size != w.size {
+		return nil, fmt.Errorf("size changed from %d to %d", s.Size, w.size)
+	}
+	uploaded, err := w.f.listMultipartUploadParts(ctx, *w.bucket, *w.key, s.UploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts of multipart upload %q: %w", s.UploadID, err)
+	}
+	for _, part := range s.Parts {
+		chunkNumber := part.PartNumber - 1
+		wantSize := min(s.ChunkSize, s.Size-int64(chunkNumber)*s.ChunkSize)
+		got, ok := uploaded[part.PartNumber]
+		if !ok || got.Etag == nil || *got.Etag != part.ETag || got.Size == nil || *got.Size != wantSize || got.Md5 == nil {
+			fs.Debugf(w.o, "multipart upload %q: uploading part %d again as it is missing or changed", s.UploadID, part.PartNumber)
+			continue
+		}
+		md5sumBinary, err := base64.StdEncoding.DecodeString(*got.Md5)
+		if err != nil || len(md5sumBinary) != md5.Size {
+			fs.Debugf(w.o, "multipart upload %q: uploading part %d again as its md5 is invalid", s.UploadID, part.PartNumber)
+			continue
+		}
+		w.addMd5(&md5sumBinary, int64(chunkNumber))
+		w.addCompletedPart(common.Int(part.PartNumber), common.String(part.ETag))
+		resumedChunks = append(resumedChunks, chunkNumber)
+	}
+	w.uploadID = common.String(s.UploadID)
+	w.chunkSize = s.ChunkSize
+	fs.Debugf(w.o, "Resuming multipart upload %q with %d parts already uploaded", s.UploadID, len(resumedChunks))
+	return resumedChunks, nil
 }
 
 // WriteChunk will write chunk number with reader bytes, where chunk number >= 0
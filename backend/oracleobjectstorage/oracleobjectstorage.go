@@ -702,4 +702,6 @@ var (
 	_ fs.MimeTyper = &Object{}
 	_ fs.GetTierer = &Object{}
 	_ fs.SetTierer = &Object{}
+
+	_ fs.ChunkWriterResumer = &objectChunkWriter{}
 )
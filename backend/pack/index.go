@@ -0,0 +1,190 @@
+package pack
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// segmentVersion is the version of the index segment format
+const segmentVersion = 1
+
+// entry is a packed file in the index
+//
+// Entries are never changed once they are in the index so they can be
+// shared between goroutines without locking.
+type entry struct {
+	Path    string            `json:"path"`             // path relative to the root of the remote
+	Pack    string            `json:"pack,omitempty"`   // ID of the pack holding the data, "" if empty
+	Offset  int64             `json:"offset,omitempty"` // where the data starts in the pack
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"modtime"`
+	Hashes  map[string]string `json:"hashes,omitempty"` // hashes by name
+	Deleted bool              `json:"deleted,omitempty"`
+}
+
+// segment is the contents of an index segment
+//
+// The segments are applied in the order of their IDs, so later
+// entries replace earlier ones for the same path. Segments listed in
+// Merged by a later segment aren't applied at all as that segment
+// holds everything in them already.
+type segment struct {
+	Version int      `json:"version"`
+	Merged  []string `json:"merged,omitempty"` // IDs of the segments merged into this one
+	Entries []entry  `json:"entries"`
+}
+
+// packInfo describes a pack object
+type packInfo struct {
+	o    fs.Object // the pack object or nil if not looked up yet
+	size int64     // total size of the pack
+	live int64     // bytes in the pack used by files in the index
+}
+
+// dirNode is a directory in the index
+type dirNode struct {
+	files map[string]*entry   // files in this directory by leaf name
+	dirs  map[string]*dirNode // subdirectories by leaf name
+}
+
+func newDirNode() *dirNode {
+	return &dirNode{
+		files: make(map[string]*entry),
+		dirs:  make(map[string]*dirNode),
+	}
+}
+
+// empty returns true if the directory has no files or subdirectories
+func (d *dirNode) empty() bool {
+	return len(d.files) == 0 && len(d.dirs) == 0
+}
+
+// index holds the packed files
+//
+// Directories are made as files are added to them and are only
+// removed by rmdir, so a directory emptied by deleting its files
+// still exists until it is removed, as on a normal file system.
+type index struct {
+	root  *dirNode
+	packs map[string]*packInfo // by pack ID
+}
+
+func newIndex() *index {
+	return &index{
+		root:  newDirNode(),
+		packs: make(map[string]*packInfo),
+	}
+}
+
+// split splits p into its directory and leaf name
+func split(p string) (dir, leaf string) {
+	dir, leaf = path.Split(p)
+	return strings.TrimSuffix(dir, "/"), leaf
+}
+
+// dir returns the node for directory p, making it and its parents if
+// create is set, or nil if it doesn't exist
+func (x *index) dir(p string, create bool) *dirNode {
+	node := x.root
+	if p == "" {
+		return node
+	}
+	for _, name := range strings.Split(p, "/") {
+		child := node.dirs[name]
+		if child == nil {
+			if !create {
+				return nil
+			}
+			child = newDirNode()
+			node.dirs[name] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// find returns the entry for the file at p or nil if not found
+func (x *index) find(p string) *entry {
+	dir, leaf := split(p)
+	node := x.dir(dir, false)
+	if node == nil {
+		return nil
+	}
+	return node.files[leaf]
+}
+
+// pack returns the info for pack id, making it if necessary
+func (x *index) pack(id string) *packInfo {
+	pk := x.packs[id]
+	if pk == nil {
+		pk = &packInfo{}
+		x.packs[id] = pk
+	}
+	return pk
+}
+
+// remove removes the file at p from the index if present
+func (x *index) remove(p string) {
+	dir, leaf := split(p)
+	node := x.dir(dir, false)
+	if node == nil {
+		return
+	}
+	if old := node.files[leaf]; old != nil {
+		if old.Pack != "" {
+			x.pack(old.Pack).live -= old.Size
+		}
+		delete(node.files, leaf)
+	}
+}
+
+// apply adds e to the index, replacing or deleting the file at its
+// path
+func (x *index) apply(e *entry) {
+	x.remove(e.Path)
+	if e.Deleted {
+		return
+	}
+	dir, leaf := split(e.Path)
+	x.dir(dir, true).files[leaf] = e
+	if e.Pack != "" {
+		x.pack(e.Pack).live += e.Size
+	}
+}
+
+// rmdir removes the empty directory p returning false if it isn't
+// empty
+func (x *index) rmdir(p string) bool {
+	if p == "" {
+		return x.root.empty()
+	}
+	dir, leaf := split(p)
+	parent := x.dir(dir, false)
+	if parent == nil {
+		return true
+	}
+	if node := parent.dirs[leaf]; node != nil {
+		if !node.empty() {
+			return false
+		}
+		delete(parent.dirs, leaf)
+	}
+	return true
+}
+
+// walk calls fn for every file in the index
+func (x *index) walk(fn func(e *entry)) {
+	var walkDir func(node *dirNode)
+	walkDir = func(node *dirNode) {
+		for _, e := range node.files {
+			fn(e)
+		}
+		for _, child := range node.dirs {
+			walkDir(child)
+		}
+	}
+	walkDir(x.root)
+}
@@ -0,0 +1,187 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// errNotPacked is returned when reading a file still waiting to be packed
+var errNotPacked = errors.New("file is waiting to be packed - try again when the batch has been uploaded")
+
+// Object is a packed file or a file stored on the remote as it is
+type Object struct {
+	f      *Fs
+	remote string
+	o      fs.Object // the file on the remote if it isn't packed
+	e      *entry    // the index entry if it is packed
+}
+
+// newObject wraps o which is stored on the remote
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{f: f, remote: o.Remote(), o: o}
+}
+
+// newPacked makes an Object for the packed file e at remote
+func (f *Fs) newPacked(remote string, e *entry) *Object {
+	return &Object{f: f, remote: remote, e: e}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	if o.o != nil {
+		return o.o.Size()
+	}
+	return o.e.Size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	if o.o != nil {
+		return o.o.ModTime(ctx)
+	}
+	return o.e.ModTime
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if o.o != nil {
+		return o.o.Hash(ctx, ht)
+	}
+	if !o.f.Hashes().Contains(ht) {
+		return "", hash.ErrUnsupported
+	}
+	return o.e.Hashes[ht.String()], nil
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if o.o != nil {
+		return o.o.SetModTime(ctx, modTime)
+	}
+	p := &pending{e: *o.e}
+	p.e.ModTime = modTime
+	e, err := o.f.s.commit(ctx, o.remote, p)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		e = &p.e
+	}
+	o.e = e
+	return nil
+}
+
+// Open opens the file for read. Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	if o.o != nil {
+		return o.o.Open(ctx, options...)
+	}
+	var (
+		offset, limit int64 = 0, -1
+		openOptions   []fs.OpenOption
+	)
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.e.Size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+			openOptions = append(openOptions, option)
+		}
+	}
+	if offset > o.e.Size {
+		offset = o.e.Size
+	}
+	if limit < 0 || offset+limit > o.e.Size {
+		limit = o.e.Size - offset
+	}
+	if limit == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if o.e.Pack == "" {
+		return nil, errNotPacked
+	}
+	pack, err := o.f.s.packObject(ctx, o.e.Pack)
+	if err != nil {
+		return nil, err
+	}
+	start := o.e.Offset + offset
+	openOptions = append(openOptions, &fs.RangeOption{Start: start, End: start + limit - 1})
+	in, err := pack.Open(ctx, openOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack %q: %w", o.e.Pack, err)
+	}
+	return readers.NewLimitedReadCloser(in, limit), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	src = fs.NewOverrideRemote(src, o.remote)
+	newObj, err := o.f.put(ctx, in, src, o, options, func(in io.Reader) (fs.Object, error) {
+		return o.f.base.Put(ctx, in, src, options...)
+	})
+	if err != nil {
+		return err
+	}
+	*o = *newObj
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	if o.o != nil {
+		return o.o.Remove(ctx)
+	}
+	_, err := o.f.s.commit(ctx, o.remote, &pending{e: entry{Path: o.e.Path, Deleted: true}})
+	if err != nil {
+		return err
+	}
+	// Remove any file on the remote the packed file was hiding
+	if hidden, err := o.f.base.NewObject(ctx, o.remote); err == nil {
+		if err := hidden.Remove(ctx); err != nil {
+			return fmt.Errorf("failed to remove file hidden by packed file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object = (*Object)(nil)
+)
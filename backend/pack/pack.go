@@ -0,0 +1,535 @@
+// Package pack implements a backend which packs small files into
+// larger objects to save on per request costs
+package pack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Globals
+var (
+	errPackDir = errors.New("can't use the pack directory through the pack remote")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "pack",
+		Description: "Pack small files into larger objects",
+		NewFs:       NewFs,
+		Options: append([]fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to store the files and packs on.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "threshold",
+			Help: `Files smaller than this are packed.
+
+Files this size or larger are stored on the remote as they are.`,
+			Default: fs.SizeSuffix(128 * 1024),
+		}, {
+			Name: "pack_dir",
+			Help: `Name of the directory the packs are kept in.
+
+This is made at the root of the remote and is hidden from listings.`,
+			Default:  ".pack",
+			Advanced: true,
+		}}, defaultBatcherOptions.FsOptions("Small files are uploaded in batches and each batch is written as one\npack, so the batch size is the most files a pack can hold.\n\n")...),
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote       string        `config:"remote"`
+	Threshold    fs.SizeSuffix `config:"threshold"`
+	PackDir      string        `config:"pack_dir"`
+	BatchMode    string        `config:"batch_mode"`
+	BatchSize    int           `config:"batch_size"`
+	BatchTimeout fs.Duration   `config:"batch_timeout"`
+}
+
+// Fs represents a remote with its small files packed
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on
+	opt      Options      // parsed options
+	base     fs.Fs        // the remote large files are stored on
+	s        *store       // the packs and their index
+	features *fs.Features // optional features
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point pack remote at itself - check the value of the remote setting")
+	}
+	if opt.Threshold <= 0 {
+		return nil, errors.New("threshold must be greater than 0")
+	}
+	opt.PackDir = strings.Trim(opt.PackDir, "/")
+	if opt.PackDir == "" || strings.Contains(opt.PackDir, "/") {
+		return nil, fmt.Errorf("invalid pack_dir %q - it must be a single directory name", opt.PackDir)
+	}
+	root := strings.Trim(rpath, "/")
+	if root == opt.PackDir || strings.HasPrefix(root, opt.PackDir+"/") {
+		return nil, errPackDir
+	}
+
+	pbase, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, opt.PackDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote for the pack directory: %w", err)
+	}
+	cache.Pin(pbase) // the store keeps using it
+	s, err := getStore(ctx, pbase, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check whether the root is a packed file
+	isFile := root != "" && s.find(root) != nil
+	if isFile {
+		root = parentDir(root)
+	}
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, root))
+	if err == fs.ErrorIsFile {
+		isFile = true
+		root = parentDir(root)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name: name,
+		root: root,
+		opt:  *opt,
+		base: base,
+		s:    s,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	// These work on packed files whatever the base supports
+	f.features.Copy = f.Copy
+	f.features.Move = f.Move
+	f.features.CleanUp = f.CleanUp
+	cache.PinUntilFinalized(base, f)
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// parentDir returns the parent directory of remote or "" if it has
+// none
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." {
+		parent = ""
+	}
+	return parent
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("pack root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+//
+// The hashes of packed files are worked out when they are packed so
+// these are the same as the remote's.
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// fullPath returns the path of remote relative to the root of the
+// remote being wrapped which is how the index stores it
+func (f *Fs) fullPath(remote string) string {
+	return path.Join(f.root, remote)
+}
+
+// inPackDir returns true if remote is the pack directory or inside it
+func (f *Fs) inPackDir(remote string) bool {
+	full := f.fullPath(remote)
+	return full == f.opt.PackDir || strings.HasPrefix(full, f.opt.PackDir+"/")
+}
+
+// List the objects and directories in dir into entries. The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if f.inPackDir(dir) {
+		return nil, fs.ErrorDirNotFound
+	}
+	baseEntries, err := f.base.List(ctx, dir)
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, err
+	}
+	notFound := err != nil
+
+	// Packed files replace files of the same name on the remote
+	f.s.mu.RLock()
+	node := f.s.index.dir(f.fullPath(dir), false)
+	var (
+		files = make(map[string]*entry)
+		dirs  = make(map[string]struct{})
+	)
+	if node != nil {
+		for leaf, e := range node.files {
+			files[path.Join(dir, leaf)] = e
+		}
+		for leaf := range node.dirs {
+			dirs[path.Join(dir, leaf)] = struct{}{}
+		}
+	}
+	f.s.mu.RUnlock()
+	if notFound && node == nil {
+		return nil, fs.ErrorDirNotFound
+	}
+
+	for _, entry := range baseEntries {
+		remote := entry.Remote()
+		switch x := entry.(type) {
+		case fs.Object:
+			if _, found := files[remote]; !found {
+				entries = append(entries, f.newObject(x))
+			}
+		case fs.Directory:
+			if f.inPackDir(remote) {
+				continue
+			}
+			delete(dirs, remote)
+			entries = append(entries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	for remote, e := range files {
+		entries = append(entries, f.newPacked(remote, e))
+	}
+	for remote := range dirs {
+		entries = append(entries, fs.NewDir(remote, time.Time{}))
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote. If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.inPackDir(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if e := f.s.find(f.fullPath(remote)); e != nil {
+		return f.newPacked(remote, e), nil
+	}
+	o, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// hashes returns the hashes of data by name
+func (f *Fs) hashes(data []byte) (map[string]string, error) {
+	sums, err := hash.StreamTypes(bytes.NewReader(data), f.Hashes())
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(sums))
+	for ht, sum := range sums {
+		hashes[ht.String()] = sum
+	}
+	return hashes, nil
+}
+
+// put uploads in to src.Remote(), replacing old if set
+//
+// Small files are packed and others are uploaded to the remote with
+// putBase.
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, old *Object, options []fs.OpenOption, putBase func(in io.Reader) (fs.Object, error)) (*Object, error) {
+	if f.inPackDir(src.Remote()) {
+		return nil, errPackDir
+	}
+	remote := src.Remote()
+	full := f.fullPath(remote)
+	size := src.Size()
+	threshold := int64(f.opt.Threshold)
+	if size < 0 {
+		// Read up to the threshold to find out if the file is small
+		buf, err := io.ReadAll(io.LimitReader(in, threshold))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buf)) < threshold {
+			size = int64(len(buf))
+		}
+		in = io.MultiReader(bytes.NewReader(buf), in)
+	}
+
+	if size < 0 || size >= threshold {
+		var (
+			o   fs.Object
+			err error
+		)
+		if old != nil && old.o != nil {
+			err = old.o.Update(ctx, in, src, options...)
+			o = old.o
+		} else {
+			o, err = putBase(in)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Delete the packed file this replaces
+		if f.s.find(full) != nil {
+			_, err = f.s.commit(ctx, remote, &pending{e: entry{Path: full, Deleted: true}})
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove replaced packed file: %w", err)
+			}
+		}
+		return f.newObject(o), nil
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("upload of %q: expecting %d bytes but got %d", remote, size, len(data))
+	}
+	hashes, err := f.hashes(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &pending{
+		e: entry{
+			Path:    full,
+			Size:    size,
+			ModTime: src.ModTime(ctx),
+			Hashes:  hashes,
+		},
+		data: data,
+	}
+	e, err := f.s.commit(ctx, remote, p)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		// Async batching so the file isn't packed yet
+		e = &p.e
+	}
+	// Delete the file on the remote this replaces
+	if old != nil && old.o != nil {
+		if err := old.o.Remove(ctx); err != nil {
+			fs.Errorf(old, "Failed to remove file replaced by packed file: %v", err)
+		}
+	}
+	return f.newPacked(remote, e), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, nil, options, func(in io.Reader) (fs.Object, error) {
+		return f.base.Put(ctx, in, src, options...)
+	})
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, nil, options, func(in io.Reader) (fs.Object, error) {
+		return f.base.Features().PutStream(ctx, in, src, options...)
+	})
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if f.inPackDir(dir) {
+		return errPackDir
+	}
+	return f.base.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if f.inPackDir(dir) {
+		return errPackDir
+	}
+	full := f.fullPath(dir)
+	f.s.mu.Lock()
+	node := f.s.index.dir(full, false)
+	if node != nil && !f.s.index.rmdir(full) {
+		f.s.mu.Unlock()
+		return fs.ErrorDirectoryNotEmpty
+	}
+	f.s.mu.Unlock()
+	err := f.base.Rmdir(ctx, dir)
+	if err != nil && node != nil {
+		// The directory may only have existed in the index
+		if _, listErr := f.base.List(ctx, dir); errors.Is(listErr, fs.ErrorDirNotFound) {
+			return nil
+		}
+	}
+	return err
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// Packed files are copied by adding them to the index again under
+// the new name which doesn't copy any data.
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.f.s != f.s || f.inPackDir(remote) {
+		return nil, fs.ErrorCantCopy
+	}
+	return f.copyOrMove(ctx, srcObj, remote, false)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// Packed files are moved by changing their names in the index.
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.f.s != f.s || f.inPackDir(remote) {
+		return nil, fs.ErrorCantMove
+	}
+	return f.copyOrMove(ctx, srcObj, remote, true)
+}
+
+// copyOrMove copies or moves src to remote
+func (f *Fs) copyOrMove(ctx context.Context, src *Object, remote string, move bool) (fs.Object, error) {
+	full := f.fullPath(remote)
+	if src.o == nil {
+		p := &pending{e: *src.e}
+		p.e.Path = full
+		if move {
+			p.remove = src.e.Path
+		}
+		e, err := f.s.commit(ctx, remote, p)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			e = &p.e
+		}
+		return f.newPacked(remote, e), nil
+	}
+
+	var (
+		o   fs.Object
+		err error
+	)
+	if move {
+		do := f.base.Features().Move
+		if do == nil {
+			return nil, fs.ErrorCantMove
+		}
+		o, err = do(ctx, src.o, remote)
+	} else {
+		do := f.base.Features().Copy
+		if do == nil {
+			return nil, fs.ErrorCantCopy
+		}
+		o, err = do(ctx, src.o, remote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.s.find(full) != nil {
+		_, err = f.s.commit(ctx, remote, &pending{e: entry{Path: full, Deleted: true}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove replaced packed file: %w", err)
+		}
+	}
+	return f.newObject(o), nil
+}
+
+// CleanUp repacks the packs with space used by deleted files in
+//
+// It also merges the index into one segment so it loads quicker
+// and cleans up the remote if it can.
+func (f *Fs) CleanUp(ctx context.Context) error {
+	if err := f.s.cleanUp(ctx); err != nil {
+		return err
+	}
+	if do := f.base.Features().CleanUp; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.CleanUpper  = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
+)
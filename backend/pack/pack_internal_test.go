@@ -0,0 +1,203 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readObject(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) string {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func listNames(ctx context.Context, t *testing.T, f fs.Fs, dir string) []string {
+	entries, err := f.List(ctx, dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reload reads the index again from the pack directory
+func (f *Fs) reload(ctx context.Context, t *testing.T) *index {
+	s := newStore(f.s.pbase)
+	require.NoError(t, s.load(ctx))
+	return s.index
+}
+
+// Check small files are packed and the packs are cleaned up
+func (f *Fs) testPack(t *testing.T) {
+	ctx := context.Background()
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	small := fstest.Item{Path: "pack/small.txt", ModTime: modTime}
+	_ = fstests.PutTestContents(ctx, t, f, &small, "small contents", true)
+	big := fstest.Item{Path: "pack/big.bin", ModTime: modTime}
+	_ = fstests.PutTestContents(ctx, t, f, &big, random.String(int(f.opt.Threshold)), true)
+
+	// Only the big file is stored as it is
+	_, err := f.base.NewObject(ctx, small.Path)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	_, err = f.base.NewObject(ctx, big.Path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pack/big.bin", "pack/small.txt"}, listNames(ctx, t, f, "pack"))
+
+	// Parts of packed files can be read
+	o, err := f.NewObject(ctx, small.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "cont", readObject(ctx, t, o, &fs.RangeOption{Start: 6, End: 9}))
+	assert.Equal(t, "tents", readObject(ctx, t, o, &fs.SeekOption{Offset: 9}))
+
+	// The index is the same when read again
+	e := f.s.find(f.fullPath(small.Path))
+	require.NotNil(t, e)
+	assert.Equal(t, e, f.reload(ctx, t).find(f.fullPath(small.Path)))
+	oldPack := e.Pack
+
+	// Replace and rename the file which leaves space to reclaim
+	src := object.NewStaticObjectInfo(small.Path, modTime, 7, true, nil, nil)
+	require.NoError(t, o.Update(ctx, bytes.NewBufferString("changed"), src))
+	moved, err := f.Move(ctx, o, "pack/moved.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pack/big.bin", "pack/moved.txt"}, listNames(ctx, t, f, "pack"))
+	assert.Equal(t, "changed", readObject(ctx, t, moved))
+	assert.True(t, moved.ModTime(ctx).Equal(modTime))
+	f.s.mu.RLock()
+	pk := f.s.index.packs[oldPack]
+	assert.Less(t, pk.live, pk.size)
+	f.s.mu.RUnlock()
+
+	// Keep the old index segments which add the small file to
+	// check they are ignored if they are left behind
+	_, oldSegments, err := f.s.list(ctx)
+	require.NoError(t, err)
+	oldData := make(map[string]string)
+	for _, o := range oldSegments {
+		seg, err := readSegment(ctx, o)
+		require.NoError(t, err)
+		for _, e := range seg.Entries {
+			if e.Path == f.fullPath(small.Path) && !e.Deleted {
+				oldData[o.Remote()] = readObject(ctx, t, o)
+			}
+		}
+	}
+	require.NotEmpty(t, oldData)
+
+	// Clean up repacks and merges the index
+	require.NoError(t, f.CleanUp(ctx))
+	entries, err := f.s.pbase.List(ctx, "")
+	require.NoError(t, err)
+	segments := 0
+	for _, entry := range entries {
+		id, suffix, ok := parseID(entry.Remote())
+		require.True(t, ok, entry.Remote())
+		if suffix == segmentSuffix {
+			segments++
+			continue
+		}
+		f.s.mu.RLock()
+		pk := f.s.index.packs[id]
+		require.NotNil(t, pk, id)
+		assert.Equal(t, pk.size, pk.live, id)
+		f.s.mu.RUnlock()
+	}
+	assert.Equal(t, 1, segments)
+	x := f.reload(ctx, t)
+	assert.Nil(t, x.find(f.fullPath(small.Path)))
+	require.NotNil(t, x.find(f.fullPath("pack/moved.txt")))
+	moved, err = f.NewObject(ctx, "pack/moved.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "changed", readObject(ctx, t, moved))
+
+	// Old segments which clean up failed to remove don't bring back
+	// deleted files
+	for name, data := range oldData {
+		_, err := f.s.put(ctx, name, []byte(data))
+		require.NoError(t, err)
+	}
+	x = f.reload(ctx, t)
+	assert.Nil(t, x.find(f.fullPath(small.Path)))
+	assert.NotNil(t, x.find(f.fullPath("pack/moved.txt")))
+	for name := range oldData {
+		o, err := f.s.pbase.NewObject(ctx, name)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+
+	// Clean up
+	for _, remote := range []string{"pack/moved.txt", big.Path} {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	require.NoError(t, f.Rmdir(ctx, "pack"))
+	_, err = f.List(ctx, "pack")
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+}
+
+// Check clean up keeps the files and packs written by another rclone
+func (f *Fs) testCleanUpOther(t *testing.T) {
+	ctx := context.Background()
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	mine := fstest.Item{Path: "other/mine.txt", ModTime: modTime}
+	_ = fstests.PutTestContents(ctx, t, f, &mine, "mine", true)
+
+	// Another rclone adds a file and is part way through adding a
+	// pack when clean up runs
+	other := newStore(f.s.pbase)
+	require.NoError(t, other.load(ctx))
+	other.writeMu.Lock()
+	_, err := other.write(ctx, []*pending{{
+		e:    entry{Path: f.fullPath("other/theirs.txt"), ModTime: modTime},
+		data: []byte("theirs"),
+	}}, nil)
+	require.NoError(t, err)
+	unfinished := other.newID() + packSuffix
+	_, err = other.put(ctx, unfinished, []byte("unfinished"))
+	require.NoError(t, err)
+	other.writeMu.Unlock()
+
+	require.NoError(t, f.CleanUp(ctx))
+	o, err := f.NewObject(ctx, "other/theirs.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "theirs", readObject(ctx, t, o))
+	x := f.reload(ctx, t)
+	require.NotNil(t, x.find(f.fullPath("other/theirs.txt")))
+	require.NotNil(t, x.find(f.fullPath(mine.Path)))
+	unfinishedObj, err := f.s.pbase.NewObject(ctx, unfinished)
+	require.NoError(t, err)
+
+	// Clean up
+	for _, remote := range []string{"other/theirs.txt", mine.Path} {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	require.NoError(t, unfinishedObj.Remove(ctx))
+	require.NoError(t, f.Rmdir(ctx, "other"))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Pack", f.testPack)
+	t.Run("CleanUpOther", f.testCleanUpOther)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,71 @@
+// Test Pack filesystem interface
+package pack
+
+import (
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestPack:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"ListR",
+		"ListP",
+		"DirMove",
+		"Purge",
+		"DirCacheFlush",
+		"UnWrap",
+		"WrapFs",
+		"SetWrapper",
+		"Shutdown",
+	},
+	UnimplementableObjectMethods: []string{
+		"MimeType",
+		"ID",
+		"GetTier",
+		"SetTier",
+		"Metadata",
+		"SetMetadata",
+		"UnWrap",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests pack wrapping the local filesystem
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestPackLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "pack"},
+		{Name: name, Key: "remote", Value: t.TempDir()},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
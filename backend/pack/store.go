@@ -0,0 +1,610 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/batcher"
+)
+
+const (
+	packSuffix    = ".pack" // suffix of pack objects
+	segmentSuffix = ".idx"  // suffix of index segments
+	maxPackSize   = 64 * 1024 * 1024
+)
+
+// Configure the batcher
+var defaultBatcherOptions = batcher.Options{
+	MaxBatchSize:          1000,
+	DefaultTimeoutSync:    500 * time.Millisecond,
+	DefaultTimeoutAsync:   10 * time.Second,
+	DefaultBatchSizeAsync: 100,
+}
+
+// The stores in use by remote so all the Fs using the same pack
+// directory share an index
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*store)
+)
+
+// pending is a change to the index waiting to be committed
+type pending struct {
+	e      entry  // the entry to add
+	data   []byte // data to pack for e or nil if e refers to packed data already
+	remove string // path of a file to delete at the same time, if any
+}
+
+// store holds the packs and index for a pack directory
+type store struct {
+	pbase       fs.Fs                              // the pack directory
+	batcher     *batcher.Batcher[*pending, *entry] // batches files into packs
+	writeMu     sync.Mutex                         // held while writing packs and segments
+	lastID      int64                              // last ID used - protected by writeMu
+	applied     map[string]struct{}                // IDs of the segments in the index - protected by writeMu
+	lastSegment string                             // ID of the last segment in the index - protected by writeMu
+	mu          sync.RWMutex                       // protects index
+	index       *index
+}
+
+// newStore makes a store for the pack directory pbase with an empty
+// index
+func newStore(pbase fs.Fs) *store {
+	return &store{
+		pbase:   pbase,
+		applied: make(map[string]struct{}),
+		index:   newIndex(),
+	}
+}
+
+// getStore returns the store for the pack directory pbase, loading
+// its index if it hasn't been used yet
+func getStore(ctx context.Context, pbase fs.Fs, opt *Options) (*store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	key := fs.ConfigString(pbase)
+	if s := stores[key]; s != nil {
+		return s, nil
+	}
+	s := newStore(pbase)
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+	batcherOptions := defaultBatcherOptions
+	batcherOptions.Mode = opt.BatchMode
+	batcherOptions.Size = opt.BatchSize
+	batcherOptions.Timeout = time.Duration(opt.BatchTimeout)
+	var err error
+	s.batcher, err = batcher.New(ctx, s, s.commitBatch, batcherOptions)
+	if err != nil {
+		return nil, err
+	}
+	stores[key] = s
+	return s, nil
+}
+
+// String returns a description of the store for logging
+func (s *store) String() string {
+	return fmt.Sprintf("pack store '%s'", fs.ConfigString(s.pbase))
+}
+
+// parseID returns the ID and suffix of the object name or ok false if
+// it isn't a pack or a segment
+func parseID(name string) (id string, suffix string, ok bool) {
+	for _, suffix = range []string{packSuffix, segmentSuffix} {
+		if id, ok = strings.CutSuffix(name, suffix); ok {
+			if _, err := strconv.ParseUint(id, 16, 64); err == nil && len(id) == 16 {
+				return id, suffix, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// noteID makes sure new IDs are after id
+//
+// Call with writeMu held or before the store is in use.
+func (s *store) noteID(id string) {
+	n, err := strconv.ParseInt(id, 16, 64)
+	if err == nil && n > s.lastID {
+		s.lastID = n
+	}
+}
+
+// newID returns an ID for a new pack and segment which sorts after
+// all the existing ones
+//
+// Call with writeMu held.
+func (s *store) newID() string {
+	n := time.Now().UnixNano()
+	if n <= s.lastID {
+		n = s.lastID + 1
+	}
+	s.lastID = n
+	return fmt.Sprintf("%016x", n)
+}
+
+// list lists the packs and segments in the pack directory, sorting
+// the segments in the order they should be applied
+func (s *store) list(ctx context.Context) (packs, segments []fs.Object, err error) {
+	entries, err := s.pbase.List(ctx, "")
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list packs: %w", err)
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		id, suffix, ok := parseID(o.Remote())
+		if !ok {
+			fs.Debugf(o, "Ignoring unknown file in pack directory")
+			continue
+		}
+		s.noteID(id)
+		if suffix == packSuffix {
+			packs = append(packs, o)
+		} else {
+			segments = append(segments, o)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Remote() < segments[j].Remote()
+	})
+	return packs, segments, nil
+}
+
+// load reads the index from the pack directory
+func (s *store) load(ctx context.Context) error {
+	packs, segments, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range packs {
+		id, _, _ := parseID(o.Remote())
+		pk := s.index.pack(id)
+		pk.o = o
+		pk.size = o.Size()
+	}
+	if err := s.applySegments(ctx, segments); err != nil {
+		return err
+	}
+	for id, pk := range s.index.packs {
+		if pk.o == nil && pk.live > 0 {
+			fs.Errorf(s, "Pack %q is missing so files in it can't be read", id)
+		}
+	}
+	fs.Debugf(s, "Loaded %d index segments and %d packs", len(segments), len(packs))
+	return nil
+}
+
+// noteSegment records that segment id has been applied to the index
+//
+// Call with writeMu held or before the store is in use.
+func (s *store) noteSegment(id string) {
+	s.applied[id] = struct{}{}
+	if id > s.lastSegment {
+		s.lastSegment = id
+	}
+}
+
+// applySegments applies the segments, which must be sorted, that
+// aren't in the index yet.
+//
+// If any of them should have been applied before a segment already in
+// the index, which can happen if another rclone is writing to the
+// pack directory, then the index is read again from all the segments
+// so they are applied in the right order.
+//
+// Segments merged into a later segment are skipped, as they may still
+// be there if clean up failed to remove them.
+//
+// Call with writeMu held or before the store is in use.
+func (s *store) applySegments(ctx context.Context, segments []fs.Object) error {
+	var (
+		toApply []fs.Object
+		rebuild bool
+	)
+	for _, o := range segments {
+		id, _, _ := parseID(o.Remote())
+		if _, ok := s.applied[id]; ok {
+			continue
+		}
+		if id < s.lastSegment {
+			rebuild = true
+		}
+		toApply = append(toApply, o)
+	}
+	if len(toApply) == 0 {
+		return nil
+	}
+	if rebuild {
+		fs.Debugf(s, "Reading the whole index again as segments have been added out of order")
+		toApply = segments
+	}
+	segs := make([]*segment, len(toApply))
+	merged := make(map[string]struct{})
+	for i, o := range toApply {
+		seg, err := readSegment(ctx, o)
+		if err != nil {
+			return err
+		}
+		segs[i] = seg
+		for _, id := range seg.Merged {
+			merged[id] = struct{}{}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rebuild {
+		x := newIndex()
+		for id, pk := range s.index.packs {
+			if pk.o != nil {
+				info := x.pack(id)
+				info.o = pk.o
+				info.size = pk.size
+			}
+		}
+		s.index = x
+		s.applied = make(map[string]struct{})
+		s.lastSegment = ""
+	}
+	for i, seg := range segs {
+		id, _, _ := parseID(toApply[i].Remote())
+		if _, ok := merged[id]; ok {
+			fs.Debugf(toApply[i], "Ignoring index segment merged into a later one")
+		} else {
+			for j := range seg.Entries {
+				s.index.apply(&seg.Entries[j])
+			}
+		}
+		s.noteSegment(id)
+	}
+	return nil
+}
+
+// readSegment reads the index segment in o
+func readSegment(ctx context.Context, o fs.Object) (*segment, error) {
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index segment %q: %w", o.Remote(), err)
+	}
+	defer fs.CheckClose(in, &err)
+	seg := new(segment)
+	if err := json.NewDecoder(in).Decode(seg); err != nil {
+		return nil, fmt.Errorf("failed to read index segment %q: %w", o.Remote(), err)
+	}
+	if seg.Version != segmentVersion {
+		return nil, fmt.Errorf("index segment %q has unsupported version %d", o.Remote(), seg.Version)
+	}
+	return seg, nil
+}
+
+// put uploads data to the pack directory as name
+func (s *store) put(ctx context.Context, name string, data []byte) (fs.Object, error) {
+	src := object.NewStaticObjectInfo(name, time.Now(), int64(len(data)), true, nil, nil)
+	return s.pbase.Put(ctx, bytes.NewReader(data), src)
+}
+
+// write packs the data in items into a new pack then commits the
+// items to the index with a new segment, returning the entries added
+//
+// merged should be the IDs of the segments the new one replaces, if
+// any.
+//
+// Call with writeMu held.
+func (s *store) write(ctx context.Context, items []*pending, merged []string) (entries []*entry, err error) {
+	id := s.newID()
+	var (
+		buf     bytes.Buffer
+		seg     = segment{Version: segmentVersion, Merged: merged}
+		results = make([]int, len(items)) // index of the entry for each item
+	)
+	for i, p := range items {
+		e := p.e
+		if len(p.data) > 0 {
+			e.Pack = id
+			e.Offset = int64(buf.Len())
+			e.Size = int64(len(p.data))
+			buf.Write(p.data)
+		}
+		results[i] = len(seg.Entries)
+		seg.Entries = append(seg.Entries, e)
+		if p.remove != "" {
+			seg.Entries = append(seg.Entries, entry{Path: p.remove, Deleted: true})
+		}
+	}
+	var pk fs.Object
+	if buf.Len() > 0 {
+		pk, err = s.put(ctx, id+packSuffix, buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload pack: %w", err)
+		}
+	}
+	data, err := json.Marshal(&seg)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.put(ctx, id+segmentSuffix, data)
+	if err != nil {
+		if pk != nil {
+			if removeErr := pk.Remove(ctx); removeErr != nil {
+				fs.Errorf(pk, "Failed to remove pack after failed index update: %v", removeErr)
+			}
+		}
+		return nil, fmt.Errorf("failed to upload index segment: %w", err)
+	}
+
+	s.noteSegment(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pk != nil {
+		info := s.index.pack(id)
+		info.o = pk
+		info.size = pk.Size()
+	}
+	for i := range seg.Entries {
+		s.index.apply(&seg.Entries[i])
+	}
+	entries = make([]*entry, len(items))
+	for i, j := range results {
+		entries[i] = &seg.Entries[j]
+	}
+	return entries, nil
+}
+
+// commitBatch is called by the batcher to commit a batch of items
+func (s *store) commitBatch(ctx context.Context, items []*pending, results []*entry, errors []error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	entries, err := s.write(ctx, items, nil)
+	if err != nil {
+		return err
+	}
+	copy(results, entries)
+	return nil
+}
+
+// commit adds p to the index using a batch if batching is on
+//
+// In async batch mode this returns nil as the entry isn't known yet.
+func (s *store) commit(ctx context.Context, name string, p *pending) (*entry, error) {
+	if s.batcher.Batching() {
+		return s.batcher.Commit(ctx, name, p)
+	}
+	var (
+		results = make([]*entry, 1)
+		errors  = make([]error, 1)
+	)
+	err := s.commitBatch(ctx, []*pending{p}, results, errors)
+	return results[0], err
+}
+
+// find returns the entry for p or nil if it isn't packed
+func (s *store) find(p string) *entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index.find(p)
+}
+
+// packObject returns the object for pack id
+func (s *store) packObject(ctx context.Context, id string) (fs.Object, error) {
+	s.mu.RLock()
+	pk := s.index.packs[id]
+	s.mu.RUnlock()
+	if pk != nil && pk.o != nil {
+		return pk.o, nil
+	}
+	o, err := s.pbase.NewObject(ctx, id+packSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pack %q: %w", id, err)
+	}
+	s.mu.Lock()
+	info := s.index.pack(id)
+	info.o = o
+	info.size = o.Size()
+	s.mu.Unlock()
+	return o, nil
+}
+
+// repack reads the files in entries from pack id and writes them to
+// new packs
+//
+// Call with writeMu held.
+func (s *store) repack(ctx context.Context, id string, entries []*entry) (err error) {
+	o, err := s.packObject(ctx, id)
+	if err != nil {
+		return err
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open pack %q: %w", id, err)
+	}
+	defer fs.CheckClose(in, &err)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Offset < entries[j].Offset
+	})
+	var (
+		items []*pending
+		size  int
+		pos   int64
+	)
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		_, err := s.write(ctx, items, nil)
+		items, size = nil, 0
+		return err
+	}
+	for _, e := range entries {
+		if _, err := io.CopyN(io.Discard, in, e.Offset-pos); err != nil {
+			return fmt.Errorf("failed to read pack %q: %w", id, err)
+		}
+		data := make([]byte, e.Size)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return fmt.Errorf("failed to read %q from pack %q: %w", e.Path, id, err)
+		}
+		pos = e.Offset + e.Size
+		newEntry := *e
+		newEntry.Pack, newEntry.Offset = "", 0
+		items = append(items, &pending{e: newEntry, data: data})
+		size += len(data)
+		if len(items) >= defaultBatcherOptions.MaxBatchSize || size >= maxPackSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// cleanUp repacks the packs with deleted files in, writes the whole
+// index to a single segment and removes the packs and segments no
+// longer needed
+//
+// Any segments written by another rclone are read first so their
+// files are kept, and packs after the last segment are left alone as
+// their segments may not have been written yet.
+func (s *store) cleanUp(ctx context.Context) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	packs, segments, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.applySegments(ctx, segments); err != nil {
+		return err
+	}
+	lastSegment := s.lastSegment
+
+	// The packs which could be in the index
+	var indexed []fs.Object
+	for _, o := range packs {
+		id, _, _ := parseID(o.Remote())
+		if id > lastSegment {
+			fs.Debugf(o, "Ignoring pack written after the last index segment")
+			continue
+		}
+		indexed = append(indexed, o)
+	}
+
+	// Find the packs with space to reclaim
+	s.mu.RLock()
+	byPack := make(map[string][]*entry)
+	s.index.walk(func(e *entry) {
+		if e.Pack != "" {
+			byPack[e.Pack] = append(byPack[e.Pack], e)
+		}
+	})
+	var toRepack []string
+	unused := 0
+	for _, o := range indexed {
+		id, _, _ := parseID(o.Remote())
+		pk := s.index.packs[id]
+		switch {
+		case pk == nil || pk.live <= 0:
+			unused++
+		case pk.live < o.Size():
+			toRepack = append(toRepack, id)
+		}
+	}
+	s.mu.RUnlock()
+	if len(toRepack) == 0 && unused == 0 && len(segments) <= 1 {
+		fs.Infof(s, "Nothing to clean up")
+		return nil
+	}
+
+	// Repack the live files
+	sort.Strings(toRepack)
+	repacked := 0
+	for _, id := range toRepack {
+		if err := s.repack(ctx, id, byPack[id]); err != nil {
+			return err
+		}
+		repacked += len(byPack[id])
+	}
+
+	// Write the whole index to a new segment which replaces the old
+	// ones
+	var (
+		items  []*pending
+		merged = make([]string, len(segments))
+	)
+	for i, o := range segments {
+		merged[i], _, _ = parseID(o.Remote())
+	}
+	s.mu.RLock()
+	s.index.walk(func(e *entry) {
+		items = append(items, &pending{e: *e})
+	})
+	s.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].e.Path < items[j].e.Path
+	})
+	if _, err := s.write(ctx, items, merged); err != nil {
+		return err
+	}
+
+	// Remove the old segments, which have all been merged into the
+	// new one, then the packs nothing refers to.
+	//
+	// The packs are only removed if all the old segments were, so
+	// the files in them can still be read if anything reads the old
+	// segments.
+	var errCount int
+	for _, o := range segments {
+		if err := o.Remove(ctx); err != nil {
+			fs.Errorf(o, "Failed to remove old index segment: %v", err)
+			errCount++
+			continue
+		}
+		id, _, _ := parseID(o.Remote())
+		delete(s.applied, id)
+	}
+	if errCount > 0 {
+		fs.Errorf(s, "Not removing unused packs as %d old index segments couldn't be removed", errCount)
+		indexed = nil
+	}
+	removed := 0
+	for _, o := range indexed {
+		id, _, _ := parseID(o.Remote())
+		s.mu.RLock()
+		pk := s.index.packs[id]
+		inUse := pk != nil && pk.live > 0
+		s.mu.RUnlock()
+		if inUse {
+			continue
+		}
+		if err := o.Remove(ctx); err != nil {
+			fs.Errorf(o, "Failed to remove unused pack: %v", err)
+			errCount++
+			continue
+		}
+		s.mu.Lock()
+		delete(s.index.packs, id)
+		s.mu.Unlock()
+		removed++
+	}
+	fs.Infof(s, "Repacked %d files from %d packs, removed %d packs and merged %d index segments", repacked, len(toRepack), removed, len(segments))
+	if errCount > 0 {
+		return fmt.Errorf("failed to remove %d old packs or index segments", errCount)
+	}
+	return nil
+}
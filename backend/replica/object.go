@@ -0,0 +1,217 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Object represents a file mirrored on the upstreams
+type Object struct {
+	f       *Fs         // the Fs this object is part of
+	remote  string      // the path of the file
+	main    fs.Object   // the newest copy
+	copies  []fs.Object // the copies indexed by upstream, nil if missing
+	current []bool      // set if the copy is the same version as main
+}
+
+// newObject makes an Object with no copies
+func (f *Fs) newObject(remote string) *Object {
+	return &Object{
+		f:       f,
+		remote:  remote,
+		copies:  make([]fs.Object, len(f.upstreams)),
+		current: make([]bool, len(f.upstreams)),
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.main.Size()
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.main.ModTime(ctx)
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return o.main.Storable()
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return o.main.Hash(ctx, ht)
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.main.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// UnWrap returns the newest copy of the file
+func (o *Object) UnWrap() fs.Object {
+	return o.main
+}
+
+// forEach calls fn on the current copies concurrently and checks the
+// quorum succeeded, queueing a repair of item if some failed
+func (o *Object) forEach(ctx context.Context, what string, item repairItem, fn func(c fs.Object) error) error {
+	errs := o.f.forEach(ctx, func(i int, u fs.Fs) error {
+		if !o.current[i] {
+			return fs.ErrorObjectNotFound
+		}
+		return fn(o.copies[i])
+	})
+	failed, err := o.f.checkQuorum(errs, fmt.Sprintf("%s %q", what, o.remote))
+	o.f.queueRepair(ctx, errs, failed, item)
+	return err
+}
+
+// SetModTime sets the modification time of all the copies
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	return o.forEach(ctx, "set modification time of", repairItem{remote: o.remote}, func(c fs.Object) error {
+		return c.SetModTime(ctx, t)
+	})
+}
+
+// Remove the copies of the object from all the upstreams
+func (o *Object) Remove(ctx context.Context) error {
+	errs := o.f.forEach(ctx, func(i int, u fs.Fs) error {
+		if o.copies[i] == nil {
+			return nil
+		}
+		return o.copies[i].Remove(ctx)
+	})
+	failed, err := o.f.checkQuorum(errs, fmt.Sprintf("remove %q", o.remote))
+	o.f.queueRepair(ctx, errs, failed, repairItem{remote: o.remote, delete: true})
+	return err
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	src = fs.NewOverrideRemote(src, o.remote)
+	newO, err := o.f.write(ctx, in, o.remote, func(ctx context.Context, i int, u fs.Fs, in io.Reader) (fs.Object, error) {
+		if c := o.copies[i]; c != nil {
+			err := c.Update(ctx, in, src, options...)
+			return c, err
+		}
+		if src.Size() < 0 {
+			return u.Features().PutStream(ctx, in, src, options...)
+		}
+		return u.Put(ctx, in, src, options...)
+	})
+	if err != nil {
+		return err
+	}
+	*o = *newO
+	return nil
+}
+
+// openResult is the result of opening a copy
+type openResult struct {
+	i      int
+	rc     io.ReadCloser
+	cancel context.CancelFunc
+	err    error
+}
+
+// cancelOnClose cancels the context of the open when it is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close the stream and cancel its context
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// The file is opened on all the upstreams with a current copy and the
+// first to answer is used. The others are cancelled.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	results := make(chan openResult, len(o.copies))
+	cancels := make([]context.CancelFunc, len(o.copies))
+	n := 0
+	for i, c := range o.copies {
+		if !o.current[i] {
+			continue
+		}
+		n++
+		openCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func(i int, c fs.Object) {
+			rc, err := c.Open(openCtx, options...)
+			results <- openResult{i: i, rc: rc, cancel: cancel, err: err}
+		}(i, c)
+	}
+	var errs []error
+	for ; n > 0; n-- {
+		r := <-results
+		if r.err != nil {
+			r.cancel()
+			fs.Debugf(o, "upstream %d: failed to open: %v", r.i+1, r.err)
+			errs = append(errs, fmt.Errorf("upstream %d: %w", r.i+1, r.err))
+			continue
+		}
+		fs.Debugf(o, "Reading from upstream %d", r.i+1)
+		// Cancel the slower ones and wait for them to finish as they
+		// may still be using the options
+		for i, cancel := range cancels {
+			if cancel != nil && i != r.i {
+				cancel()
+			}
+		}
+		for n--; n > 0; n-- {
+			slow := <-results
+			if slow.err == nil {
+				_ = slow.rc.Close()
+			}
+			slow.cancel()
+		}
+		return &cancelOnClose{ReadCloser: r.rc, cancel: r.cancel}, nil
+	}
+	if len(errs) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return nil, errs[0]
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
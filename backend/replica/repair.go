@@ -0,0 +1,237 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// repairItem is a file whose copies need bringing back into line
+type repairItem struct {
+	remote string // path of the file
+	delete bool   // set if the file should be removed from all upstreams
+}
+
+// queuedRepair is a repairItem with the context it was queued from
+type queuedRepair struct {
+	ctx  context.Context
+	item repairItem
+}
+
+// repairQueue runs repairs in the background
+type repairQueue struct {
+	f       *Fs
+	mu      sync.Mutex
+	items   []queuedRepair // repairs waiting to run
+	running bool           // set if the worker is running
+	wg      sync.WaitGroup // for the worker
+}
+
+// newRepairQueue makes a repair queue for f
+func newRepairQueue(f *Fs) *repairQueue {
+	return &repairQueue{f: f}
+}
+
+// add queues item for repair, starting the worker if necessary
+func (q *repairQueue) add(ctx context.Context, item repairItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fs.Infof(q.f, "Queueing repair of %q", item.remote)
+	// The repair outlives the operation which queued it but should
+	// use its config
+	q.items = append(q.items, queuedRepair{ctx: context.WithoutCancel(ctx), item: item})
+	if !q.running {
+		q.running = true
+		q.wg.Add(1)
+		go q.run()
+	}
+}
+
+// run does the queued repairs until there are none left
+func (q *repairQueue) run() {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		next := q.items[0]
+		q.items = q.items[1:]
+		q.mu.Unlock()
+		if _, err := q.f.repair(next.ctx, next.item); err != nil {
+			fs.Errorf(q.f, "Failed to repair %q - run the repair backend command to fix: %v", next.item.remote, err)
+		}
+	}
+}
+
+// pending returns the number of repairs waiting
+func (q *repairQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// shutdown waits for the queued repairs to finish
+func (q *repairQueue) shutdown(ctx context.Context) error {
+	if n := q.pending(); n > 0 {
+		fs.Infof(q.f, "Waiting for %d queued repairs to finish", n)
+	}
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d repairs not done - run the repair backend command to fix: %w", q.pending(), ctx.Err())
+	}
+}
+
+// repair brings the copies of item on the upstreams into line
+// returning the number of copies written or deleted
+func (f *Fs) repair(ctx context.Context, item repairItem) (n int, err error) {
+	copies, err := f.findCopies(ctx, item.remote)
+	if err == fs.ErrorObjectNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if item.delete {
+		for _, c := range copies {
+			if c == nil {
+				continue
+			}
+			if err = operations.DeleteFile(ctx, c); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	}
+	return f.repairObject(ctx, f.newObjectFromCopies(ctx, item.remote, copies))
+}
+
+// repairObject copies the current version of o to the upstreams
+// which are missing it returning the number of copies written
+func (f *Fs) repairObject(ctx context.Context, o *Object) (n int, err error) {
+	for i, u := range f.upstreams {
+		if o.current[i] || u == nil {
+			continue
+		}
+		fs.Infof(o, "Copying to upstream %d", i+1)
+		_, err = operations.Copy(ctx, u, o.copies[i], o.remote, o.main)
+		if err != nil {
+			return n, fmt.Errorf("upstream %d: %w", i+1, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "repair":
+		return f.repairAll(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "repair",
+	Short: "Make all the upstreams have the same files",
+	Long: `This lists every file under the path given on all the upstreams and
+copies the newest version of any file which is missing or out of date
+on some upstreams to them.
+
+Note that a file which was deleted from some upstreams but not others
+will be copied back to them.
+
+Usage Example:
+
+    rclone backend repair replica:
+    rclone backend repair replica:path/to/dir
+
+Use --dry-run to see what would be copied.
+`,
+}}
+
+// repairStats is returned by the repair command
+type repairStats struct {
+	Files    int `json:"files"`    // number of files checked
+	Repaired int `json:"repaired"` // number of files repaired
+	Copies   int `json:"copies"`   // number of copies written
+	Failed   int `json:"failed"`   // number of files which couldn't be repaired
+}
+
+// repairAll repairs all the files under the root
+func (f *Fs) repairAll(ctx context.Context) (*repairStats, error) {
+	var (
+		stats repairStats
+		mu    sync.Mutex
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	var walkDir func(dir string) error
+	walkDir = func(dir string) error {
+		entries, err := f.List(ctx, dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case *Object:
+				o := x
+				g.Go(func() error {
+					n, err := f.repairObject(gCtx, o)
+					mu.Lock()
+					defer mu.Unlock()
+					stats.Files++
+					if n > 0 {
+						stats.Repaired++
+						stats.Copies += n
+					}
+					if err != nil {
+						fs.Errorf(o, "Failed to repair: %v", err)
+						stats.Failed++
+					}
+					return nil
+				})
+			case fs.Directory:
+				if err := walkDir(x.Remote()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walkDir("")
+	if waitErr := g.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stats.Failed > 0 {
+		return &stats, fmt.Errorf("failed to repair %d files", stats.Failed)
+	}
+	return &stats, nil
+}
@@ -0,0 +1,773 @@
+// Package replica provides an Fs which mirrors files to several
+// upstream remotes.
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "replica",
+		Description: "Mirror files to several remotes",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `List of space separated upstreams.
+
+Every file is written to all of the upstreams.
+
+Can be 'remotea:dir remoteb:dir', '"remotea:dir with space" remoteb:', etc.`,
+			Required: true,
+			Default:  fs.SpaceSepList(nil),
+		}, {
+			Name: "write_quorum",
+			Help: `Number of upstreams which must commit a write for it to succeed.
+
+If a write succeeds on at least this many upstreams but fails on
+others, a repair is queued to copy the file to the others.
+
+Set to 0 to use a majority of the upstreams.`,
+			Default: 0,
+		}, {
+			Name: "straggler_timeout",
+			Help: `How long to wait for the other upstreams once the quorum has committed.
+
+Once write_quorum upstreams have committed a write, any upstreams
+which haven't finished within this time are cancelled and a repair is
+queued for them.
+
+Upstreams which don't read any of the data waiting for them for this
+long are dropped from the write whether or not the quorum has
+committed, so a hung upstream can't stop the write finishing.
+
+Set to 0 to wait for all the upstreams.`,
+			Default:  fs.Duration(time.Minute),
+			Advanced: true,
+		}, {
+			Name: "buffer_size",
+			Help: `Amount of data to buffer for upstreams which are behind the others.
+
+The data for a write is read once and buffered for the upstreams. If
+an upstream falls this far behind the fastest and write_quorum other
+upstreams are waiting for it, it is dropped from the write and a
+repair is queued for it.
+
+This is the most memory used by each write.`,
+			Default:  fs.SizeSuffix(16 * 1024 * 1024),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams        fs.SpaceSepList `config:"upstreams"`
+	WriteQuorum      int             `config:"write_quorum"`
+	StragglerTimeout fs.Duration     `config:"straggler_timeout"`
+	BufferSize       fs.SizeSuffix   `config:"buffer_size"`
+}
+
+// Fs represents a mirrored remote
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	opt       Options      // parsed options
+	features  *fs.Features // optional features
+	upstreams []fs.Fs      // the upstreams, nil if not available
+	quorum    int          // number of upstreams needed for a write
+	repairs   *repairQueue // repairs waiting to be done
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(opt.Upstreams)
+	if n < 2 {
+		return nil, errors.New("replica needs at least 2 upstreams - check the value of the upstreams setting")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point replica remote at itself - check the value of the upstreams setting")
+		}
+	}
+	quorum := opt.WriteQuorum
+	if quorum == 0 {
+		quorum = n/2 + 1
+	}
+	if quorum < 1 || quorum > n {
+		return nil, fmt.Errorf("write_quorum must be between 1 and the number of upstreams %d", n)
+	}
+	if opt.BufferSize < teeChunkSize {
+		opt.BufferSize = teeChunkSize
+	}
+
+	f := &Fs{
+		name:   name,
+		root:   strings.Trim(root, "/"),
+		opt:    *opt,
+		quorum: quorum,
+	}
+	f.repairs = newRepairQueue(f)
+
+	// If the root is a file then use its parent as the root
+	isFile := false
+	if f.root != "" {
+		dir, leaf := path.Split(f.root)
+		if err = f.setRoot(ctx, strings.Trim(dir, "/")); err != nil {
+			return nil, err
+		}
+		_, err = f.NewObject(ctx, leaf)
+		isFile = err == nil
+	}
+	if !isFile {
+		if err = f.setRoot(ctx, strings.Trim(root, "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from the upstreams
+	features := (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+		PartialUploads:          true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		if u != nil {
+			features = features.Mask(ctx, u)
+		}
+	}
+	// We can always shutdown to finish the repairs
+	features.Shutdown = f.Shutdown
+	f.features = features
+
+	// Keep the upstreams in the cache while this Fs is in use
+	for _, u := range f.upstreams {
+		if u != nil {
+			cache.Pin(u)
+		}
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			if u != nil {
+				cache.Unpin(u)
+			}
+		}
+	})
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// setRoot makes the upstreams for root
+//
+// Upstreams which can't be made are logged and left as nil as long
+// as there is at least one left.
+func (f *Fs) setRoot(ctx context.Context, root string) error {
+	f.root = root
+	f.upstreams = make([]fs.Fs, len(f.opt.Upstreams))
+	errs := make([]error, len(f.opt.Upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.opt.Upstreams {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			remote := fspath.JoinRootPath(u, root)
+			uFs, err := cache.Get(ctx, remote)
+			if err == fs.ErrorIsFile {
+				err = fmt.Errorf("upstream %q is a file", remote)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to create upstream %q: %w", remote, err)
+				return
+			}
+			f.upstreams[i] = uFs
+		}(i, u)
+	}
+	wg.Wait()
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			fs.Errorf(f, "%v", err)
+			failed++
+		}
+	}
+	if failed == len(errs) {
+		return fmt.Errorf("no upstreams available: %w", errs[0])
+	}
+	return nil
+}
+
+// errUpstreamUnavailable is returned for upstreams which couldn't be created
+var errUpstreamUnavailable = errors.New("upstream unavailable")
+
+// forEach calls fn for each upstream concurrently, returning an error
+// for each one. Missing upstreams return an error.
+func (f *Fs) forEach(ctx context.Context, fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		if u == nil {
+			errs[i] = errUpstreamUnavailable
+			continue
+		}
+		wg.Add(1)
+		go func(i int, u fs.Fs) {
+			defer wg.Done()
+			errs[i] = fn(i, u)
+		}(i, u)
+	}
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the first error in errs with the upstream number
+func firstError(errs []error) error {
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("upstream %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// checkQuorum returns an error if fewer than the quorum of errs are
+// nil. It returns the indices of the upstreams which failed.
+func (f *Fs) checkQuorum(errs []error, what string) (failed []int, err error) {
+	for i, err := range errs {
+		if err != nil {
+			fs.Errorf(f, "upstream %d: failed to %s: %v", i+1, what, err)
+			failed = append(failed, i)
+		}
+	}
+	if ok := len(errs) - len(failed); ok < f.quorum {
+		return failed, fmt.Errorf("failed to %s: only %d upstreams succeeded but need %d: %w", what, ok, f.quorum, firstError(errs))
+	}
+	return failed, nil
+}
+
+// queueRepair queues a repair of item if some of the upstreams
+// succeeded and some failed.
+//
+// This is done whether or not the quorum was reached as otherwise the
+// upstreams which succeeded would be left out of line with the others.
+func (f *Fs) queueRepair(ctx context.Context, errs []error, failed []int, item repairItem) {
+	if len(failed) > 0 && len(failed) < len(errs) {
+		f.repairs.add(ctx, item)
+	}
+}
+
+// sameVersion returns true if a and b are copies of the same version
+// of a file
+func (f *Fs) sameVersion(ctx context.Context, a, b fs.Object) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	precision := f.Precision()
+	if precision == fs.ModTimeNotSupported {
+		return true
+	}
+	dt := a.ModTime(ctx).Sub(b.ModTime(ctx))
+	return dt <= precision && dt >= -precision
+}
+
+// newObjectFromCopies makes an Object from the copies of a file found
+// on the upstreams indexed by upstream. The newest copy is the
+// current version and only the copies the same as it are read.
+func (f *Fs) newObjectFromCopies(ctx context.Context, remote string, copies []fs.Object) *Object {
+	o := f.newObject(remote)
+	for i, c := range copies {
+		if c == nil {
+			continue
+		}
+		o.copies[i] = c
+		if o.main == nil || c.ModTime(ctx).After(o.main.ModTime(ctx)) {
+			o.main = c
+		}
+	}
+	for i, c := range o.copies {
+		o.current[i] = c != nil && f.sameVersion(ctx, c, o.main)
+	}
+	return o
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	entries := make([]fs.DirEntries, len(f.upstreams))
+	errs := f.forEach(ctx, func(i int, u fs.Fs) (err error) {
+		entries[i], err = u.List(ctx, dir)
+		return err
+	})
+	found := false
+	for i, err := range errs {
+		switch err {
+		case nil:
+			found = true
+		case fs.ErrorDirNotFound:
+		default:
+			fs.Errorf(f, "upstream %d: failed to list %q: %v", i+1, dir, err)
+		}
+	}
+	if !found {
+		for _, err := range errs {
+			if err != fs.ErrorDirNotFound {
+				return nil, firstError(errs)
+			}
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+	var (
+		out    fs.DirEntries
+		copies = make(map[string][]fs.Object)
+		dirs   = make(map[string]struct{})
+	)
+	for i, upstreamEntries := range entries {
+		for _, entry := range upstreamEntries {
+			switch x := entry.(type) {
+			case fs.Object:
+				if copies[x.Remote()] == nil {
+					copies[x.Remote()] = make([]fs.Object, len(f.upstreams))
+				}
+				copies[x.Remote()][i] = x
+			case fs.Directory:
+				if _, found := dirs[x.Remote()]; !found {
+					dirs[x.Remote()] = struct{}{}
+					out = append(out, x)
+				}
+			default:
+				return nil, fmt.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	for remote, objs := range copies {
+		out = append(out, f.newObjectFromCopies(ctx, remote, objs))
+	}
+	return out, nil
+}
+
+// findCopies finds the copies of remote on each upstream
+func (f *Fs) findCopies(ctx context.Context, remote string) ([]fs.Object, error) {
+	copies := make([]fs.Object, len(f.upstreams))
+	errs := f.forEach(ctx, func(i int, u fs.Fs) (err error) {
+		copies[i], err = u.NewObject(ctx, remote)
+		return err
+	})
+	found := false
+	for i, err := range errs {
+		switch err {
+		case nil:
+			found = true
+		case fs.ErrorObjectNotFound, fs.ErrorIsDir:
+		default:
+			fs.Errorf(f, "upstream %d: failed to find %q: %v", i+1, remote, err)
+		}
+	}
+	if !found {
+		for _, err := range errs {
+			if err != fs.ErrorObjectNotFound && err != fs.ErrorIsDir {
+				return nil, firstError(errs)
+			}
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	return copies, nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	copies, err := f.findCopies(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObjectFromCopies(ctx, remote, copies), nil
+}
+
+// writeFn writes the data from in to upstream i returning the object
+type writeFn func(ctx context.Context, i int, u fs.Fs, in io.Reader) (fs.Object, error)
+
+// write writes the data from in to every upstream using fn
+//
+// It succeeds once the quorum of upstreams has committed the write.
+// The upstreams which failed, fell too far behind the others or were
+// cancelled after the straggler_timeout are queued for repair.
+func (f *Fs) write(ctx context.Context, in io.Reader, remote string, fn writeFn) (*Object, error) {
+	n := len(f.upstreams)
+	t := newTee(in, n, int(f.opt.BufferSize), f.quorum, time.Duration(f.opt.StragglerTimeout))
+	readers := t.readers
+	type result struct {
+		i   int
+		o   fs.Object
+		err error
+	}
+	results := make(chan result, n)
+	cancels := make([]context.CancelFunc, n)
+	for i, u := range f.upstreams {
+		if u == nil {
+			readers[i].close(errUpstreamUnavailable)
+			results <- result{i: i, err: errUpstreamUnavailable}
+			continue
+		}
+		var uCtx context.Context
+		uCtx, cancels[i] = context.WithCancel(ctx)
+		go func(i int, u fs.Fs, uCtx context.Context) {
+			o, err := fn(uCtx, i, u, readers[i])
+			// Stop the reader so it doesn't hold up the others
+			readers[i].close(errTeeClosed)
+			results <- result{i: i, o: o, err: err}
+		}(i, u, uCtx)
+	}
+	var (
+		copies    = make([]fs.Object, n)
+		errs      = make([]error, n)
+		committed = 0
+		timer     *time.Timer
+	)
+	for range f.upstreams {
+		r := <-results
+		copies[r.i], errs[r.i] = r.o, r.err
+		if r.err == nil {
+			committed++
+			if committed == f.quorum && f.opt.StragglerTimeout > 0 {
+				timer = time.AfterFunc(time.Duration(f.opt.StragglerTimeout), func() {
+					for i, cancel := range cancels {
+						if cancel != nil {
+							fs.Debugf(f, "upstream %d: cancelling write of %q as quorum reached", i+1, remote)
+							readers[i].close(context.Canceled)
+							cancel()
+						}
+					}
+				})
+			}
+		}
+	}
+	if timer != nil {
+		timer.Stop()
+	}
+	for _, cancel := range cancels {
+		if cancel != nil {
+			cancel()
+		}
+	}
+	closeErr := t.close()
+	failed, err := f.checkQuorum(errs, fmt.Sprintf("write %q", remote))
+	f.queueRepair(ctx, errs, failed, repairItem{remote: remote})
+	if closeErr != nil {
+		return nil, closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.newObjectFromCopies(ctx, remote, copies), nil
+}
+
+// put uploads src to all the upstreams
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (*Object, error) {
+	return f.write(ctx, in, src.Remote(), func(ctx context.Context, i int, u fs.Fs, in io.Reader) (fs.Object, error) {
+		if stream {
+			return u.Features().PutStream(ctx, in, src, options...)
+		}
+		return u.Put(ctx, in, src, options...)
+	})
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(ctx, in, src, options...)
+	case fs.ErrorObjectNotFound:
+		return f.put(ctx, in, src, false, options...)
+	default:
+		return nil, err
+	}
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(ctx, in, src, options...)
+	case fs.ErrorObjectNotFound:
+		return f.put(ctx, in, src, true, options...)
+	default:
+		return nil, err
+	}
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	_, err := f.checkQuorum(f.forEach(ctx, func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	}), fmt.Sprintf("make directory %q", dir))
+	return err
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+	return f.dirResult(errs)
+}
+
+// dirResult returns the result of a directory operation which
+// returned errs from each upstream
+//
+// It is OK for the directory not to be found on some upstreams but
+// any other error is returned.
+func (f *Fs) dirResult(errs []error) error {
+	found := false
+	for i, err := range errs {
+		switch err {
+		case nil:
+			found = true
+		case fs.ErrorDirNotFound:
+			errs[i] = nil
+		}
+	}
+	if err := firstError(errs); err != nil {
+		return err
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Purge all files in the directory specified
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		return u.Features().Purge(ctx, dir)
+	})
+	return f.dirResult(errs)
+}
+
+// serverSide copies or moves src to remote using do on each upstream
+func (f *Fs) serverSide(ctx context.Context, src fs.Object, remote string, what string, do func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error)) (*Object, *Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || len(srcObj.copies) != len(f.upstreams) {
+		return nil, nil, nil
+	}
+	copies := make([]fs.Object, len(f.upstreams))
+	errs := f.forEach(ctx, func(i int, u fs.Fs) (err error) {
+		if !srcObj.current[i] {
+			return fs.ErrorObjectNotFound
+		}
+		copies[i], err = do(u)(ctx, srcObj.copies[i], remote)
+		return err
+	})
+	failed, err := f.checkQuorum(errs, fmt.Sprintf("%s %q", what, remote))
+	f.queueRepair(ctx, errs, failed, repairItem{remote: remote})
+	if err != nil {
+		return nil, srcObj, err
+	}
+	return f.newObjectFromCopies(ctx, remote, copies), srcObj, nil
+}
+
+// Copy src to this remote using server side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	dst, srcObj, err := f.serverSide(ctx, src, remote, "copy", func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error) {
+		return u.Features().Copy
+	})
+	if srcObj == nil {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// Move src to this remote using server side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	dst, srcObj, err := f.serverSide(ctx, src, remote, "move", func(u fs.Fs) func(context.Context, fs.Object, string) (fs.Object, error) {
+		return u.Features().Move
+	})
+	if srcObj == nil {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	// Remove any copies of the source left behind
+	for i, c := range srcObj.copies {
+		if c != nil && (err != nil || dst.copies[i] == nil) {
+			srcObj.f.repairs.add(ctx, repairItem{remote: srcObj.remote, delete: true})
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || len(srcFs.upstreams) != len(f.upstreams) {
+		fs.Debugf(src, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	// Check the destination doesn't exist before moving anything
+	_, err := f.List(ctx, dstRemote)
+	if err == nil {
+		return fs.ErrorDirExists
+	} else if err != fs.ErrorDirNotFound {
+		return err
+	}
+	errs := f.forEach(ctx, func(i int, u fs.Fs) error {
+		if srcFs.upstreams[i] == nil {
+			return errUpstreamUnavailable
+		}
+		return u.Features().DirMove(ctx, srcFs.upstreams[i], srcRemote, dstRemote)
+	})
+	return f.dirResult(errs)
+}
+
+// Shutdown the backend, finishing the queued repairs
+func (f *Fs) Shutdown(ctx context.Context) error {
+	err := f.repairs.shutdown(ctx)
+	var errs []error
+	for _, u := range f.upstreams {
+		if u == nil {
+			continue
+		}
+		if do := u.Features().Shutdown; do != nil {
+			errs = append(errs, do(ctx))
+		}
+	}
+	if err == nil {
+		err = firstError(errs)
+	}
+	return err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("replica root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatest time.Duration
+	for _, u := range f.upstreams {
+		if u != nil && u.Precision() > greatest {
+			greatest = u.Precision()
+		}
+	}
+	return greatest
+}
+
+// Hashes returns the hashes supported by all the upstreams
+func (f *Fs) Hashes() hash.Set {
+	set := hash.Supported()
+	for _, u := range f.upstreams {
+		if u != nil {
+			set = set.Overlap(u.Hashes())
+		}
+	}
+	return set
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.Commander   = (*Fs)(nil)
+	_ fs.Shutdowner  = (*Fs)(nil)
+)
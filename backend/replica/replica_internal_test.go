@@ -0,0 +1,156 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBroken = errors.New("upstream broken")
+
+// brokenFs is an upstream which fails all uploads
+type brokenFs struct {
+	fs.Fs
+}
+
+// Put fails after reading some of the input
+func (b brokenFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	_, _ = io.CopyN(io.Discard, in, 10)
+	return nil, errBroken
+}
+
+func putFile(ctx context.Context, t *testing.T, f fs.Fs, name, data string) fs.Object {
+	item := fstest.Item{Path: name, ModTime: fstest.Time("2001-02-03T04:05:06.499999999Z")}
+	o := fstests.PutTestContents(ctx, t, f, &item, data, true)
+	require.NotNil(t, o)
+	return o
+}
+
+// withBroken runs fn with upstream i failing uploads
+func (f *Fs) withBroken(i int, fn func()) {
+	u := f.upstreams[i]
+	f.upstreams[i] = brokenFs{Fs: u}
+	defer func() { f.upstreams[i] = u }()
+	fn()
+}
+
+// Check a write succeeds with the quorum and the missing copy is
+// repaired
+func (f *Fs) testQuorumAndRepair(t *testing.T) {
+	ctx := context.Background()
+	const remote = "quorum/file"
+	data := "hello replicated world"
+
+	var o fs.Object
+	f.withBroken(0, func() {
+		o = putFile(ctx, t, f, remote, data)
+	})
+	require.NoError(t, f.repairs.shutdown(ctx))
+	assert.Equal(t, 0, f.repairs.pending())
+	copies, err := f.findCopies(ctx, remote)
+	require.NoError(t, err)
+	for i, c := range copies {
+		assert.NotNil(t, c, "copy %d", i)
+	}
+
+	// Too many failures fails the write
+	var err2 error
+	f.withBroken(0, func() {
+		f.withBroken(1, func() {
+			_, err2 = f.Put(ctx, strings.NewReader(data+"!"), fs.NewOverrideRemote(o, remote+"2"))
+		})
+	})
+	assert.ErrorContains(t, err2, "only 1 upstreams succeeded")
+	require.NoError(t, f.repairs.shutdown(ctx))
+
+	// The repair queued by the failed write may have run while the
+	// upstreams were still broken so finish it here
+	_, err = f.repair(ctx, repairItem{remote: remote + "2"})
+	require.NoError(t, err)
+
+	// Lose a copy then repair it with the command
+	require.NoError(t, copies[2].Remove(ctx))
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.False(t, o.(*Object).current[2])
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, data, string(got))
+
+	stats, err := f.repairAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Repaired)
+	assert.Equal(t, 1, stats.Copies)
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, o.(*Object).current)
+
+	// An out of date copy is replaced
+	_ = putFile(ctx, t, f.upstreams[1], remote, "old")
+	require.NoError(t, copies[1].SetModTime(ctx, time.Unix(1000, 0)))
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), o.Size())
+	stats, err = f.repairAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Copies)
+
+	// Clean up, including the copy left by the failed write
+	require.NoError(t, o.Remove(ctx))
+	o2, err := f.NewObject(ctx, remote+"2")
+	require.NoError(t, err)
+	require.NoError(t, o2.Remove(ctx))
+	require.NoError(t, f.Rmdir(ctx, "quorum"))
+}
+
+// Check a write which misses the quorum queues a repair so the
+// upstreams which did write the file aren't left out of line
+func (f *Fs) testQuorumFailureRepair(t *testing.T) {
+	ctx := context.Background()
+	const remote = "quorumfail/file"
+	data := "hello replicated world"
+	src := fs.NewOverrideRemote(putFile(ctx, t, f.upstreams[0], "quorumfail/src", data), remote)
+
+	_, err := f.write(ctx, strings.NewReader(data), remote, func(ctx context.Context, i int, u fs.Fs, in io.Reader) (fs.Object, error) {
+		if i != len(f.upstreams)-1 {
+			return nil, errBroken
+		}
+		return u.Put(ctx, in, src)
+	})
+	assert.ErrorIs(t, err, errBroken)
+	require.NoError(t, f.repairs.shutdown(ctx))
+	copies, err := f.findCopies(ctx, remote)
+	require.NoError(t, err)
+	for i, c := range copies {
+		assert.NotNil(t, c, "copy %d", i)
+	}
+
+	// Clean up
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	o, err = f.upstreams[0].NewObject(ctx, "quorumfail/src")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.Rmdir(ctx, "quorumfail"))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("QuorumAndRepair", f.testQuorumAndRepair)
+	t.Run("QuorumFailureRepair", f.testQuorumFailureRepair)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,70 @@
+// Test Replica filesystem interface
+package replica
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestReplica:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"UnWrap",
+		"WrapFs",
+		"SetWrapper",
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"DirCacheFlush",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"About",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"ListR",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"ID",
+		"GetTier",
+		"SetTier",
+		"Metadata",
+		"SetMetadata",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests replica with 3 upstreams on the local filesystem
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	upstreams := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	name := "TestReplicaLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "replica"},
+		{Name: name, Key: "upstreams", Value: strings.Join(upstreams, " ")},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
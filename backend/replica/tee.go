@@ -0,0 +1,249 @@
+package replica
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Errors returned to the upstreams dropped from a write
+var (
+	errFellBehind = errors.New("dropped as too far behind the other upstreams")
+	errStalled    = errors.New("dropped as not reading the data")
+	errTeeClosed  = errors.New("read on closed tee")
+)
+
+// teeChunkSize is the most data read from the input in one go
+const teeChunkSize = 64 * 1024
+
+// tee copies the data read from in to several readers which read it
+// at their own pace.
+//
+// Up to bufferSize bytes are kept for the readers which are behind.
+// If the buffer is full and at least quorum readers are waiting for
+// more data, then the readers holding up the buffer are dropped so one
+// slow or hung upstream can't stop the others finishing.
+//
+// If stallTimeout is set then readers which don't read anything for
+// that long while there is data waiting for them are dropped too,
+// whether or not the quorum is waiting.
+type tee struct {
+	in           io.Reader
+	bufferSize   int
+	quorum       int
+	stallTimeout time.Duration
+	readers      []*teeReader
+	done         chan struct{} // closed when fill has finished
+	mu           sync.Mutex    // protects the items below
+	cond         *sync.Cond    // signalled when anything changes
+	buf          []byte        // data from offset base
+	base         int64         // offset of buf[0] in the input
+	end          int64         // offset of the end of buf in the input
+	err          error         // error reading in - io.EOF at the end
+	closed       bool          // set when the tee is closed
+}
+
+// teeReader is one of the outputs of a tee
+type teeReader struct {
+	t        *tee
+	off      int64     // offset of the next read in the input
+	err      error     // set if the reader is closed or dropped
+	lastRead time.Time // when data was last read or became available
+}
+
+// newTee makes a tee reading from in with n readers and starts
+// reading the input.
+func newTee(in io.Reader, n int, bufferSize int, quorum int, stallTimeout time.Duration) *tee {
+	t := &tee{
+		in:           in,
+		bufferSize:   bufferSize,
+		quorum:       quorum,
+		stallTimeout: stallTimeout,
+		readers:      make([]*teeReader, n),
+		done:         make(chan struct{}),
+	}
+	t.cond = sync.NewCond(&t.mu)
+	now := time.Now()
+	for i := range t.readers {
+		t.readers[i] = &teeReader{t: t, lastRead: now}
+	}
+	go t.fill()
+	if stallTimeout > 0 {
+		go t.watchdog()
+	}
+	return t
+}
+
+// active returns true if the reader hasn't been closed or dropped
+func (r *teeReader) active() bool {
+	return r.err == nil
+}
+
+// trim discards the data all the active readers have read
+//
+// Call with the lock held.
+func (t *tee) trim() {
+	minOff := t.end
+	for _, r := range t.readers {
+		if r.active() && r.off < minOff {
+			minOff = r.off
+		}
+	}
+	t.buf = t.buf[minOff-t.base:]
+	t.base = minOff
+}
+
+// dropBehind drops the readers holding up the buffer if at least
+// quorum readers are waiting for more data, returning true if any
+// were dropped.
+//
+// Call with the lock held.
+func (t *tee) dropBehind() bool {
+	waiting := 0
+	for _, r := range t.readers {
+		if r.active() && r.off == t.end {
+			waiting++
+		}
+	}
+	if waiting < t.quorum {
+		return false
+	}
+	dropped := false
+	for _, r := range t.readers {
+		if r.active() && r.off == t.base {
+			r.err = errFellBehind
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// fill reads the input into the buffer while there are readers for it
+func (t *tee) fill() {
+	defer close(t.done)
+	chunk := make([]byte, teeChunkSize)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		t.trim()
+		active := 0
+		for _, r := range t.readers {
+			if r.active() {
+				active++
+			}
+		}
+		if active == 0 || t.closed {
+			return
+		}
+		space := t.bufferSize - len(t.buf)
+		if space <= 0 {
+			if t.dropBehind() {
+				t.cond.Broadcast()
+			} else {
+				t.cond.Wait()
+			}
+			continue
+		}
+		t.mu.Unlock()
+		n, err := t.in.Read(chunk[:min(space, len(chunk))])
+		t.mu.Lock()
+		if n > 0 {
+			// The readers which were waiting have data from now
+			now := time.Now()
+			for _, r := range t.readers {
+				if r.off == t.end {
+					r.lastRead = now
+				}
+			}
+			t.buf = append(t.buf, chunk[:n]...)
+			t.end += int64(n)
+		}
+		if err != nil {
+			t.err = err
+		}
+		t.cond.Broadcast()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watchdog drops the readers which have stalled until the tee is
+// closed
+func (t *tee) watchdog() {
+	ticker := time.NewTicker(max(t.stallTimeout/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			dropped := false
+			for _, r := range t.readers {
+				if r.active() && r.off < t.end && now.Sub(r.lastRead) >= t.stallTimeout {
+					r.err = errStalled
+					dropped = true
+				}
+			}
+			if dropped {
+				t.cond.Broadcast()
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Read data from the input
+func (r *teeReader) Read(p []byte) (n int, err error) {
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for r.active() && r.off == t.end && t.err == nil {
+		t.cond.Wait()
+	}
+	if !r.active() {
+		return 0, r.err
+	}
+	if r.off < t.end {
+		n = copy(p, t.buf[r.off-t.base:])
+		r.off += int64(n)
+		r.lastRead = time.Now()
+		t.cond.Broadcast()
+		return n, nil
+	}
+	return 0, t.err
+}
+
+// close stops the reader, returning err from any reads in progress
+func (r *teeReader) close(err error) {
+	t := r.t
+	t.mu.Lock()
+	if r.active() {
+		r.err = err
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// close closes all the readers and waits for the input to stop being
+// read, returning any error from reading it.
+func (t *tee) close() error {
+	t.mu.Lock()
+	t.closed = true
+	for _, r := range t.readers {
+		if r.active() {
+			r.err = errTeeClosed
+		}
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	<-t.done
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == io.EOF {
+		return nil
+	}
+	return t.err
+}
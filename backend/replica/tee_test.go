@@ -0,0 +1,78 @@
+package replica
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTee reads all the readers of t except those in skip
+// concurrently returning what they read and the errors
+func readTee(t *tee, skip ...int) ([][]byte, []error) {
+	n := len(t.readers)
+	out := make([][]byte, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, r := range t.readers {
+		skipped := false
+		for _, j := range skip {
+			skipped = skipped || i == j
+		}
+		if skipped {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r *teeReader) {
+			defer wg.Done()
+			out[i], errs[i] = io.ReadAll(r)
+			r.close(errTeeClosed)
+		}(i, r)
+	}
+	wg.Wait()
+	return out, errs
+}
+
+func TestTee(t *testing.T) {
+	data := make([]byte, 10*teeChunkSize+17)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// All the readers get all the data
+	tr := newTee(bytes.NewReader(data), 3, teeChunkSize, 3, 0)
+	out, errs := readTee(tr)
+	require.NoError(t, tr.close())
+	for i := range out {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, data, out[i])
+	}
+
+	// A hung reader is dropped once the quorum is waiting for it
+	tr = newTee(bytes.NewReader(data), 3, teeChunkSize, 2, 0)
+	out, errs = readTee(tr, 0)
+	for i := 1; i < 3; i++ {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, data, out[i])
+	}
+	_, err := tr.readers[0].Read(make([]byte, 1))
+	assert.Equal(t, errFellBehind, err)
+	require.NoError(t, tr.close())
+
+	// A hung reader is dropped after the stall timeout even if the
+	// quorum needs it
+	tr = newTee(bytes.NewReader(data), 3, teeChunkSize, 3, 50*time.Millisecond)
+	start := time.Now()
+	out, errs = readTee(tr, 0)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	for i := 1; i < 3; i++ {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, data, out[i])
+	}
+	_, err = tr.readers[0].Read(make([]byte, 1))
+	assert.Equal(t, errStalled, err)
+	require.NoError(t, tr.close())
+}
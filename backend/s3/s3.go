@@ -6003,43 +6003,180 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		chunkSize = chunksize.Calculator(src, size, uploadParts, chunkSize)
 	}
 
-	var mOut *s3.CreateMultipartUploadOutput
-	err = f.pacer.Call(func() (bool, error) {
-		mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
-		if err == nil {
-			if mOut == nil {
-				err = fserrors.RetryErrorf("internal error: no info from multipart upload")
-			} else if mOut.UploadId == nil {
-				err = fserrors.RetryErrorf("internal error: no UploadId in multpart upload: %#v", *mOut)
-			}
-		}
-		return f.shouldRetry(ctx, err)
-	})
-	if err != nil {
-		return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
-	}
-
 	chunkWriter := &s3ChunkWriter{
 		chunkSize:            int64(chunkSize),
 		size:                 size,
 		f:                    f,
-		bucket:               mOut.Bucket,
-		key:                  mOut.Key,
-		uploadID:             mOut.UploadId,
+		bucket:               mReq.Bucket,
+		key:                  mReq.Key,
 		multiPartUploadInput: &mReq,
 		completedParts:       make([]types.CompletedPart, 0),
 		ui:                   ui,
 		o:                    o,
 	}
+
+	// Carry on with a previous upload if asked to
+	var resumedChunks []int
+	for _, option := range options {
+		if resume, ok := option.(*fs.ResumeChunkWriterOption); ok {
+			resumedChunks, err = chunkWriter.resume(ctx, resume.State)
+			if err != nil {
+				fs.Logf(o, "Not resuming multipart upload: %v", err)
+			}
+		}
+	}
+
+	if chunkWriter.uploadID == nil {
+		var mOut *s3.CreateMultipartUploadOutput
+		err = f.pacer.Call(func() (bool, error) {
+			mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
+			if err == nil {
+				if mOut == nil {
+					err = fserrors.RetryErrorf("internal error: no info from multipart upload")
+				} else if mOut.UploadId == nil {
+					err = fserrors.RetryErrorf("internal error: no UploadId in multpart upload: %#v", *mOut)
+				}
+			}
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
+		}
+		chunkWriter.bucket = mOut.Bucket
+		chunkWriter.key = mOut.Key
+		chunkWriter.uploadID = mOut.UploadId
+		fs.Debugf(o, "open chunk writer: started multipart upload: %v", *mOut.UploadId)
+	}
+
 	info = fs.ChunkWriterInfo{
-		ChunkSize:         int64(chunkSize),
+		ChunkSize:         chunkWriter.chunkSize,
 		Concurrency:       o.fs.opt.UploadConcurrency,
 		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
+		ResumedChunks:     resumedChunks,
 	}
-	fs.Debugf(o, "open chunk writer: started multipart upload: %v", *mOut.UploadId)
 	return info, chunkWriter, err
 }
 
+// s3ChunkWriterState is the state of a multipart upload returned by
+// ChunkWriterState so it can be resumed
+type s3ChunkWriterState struct {
+	UploadID  string
+	ChunkSize int64
+	Size      int64
+	Parts     []s3ChunkWriterStatePart
+}
+
+// s3ChunkWriterStatePart is a part in s3ChunkWriterState
+type s3ChunkWriterStatePart struct {
+	PartNumber int32
+	ETag       string
+	MD5        []byte
+}
+
+// ChunkWriterState returns the state of the upload so it can be
+// resumed with fs.ResumeChunkWriterOption
+func (w *s3ChunkWriter) ChunkWriterState() (string, error) {
+	state := s3ChunkWriterState{
+		UploadID:  *w.uploadID,
+		ChunkSize: w.chunkSize,
+		Size:      w.size,
+	}
+	w.completedPartsMu.Lock()
+	w.md5sMu.Lock()
+	for _, part := range w.completedParts {
+		statePart := s3ChunkWriterStatePart{
+			PartNumber: *part.PartNumber,
+			ETag:       deref(part.ETag),
+		}
+		start := int64(*part.PartNumber-1) * md5.Size
+		if end := start + md5.Size; end <= int64(len(w.md5s)) {
+			statePart.MD5 = append([]byte(nil), w.md5s[start:end]...)
+		}
+		state.Parts = append(state.Parts, statePart)
+	}
+	w.md5sMu.Unlock()
+	w.completedPartsMu.Unlock()
+	data, err := json.Marshal(&state)
+	return string(data), err
+}
+
+// resume the multipart upload described by state
+//
+// This checks the parts in state are still in the upload and returns
+// the chunk numbers of those which are.
+func (w *s3ChunkWriter) resume(ctx context.Context, state string) (resumedChunks []int, err error) {
+	var s s3ChunkWriterState
+	err = json.Unmarshal([]byte(state), &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if s.UploadID == "" || s.ChunkSize <= 0 {
+		return nil, errors.New("invalid state")
+	}
+	if w.size < 0 || s.Size != w.size {
+		return nil, fmt.Errorf("size changed from %d to %d", s.Size, w.size)
+	}
+	uploaded, err := w.f.listParts(ctx, *w.bucket, *w.key, s.UploadID, w.multiPartUploadInput)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range s.Parts {
+		chunkNumber := int(part.PartNumber) - 1
+		wantSize := min(s.ChunkSize, s.Size-int64(chunkNumber)*s.ChunkSize)
+		got, ok := uploaded[part.PartNumber]
+		if !ok || deref(got.ETag) != part.ETag || deref(got.Size) != wantSize {
+			fs.Debugf(w.o, "multipart upload %q: uploading part %d again as it is missing or changed", s.UploadID, part.PartNumber)
+			continue
+		}
+		w.addCompletedPart(aws.Int32(part.PartNumber), aws.String(part.ETag))
+		if len(part.MD5) == md5.Size {
+			w.addMd5(&part.MD5, int64(chunkNumber))
+		}
+		resumedChunks = append(resumedChunks, chunkNumber)
+	}
+	w.uploadID = aws.String(s.UploadID)
+	w.chunkSize = s.ChunkSize
+	fs.Debugf(w.o, "Resuming multipart upload %q with %d parts already uploaded", s.UploadID, len(resumedChunks))
+	return resumedChunks, nil
+}
+
+// listParts returns the parts uploaded so far in the multipart upload
+// uploadID indexed by part number
+func (f *Fs) listParts(ctx context.Context, bucket, key, uploadID string, mReq *s3.CreateMultipartUploadInput) (parts map[int32]types.Part, err error) {
+	var partNumberMarker *string
+	parts = make(map[int32]types.Part)
+	for {
+		req := s3.ListPartsInput{
+			Bucket:               &bucket,
+			Key:                  &key,
+			UploadId:             &uploadID,
+			PartNumberMarker:     partNumberMarker,
+			RequestPayer:         mReq.RequestPayer,
+			SSECustomerAlgorithm: mReq.SSECustomerAlgorithm,
+			SSECustomerKey:       mReq.SSECustomerKey,
+			SSECustomerKeyMD5:    mReq.SSECustomerKeyMD5,
+		}
+		var resp *s3.ListPartsOutput
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err = f.c.ListParts(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list parts of multipart upload %q: %w", uploadID, err)
+		}
+		for _, part := range resp.Parts {
+			if part.PartNumber != nil {
+				parts[*part.PartNumber] = part
+			}
+		}
+		if !deref(resp.IsTruncated) || resp.NextPartNumberMarker == nil {
+			break
+		}
+		partNumberMarker = resp.NextPartNumberMarker
+	}
+	return parts, nil
+}
+
 // add a part number and etag to the completed parts
 func (w *s3ChunkWriter) addCompletedPart(partNum *int32, eTag *string) {
 	w.completedPartsMu.Lock()
@@ -6672,4 +6809,6 @@ var (
 	_ fs.GetTierer       = &Object{}
 	_ fs.SetTierer       = &Object{}
 	_ fs.Metadataer      = &Object{}
+
+	_ fs.ChunkWriterResumer = &s3ChunkWriter{}
 )
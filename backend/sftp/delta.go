@@ -0,0 +1,244 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/delta"
+)
+
+const (
+	deltaMaxBatch  = 64          // max number of dd commands to run in one go
+	deltaMaxDDSize = 1024 * 1024 // largest block size to use with dd
+	deltaMinDDSize = 4096        // smallest block size to use with dd before copying by bytes
+)
+
+// deltaSupported returns true if --delta can be used with this remote
+//
+// This needs a unix shell with GNU split and dd and an md5sum command
+// which reads from standard input.
+func (f *Fs) deltaSupported() bool {
+	if f.shellType != defaultShellType {
+		return false
+	}
+	_ = f.Hashes()
+	return f.opt.Md5sumCommand != "" && f.opt.Md5sumCommand != hashCommandNotSupported
+}
+
+// DeltaSignature returns the block checksums of the object for --delta
+//
+// These are calculated on the server by splitting the file into blocks
+// and running the md5sum command on each, all in one command. This
+// means the signature is Aligned.
+func (o *Object) DeltaSignature(ctx context.Context, blockSize int) (*delta.Signature, error) {
+	if !o.fs.deltaSupported() {
+		return nil, fs.ErrorNotImplemented
+	}
+	shellPathArg, err := o.fs.quoteOrEscapeShellPath(o.shellPath())
+	if err != nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	size := o.Size()
+	blocks := (size + int64(blockSize) - 1) / int64(blockSize)
+	md5sumArg, err := o.fs.quoteOrEscapeShellPath(o.fs.opt.Md5sumCommand)
+	if err != nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	cmd := fmt.Sprintf("split -b %d --filter=%s < %s", blockSize, md5sumArg, shellPathArg)
+	// If the command doesn't work then fall back to a normal upload
+	outBytes, err := o.fs.run(ctx, cmd)
+	if err != nil {
+		fs.Debugf(o, "Failed to calculate block checksums: %v", err)
+		return nil, fs.ErrorNotImplemented
+	}
+	lines := bytes.Split(bytes.TrimSpace(outBytes), []byte{'\n'})
+	if blocks == 0 {
+		lines = nil
+	}
+	if int64(len(lines)) != blocks {
+		fs.Debugf(o, "Failed to calculate block checksums: expecting %d checksums but got %d", blocks, len(lines))
+		return nil, fs.ErrorNotImplemented
+	}
+	sig := &delta.Signature{
+		BlockSize: blockSize,
+		Size:      size,
+		Blocks:    make([]delta.Block, blocks),
+		Aligned:   true,
+	}
+	for i, line := range lines {
+		sum, err := hex.DecodeString(parseHash(line))
+		if err != nil || len(sum) != len(sig.Blocks[i].Strong) {
+			fs.Debugf(o, "Can't parse block checksum %q from %q", line, o.fs.opt.Md5sumCommand)
+			return nil, fs.ErrorNotImplemented
+		}
+		copy(sig.Blocks[i].Strong[:], sum)
+	}
+	return sig, nil
+}
+
+// deltaWriter makes the new file for DeltaUpdate
+//
+// New data is written with SFTP and ranges of the old file are copied
+// on the server with dd.
+type deltaWriter struct {
+	ctx     context.Context
+	f       *Fs
+	file    *sftp.File
+	oldPath string   // quoted shell path of the old file
+	tmpPath string   // quoted shell path of the new file
+	off     int64    // size of the new file so far
+	cmds    []string // pending dd commands
+}
+
+// Write new data
+func (w *deltaWriter) Write(p []byte) (n int, err error) {
+	n, err = w.file.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// Copy size bytes from offset in the old file
+//
+// This uses the largest dd block size the offsets allow for as much as
+// possible, then copies the rest, or all of it if the offsets aren't
+// aligned well enough, with a dd which counts in bytes.
+func (w *deltaWriter) Copy(offset, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	bs := int64(deltaMaxDDSize)
+	for bs >= deltaMinDDSize && ((offset|w.off)%bs != 0 || bs > size) {
+		bs /= 2
+	}
+	if bs >= deltaMinDDSize {
+		count := size / bs
+		w.cmds = append(w.cmds, fmt.Sprintf("dd if=%s of=%s bs=%d skip=%d seek=%d count=%d conv=notrunc",
+			w.oldPath, w.tmpPath, bs, offset/bs, w.off/bs, count))
+		offset += count * bs
+		w.off += count * bs
+		size -= count * bs
+	}
+	if size > 0 {
+		w.cmds = append(w.cmds, fmt.Sprintf("dd if=%s of=%s bs=%d iflag=skip_bytes,count_bytes oflag=seek_bytes skip=%d seek=%d count=%d conv=notrunc",
+			w.oldPath, w.tmpPath, deltaMaxDDSize, offset, w.off, size))
+		w.off += size
+	}
+	if len(w.cmds) >= deltaMaxBatch {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush runs the pending dd commands
+func (w *deltaWriter) flush() error {
+	if len(w.cmds) == 0 {
+		return nil
+	}
+	_, err := w.f.run(w.ctx, strings.Join(w.cmds, " && "))
+	w.cmds = w.cmds[:0]
+	if err != nil {
+		return fmt.Errorf("failed to copy existing data: %w", err)
+	}
+	return nil
+}
+
+// DeltaUpdate updates the object for --delta
+//
+// The new file is made next to the old one using the partial suffix
+// then renamed over it when complete.
+func (o *Object) DeltaUpdate(ctx context.Context, src fs.ObjectInfo, fn func(w delta.Writer) error, options ...fs.OpenOption) (err error) {
+	if !o.fs.deltaSupported() {
+		return fs.ErrorNotImplemented
+	}
+	suffix := o.fs.ci.PartialSuffix
+	if suffix == "" {
+		suffix = ".partial"
+	}
+	tmpPath := o.path() + suffix
+	w := &deltaWriter{
+		ctx: ctx,
+		f:   o.fs,
+	}
+	w.oldPath, err = o.fs.quoteOrEscapeShellPath(o.shellPath())
+	if err != nil {
+		return fs.ErrorNotImplemented
+	}
+	w.tmpPath, err = o.fs.quoteOrEscapeShellPath(o.shellPath() + suffix)
+	if err != nil {
+		return fs.ErrorNotImplemented
+	}
+
+	o.fs.addSession() // Show session in use
+	defer o.fs.removeSession()
+	// Clear the hash cache since we are about to update the object
+	o.md5sum = nil
+	o.sha1sum = nil
+	c, err := o.fs.getSftpConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("DeltaUpdate: %w", err)
+	}
+	// Hang on to the connection for the whole upload so it doesn't get reused while we are uploading
+	defer func() {
+		if err != nil {
+			if removeErr := c.sftpClient.Remove(tmpPath); removeErr != nil && !errors.Is(removeErr, iofs.ErrNotExist) {
+				fs.Debugf(src, "Failed to remove partial file: %v", removeErr)
+			}
+		}
+		o.fs.putSftpConnection(&c, err)
+	}()
+	w.file, err = c.sftpClient.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("DeltaUpdate Create failed: %w", err)
+	}
+	err = fn(w)
+	if err == nil {
+		err = w.flush()
+	}
+	if err == nil {
+		err = w.file.Truncate(w.off)
+	}
+	if err == nil && o.mode.Perm() != 0 {
+		err = w.file.Chmod(o.mode.Perm())
+	}
+	closeErr := w.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("DeltaUpdate failed: %w", err)
+	}
+	if _, ok := c.sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+		err = c.sftpClient.PosixRename(tmpPath, o.path())
+	} else {
+		err = c.sftpClient.Remove(o.path())
+		if err == nil {
+			err = c.sftpClient.Rename(tmpPath, o.path())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("DeltaUpdate Rename failed: %w", err)
+	}
+
+	// Set the mod time - this stats the object if o.fs.opt.SetModTime == true
+	err = o.SetModTime(ctx, src.ModTime(ctx))
+	if err != nil {
+		return fmt.Errorf("DeltaUpdate SetModTime failed: %w", err)
+	}
+	if !o.fs.opt.SetModTime {
+		err = o.stat(ctx)
+		if err != nil {
+			return fmt.Errorf("DeltaUpdate stat failed: %w", err)
+		}
+	}
+	return nil
+}
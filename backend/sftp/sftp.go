@@ -2238,4 +2238,5 @@ var (
 	_ fs.Abouter        = &Fs{}
 	_ fs.Shutdowner     = &Fs{}
 	_ fs.Object         = &Object{}
+	_ fs.DeltaUpdater   = &Object{}
 )
@@ -0,0 +1,128 @@
+package tiering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "migrate":
+		age := time.Duration(f.opt.Age)
+		if s, ok := opt["age"]; ok {
+			age, err = fs.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("bad duration for age: %w", err)
+			}
+		}
+		dirs := arg
+		if len(dirs) == 0 {
+			dirs = []string{""}
+		}
+		migrated := []string{}
+		for _, dir := range dirs {
+			moved, err := f.migrate(ctx, dir, age)
+			migrated = append(migrated, moved...)
+			if err != nil {
+				return migrated, err
+			}
+		}
+		return migrated, nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "migrate",
+	Short: "Move files not used for a while to the cold remote",
+	Long: `This moves the files on the hot remote which haven't been used for
+longer than the age option to the cold remote. It looks in the
+directories given, or everywhere if none are given, and prints the
+paths of the files moved.
+
+Usage Example:
+
+    rclone backend migrate tiering:
+    rclone backend migrate tiering: path/to/dir -o age=7d
+
+Use --dry-run to see what would be moved.
+`,
+	Opts: map[string]string{
+		"age": "Move files not used for longer than this instead of the age option",
+	},
+}}
+
+// migrate moves the files under dir on the hot remote which haven't
+// been used for longer than age to the cold remote
+func (f *Fs) migrate(ctx context.Context, dir string, age time.Duration) (migrated []string, err error) {
+	var (
+		cutoff = time.Now().Add(-age)
+		mu     sync.Mutex
+		failed = 0
+	)
+	err = walk.ListR(ctx, f.hot, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok || !f.lastUsed(ctx, o).Before(cutoff) {
+				continue
+			}
+			if operations.SkipDestructive(ctx, o, "move to cold remote") {
+				continue
+			}
+			_, err := operations.Move(ctx, f.cold, nil, o.Remote(), o)
+			mu.Lock()
+			if err != nil {
+				err = fs.CountError(ctx, err)
+				fs.Errorf(o, "Failed to move to cold remote: %v", err)
+				failed++
+			} else {
+				migrated = append(migrated, o.Remote())
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	sort.Strings(migrated)
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("failed to move %d files to the cold remote", failed)
+	}
+	fs.Infof(f, "Moved %d files to the cold remote", len(migrated))
+	return migrated, err
+}
+
+// sweep runs migrate every sweep interval until Shutdown is called
+func (f *Fs) sweep(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(f.opt.SweepInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if _, err := f.migrate(ctx, "", time.Duration(f.opt.Age)); err != nil {
+				fs.Errorf(f, "Background move to the cold remote failed: %v", err)
+			}
+		}
+	}
+}
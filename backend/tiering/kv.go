@@ -0,0 +1,45 @@
+package tiering
+
+import (
+	"context"
+	"time"
+
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// kvGet: get the last access time of a file
+type kvGet struct {
+	key string
+	t   time.Time
+}
+
+func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return nil
+	}
+	return op.t.UnmarshalBinary(data)
+}
+
+// kvPut: set the last access time of a file
+type kvPut struct {
+	key string
+	t   time.Time
+}
+
+func (op *kvPut) Do(ctx context.Context, b kv.Bucket) error {
+	data, err := op.t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(op.key), data)
+}
+
+// kvDelete: remove the last access time of a file
+type kvDelete struct {
+	key string
+}
+
+func (op *kvDelete) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Delete([]byte(op.key))
+}
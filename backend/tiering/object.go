@@ -0,0 +1,145 @@
+package tiering
+
+import (
+	"context"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Object is a file on the hot or cold remote
+type Object struct {
+	fs.Object
+	f    *Fs
+	cold bool // set if the file is on the cold remote
+}
+
+// newObject wraps o which is on the cold remote if cold is set
+func (f *Fs) newObject(o fs.Object, cold bool) *Object {
+	return &Object{Object: o, f: f, cold: cold}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if !o.f.Hashes().Contains(ht) {
+		return "", nil
+	}
+	return o.Object.Hash(ctx, ht)
+}
+
+// Open opens the file for read, recording that it was used
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	o.f.touch(o.Remote())
+	return in, nil
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// Files on the cold remote are written to the hot remote and the
+// cold copy removed.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	remote := o.Remote()
+	if !o.cold {
+		err := o.Object.Update(ctx, in, src, options...)
+		if err != nil {
+			return err
+		}
+		o.f.touch(remote)
+		return nil
+	}
+	newObj, err := o.f.hot.Put(ctx, in, fs.NewOverrideRemote(src, remote), options...)
+	if err != nil {
+		return err
+	}
+	coldObj := o.Object
+	o.Object, o.cold = newObj, false
+	o.f.touch(remote)
+	return coldObj.Remove(ctx)
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	err := o.Object.Remove(ctx)
+	if err != nil {
+		return err
+	}
+	o.f.forget(o.Remote())
+	if !o.cold {
+		// Remove any older copy the file was hiding
+		return o.f.removeCold(ctx, o.Remote())
+	}
+	return nil
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	if do, ok := o.Object.(fs.IDer); ok {
+		return do.ID()
+	}
+	return ""
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.IDer            = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,541 @@
+// Package tiering implements a backend which moves files which
+// haven't been used for a while from a hot remote to a cold one
+package tiering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "tiering",
+		Description: "Move files not used for a while from a hot remote to a cold one",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by both the hot and cold remotes is read and
+written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "hot",
+			Help:     "Remote new files are written to.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name:     "cold",
+			Help:     "Remote files which haven't been used for a while are moved to.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "age",
+			Help: `Move files to the cold remote after they haven't been used for this long.
+
+A file is used when it is read or written through this remote, or
+when its modification time changes.`,
+			Default: fs.Duration(30 * 24 * time.Hour),
+		}, {
+			Name: "sweep_interval",
+			Help: `How often to move old files to the cold remote in the background.
+
+If this is set then rclone checks the hot remote for files older than
+age this often while it is running, for example with rclone mount or
+rclone serve. Set to 0 to disable and use the migrate backend command
+instead.`,
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Hot           string      `config:"hot"`
+	Cold          string      `config:"cold"`
+	Age           fs.Duration `config:"age"`
+	SweepInterval fs.Duration `config:"sweep_interval"`
+}
+
+// Fs represents a hot and a cold remote shown as one
+type Fs struct {
+	name     string        // name of this remote
+	root     string        // the path we are working on
+	opt      Options       // parsed options
+	hot      fs.Fs         // the remote files are written to
+	cold     fs.Fs         // the remote unused files are moved to
+	features *fs.Features  // optional features
+	db       *kv.DB        // last access times of the files, nil if not supported
+	stop     chan struct{} // closed to stop the background sweep
+	stopOnce sync.Once     // makes sure stop is only closed once
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range []string{opt.Hot, opt.Cold} {
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point tiering remote at itself - check the value of the hot and cold settings")
+		}
+	}
+	if opt.Age <= 0 {
+		return nil, errors.New("age must be greater than 0")
+	}
+
+	hot, cold, isFile, err := newTiers(ctx, opt, rpath)
+	if err == nil && isFile {
+		// Point both tiers at the directory containing the file
+		rpath = parentDir(rpath)
+		hot, cold, _, err = newTiers(ctx, opt, rpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &Fs{
+		name: name,
+		root: rpath,
+		opt:  *opt,
+		hot:  hot,
+		cold: cold,
+	}
+	features := (&fs.Features{
+		CaseInsensitive:         true,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		CanHaveEmptyDirectories: true,
+		ReadMetadata:            true,
+		WriteMetadata:           true,
+		UserMetadata:            true,
+	}).Fill(ctx, f)
+	features = features.Mask(ctx, hot).Mask(ctx, cold)
+	// New files are written to the hot remote and moves are done on
+	// the remote the file is on so these don't need the support of
+	// both remotes
+	if hot.Features().PutStream != nil {
+		features.PutStream = f.PutStream
+	}
+	if hot.Features().Copy != nil {
+		features.Copy = f.Copy
+	}
+	if operations.CanServerSideMove(hot) {
+		features.Move = f.Move
+	}
+	// Always shut down to stop the sweep and close the database
+	features.Shutdown = f.Shutdown
+	f.features = features
+
+	if kv.Supported() {
+		f.db, err = kv.Start(ctx, "tiering", f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cache.Pin(hot)
+	cache.Pin(cold)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.hot)
+		cache.Unpin(f.cold)
+	})
+
+	if opt.SweepInterval > 0 {
+		f.stop = make(chan struct{})
+		go f.sweep(context.WithoutCancel(ctx))
+	}
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// newTiers makes the hot and cold remotes rooted at rpath
+//
+// isFile is set if rpath points to a file on either of them.
+func newTiers(ctx context.Context, opt *Options, rpath string) (hot, cold fs.Fs, isFile bool, err error) {
+	hot, err = cache.Get(ctx, fspath.JoinRootPath(opt.Hot, rpath))
+	if err == fs.ErrorIsFile {
+		isFile = true
+	} else if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to make hot remote %q: %w", opt.Hot, err)
+	}
+	cold, err = cache.Get(ctx, fspath.JoinRootPath(opt.Cold, rpath))
+	if err == fs.ErrorIsFile {
+		isFile = true
+	} else if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to make cold remote %q: %w", opt.Cold, err)
+	}
+	return hot, cold, isFile, nil
+}
+
+// parentDir returns the parent directory of remote or "" if it has
+// none
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." || parent == "/" {
+		parent = ""
+	}
+	return parent
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("tiering root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	precision := f.hot.Precision()
+	if p := f.cold.Precision(); p > precision {
+		precision = p
+	}
+	return precision
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.hot.Hashes().Overlap(f.cold.Hashes())
+}
+
+// tier returns the remote for the hot or cold tier
+func (f *Fs) tier(cold bool) fs.Fs {
+	if cold {
+		return f.cold
+	}
+	return f.hot
+}
+
+// key returns the key of remote in the database
+func (f *Fs) key(remote string) string {
+	return path.Join(strings.Trim(f.root, "/"), remote)
+}
+
+// touch records that remote was used now
+func (f *Fs) touch(remote string) {
+	if f.db == nil {
+		return
+	}
+	if err := f.db.Do(true, &kvPut{key: f.key(remote), t: time.Now()}); err != nil {
+		fs.Debugf(remote, "Failed to record access: %v", err)
+	}
+}
+
+// forget removes the record of remote being used
+func (f *Fs) forget(remote string) {
+	if f.db == nil {
+		return
+	}
+	if err := f.db.Do(true, &kvDelete{key: f.key(remote)}); err != nil {
+		fs.Debugf(remote, "Failed to remove access record: %v", err)
+	}
+}
+
+// lastUsed returns the time o was last used - the later of its
+// modification time and the last time it was read or written
+func (f *Fs) lastUsed(ctx context.Context, o fs.Object) time.Time {
+	t := o.ModTime(ctx)
+	if f.db == nil {
+		return t
+	}
+	op := &kvGet{key: f.key(o.Remote())}
+	if err := f.db.Do(false, op); err != nil {
+		fs.Debugf(o, "Failed to read access record: %v", err)
+	}
+	if op.t.After(t) {
+		t = op.t
+	}
+	return t
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	hotEntries, hotErr := f.hot.List(ctx, dir)
+	if hotErr != nil && !errors.Is(hotErr, fs.ErrorDirNotFound) {
+		return nil, hotErr
+	}
+	coldEntries, coldErr := f.cold.List(ctx, dir)
+	if coldErr != nil && !errors.Is(coldErr, fs.ErrorDirNotFound) {
+		return nil, coldErr
+	}
+	if hotErr != nil && coldErr != nil {
+		return nil, fs.ErrorDirNotFound
+	}
+	// Files on the hot remote hide any on the cold remote as they
+	// are newer
+	seen := make(map[string]struct{}, len(hotEntries))
+	entries = make(fs.DirEntries, 0, len(hotEntries)+len(coldEntries))
+	for i, tierEntries := range []fs.DirEntries{hotEntries, coldEntries} {
+		cold := i == 1
+		for _, entry := range tierEntries {
+			remote := entry.Remote()
+			if _, found := seen[remote]; found {
+				continue
+			}
+			seen[remote] = struct{}{}
+			switch x := entry.(type) {
+			case fs.Object:
+				entries = append(entries, f.newObject(x, cold))
+			case fs.Directory:
+				entries = append(entries, x)
+			default:
+				return nil, fmt.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.hot.NewObject(ctx, remote)
+	if err == nil {
+		return f.newObject(o, false), nil
+	}
+	if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, err
+	}
+	o, err = f.cold.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, true), nil
+}
+
+// removeCold removes the copy of remote on the cold remote if there
+// is one as a newer one has been written to the hot remote
+func (f *Fs) removeCold(ctx context.Context, remote string) error {
+	o, err := f.cold.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) || errors.Is(err, fs.ErrorNotAFile) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fs.Debugf(o, "Removing old copy from the cold remote")
+	return o.Remove(ctx)
+}
+
+// written finishes writing newObj to remote on the hot remote
+func (f *Fs) written(ctx context.Context, newObj fs.Object, remote string) (fs.Object, error) {
+	f.touch(remote)
+	o := f.newObject(newObj, false)
+	if err := f.removeCold(ctx, remote); err != nil {
+		return o, fmt.Errorf("failed to remove old copy from the cold remote: %w", err)
+	}
+	return o, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.hot.Put(ctx, in, src, options...)
+	if err != nil {
+		if o == nil {
+			return nil, err
+		}
+		return f.newObject(o, false), err
+	}
+	return f.written(ctx, o, src.Remote())
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.hot.Features().PutStream
+	if do == nil {
+		return nil, errors.New("can't PutStream: not supported by the hot remote")
+	}
+	o, err := do(ctx, in, src, options...)
+	if err != nil {
+		if o == nil {
+			return nil, err
+		}
+		return f.newObject(o, false), err
+	}
+	return f.written(ctx, o, src.Remote())
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Directories are made on the hot remote.
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.hot.Mkdir(ctx, dir)
+}
+
+// rmdir removes dir from tier returning whether it was found
+func rmdir(ctx context.Context, tier fs.Fs, dir string) (found bool, err error) {
+	err = tier.Rmdir(ctx, dir)
+	if err == nil {
+		return true, nil
+	}
+	// Not all remotes return ErrorDirNotFound so check
+	if _, listErr := tier.List(ctx, dir); errors.Is(listErr, fs.ErrorDirNotFound) {
+		return false, nil
+	}
+	return true, err
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	found := false
+	for _, tier := range []fs.Fs{f.hot, f.cold} {
+		tierFound, err := rmdir(ctx, tier, dir)
+		if err != nil {
+			return err
+		}
+		found = found || tierFound
+	}
+	if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	// New files are written to the hot remote so only files on
+	// it can be copied
+	srcObj, ok := src.(*Object)
+	do := f.hot.Features().Copy
+	if !ok || srcObj.cold || do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, err := do(ctx, srcObj.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.written(ctx, o, remote)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	// Files stay on the tier they are on
+	tier := f.tier(srcObj.cold)
+	var (
+		o   fs.Object
+		err error
+	)
+	if do := tier.Features().Move; do != nil {
+		o, err = do(ctx, srcObj.Object, remote)
+	} else if do := tier.Features().Copy; do != nil {
+		o, err = do(ctx, srcObj.Object, remote)
+		if err == nil {
+			err = srcObj.Object.Remove(ctx)
+		}
+	} else {
+		return nil, fs.ErrorCantMove
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.forget(src.Remote())
+	if srcObj.cold {
+		// Remove any file the moved one replaces on the hot remote
+		if old, err := f.hot.NewObject(ctx, remote); err == nil {
+			if err := old.Remove(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return f.newObject(o, true), nil
+	}
+	return f.written(ctx, o, remote)
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if f.stop != nil {
+		f.stopOnce.Do(func() {
+			close(f.stop)
+		})
+	}
+	var err error
+	if f.db != nil && !f.db.IsStopped() {
+		err = f.db.Stop(false)
+	}
+	for _, tier := range []fs.Fs{f.hot, f.cold} {
+		if do := tier.Features().Shutdown; do != nil {
+			if tierErr := do(ctx); tierErr != nil {
+				err = tierErr
+			}
+		}
+	}
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.Commander   = (*Fs)(nil)
+	_ fs.Shutdowner  = (*Fs)(nil)
+)
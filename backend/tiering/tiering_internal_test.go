@@ -0,0 +1,101 @@
+package tiering
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readObject(ctx context.Context, t *testing.T, o fs.Object) string {
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+// tierOf returns which tier remote is on
+func (f *Fs) tierOf(ctx context.Context, t *testing.T, remote string) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	if o.(*Object).cold {
+		return "cold"
+	}
+	return "hot"
+}
+
+// Check files are moved to the cold remote and back
+func (f *Fs) testMigrate(t *testing.T) {
+	ctx := context.Background()
+	const remote = "tiering/file.txt"
+	item := fstest.Item{Path: remote, ModTime: fstest.Time("2001-02-03T04:05:06Z")}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "hello", true)
+	assert.Equal(t, "hot", f.tierOf(ctx, t, remote))
+
+	// The file was just written so isn't moved despite its old
+	// modification time
+	out, err := f.Command(ctx, "migrate", []string{"tiering"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, out)
+
+	// Until it is old enough
+	time.Sleep(20 * time.Millisecond)
+	out, err = f.Command(ctx, "migrate", []string{"tiering"}, map[string]string{"age": "10ms"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{remote}, out)
+	assert.Equal(t, "cold", f.tierOf(ctx, t, remote))
+	_, err = f.hot.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// It is read from the cold remote
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readObject(ctx, t, o))
+	entries, err := f.List(ctx, "tiering")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, remote, entries[0].Remote())
+
+	// Writing it moves it back to the hot remote
+	src := object.NewStaticObjectInfo(remote, item.ModTime, 7, true, nil, nil)
+	require.NoError(t, o.Update(ctx, bytes.NewBufferString("goodbye"), src))
+	assert.Equal(t, "hot", f.tierOf(ctx, t, remote))
+	_, err = f.cold.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// Without a record of use the modification time is used
+	f.forget(remote)
+	out, err = f.Command(ctx, "migrate", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{remote}, out)
+	assert.Equal(t, "cold", f.tierOf(ctx, t, remote))
+
+	// A file on the hot remote hides one on the cold remote
+	_, err = f.hot.Put(ctx, bytes.NewBufferString("newer"), src)
+	require.NoError(t, err)
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, "newer", readObject(ctx, t, o))
+	require.NoError(t, o.Remove(ctx))
+	_, err = f.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	require.NoError(t, f.Rmdir(ctx, "tiering"))
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Migrate", f.testMigrate)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,70 @@
+// Test Tiering filesystem interface
+package tiering
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestTiering:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"ListR",
+		"ListP",
+		"DirMove",
+		"Purge",
+		"About",
+		"DirCacheFlush",
+		"UnWrap",
+		"WrapFs",
+		"SetWrapper",
+	},
+	UnimplementableObjectMethods: []string{
+		"GetTier",
+		"SetTier",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests tiering with hot and cold local directories
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestTieringLocal"
+	dir := t.TempDir()
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "tiering"},
+		{Name: name, Key: "hot", Value: filepath.Join(dir, "hot")},
+		{Name: name, Key: "cold", Value: filepath.Join(dir, "cold")},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
@@ -0,0 +1,181 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Case folding modes
+const (
+	caseUpper = "upper"
+	caseLower = "lower"
+)
+
+// Errors returned when decoding names
+var (
+	errMissingPrefix = errors.New("name doesn't start with prefix")
+	errMissingSuffix = errors.New("name doesn't end with suffix")
+	errNotReversible = errors.New("name doesn't encode back to itself")
+)
+
+// namer transforms the names of files and directories to and from
+// the names stored on the remote
+type namer struct {
+	prefix         string
+	suffix         string
+	caseMode       string
+	form           norm.Form
+	normalize      bool
+	encodeReplacer *strings.Replacer
+	decodeReplacer *strings.Replacer
+	regex          *regexp.Regexp
+	regexReplace   string
+	reverseRegex   *regexp.Regexp
+	reverseReplace string
+}
+
+// newNamer makes a namer from the options
+func newNamer(opt *Options) (*namer, error) {
+	n := &namer{
+		prefix:         opt.Prefix,
+		suffix:         opt.Suffix,
+		caseMode:       opt.Case,
+		regexReplace:   opt.RegexReplace,
+		reverseReplace: opt.ReverseRegexReplace,
+	}
+	if strings.Contains(n.prefix+n.suffix, "/") {
+		return nil, errors.New("prefix and suffix can't contain \"/\"")
+	}
+	switch n.caseMode {
+	case "", caseUpper, caseLower:
+	default:
+		return nil, fmt.Errorf("unknown case %q", n.caseMode)
+	}
+	switch strings.ToUpper(opt.UnicodeNormalization) {
+	case "":
+	case "NFC":
+		n.form, n.normalize = norm.NFC, true
+	case "NFD":
+		n.form, n.normalize = norm.NFD, true
+	default:
+		return nil, fmt.Errorf("unknown unicode_normalization %q", opt.UnicodeNormalization)
+	}
+	if len(opt.Replace) > 0 {
+		var encodePairs, decodePairs []string
+		for _, pair := range opt.Replace {
+			from, to, ok := strings.Cut(pair, "=")
+			if !ok || from == "" || to == "" {
+				return nil, fmt.Errorf("replace %q should be in the form old=new", pair)
+			}
+			if strings.Contains(to, "/") {
+				return nil, fmt.Errorf("replace %q can't replace with \"/\"", pair)
+			}
+			encodePairs = append(encodePairs, from, to)
+			decodePairs = append(decodePairs, to, from)
+		}
+		n.encodeReplacer = strings.NewReplacer(encodePairs...)
+		n.decodeReplacer = strings.NewReplacer(decodePairs...)
+	}
+	var err error
+	if opt.Regex != "" {
+		n.regex, err = regexp.Compile(opt.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex: %w", err)
+		}
+	}
+	if opt.ReverseRegex != "" {
+		n.reverseRegex, err = regexp.Compile(opt.ReverseRegex)
+		if err != nil {
+			return nil, fmt.Errorf("bad reverse_regex: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// encodeName transforms a single file or directory name into the
+// name stored on the remote
+func (n *namer) encodeName(name string) string {
+	if n.encodeReplacer != nil {
+		name = n.encodeReplacer.Replace(name)
+	}
+	if n.regex != nil {
+		name = n.regex.ReplaceAllString(name, n.regexReplace)
+	}
+	switch n.caseMode {
+	case caseUpper:
+		name = strings.ToUpper(name)
+	case caseLower:
+		name = strings.ToLower(name)
+	}
+	if n.normalize {
+		name = n.form.String(name)
+	}
+	return n.prefix + name + n.suffix
+}
+
+// decodeName transforms a single name stored on the remote back
+// into the file or directory name
+//
+// It returns an error if the name couldn't have been made by
+// encodeName, as the file or directory it names couldn't be read or
+// written.
+func (n *namer) decodeName(encoded string) (string, error) {
+	name, ok := strings.CutPrefix(encoded, n.prefix)
+	if !ok {
+		return "", errMissingPrefix
+	}
+	name, ok = strings.CutSuffix(name, n.suffix)
+	if !ok {
+		return "", errMissingSuffix
+	}
+	// Case folding and normalization can't be undone so leave the
+	// name as it is
+	if n.reverseRegex != nil {
+		name = n.reverseRegex.ReplaceAllString(name, n.reverseReplace)
+	}
+	if n.decodeReplacer != nil {
+		name = n.decodeReplacer.Replace(name)
+	}
+	if name == "" || n.encodeName(name) != encoded {
+		return "", errNotReversible
+	}
+	return name, nil
+}
+
+// encodePath transforms each name in the path p
+func (n *namer) encodePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	names := strings.Split(p, "/")
+	for i, name := range names {
+		if name != "" {
+			names[i] = n.encodeName(name)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// decodePath transforms each name in the path p stored on the remote
+// back
+func (n *namer) decodePath(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	names := strings.Split(p, "/")
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		decoded, err := n.decodeName(name)
+		if err != nil {
+			return "", fmt.Errorf("can't decode %q: %w", name, err)
+		}
+		names[i] = decoded
+	}
+	return strings.Join(names, "/"), nil
+}
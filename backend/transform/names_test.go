@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamer(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opt     Options
+		in      string
+		encoded string
+	}{
+		{"none", Options{}, "dir/file.txt", "dir/file.txt"},
+		{"prefix", Options{Prefix: "p_"}, "dir/file.txt", "p_dir/p_file.txt"},
+		{"suffix", Options{Suffix: ".bin"}, "dir/file.txt", "dir.bin/file.txt.bin"},
+		{"upper", Options{Case: caseUpper}, "Dir/file.txt", "DIR/FILE.TXT"},
+		{"lower", Options{Case: caseLower}, "Dir/FILE.txt", "dir/file.txt"},
+		{"nfc", Options{UnicodeNormalization: "NFC"}, "e\u0301/a", "\u00e9/a"},
+		{"nfd", Options{UnicodeNormalization: "nfd"}, "\u00e9/a", "e\u0301/a"},
+		{"replace", Options{Replace: fs.CommaSepList{":=：", "?=？"}}, "a:b/c?", "a：b/c？"},
+		{"regex", Options{
+			Regex:               `^(\d{4})-(\d{2})-(\d{2})`,
+			RegexReplace:        "$3.$2.$1",
+			ReverseRegex:        `^(\d{2})\.(\d{2})\.(\d{4})`,
+			ReverseRegexReplace: "$3-$2-$1",
+		}, "2001-02-03 notes/2024-12-25.txt", "03.02.2001 notes/25.12.2024.txt"},
+		{"all", Options{Prefix: "x", Suffix: "y", Case: caseLower, Replace: fs.CommaSepList{" =_"}}, "A B/c", "xa_by/xcy"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := newNamer(&test.opt)
+			require.NoError(t, err)
+			assert.Equal(t, test.encoded, n.encodePath(test.in))
+			decoded, err := n.decodePath(test.encoded)
+			require.NoError(t, err)
+			if test.opt.Case == "" && test.opt.UnicodeNormalization == "" {
+				assert.Equal(t, test.in, decoded)
+			} else {
+				assert.Equal(t, test.encoded, n.encodePath(decoded))
+			}
+		})
+	}
+}
+
+func TestNamerDecodeErrors(t *testing.T) {
+	n, err := newNamer(&Options{Prefix: "p_", Suffix: "_s", Case: caseLower})
+	require.NoError(t, err)
+	for _, test := range []struct {
+		in   string
+		want error
+	}{
+		{"file_s", errMissingPrefix},
+		{"p_file", errMissingSuffix},
+		{"p_FILE_s", errNotReversible},
+		{"p__s", errNotReversible},
+	} {
+		_, err := n.decodeName(test.in)
+		assert.ErrorIs(t, err, test.want, test.in)
+	}
+	_, err = n.decodePath("p_dir_s/file")
+	assert.ErrorIs(t, err, errMissingPrefix)
+}
+
+func TestNamerBadOptions(t *testing.T) {
+	for _, opt := range []Options{
+		{Prefix: "a/"},
+		{Case: "title"},
+		{UnicodeNormalization: "NFKC"},
+		{Replace: fs.CommaSepList{"ab"}},
+		{Replace: fs.CommaSepList{"a=/"}},
+		{Regex: "("},
+		{ReverseRegex: "["},
+	} {
+		_, err := newNamer(&opt)
+		assert.Error(t, err, opt)
+	}
+}
@@ -0,0 +1,549 @@
+// Package transform implements a backend which stores files on
+// another remote under transformed names
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "transform",
+		Description: "Transform the names of files on a remote",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to store the files on.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "prefix",
+			Help: `Text to add to the start of each name.`,
+		}, {
+			Name: "suffix",
+			Help: `Text to add to the end of each name.`,
+		}, {
+			Name: "case",
+			Help: `Change the case of each name.
+
+Names read from the remote are shown as they are, so the remote
+appears to be case insensitive.`,
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "Don't change the case.",
+			}, {
+				Value: caseUpper,
+				Help:  "Change names to upper case.",
+			}, {
+				Value: caseLower,
+				Help:  "Change names to lower case.",
+			}},
+		}, {
+			Name: "unicode_normalization",
+			Help: `Convert each name to this Unicode normalization form.`,
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "Don't change the normalization.",
+			}, {
+				Value: "NFC",
+				Help:  "Composed form as used by most systems.",
+			}, {
+				Value: "NFD",
+				Help:  "Decomposed form as used by macOS.",
+			}},
+		}, {
+			Name: "replace",
+			Help: `Comma separated list of old=new strings to replace in each name.
+
+For example "\=＼,:=：" replaces "\" and ":" with full width versions
+of themselves. Names are changed back when read from the remote, so
+the new strings shouldn't appear in the names of the files.`,
+			Default: fs.CommaSepList{},
+		}, {
+			Name: "regex",
+			Help: `Regular expression to replace in each name.
+
+Each match is replaced with regex_replace. Set reverse_regex and
+reverse_regex_replace to change the names back when read from the
+remote.`,
+			Advanced: true,
+		}, {
+			Name:     "regex_replace",
+			Help:     `Text to replace matches of regex with, which may use $1 etc.`,
+			Advanced: true,
+		}, {
+			Name:     "reverse_regex",
+			Help:     `Regular expression to replace in each name read from the remote.`,
+			Advanced: true,
+		}, {
+			Name:     "reverse_regex_replace",
+			Help:     `Text to replace matches of reverse_regex with, which may use $1 etc.`,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote               string          `config:"remote"`
+	Prefix               string          `config:"prefix"`
+	Suffix               string          `config:"suffix"`
+	Case                 string          `config:"case"`
+	UnicodeNormalization string          `config:"unicode_normalization"`
+	Replace              fs.CommaSepList `config:"replace"`
+	Regex                string          `config:"regex"`
+	RegexReplace         string          `config:"regex_replace"`
+	ReverseRegex         string          `config:"reverse_regex"`
+	ReverseRegexReplace  string          `config:"reverse_regex_replace"`
+}
+
+// Fs represents a remote with transformed names
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on
+	opt      Options      // parsed options
+	base     fs.Fs        // the remote being wrapped
+	namer    *namer       // transforms the names
+	features *fs.Features // optional features
+	wrapper  fs.Fs        // the Fs wrapping this one, if any
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point transform remote at itself - check the value of the remote setting")
+	}
+	n, err := newNamer(opt)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure to remove trailing . referring to the current dir
+	if path.Base(rpath) == "." {
+		rpath = strings.TrimSuffix(rpath, ".")
+	}
+
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, n.encodePath(rpath)))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name:  name,
+		root:  rpath,
+		opt:   *opt,
+		base:  base,
+		namer: n,
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:          opt.Case != "",
+		DuplicateFiles:           true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		CanHaveEmptyDirectories:  true,
+		BucketBased:              true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+		SlowModTime:              true,
+		SlowHash:                 true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	// Mask only keeps CaseInsensitive if base has it
+	f.features.CaseInsensitive = opt.Case != "" || base.Features().CaseInsensitive
+	cache.PinUntilFinalized(base, f)
+
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(strings.Trim(rpath, "/"))
+		if f.root == "." {
+			f.root = ""
+		}
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("transform root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// wrapEntries decodes the names of baseEntries, skipping any which
+// can't be decoded
+func (f *Fs) wrapEntries(baseEntries fs.DirEntries) (fs.DirEntries, error) {
+	entries := make(fs.DirEntries, 0, len(baseEntries))
+	for _, entry := range baseEntries {
+		remote, err := f.namer.decodePath(entry.Remote())
+		if err != nil {
+			fs.Debugf(entry, "Skipping: %v", err)
+			continue
+		}
+		switch x := entry.(type) {
+		case fs.Object:
+			entries = append(entries, f.newObject(remote, x))
+		case fs.Directory:
+			entries = append(entries, fs.NewDirWrapper(remote, x))
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	baseEntries, err := f.base.List(ctx, f.namer.encodePath(dir))
+	if err != nil {
+		return nil, err
+	}
+	return f.wrapEntries(baseEntries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	return f.base.Features().ListR(ctx, f.namer.encodePath(dir), func(baseEntries fs.DirEntries) error {
+		entries, err := f.wrapEntries(baseEntries)
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	})
+}
+
+// NewObject finds the Object at remote. If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.base.NewObject(ctx, f.namer.encodePath(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(remote, o), nil
+}
+
+// wrap wraps the object returned by a put or copy which was made at
+// remote
+func (f *Fs) wrap(remote string, o fs.Object, err error) (fs.Object, error) {
+	if o != nil {
+		o = f.newObject(remote, o)
+	}
+	return o, err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	remote := src.Remote()
+	o, err := f.base.Put(ctx, in, fs.NewOverrideRemote(src, f.namer.encodePath(remote)), options...)
+	return f.wrap(remote, o, err)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	remote := src.Remote()
+	o, err := f.base.Features().PutStream(ctx, in, fs.NewOverrideRemote(src, f.namer.encodePath(remote)), options...)
+	return f.wrap(remote, o, err)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.base.Mkdir(ctx, f.namer.encodePath(dir))
+}
+
+// MkdirMetadata makes the directory passed in as dir.
+//
+// It shouldn't return an error if it already exists.
+//
+// If the metadata is not nil it is set.
+//
+// It returns the directory that was created.
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	newDir, err := f.base.Features().MkdirMetadata(ctx, f.namer.encodePath(dir), metadata)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewDirWrapper(dir, newDir), nil
+}
+
+// DirSetModTime sets the directory modtime for dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	return f.base.Features().DirSetModTime(ctx, f.namer.encodePath(dir), modTime)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.base.Rmdir(ctx, f.namer.encodePath(dir))
+}
+
+// Purge all files in the directory specified
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	return f.base.Features().Purge(ctx, f.namer.encodePath(dir))
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	o, err := f.base.Features().Copy(ctx, srcObj.Object, f.namer.encodePath(remote))
+	return f.wrap(remote, o, err)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	o, err := f.base.Features().Move(ctx, srcObj.Object, f.namer.encodePath(remote))
+	return f.wrap(remote, o, err)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		return fs.ErrorCantDirMove
+	}
+	return f.base.Features().DirMove(ctx, srcFs.base, srcFs.namer.encodePath(srcRemote), f.namer.encodePath(dstRemote))
+}
+
+// PublicLink generates a public link to the remote path (usually readable by anyone)
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+	return f.base.Features().PublicLink(ctx, f.namer.encodePath(remote), expire, unlink)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	return f.base.Features().About(ctx)
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	return f.base.Features().CleanUp(ctx)
+}
+
+// ChangeNotify calls the passed function with a path
+// that has had changes. If the implementation
+// uses polling, it should adhere to the given interval.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	f.base.Features().ChangeNotify(ctx, func(remote string, entryType fs.EntryType) {
+		decoded, err := f.namer.decodePath(remote)
+		if err != nil {
+			fs.Debugf(f, "ChangeNotify: ignoring %q: %v", remote, err)
+			return
+		}
+		notifyFunc(decoded, entryType)
+	}, pollIntervalChan)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.base.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if do := f.base.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+var commandHelp = []fs.CommandHelp{
+	{
+		Name:  "encode",
+		Short: "Encode the given path(s)",
+		Long: `This transforms the paths given as arguments into the paths stored
+on the remote, returning a list of the results.
+
+Usage Example:
+
+    rclone backend encode transform: path1 [path2...]
+    rclone rc backend/command command=encode fs=transform: path1 [path2...]
+`,
+	},
+	{
+		Name:  "decode",
+		Short: "Decode the given path(s)",
+		Long: `This transforms the paths stored on the remote given as arguments
+back, returning a list of the results. It will return an error if any
+of the inputs couldn't have been made by encode.
+
+Usage Example:
+
+    rclone backend decode transform: encodedpath1 [encodedpath2...]
+    rclone rc backend/command command=decode fs=transform: encodedpath1 [encodedpath2...]
+`,
+	},
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "encode":
+		out := make([]string, 0, len(arg))
+		for _, remote := range arg {
+			out = append(out, f.namer.encodePath(remote))
+		}
+		return out, nil
+	case "decode":
+		out := make([]string, 0, len(arg))
+		for _, encoded := range arg {
+			remote, err := f.namer.decodePath(encoded)
+			if err != nil {
+				return out, err
+			}
+			out = append(out, remote)
+		}
+		return out, nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.PublicLinker    = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.ChangeNotifier  = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
@@ -0,0 +1,57 @@
+// Test Transform filesystem interface
+package transform
+
+import (
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestTransform:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ListP",
+	},
+	UnimplementableObjectMethods: []string{
+		"GetTier",
+		"SetTier",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests transform wrapping the local filesystem
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestTransformLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "transform"},
+		{Name: name, Key: "remote", Value: t.TempDir()},
+		{Name: name, Key: "prefix", Value: "pre-"},
+		{Name: name, Key: "suffix", Value: "-suf"},
+		{Name: name, Key: "replace", Value: "?=？"},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
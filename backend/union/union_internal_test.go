@@ -96,7 +96,7 @@ func TestMoveCopy(t *testing.T) {
 	fLocal := unionFs.upstreams[0].Fs
 	fMemory := unionFs.upstreams[1].Fs
 
-	if runtime.GOOS == "darwin" {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
 		// need to disable as this test specifically tests a local that can't Copy
 		f.Features().Disable("Copy")
 		fLocal.Features().Disable("Copy")
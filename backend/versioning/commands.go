@@ -0,0 +1,308 @@
+package versioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "versions":
+		return f.versions(ctx, arg)
+	case "restore":
+		at, ok := opt["at"]
+		if !ok {
+			return nil, errors.New("please provide the time to restore to with -o at=TIME")
+		}
+		t, err := fs.ParseTime(at)
+		if err != nil {
+			return nil, fmt.Errorf("bad time for at: %w", err)
+		}
+		return f.restore(ctx, arg, t)
+	case "prune":
+		return nil, f.prune(ctx, arg, opt)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "versions",
+	Short: "List the old versions of files",
+	Long: `This lists the old versions of the files under the paths given, or
+all the files if no paths are given, as JSON.
+
+Usage Example:
+
+    rclone backend versions versioning:
+    rclone backend versions versioning: path/to/file.txt path/to/dir
+
+Each version is shown with the time it was replaced and the name it
+has in listings with --versioning-versions.
+`,
+}, {
+	Name:  "restore",
+	Short: "Restore files to how they were at a time",
+	Long: `This restores the files under the paths given, or all the files if no
+paths are given, to the versions they had at the time given.
+
+Usage Example:
+
+    rclone backend restore versioning: -o at=2024-01-02
+    rclone backend restore versioning: path/to/file.txt -o at=3h
+
+The time is given in the same way as --versioning-version-at. The
+current version of each file restored is kept as an old version so a
+restore can be undone. Files which didn't exist at the time aren't
+touched and files which have been deleted since are restored.
+
+It prints the paths of the files restored. Use --dry-run to see what
+would be restored.
+`,
+	Opts: map[string]string{
+		"at": "Time to restore the files to - required",
+	},
+}, {
+	Name:  "prune",
+	Short: "Delete old versions",
+	Long: `This permanently deletes old versions of the files under the paths
+given, or all the files if no paths are given.
+
+Usage Example:
+
+    rclone backend prune versioning: -o older-than=30d
+    rclone backend prune versioning: path/to/dir -o keep=3
+
+At least one of the options must be given. If both are given then
+versions are deleted if either says so. Directories in the version
+directory left empty are removed. Use --dry-run to see what would be
+deleted.
+`,
+	Opts: map[string]string{
+		"older-than": "Delete versions replaced longer ago than this, e.g. 30d",
+		"keep":       "Number of versions of each file to keep",
+	},
+}}
+
+// versionInfo describes an old version of a file
+type versionInfo struct {
+	Path     string    // path of the file
+	Name     string    // path of the version shown with --versioning-versions
+	Replaced time.Time // when the version was replaced
+	Size     int64
+	ModTime  time.Time
+}
+
+// forEachVersion calls fn for each old version of the files under
+// root, or of the file root
+func (f *Fs) forEachVersion(ctx context.Context, root string, fn func(remote string, v oldVersion) error) error {
+	if root != "" {
+		versions, _, err := f.listVersions(ctx, parentDir(root))
+		if err != nil {
+			return err
+		}
+		if vs, found := versions[root]; found {
+			for _, v := range vs {
+				if err := fn(root, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	err := walk.ListR(ctx, f.vbase, root, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			t, remote := removeVersion(o.Remote())
+			if t.IsZero() {
+				continue
+			}
+			if err := fn(remote, oldVersion{t: t, o: o}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	}
+	return err
+}
+
+// roots returns the paths given to a command or the root
+func roots(arg []string) []string {
+	if len(arg) == 0 {
+		return []string{""}
+	}
+	return arg
+}
+
+// versions lists the old versions of the files under the paths in arg
+func (f *Fs) versions(ctx context.Context, arg []string) (out []versionInfo, err error) {
+	out = []versionInfo{}
+	for _, root := range roots(arg) {
+		err = f.forEachVersion(ctx, root, func(remote string, v oldVersion) error {
+			out = append(out, versionInfo{
+				Path:     remote,
+				Name:     v.o.Remote(),
+				Replaced: v.t,
+				Size:     v.o.Size(),
+				ModTime:  v.o.ModTime(ctx),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Replaced.Before(out[j].Replaced)
+	})
+	return out, nil
+}
+
+// walkAt calls fn for each file under dir as it was at time t
+func (f *Fs) walkAt(ctx context.Context, dir string, t time.Time, fn func(o *Object) error) error {
+	entries, err := f.listAt(ctx, dir, t)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case *Object:
+			err = fn(x)
+		case fs.Directory:
+			err = f.walkAt(ctx, x.Remote(), t, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore restores the files under the paths in arg to the versions
+// they had at time t
+func (f *Fs) restore(ctx context.Context, arg []string, t time.Time) (restored []string, err error) {
+	restored = []string{}
+	restoreFile := func(o *Object) error {
+		if !o.version {
+			return nil
+		}
+		if operations.SkipDestructive(ctx, o, "restore") {
+			return nil
+		}
+		_, err := f.replace(ctx, nil, o.remote, func(fdst fs.Fs, remote string) (fs.Object, error) {
+			return operations.Copy(ctx, fdst, nil, remote, o.Object)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore %q: %w", o.remote, err)
+		}
+		restored = append(restored, o.remote)
+		return nil
+	}
+	for _, root := range roots(arg) {
+		if err := f.checkWritable(root); err != nil {
+			return nil, err
+		}
+		if root != "" {
+			o, err := f.objectAt(ctx, root, t)
+			if err == nil {
+				if err := restoreFile(o.(*Object)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if !errors.Is(err, fs.ErrorObjectNotFound) && !errors.Is(err, fs.ErrorIsDir) {
+				return nil, err
+			}
+		}
+		if err := f.walkAt(ctx, root, t, restoreFile); err != nil {
+			return nil, err
+		}
+	}
+	return restored, nil
+}
+
+// prune deletes the old versions of the files under the paths in arg
+// as set by the options in opt
+func (f *Fs) prune(ctx context.Context, arg []string, opt map[string]string) error {
+	var (
+		cutoff time.Time
+		keep   = -1
+	)
+	if s, ok := opt["older-than"]; ok {
+		age, err := fs.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("bad duration for older-than: %w", err)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+	if s, ok := opt["keep"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad number for keep: %q", s)
+		}
+		keep = n
+	}
+	if cutoff.IsZero() && keep < 0 {
+		return errors.New("please provide -o older-than=DURATION and/or -o keep=N")
+	}
+	for _, root := range roots(arg) {
+		if err := f.checkWritable(root); err != nil {
+			return err
+		}
+		versions := make(map[string][]oldVersion)
+		err := f.forEachVersion(ctx, root, func(remote string, v oldVersion) error {
+			versions[remote] = append(versions[remote], v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		deleted := 0
+		for _, vs := range versions {
+			sort.Slice(vs, func(i, j int) bool {
+				return vs[i].t.Before(vs[j].t)
+			})
+			for i, v := range vs {
+				if v.t.Before(cutoff) || (keep >= 0 && i < len(vs)-keep) {
+					if err := operations.DeleteFile(ctx, v.o); err != nil {
+						return err
+					}
+					deleted++
+				}
+			}
+		}
+		fs.Infof(f, "Deleted %d old versions under %q", deleted, root)
+		if deleted > 0 {
+			if err := operations.Rmdirs(ctx, f.vbase, parentDir(root), true); err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
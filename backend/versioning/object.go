@@ -0,0 +1,145 @@
+package versioning
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Object is a file on the base or an old version of one
+type Object struct {
+	fs.Object
+	f       *Fs
+	remote  string
+	version bool // set if this is an old version in the version directory
+}
+
+// newObject wraps o which is at remote in f
+func (f *Fs) newObject(o fs.Object, remote string) *Object {
+	return &Object{Object: o, f: f, remote: remote}
+}
+
+// newVersion wraps the old version o which is shown at remote in f
+func (f *Fs) newVersion(o fs.Object, remote string) *Object {
+	return &Object{Object: o, f: f, remote: remote, version: true}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// checkWritable returns an error if the object can't be changed
+func (o *Object) checkWritable() error {
+	if o.f.opt.VersionAt.IsSet() {
+		return errNotWithVersionAt
+	}
+	if o.version {
+		return errOldVersion
+	}
+	return nil
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if err := o.checkWritable(); err != nil {
+		return err
+	}
+	return o.Object.SetModTime(ctx, modTime)
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// The current contents are kept as an old version once the upload
+// has succeeded.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	if err := o.checkWritable(); err != nil {
+		return err
+	}
+	newObj, err := o.f.replace(ctx, o.Object, o.Object.Remote(), func(fdst fs.Fs, remote string) (fs.Object, error) {
+		return fdst.Put(ctx, in, fs.NewOverrideRemote(src, remote), options...)
+	})
+	if newObj == nil {
+		return err
+	}
+	o.Object = newObj
+	return err
+}
+
+// Remove an object
+//
+// The object is kept as an old version. Removing an old version
+// deletes it permanently.
+func (o *Object) Remove(ctx context.Context) error {
+	if o.f.opt.VersionAt.IsSet() {
+		return errNotWithVersionAt
+	}
+	if o.version {
+		return o.Object.Remove(ctx)
+	}
+	_, err := o.f.keep(ctx, o.Object)
+	return err
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	if err := o.checkWritable(); err != nil {
+		return err
+	}
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,751 @@
+// Package versioning implements a backend which keeps old versions
+// of files on remotes which don't support versions natively
+package versioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/version"
+)
+
+// Globals
+var (
+	errNotWithVersionAt = errors.New("can't modify or delete files in --versioning-version-at mode")
+	errOldVersion       = errors.New("can't modify an old version - restore it instead")
+	errVersionDir       = errors.New("can't use the version directory through the versioning remote")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "versioning",
+		Description: "Keep old versions of files on any remote",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.
+Old versions keep the metadata they had.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to keep versions on.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "version_dir",
+			Help: `Name of the directory old versions are kept in.
+
+This is made at the root of the remote being wrapped and is hidden
+from listings. On bucket based remotes, if the remote being wrapped
+doesn't include a bucket, it is made at the root of each bucket.`,
+			Default:  ".versions",
+			Advanced: true,
+		}, {
+			Name:     "versions",
+			Help:     "Include old versions in directory listings.",
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "version_at",
+			Help: `Show file versions as they were at the specified time.
+
+The parameter should be a date, "2006-01-02", datetime "2006-01-02
+15:04:05" or a duration for that long ago, eg "100d" or "1h".
+
+Note that when using this no file write operations are permitted,
+so you can't upload files or delete them.
+
+See [the time option docs](/docs/#time-option) for valid formats.
+`,
+			Default:  fs.Time{},
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote     string  `config:"remote"`
+	VersionDir string  `config:"version_dir"`
+	Versions   bool    `config:"versions"`
+	VersionAt  fs.Time `config:"version_at"`
+}
+
+// Fs represents a remote which keeps old versions of its files
+type Fs struct {
+	name       string       // name of this remote
+	root       string       // the path we are working on
+	opt        Options      // parsed options
+	versionDir string       // path of the version directory relative to the remote being wrapped
+	base       fs.Fs        // the remote being wrapped
+	vbase      fs.Fs        // the same path as base in the version directory
+	features   *fs.Features // optional features
+	wrapper    fs.Fs        // the Fs wrapping this one, if any
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point versioning remote at itself - check the value of the remote setting")
+	}
+	if opt.Versions && opt.VersionAt.IsSet() {
+		return nil, errors.New("can't use --versioning-versions and --versioning-version-at at the same time")
+	}
+	opt.VersionDir = strings.Trim(opt.VersionDir, "/")
+	if opt.VersionDir == "" || strings.Contains(opt.VersionDir, "/") {
+		return nil, fmt.Errorf("invalid version_dir %q - it must be a single directory name", opt.VersionDir)
+	}
+	root := strings.Trim(rpath, "/")
+
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, root))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	isFile := err == fs.ErrorIsFile
+	if isFile {
+		root = parentDir(root)
+	}
+	features := base.Features()
+	if features.Move == nil && features.Copy == nil {
+		return nil, fmt.Errorf("can't keep versions on %v as it doesn't support server-side move or copy", base)
+	}
+	bucket, versionDir, err := findVersionDir(opt, features.BucketBased, root)
+	if err != nil {
+		return nil, err
+	}
+	if root == versionDir || strings.HasPrefix(root, versionDir+"/") {
+		return nil, errVersionDir
+	}
+	vroot := path.Join(versionDir, strings.TrimPrefix(root, bucket))
+	vbase, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, vroot))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote for the version directory: %w", err)
+	}
+	f := &Fs{
+		name:       name,
+		root:       rpath,
+		opt:        *opt,
+		versionDir: versionDir,
+		base:       base,
+		vbase:      vbase,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		ReadMetadata:            true,
+		WriteMetadata:           true,
+		UserMetadata:            true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	cache.Pin(base)
+	cache.Pin(vbase)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.base)
+		cache.Unpin(f.vbase)
+	})
+
+	if isFile {
+		f.root = parentDir(rpath)
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// findVersionDir returns the path of the version directory relative
+// to the remote being wrapped for root.
+//
+// This is normally at the root of the remote being wrapped. On bucket
+// based remotes where the remote being wrapped doesn't include a
+// bucket it is at the root of the bucket in root instead, as the
+// version directory can't be a bucket. The bucket is returned too in
+// this case.
+func findVersionDir(opt *Options, bucketBased bool, root string) (bucket, versionDir string, err error) {
+	_, remotePath, err := fspath.SplitFs(opt.Remote)
+	if err != nil {
+		return "", "", err
+	}
+	if !bucketBased || strings.Trim(remotePath, "/") != "" {
+		return "", opt.VersionDir, nil
+	}
+	bucket, _, _ = strings.Cut(root, "/")
+	if bucket == "" {
+		return "", "", errors.New("can't keep versions at the root of a bucket based remote - include the bucket in the path")
+	}
+	return bucket, path.Join(bucket, opt.VersionDir), nil
+}
+
+// parentDir returns the parent directory of remote or "" if it has
+// none
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." {
+		parent = ""
+	}
+	return parent
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("versioning root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// isVersionDir returns true if dir is the version directory
+func (f *Fs) isVersionDir(dir string) bool {
+	return path.Join(strings.Trim(f.root, "/"), dir) == f.versionDir
+}
+
+// inVersionDir returns true if remote is inside the version directory
+func (f *Fs) inVersionDir(remote string) bool {
+	full := path.Join(strings.Trim(f.root, "/"), remote)
+	return full == f.versionDir || strings.HasPrefix(full, f.versionDir+"/")
+}
+
+// addVersion returns remote with the version t added to its leaf name
+func addVersion(remote string, t time.Time) string {
+	return path.Join(parentDir(remote), version.Add(path.Base(remote), t))
+}
+
+// removeVersion returns remote without the version in its leaf name
+// and the time of the version, or a zero time if it doesn't have one
+func removeVersion(remote string) (t time.Time, remoteWithoutVersion string) {
+	t, leaf := version.Remove(path.Base(remote))
+	return t, path.Join(parentDir(remote), leaf)
+}
+
+// oldVersion is a version of a file which has been replaced
+type oldVersion struct {
+	t time.Time // when the version was replaced
+	o fs.Object // the version in vbase
+}
+
+// listVersions lists dir in the version directory returning the old
+// versions of each file by name, oldest first, and the directories
+//
+// It doesn't return an error if the directory doesn't exist.
+func (f *Fs) listVersions(ctx context.Context, dir string) (versions map[string][]oldVersion, dirs []fs.Directory, err error) {
+	entries, err := f.vbase.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	versions = make(map[string][]oldVersion)
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			t, remote := removeVersion(x.Remote())
+			if t.IsZero() {
+				fs.Debugf(x, "Ignoring file without a version in the version directory")
+				continue
+			}
+			versions[remote] = append(versions[remote], oldVersion{t: t, o: x})
+		case fs.Directory:
+			dirs = append(dirs, x)
+		}
+	}
+	for _, vs := range versions {
+		sort.Slice(vs, func(i, j int) bool {
+			return vs[i].t.Before(vs[j].t)
+		})
+	}
+	return versions, dirs, nil
+}
+
+// versionAt returns the old version of a file which was current at
+// t or nil if the file is current
+func versionAt(vs []oldVersion, t time.Time) *oldVersion {
+	for i := range vs {
+		if vs[i].t.After(t) {
+			return &vs[i]
+		}
+	}
+	return nil
+}
+
+// listAt lists dir as it was at time t
+//
+// Files which have changed since t are shown with the version which
+// was current then, and files deleted before t are left out.
+func (f *Fs) listAt(ctx context.Context, dir string, t time.Time) (entries fs.DirEntries, err error) {
+	versions, vdirs, err := f.listVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	baseEntries, err := f.base.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) && versions != nil {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(baseEntries))
+	for _, entry := range baseEntries {
+		remote := entry.Remote()
+		seen[remote] = struct{}{}
+		switch x := entry.(type) {
+		case fs.Object:
+			if v := versionAt(versions[remote], t); v != nil {
+				entries = append(entries, f.newVersion(v.o, remote))
+			} else {
+				entries = append(entries, f.newObject(x, remote))
+			}
+		case fs.Directory:
+			if !f.isVersionDir(remote) {
+				entries = append(entries, x)
+			}
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	for remote, vs := range versions {
+		if _, found := seen[remote]; found {
+			continue
+		}
+		// The file has been deleted so show it if it was deleted
+		// after t
+		if v := versionAt(vs, t); v != nil {
+			entries = append(entries, f.newVersion(v.o, remote))
+		}
+	}
+	for _, d := range vdirs {
+		if _, found := seen[d.Remote()]; !found {
+			entries = append(entries, d)
+		}
+	}
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if f.inVersionDir(dir) {
+		return nil, fs.ErrorDirNotFound
+	}
+	if f.opt.VersionAt.IsSet() {
+		return f.listAt(ctx, dir, time.Time(f.opt.VersionAt))
+	}
+	baseEntries, err := f.base.List(ctx, dir)
+	notFound := errors.Is(err, fs.ErrorDirNotFound)
+	if err != nil && !(f.opt.Versions && notFound) {
+		return nil, err
+	}
+	entries = make(fs.DirEntries, 0, len(baseEntries))
+	seen := make(map[string]struct{})
+	for _, entry := range baseEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			entries = append(entries, f.newObject(x, x.Remote()))
+		case fs.Directory:
+			if f.isVersionDir(x.Remote()) {
+				continue
+			}
+			seen[x.Remote()] = struct{}{}
+			entries = append(entries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	if !f.opt.Versions {
+		return entries, nil
+	}
+	// Add the old versions with their version in their names
+	versions, vdirs, err := f.listVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if notFound && versions == nil {
+		return nil, fs.ErrorDirNotFound
+	}
+	for _, vs := range versions {
+		for _, v := range vs {
+			entries = append(entries, f.newVersion(v.o, v.o.Remote()))
+		}
+	}
+	for _, d := range vdirs {
+		if _, found := seen[d.Remote()]; !found {
+			entries = append(entries, d)
+		}
+	}
+	return entries, nil
+}
+
+// objectAt returns the version of the file at remote which was
+// current at time t
+func (f *Fs) objectAt(ctx context.Context, remote string, t time.Time) (fs.Object, error) {
+	versions, _, err := f.listVersions(ctx, parentDir(remote))
+	if err != nil {
+		return nil, err
+	}
+	if v := versionAt(versions[remote], t); v != nil {
+		return f.newVersion(v.o, remote), nil
+	}
+	o, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.inVersionDir(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if f.opt.VersionAt.IsSet() {
+		return f.objectAt(ctx, remote, time.Time(f.opt.VersionAt))
+	}
+	o, err := f.base.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) && f.opt.Versions && version.Match(path.Base(remote)) {
+		o, err = f.vbase.NewObject(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+		return f.newVersion(o, remote), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// checkWritable returns an error if remote can't be written to
+func (f *Fs) checkWritable(remote string) error {
+	if f.opt.VersionAt.IsSet() {
+		return errNotWithVersionAt
+	}
+	if f.inVersionDir(remote) {
+		return errVersionDir
+	}
+	return nil
+}
+
+// move moves o to remote in fdst with a server-side move, or a
+// server-side copy and delete if the move isn't possible
+func move(ctx context.Context, fdst fs.Fs, o fs.Object, remote string) (fs.Object, error) {
+	if do := fdst.Features().Move; do != nil {
+		newObj, err := do(ctx, o, remote)
+		if !errors.Is(err, fs.ErrorCantMove) {
+			return newObj, err
+		}
+	}
+	do := fdst.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	newObj, err := do(ctx, o, remote)
+	if err != nil {
+		return nil, err
+	}
+	return newObj, o.Remove(ctx)
+}
+
+// keep moves the current version o of a file into the version
+// directory returning the old version
+func (f *Fs) keep(ctx context.Context, o fs.Object) (fs.Object, error) {
+	vremote := addVersion(o.Remote(), time.Now().UTC())
+	v, err := move(ctx, f.vbase, o, vremote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to keep old version of %q: %w", o.Remote(), err)
+	}
+	fs.Debugf(o, "Kept old version as %q", vremote)
+	return v, nil
+}
+
+// findExisting returns the current version of remote or nil if it
+// doesn't exist
+func (f *Fs) findExisting(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.base.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) || errors.Is(err, fs.ErrorNotAFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// unkeep puts the old version v back to remote after a failed upload
+func (f *Fs) unkeep(ctx context.Context, v fs.Object, remote string) {
+	if v == nil {
+		return
+	}
+	if _, err := move(ctx, f.base, v, remote); err != nil {
+		fs.Errorf(remote, "Failed to put back old version %q: %v", v.Remote(), err)
+	}
+}
+
+// keepCopy copies the current version o of a file into the version
+// directory with a server-side copy returning the old version
+//
+// It returns fs.ErrorCantCopy if the copy isn't possible.
+func (f *Fs) keepCopy(ctx context.Context, o fs.Object) (fs.Object, error) {
+	do := f.vbase.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	vremote := addVersion(o.Remote(), time.Now().UTC())
+	v, err := do(ctx, o, vremote)
+	if errors.Is(err, fs.ErrorCantCopy) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to keep old version of %q: %w", o.Remote(), err)
+	}
+	fs.Debugf(o, "Kept old version as %q", vremote)
+	return v, nil
+}
+
+// putFn writes a file to remote in fdst
+type putFn func(fdst fs.Fs, remote string) (fs.Object, error)
+
+// replace writes remote with put keeping the existing version old
+// which is looked up if nil, returning the new object in the base.
+//
+// Old is kept before the new version is written so old is left as
+// the current version if the write fails. If the remote can copy, old
+// is copied into the version directory then overwritten, and the copy
+// is moved back if the write fails. Otherwise the new version is
+// uploaded to a temporary name in the version directory and only
+// moved into place after old is moved out.
+func (f *Fs) replace(ctx context.Context, old fs.Object, remote string, put putFn) (fs.Object, error) {
+	if err := f.checkWritable(remote); err != nil {
+		return nil, err
+	}
+	if old == nil {
+		var err error
+		old, err = f.findExisting(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if old == nil {
+		return put(f.base, remote)
+	}
+
+	// Copy old to the version directory then overwrite it
+	v, err := f.keepCopy(ctx, old)
+	if err == nil {
+		o, err := put(f.base, remote)
+		if o == nil {
+			// The failed upload may have removed old so put the
+			// copy back in its place
+			f.unkeep(ctx, v, remote)
+			return nil, err
+		}
+		return o, err
+	}
+	if !errors.Is(err, fs.ErrorCantCopy) {
+		return nil, err
+	}
+
+	// Upload to a temporary name, which is ignored in the version
+	// directory as it doesn't have a version, then move it into place
+	tmpRemote := remote + ".rclone-upload-" + random.String(8)
+	tmp, err := put(f.vbase, tmpRemote)
+	if tmp == nil {
+		return nil, err
+	}
+	removeTmp := func() {
+		if removeErr := tmp.Remove(ctx); removeErr != nil {
+			fs.Errorf(remote, "Failed to remove temporary upload %q: %v", tmpRemote, removeErr)
+		}
+	}
+	if err != nil {
+		removeTmp()
+		return nil, err
+	}
+	v, err = f.keep(ctx, old)
+	if err != nil {
+		removeTmp()
+		return nil, err
+	}
+	o, err := move(ctx, f.base, tmp, remote)
+	if err != nil {
+		removeTmp()
+		f.unkeep(ctx, v, remote)
+		return nil, fmt.Errorf("failed to move upload of %q into place: %w", remote, err)
+	}
+	return o, nil
+}
+
+// wrapObject wraps the object o returned with err from the base
+func (f *Fs) wrapObject(o fs.Object, err error) (fs.Object, error) {
+	if o == nil {
+		return nil, err
+	}
+	return f.newObject(o, o.Remote()), err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.wrapObject(f.replace(ctx, nil, src.Remote(), func(fdst fs.Fs, remote string) (fs.Object, error) {
+		return fdst.Put(ctx, in, fs.NewOverrideRemote(src, remote), options...)
+	}))
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if f.base.Features().PutStream == nil {
+		return nil, errors.New("can't PutStream: not supported by underlying remote")
+	}
+	return f.wrapObject(f.replace(ctx, nil, src.Remote(), func(fdst fs.Fs, remote string) (fs.Object, error) {
+		return fdst.Features().PutStream(ctx, in, fs.NewOverrideRemote(src, remote), options...)
+	}))
+}
+
+// Mkdir makes the directory (container, bucket)
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if err := f.checkWritable(dir); err != nil {
+		return err
+	}
+	return f.base.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if err := f.checkWritable(dir); err != nil {
+		return err
+	}
+	return f.base.Rmdir(ctx, dir)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.base.Features().Copy
+	srcObj, ok := src.(*Object)
+	if do == nil || !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	return f.wrapObject(f.replace(ctx, nil, remote, func(fdst fs.Fs, remote string) (fs.Object, error) {
+		do := fdst.Features().Copy
+		if do == nil {
+			return nil, fs.ErrorCantCopy
+		}
+		return do(ctx, srcObj.Object, remote)
+	}))
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.base.Features().DirCacheFlush; do != nil {
+		do()
+	}
+	if do := f.vbase.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if do := f.base.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
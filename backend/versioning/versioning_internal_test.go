@@ -0,0 +1,227 @@
+package versioning
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readObject(ctx context.Context, t *testing.T, o fs.Object) string {
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func listNames(ctx context.Context, t *testing.T, f fs.Fs, dir string) []string {
+	entries, err := f.List(ctx, dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tick returns the time now with a gap either side so it is between
+// the versions made before and after
+func tick() time.Time {
+	time.Sleep(10 * time.Millisecond)
+	t := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	return t
+}
+
+// newFsWith makes a new Fs on the same remote as f with extra options
+func (f *Fs) newFsWith(ctx context.Context, t *testing.T, m configmap.Simple) fs.Fs {
+	m["remote"] = f.opt.Remote
+	m["version_dir"] = f.opt.VersionDir
+	newFs, err := NewFs(ctx, f.name, f.root, m)
+	require.NoError(t, err)
+	return newFs
+}
+
+// Check old versions are kept and can be listed, restored and pruned
+func (f *Fs) testVersions(t *testing.T) {
+	ctx := context.Background()
+	const remote = "versions/file.txt"
+	item := fstest.Item{Path: remote, ModTime: fstest.Time("2001-02-03T04:05:06Z")}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "one", true)
+	other := fstest.Item{Path: "versions/other.txt", ModTime: item.ModTime}
+	_ = fstests.PutTestContents(ctx, t, f, &other, "other", true)
+	t1 := tick()
+
+	// Overwrite and delete the file
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	src := object.NewStaticObjectInfo(remote, item.ModTime, 3, true, nil, nil)
+	require.NoError(t, o.Update(ctx, bytes.NewBufferString("two"), src))
+	assert.Equal(t, "two", readObject(ctx, t, o))
+	t2 := tick()
+	require.NoError(t, o.Remove(ctx))
+	t3 := tick()
+
+	// The old versions are hidden
+	assert.Equal(t, []string{"versions/other.txt"}, listNames(ctx, t, f, "versions"))
+	_, err = f.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	out, err := f.Command(ctx, "versions", []string{"versions"}, nil)
+	require.NoError(t, err)
+	versions := out.([]versionInfo)
+	require.Len(t, versions, 2)
+	for i, v := range versions {
+		assert.Equal(t, remote, v.Path)
+		assert.NotEqual(t, remote, v.Name)
+		assert.Equal(t, int64(3), v.Size)
+		if i > 0 {
+			assert.True(t, versions[i-1].Replaced.Before(v.Replaced))
+		}
+	}
+
+	// Show the old versions in listings
+	fVersions := f.newFsWith(ctx, t, configmap.Simple{"versions": "true"})
+	assert.Equal(t, []string{versions[0].Name, versions[1].Name, "versions/other.txt"}, listNames(ctx, t, fVersions, "versions"))
+	vo, err := fVersions.NewObject(ctx, versions[0].Name)
+	require.NoError(t, err)
+	assert.Equal(t, "one", readObject(ctx, t, vo))
+	assert.Equal(t, errOldVersion, vo.SetModTime(ctx, time.Now()))
+
+	// Show the files as they were at a time
+	for _, test := range []struct {
+		at   time.Time
+		want string
+	}{
+		{t1, "one"},
+		{t2, "two"},
+		{t3, ""},
+	} {
+		fAt := f.newFsWith(ctx, t, configmap.Simple{"version_at": test.at.Format(time.RFC3339Nano)})
+		o, err := fAt.NewObject(ctx, remote)
+		if test.want == "" {
+			assert.Equal(t, fs.ErrorObjectNotFound, err)
+			assert.Equal(t, []string{"versions/other.txt"}, listNames(ctx, t, fAt, "versions"))
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, test.want, readObject(ctx, t, o))
+		assert.Equal(t, []string{remote, "versions/other.txt"}, listNames(ctx, t, fAt, "versions"))
+		assert.Equal(t, errNotWithVersionAt, o.Remove(ctx))
+		_, err = fAt.Put(ctx, bytes.NewBufferString("new"), src)
+		assert.Equal(t, errNotWithVersionAt, err)
+	}
+
+	// Restore the deleted file
+	out, err = f.Command(ctx, "restore", []string{"versions"}, map[string]string{"at": t2.Format(time.RFC3339Nano)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{remote}, out)
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, "two", readObject(ctx, t, o))
+
+	// Prune all but the last version
+	_, err = f.Command(ctx, "prune", nil, nil)
+	assert.Error(t, err)
+	_, err = f.Command(ctx, "prune", []string{"versions"}, map[string]string{"keep": "1"})
+	require.NoError(t, err)
+	out, err = f.Command(ctx, "versions", []string{remote}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, versions[1:], out)
+
+	// Clean up
+	_, err = f.Command(ctx, "prune", []string{"versions"}, map[string]string{"keep": "0"})
+	require.NoError(t, err)
+	for _, name := range []string{remote, other.Path} {
+		o, err := f.base.NewObject(ctx, name)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	require.NoError(t, f.base.Rmdir(ctx, "versions"))
+}
+
+// Check a failed update leaves the current version in place and
+// doesn't keep a version
+func (f *Fs) testFailedUpdate(t *testing.T) {
+	ctx := context.Background()
+	const remote = "failed/file.txt"
+	item := fstest.Item{Path: remote, ModTime: fstest.Time("2001-02-03T04:05:06Z")}
+	_ = fstests.PutTestContents(ctx, t, f, &item, "one", true)
+
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	errUpload := errors.New("upload failed")
+	in := io.MultiReader(bytes.NewBufferString("tw"), iotest.ErrReader(errUpload))
+	src := object.NewStaticObjectInfo(remote, item.ModTime, 3, true, nil, nil)
+	assert.ErrorIs(t, o.Update(ctx, in, src), errUpload)
+	_, err = f.Put(ctx, iotest.ErrReader(errUpload), src)
+	assert.ErrorIs(t, err, errUpload)
+
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, "one", readObject(ctx, t, o))
+	entries, err := f.vbase.List(ctx, "failed")
+	if !errors.Is(err, fs.ErrorDirNotFound) {
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	}
+
+	// Clean up
+	require.NoError(t, o.(*Object).Object.Remove(ctx))
+	require.NoError(t, f.base.Rmdir(ctx, "failed"))
+	_ = f.vbase.Rmdir(ctx, "failed")
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Versions", f.testVersions)
+	t.Run("FailedUpdate", f.testFailedUpdate)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
+
+func TestFindVersionDir(t *testing.T) {
+	for _, test := range []struct {
+		remote      string
+		bucketBased bool
+		root        string
+		wantBucket  string
+		wantDir     string
+		wantErr     bool
+	}{
+		{"remote:", false, "", "", ".versions", false},
+		{"remote:", false, "dir/sub", "", ".versions", false},
+		{"remote:path", true, "dir", "", ".versions", false},
+		{"remote:bucket", true, "", "", ".versions", false},
+		{"remote:", true, "bucket", "bucket", "bucket/.versions", false},
+		{"remote:", true, "bucket/dir/sub", "bucket", "bucket/.versions", false},
+		{"remote:/", true, "bucket/dir", "bucket", "bucket/.versions", false},
+		{"remote:", true, "", "", "", true},
+	} {
+		what := test.remote + " " + test.root
+		opt := &Options{Remote: test.remote, VersionDir: ".versions"}
+		bucket, versionDir, err := findVersionDir(opt, test.bucketBased, test.root)
+		if test.wantErr {
+			assert.Error(t, err, what)
+			continue
+		}
+		require.NoError(t, err, what)
+		assert.Equal(t, test.wantBucket, bucket, what)
+		assert.Equal(t, test.wantDir, versionDir, what)
+	}
+}
@@ -0,0 +1,81 @@
+// Test Versioning filesystem interface
+package versioning
+
+import (
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var defaultOpt = fstests.Opt{
+	RemoteName: "TestVersioning:",
+	NilObject:  (*Object)(nil),
+	UnimplementableFsMethods: []string{
+		"OpenWriterAt",
+		"OpenChunkWriter",
+		"MergeDirs",
+		"PutUnchecked",
+		"UserInfo",
+		"Disconnect",
+		"ChangeNotify",
+		"CleanUp",
+		"DirSetModTime",
+		"MkdirMetadata",
+		"PublicLink",
+		"ListR",
+		"ListP",
+		"Move",
+		"DirMove",
+		"Purge",
+	},
+	UnimplementableObjectMethods: []string{
+		"ID",
+		"GetTier",
+		"SetTier",
+	},
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	opt := defaultOpt
+	opt.RemoteName = *fstest.RemoteName
+	fstests.Run(t, &opt)
+}
+
+// TestLocal tests versioning wrapping the local filesystem
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestVersioningLocal"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "versioning"},
+		{Name: name, Key: "remote", Value: t.TempDir()},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
+
+// TestLocalNoClone tests versioning wrapping a local filesystem which
+// can't copy so uploads are made to a temporary name first
+func TestLocalNoClone(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestVersioningLocalNoClone"
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "versioning"},
+		{Name: name, Key: "remote", Value: ":local,no_clone:" + t.TempDir()},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
@@ -31,15 +31,19 @@ docs = [
     "fichier.md",
     "alias.md",
     "s3.md",
+    "archive.md",
     "b2.md",
     "box.md",
     "cache.md",
+    "chaos.md",
     "chunker.md",
     "sharefile.md",
     "crypt.md",
     "compress.md",
     "combine.md",
+    "dedup.md",
     "dropbox.md",
+    "erasure.md",
     "filefabric.md",
     "filescom.md",
     "ftp.md",
@@ -47,6 +51,7 @@ docs = [
     "googlecloudstorage.md",
     "drive.md",
     "googlephotos.md",
+    "guard.md",
     "hasher.md",
     "hdfs.md",
     "hidrive.md",
@@ -66,8 +71,10 @@ docs = [
     "onedrive.md",
     "opendrive.md",
     "oracleobjectstorage/_index.md",
+    "pack.md",
     "qingstor.md",
     "quatrix.md",
+    "replica.md",
     "sia.md",
     "swift.md",
     "pcloud.md",
@@ -82,9 +89,12 @@ docs = [
     "smb.md",
     "storj.md",
     "sugarsync.md",
+    "tiering.md",
+    "transform.md",
     "ulozto.md",
     "uptobox.md",
     "union.md",
+    "versioning.md",
     "webdav.md",
     "yandex.md",
     "zoho.md",
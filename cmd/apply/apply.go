@@ -0,0 +1,86 @@
+// Package apply provides the apply command.
+package apply
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "apply plan.json [source:path dest:path]",
+	Short: `Carry out the changes in a plan made with --plan-file.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Makes the changes listed in a plan written by |rclone sync|, |copy|
+or |move| with the |--plan-file| flag.
+
+Making a plan runs the sync as normal, comparing the source and
+destination, but instead of changing anything it writes everything
+it would have done to the plan file as JSON. Check the plan, then
+carry it out with this command.
+
+    rclone sync --plan-file plan.json source:path dest:path
+    # review plan.json
+    rclone apply plan.json
+
+The plan lists each action with the size, modification time and
+checksum, if cheap to read, of the files it acts on. Before each
+action rclone checks the files are the same as when the plan was
+made. If any have changed, or files have appeared where the plan
+expects none, the action is refused with an error and the rest of
+the plan carries on. As with sync, the deletions on the destination
+are skipped if there were any errors, unless |--ignore-errors| is
+set.
+
+The actions are carried out in this order: make directories, renames,
+copies and moves, deletions, then removal of empty directories.
+
+The source and destination are read from the plan. Pass them after
+the plan file to use different ones. They must be passed if the plan
+was made with parameters for a remote on the command line, such as
+|:s3,access_key_id=XXX:path| or |remote,region=eu:path|, as these
+aren't stored in the plan in case they are secret.
+
+Directory modification times and metadata aren't part of the plan so
+aren't set by |apply|. The |--fix-case| and |--copy-dest| flags can't
+be used when making a plan.
+
+Flags like |--backup-dir|, |--transfers| and |--dry-run| work with
+|apply| as with sync.
+
+**Note**: Use the |-P|/|--progress| flag to view real-time transfer statistics.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+		"groups":            "Sync,Copy,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 3, command, args)
+		if len(args) == 2 {
+			fs.Fatalf(nil, "Need both the source and the destination or neither")
+		}
+		plan, err := sync.ReadPlan(args[0])
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		if len(args) == 1 {
+			src, dst, err := plan.Remotes()
+			if err != nil {
+				fs.Fatalf(nil, "%v - pass the source and destination after the plan file", err)
+			}
+			args = append(args, src, dst)
+		}
+		fsrc, fdst := cmd.NewFsSrcDst(args[1:])
+		cmd.Run(false, true, command, func() error {
+			return sync.Apply(context.Background(), fdst, fsrc, plan)
+		})
+	},
+}
@@ -0,0 +1,75 @@
+// Package archive provides the archive command.
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(Command)
+	Command.AddCommand(createCommand)
+	Command.AddCommand(extractCommand)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "archive <action> [opts] <source> <destination>",
+	Short: `Create and extract zip and tar archives on remotes.`,
+	Long: `Create archives from the files on a remote, or extract archives into a
+remote, without storing them locally. Requires the use of a subcommand
+to specify the action, e.g.
+
+    rclone archive create remote:dir remote:backup.tar.gz
+    rclone archive extract remote:backup.tar.gz remote:dir
+
+The zip, tar and tar.gz (tgz) formats are supported.
+
+Each subcommand has its own options which you can see in their help.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+	},
+	RunE: func(command *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("archive requires an action, e.g. 'rclone archive create remote:dir remote:backup.zip'")
+		}
+		return errors.New("unknown action")
+	},
+}
+
+// Archive formats
+const (
+	formatZip   = "zip"
+	formatTar   = "tar"
+	formatTarGz = "tar.gz"
+)
+
+// formatOf returns the format of the archive called name
+func formatOf(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return formatZip, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return formatTar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return formatTarGz, nil
+	}
+	return "", fmt.Errorf("can't tell the format of %q - it should end in .zip, .tar, .tar.gz or .tgz", name)
+}
+
+// checkFormat checks format is one of the supported formats
+func checkFormat(format string) (string, error) {
+	switch format {
+	case formatZip, formatTar, formatTarGz:
+		return format, nil
+	case "tgz":
+		return formatTarGz, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q - use zip, tar or tar.gz", format)
+}
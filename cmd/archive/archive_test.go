@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06Z")
+	t2 = fstest.Time("2018-03-04T05:06:07Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestFormatOf(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{"a.zip", formatZip},
+		{"a.ZIP", formatZip},
+		{"a.tar", formatTar},
+		{"a.tar.gz", formatTarGz},
+		{"a.tgz", formatTarGz},
+		{"a.gz", ""},
+	} {
+		got, err := formatOf(test.name)
+		assert.Equal(t, test.want, got, test.name)
+		assert.Equal(t, test.want == "", err != nil, test.name)
+	}
+}
+
+func TestCreateExtract(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello.txt", "hello world", t1)
+	file2 := r.WriteFile("dir/sub/file.bin", "some binary data", t2)
+	file3 := r.WriteFile("dir/potato.txt", "potatoes", t1)
+	archives := r.Fremote
+	r.Mkdir(ctx, archives)
+
+	for _, format := range []string{formatZip, formatTar, formatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			name := "test." + format
+			require.NoError(t, Create(ctx, archives, name, r.Flocal, format))
+			o, err := archives.NewObject(ctx, name)
+			require.NoError(t, err)
+			assert.Greater(t, o.Size(), int64(0))
+
+			fdst, err := fs.NewFs(ctx, path.Join(r.LocalName, "extract-"+format))
+			require.NoError(t, err)
+			require.NoError(t, Extract(ctx, fdst, archives, name))
+			fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1, file2, file3}, nil, time.Second)
+
+			// Extracting again changes nothing
+			require.NoError(t, Extract(ctx, fdst, archives, name))
+			require.NoError(t, operations.Purge(ctx, fdst, ""))
+		})
+	}
+}
+
+func TestCreateExtractFiltered(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello.txt", "hello world", t1)
+	_ = r.WriteFile("dir/sub/file.bin", "some binary data", t2)
+	file3 := r.WriteFile("dir/potato.txt", "potatoes", t1)
+	r.Mkdir(ctx, r.Fremote)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("+ *.txt"))
+	require.NoError(t, fi.AddRule("- **"))
+	filtered := filter.ReplaceConfig(ctx, fi)
+
+	// Filter what goes in to the archive
+	require.NoError(t, Create(filtered, r.Fremote, "txt.tar", r.Flocal, formatTar))
+	fdst, err := fs.NewFs(ctx, path.Join(r.LocalName, "extract"))
+	require.NoError(t, err)
+	require.NoError(t, Extract(ctx, fdst, r.Fremote, "txt.tar"))
+	fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1, file3}, []string{"dir"}, time.Second)
+	require.NoError(t, operations.Purge(ctx, fdst, ""))
+
+	// Filter what comes out of the archive
+	for _, format := range []string{formatZip, formatTarGz} {
+		name := "all." + format
+		require.NoError(t, Create(ctx, r.Fremote, name, r.Flocal, format))
+		fdst, err := fs.NewFs(ctx, path.Join(r.LocalName, "extract-"+format))
+		require.NoError(t, err)
+		require.NoError(t, Extract(filtered, fdst, r.Fremote, name))
+		fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1, file3}, []string{"dir"}, time.Second)
+		require.NoError(t, operations.Purge(ctx, fdst, ""))
+	}
+}
+
+func TestCreateNotIntoItself(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello.txt", "hello world", t1)
+	require.NoError(t, Create(ctx, r.Flocal, "self.zip", r.Flocal, formatZip))
+	require.NoError(t, Create(ctx, r.Flocal, "self.zip", r.Flocal, formatZip))
+	fdst, err := fs.NewFs(ctx, path.Join(r.LocalName, "extract"))
+	require.NoError(t, err)
+	require.NoError(t, Extract(ctx, fdst, r.Flocal, "self.zip"))
+	fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1}, nil, time.Second)
+}
@@ -0,0 +1,274 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	createFormat = ""
+)
+
+func init() {
+	cmdFlags := createCommand.Flags()
+	flags.StringVarP(cmdFlags, &createFormat, "format", "", createFormat, "Archive format: zip, tar or tar.gz (default from the file name)", "")
+}
+
+var createCommand = &cobra.Command{
+	Use:   "create source:path dest:path/to/archive",
+	Short: `Create an archive from the files in a remote directory.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Writes the files in the source directory and its subdirectories into
+a single zip, tar or tar.gz archive on the destination.
+
+    rclone archive create remote:photos remote:backups/photos.tar.gz
+
+The archive is streamed as it is made so nothing is stored locally.
+The destination must support streaming uploads which most remotes do.
+
+The format is taken from the extension of the archive name (|.zip|,
+|.tar|, |.tar.gz| or |.tgz|) unless the |--format| flag is used.
+
+Use the filtering flags to choose which files are put in the archive
+and |--max-depth| to limit the directory depth, for example
+
+    rclone archive create --include "*.jpg" remote:photos remote:jpegs.zip
+
+The modification times of the files and directories are stored in the
+archive. Files in zip archives are compressed with deflate.
+
+Files which don't have a known size, such as Google Docs, can't be put
+in tar archives.
+
+**Note**: Use the |-P|/|--progress| flag to view real-time transfer statistics.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+		"groups":            "Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		fdst, dstFileName := cmd.NewFsDstFile(args[1:])
+		cmd.Run(false, true, command, func() error {
+			format, err := createFormatOf(dstFileName)
+			if err != nil {
+				return err
+			}
+			return Create(context.Background(), fdst, dstFileName, fsrc, format)
+		})
+	},
+}
+
+// createFormatOf returns the format to create dstFileName in
+func createFormatOf(dstFileName string) (string, error) {
+	if createFormat != "" {
+		return checkFormat(createFormat)
+	}
+	return formatOf(dstFileName)
+}
+
+// Create writes the files in fsrc into the archive dstFileName in fdst
+func Create(ctx context.Context, fdst fs.Fs, dstFileName string, fsrc fs.Fs, format string) error {
+	putStream := fdst.Features().PutStream
+	if putStream == nil {
+		return fmt.Errorf("can't create archive on %v as it doesn't support streaming uploads", fdst)
+	}
+	entries, err := listSorted(ctx, fsrc, fdst, dstFileName)
+	if err != nil {
+		return err
+	}
+	if operations.SkipDestructive(ctx, dstFileName, "create archive") {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := writeArchive(ctx, pw, format, entries)
+		_ = pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	src := object.NewStaticObjectInfo(dstFileName, time.Now(), -1, true, nil, fdst)
+	_, err = putStream(ctx, pr, src)
+	// Stop the writer if the upload failed
+	_ = pr.CloseWithError(err)
+	if wErr := <-writeErr; wErr != nil {
+		err = wErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create archive %q: %w", dstFileName, err)
+	}
+	fs.Infof(fdst, "Created archive %q", dstFileName)
+	return nil
+}
+
+// listSorted lists the files and directories in fsrc which pass the
+// filters in path order, leaving out the archive being made
+func listSorted(ctx context.Context, fsrc, fdst fs.Fs, dstFileName string) (entries fs.DirEntries, err error) {
+	archivePath := path.Join(fdst.Root(), dstFileName)
+	sameConfig := operations.SameConfig(fsrc, fdst)
+	err = walk.ListR(ctx, fsrc, "", false, fs.GetConfig(ctx).MaxDepth, walk.ListAll, func(batch fs.DirEntries) error {
+		for _, entry := range batch {
+			if sameConfig && path.Join(fsrc.Root(), entry.Remote()) == archivePath {
+				fs.Debugf(entry, "Not adding the archive to itself")
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Remote() < entries[j].Remote()
+	})
+	return entries, nil
+}
+
+// writer writes the entries of an archive
+type writer interface {
+	// create starts the next entry returning a writer for its data
+	create(name string, size int64, modTime time.Time, dir bool) (io.Writer, error)
+	// Close finishes the archive
+	Close() error
+}
+
+// newWriter returns a writer for an archive in format writing to out
+func newWriter(out io.Writer, format string) (writer, error) {
+	switch format {
+	case formatZip:
+		return zipWriter{zip.NewWriter(out)}, nil
+	case formatTar:
+		return &tarWriter{Writer: tar.NewWriter(out)}, nil
+	case formatTarGz:
+		gz := gzip.NewWriter(out)
+		return &tarWriter{Writer: tar.NewWriter(gz), gz: gz}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// zipWriter writes zip archives
+type zipWriter struct {
+	*zip.Writer
+}
+
+// create starts the next entry returning a writer for its data
+func (w zipWriter) create(name string, size int64, modTime time.Time, dir bool) (io.Writer, error) {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	if dir {
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+	}
+	return w.CreateHeader(hdr)
+}
+
+// tarWriter writes tar archives, optionally compressed
+type tarWriter struct {
+	*tar.Writer
+	gz *gzip.Writer // set if compressing
+}
+
+// create starts the next entry returning a writer for its data
+func (w *tarWriter) create(name string, size int64, modTime time.Time, dir bool) (io.Writer, error) {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX, // to keep the modification times exactly
+	}
+	if dir {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		hdr.Size = 0
+		hdr.Mode = 0755
+	} else if size < 0 {
+		return nil, errors.New("can't add file of unknown size to a tar archive")
+	}
+	return w.Writer, w.WriteHeader(hdr)
+}
+
+// Close finishes the archive
+func (w *tarWriter) Close() error {
+	err := w.Writer.Close()
+	if w.gz != nil {
+		if gzErr := w.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	return err
+}
+
+// writeArchive writes the entries into an archive in format to out
+func writeArchive(ctx context.Context, out io.Writer, format string, entries fs.DirEntries) error {
+	w, err := newWriter(out, format)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Directory:
+			_, err = w.create(x.Remote(), 0, x.ModTime(ctx), true)
+		case fs.Object:
+			err = addFile(ctx, w, x)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add %q: %w", entry.Remote(), err)
+		}
+	}
+	return w.Close()
+}
+
+// addFile copies o into the archive
+func addFile(ctx context.Context, w writer, o fs.Object) (err error) {
+	tr := accounting.Stats(ctx).NewTransfer(o, nil)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	size := o.Size()
+	out, err := w.create(o.Remote(), size, o.ModTime(ctx), false)
+	if err != nil {
+		return err
+	}
+	rc, err := operations.Open(ctx, o)
+	if err != nil {
+		return err
+	}
+	in := tr.Account(ctx, rc).WithBuffer() // account and buffer the transfer
+	defer fs.CheckClose(in, &err)
+	n, err := io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("file changed size while being archived: expecting %d bytes but read %d", size, n)
+	}
+	fs.Debugf(o, "Added to archive")
+	return nil
+}
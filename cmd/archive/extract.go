@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	archivebackend "github.com/rclone/rclone/backend/archive"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+var extractCommand = &cobra.Command{
+	Use:   "extract source:path/to/archive dest:path",
+	Short: `Extract an archive into a remote directory.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Copies the files in a zip, tar or tar.gz archive into the destination
+directory.
+
+    rclone archive extract remote:backups/photos.tar.gz remote:photos
+
+The format is taken from the extension of the archive name (|.zip|,
+|.tar|, |.tar.gz| or |.tgz|).
+
+Files which are already in the destination with the same size and
+modification time are skipped, as with |rclone copy|. Use the filtering
+flags to choose which files are extracted, for example
+
+    rclone archive extract --include "*.jpg" remote:photos.zip remote:jpegs
+
+The modification times stored in the archive are set on the files.
+Only files are extracted - links and other special files are ignored.
+
+Zip and tar archives are read with ranged reads of just the files being
+extracted, several at once as set by |--transfers|. Archives compressed
+with gzip can only be read from the start so are extracted one file at
+a time in a single pass.
+
+See the [archive](/archive/) backend to read archives without
+extracting them.
+
+**Note**: Use the |-P|/|--progress| flag to view real-time transfer statistics.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+		"groups":            "Copy,Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
+		cmd.Run(true, true, command, func() error {
+			if srcFileName == "" {
+				return fmt.Errorf("%q is not an archive file", args[0])
+			}
+			return Extract(context.Background(), fdst, fsrc, srcFileName)
+		})
+	},
+}
+
+// Extract copies the files in the archive srcFileName in fsrc into fdst
+func Extract(ctx context.Context, fdst, fsrc fs.Fs, srcFileName string) error {
+	format, err := formatOf(srcFileName)
+	if err != nil {
+		return err
+	}
+	if format == formatTarGz {
+		return extractStream(ctx, fdst, fsrc, srcFileName)
+	}
+	// Zip and tar archives can be read at random so copy the files
+	// from the archive backend
+	m := configmap.Simple{"remote": fs.ConfigStringFull(fsrc)}
+	farchive, err := archivebackend.NewFs(ctx, ":archive", srcFileName, m)
+	if err != nil {
+		return err
+	}
+	return sync.CopyDir(ctx, fdst, farchive, false)
+}
+
+// extractStream extracts a tar.gz archive in a single pass
+func extractStream(ctx context.Context, fdst, fsrc fs.Fs, srcFileName string) (err error) {
+	o, err := fsrc.NewObject(ctx, srcFileName)
+	if err != nil {
+		return err
+	}
+	in, err := operations.Open(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to read archive %q: %w", srcFileName, err)
+	}
+	var (
+		fi     = filter.GetConfig(ctx)
+		tr     = tar.NewReader(gz)
+		failed = 0
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %q: %w", srcFileName, err)
+		}
+		name := path.Clean("/" + hdr.Name)[1:]
+		if name == "" || !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if !fi.Include(name, hdr.Size, hdr.ModTime, nil) {
+			fs.Debugf(name, "Excluded from extract")
+			continue
+		}
+		src := object.NewStaticObjectInfo(name, hdr.ModTime, hdr.Size, true, nil, fsrc)
+		if dst, err := fdst.NewObject(ctx, name); err == nil && operations.Equal(ctx, src, dst) {
+			fs.Debugf(dst, "Unchanged skipping")
+			continue
+		}
+		_, err = operations.RcatSize(ctx, fdst, name, io.NopCloser(tr), hdr.Size, hdr.ModTime, nil)
+		if err != nil {
+			err = fs.CountError(ctx, err)
+			fs.Errorf(name, "Failed to extract: %v", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to extract %d files", failed)
+	}
+	return nil
+}
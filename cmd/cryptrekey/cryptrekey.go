@@ -0,0 +1,107 @@
+// Package cryptrekey provides the cryptrekey command.
+package cryptrekey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	deleteSrc = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &deleteSrc, "delete-src", "", deleteSrc, "Delete the source files after they have been re-encrypted", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "cryptrekey cryptedremote:path newcryptedremote:path",
+	Short: `Re-encrypt a crypted remote with new keys.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Copies the files in a [crypted](/crypt/) remote into another crypted
+remote with different passwords or file name encryption settings,
+decrypting them with the keys of the first and encrypting them with
+the keys of the second. Use this to rotate the keys of a crypted
+remote.
+
+Make a new crypt remote with the new passwords pointing at a different
+directory of the underlying remote, then use it like this
+
+    rclone cryptrekey oldcrypt:path newcrypt:path
+
+Files which are already in |newcrypt:path| with the same size and
+modification time are skipped, so if the rekey is interrupted running
+the command again will carry on where it left off.
+
+If the passwords of the two remotes are the same and only the file
+name encryption settings differ then the encrypted data doesn't need
+to change. In this case if both crypt remotes wrap the same underlying
+remote the files are copied or moved with server-side operations,
+where the underlying remote supports them, rather than being
+downloaded and uploaded again.
+
+Once the rekey has finished check the files were re-encrypted correctly with
+
+    rclone cryptcheck oldcrypt:path newcrypt:path
+
+Use the |--delete-src| flag to delete each source file once it has
+been re-encrypted, leaving |oldcrypt:path| empty. It is safer to leave
+this off and purge |oldcrypt:path| after |cryptcheck| has succeeded.
+
+**Note**: Use the |-P|/|--progress| flag to view real-time transfer statistics.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+		"groups":            "Filter,Listing,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		cmd.Run(true, true, command, func() error {
+			return cryptRekey(context.Background(), fdst, fsrc, deleteSrc)
+		})
+	},
+}
+
+// cryptRekey re-encrypts the files in fsrc into fdst
+func cryptRekey(ctx context.Context, fdst, fsrc fs.Fs, deleteSrc bool) error {
+	// Check to see both are crypts
+	srcCrypt, ok := fsrc.(*crypt.Fs)
+	if !ok {
+		return fmt.Errorf("%s:%s is not a crypt remote", fsrc.Name(), fsrc.Root())
+	}
+	dstCrypt, ok := fdst.(*crypt.Fs)
+	if !ok {
+		return fmt.Errorf("%s:%s is not a crypt remote", fdst.Name(), fdst.Root())
+	}
+	srcUnderlying, dstUnderlying := srcCrypt.UnWrap(), dstCrypt.UnWrap()
+	if operations.OverlappingFilterCheck(ctx, dstUnderlying, srcUnderlying) {
+		return errors.New("can't rekey into an overlapping directory of the underlying remote - point the new crypt remote at a different directory")
+	}
+	if operations.SameConfig(dstUnderlying, srcUnderlying) {
+		// The crypt backend only does server-side copies and
+		// moves between crypt remotes with the same data
+		// keys, so this allows name-only changes to avoid
+		// re-uploading the data.
+		var ci *fs.ConfigInfo
+		ctx, ci = fs.AddConfig(ctx)
+		ci.ServerSideAcrossConfigs = true
+	}
+	if deleteSrc {
+		return sync.MoveDir(ctx, fdst, fsrc, true, true)
+	}
+	return sync.CopyDir(ctx, fdst, fsrc, true)
+}
@@ -0,0 +1,139 @@
+package cryptrekey
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/rclone/rclone/backend/crypt"
+	_ "github.com/rclone/rclone/backend/local"
+	rfs "github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCrypt makes a crypt remote called name on dir
+func newCrypt(ctx context.Context, t *testing.T, name, dir, password, filenameEncryption string) rfs.Fs {
+	f, err := crypt.NewFs(ctx, name, "", configmap.Simple{
+		"remote":              dir,
+		"password":            obscure.MustObscure(password),
+		"filename_encryption": filenameEncryption,
+		"filename_encoding":   "base32",
+	})
+	require.NoError(t, err)
+	return f
+}
+
+// readFiles returns the contents of all the files under dir sorted
+func readFiles(t *testing.T, dir string) (contents []string) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		contents = append(contents, string(data))
+		return err
+	})
+	if !os.IsNotExist(err) {
+		require.NoError(t, err)
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func readObject(ctx context.Context, t *testing.T, f rfs.Fs, remote string) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestCryptRekey(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"file.txt":          "hello",
+		"dir/file2.txt":     "potato",
+		"dir/sub/file3.txt": "sausage",
+	}
+	for _, test := range []struct {
+		name               string
+		password           string
+		filenameEncryption string
+		deleteSrc          bool
+		wantSameData       bool // set if the data should be copied or moved server-side
+	}{
+		{"NewKeys", "sausage", "standard", false, false},
+		{"NewKeysDeleteSrc", "sausage", "standard", true, false},
+		{"NewNames", "potato", "obfuscate", false, true},
+		{"NewNamesDeleteSrc", "potato", "obfuscate", true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+			fsrc := newCrypt(ctx, t, "oldcrypt", oldDir, "potato", "standard")
+			fdst := newCrypt(ctx, t, "newcrypt", newDir, test.password, test.filenameEncryption)
+			for remote, contents := range files {
+				src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+				_, err := fsrc.Put(ctx, bytes.NewBufferString(contents), src)
+				require.NoError(t, err)
+			}
+			encrypted := readFiles(t, oldDir)
+			require.Len(t, encrypted, len(files))
+
+			require.NoError(t, cryptRekey(ctx, fdst, fsrc, test.deleteSrc))
+
+			// The files can be read with the new keys
+			for remote, contents := range files {
+				assert.Equal(t, contents, readObject(ctx, t, fdst, remote), remote)
+			}
+
+			// The encrypted data is only the same if the
+			// crypt remotes share data keys, as otherwise
+			// it must be encrypted again
+			reencrypted := readFiles(t, newDir)
+			require.Len(t, reencrypted, len(files))
+			if test.wantSameData {
+				assert.Equal(t, encrypted, reencrypted)
+			} else {
+				for _, data := range reencrypted {
+					assert.NotContains(t, encrypted, data)
+				}
+			}
+
+			if test.deleteSrc {
+				assert.Empty(t, readFiles(t, oldDir))
+			} else {
+				assert.Equal(t, encrypted, readFiles(t, oldDir))
+			}
+		})
+	}
+}
+
+func TestCryptRekeyErrors(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fsrc := newCrypt(ctx, t, "oldcrypt", filepath.Join(dir, "old"), "potato", "standard")
+
+	// Both remotes must be crypts
+	local, err := rfs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	assert.ErrorContains(t, cryptRekey(ctx, local, fsrc, false), "is not a crypt remote")
+	assert.ErrorContains(t, cryptRekey(ctx, fsrc, local, false), "is not a crypt remote")
+
+	// They can't overlap on the underlying remote
+	fdst := newCrypt(ctx, t, "newcrypt", filepath.Join(dir, "old", "new"), "sausage", "standard")
+	assert.ErrorContains(t, cryptRekey(ctx, fdst, fsrc, false), "overlapping")
+}
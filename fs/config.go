@@ -155,6 +155,11 @@ var ConfigOptionsInfo = Options{{
 	Default: "hash",
 	Help:    "Strategies to use when synchronizing using track-renames hash|modtime|leaf",
 	Groups:  "Sync",
+}, {
+	Name:    "track_renames_index",
+	Default: false,
+	Help:    "Keep an index of the destination hashes so --track-renames doesn't need to hash the destination",
+	Groups:  "Sync",
 }, {
 	Name:    "retries",
 	Default: 3,
@@ -266,6 +271,16 @@ var ConfigOptionsInfo = Options{{
 	Default: false,
 	Help:    "Preserve the extension when using --suffix",
 	Groups:  "Sync",
+}, {
+	Name:    "checkpoint",
+	Default: false,
+	Help:    "Record checked files so an interrupted sync or copy can skip them when run again",
+	Groups:  "Sync",
+}, {
+	Name:    "plan_file",
+	Default: "",
+	Help:    "Write the changes a sync, copy or move would make to this file instead of making them",
+	Groups:  "Sync",
 }, {
 	Name:    "fast_list",
 	Default: false,
@@ -442,6 +457,16 @@ var ConfigOptionsInfo = Options{{
 	Default: SizeSuffix(64 * 1024 * 1024),
 	Help:    "Chunk size for multi-thread downloads / uploads, if not set by filesystem",
 	Groups:  "Copy",
+}, {
+	Name:    "multi_thread_resume",
+	Default: false,
+	Help:    "Save the state of multi-thread uploads so they can be resumed if interrupted",
+	Groups:  "Copy",
+}, {
+	Name:    "delta",
+	Default: false,
+	Help:    "Send only the changed blocks of files being updated where the destination supports it",
+	Groups:  "Copy",
 }, {
 	Name:    "use_json_log",
 	Default: false,
@@ -555,6 +580,7 @@ type ConfigInfo struct {
 	MaxDeleteSize              SizeSuffix        `config:"max_delete_size"`
 	TrackRenames               bool              `config:"track_renames"`          // Track file renames.
 	TrackRenamesStrategy       string            `config:"track_renames_strategy"` // Comma separated list of strategies used to track renames
+	TrackRenamesIndex          bool              `config:"track_renames_index"`    // Keep a persistent index of destination hashes for track renames
 	Retries                    int               `config:"retries"`                // High-level retries
 	RetriesInterval            time.Duration     `config:"retries_sleep"`
 	LowLevelRetries            int               `config:"low_level_retries"`
@@ -577,6 +603,8 @@ type ConfigInfo struct {
 	BackupDir                  string            `config:"backup_dir"`
 	Suffix                     string            `config:"suffix"`
 	SuffixKeepExtension        bool              `config:"suffix_keep_extension"`
+	Checkpoint                 bool              `config:"checkpoint"`
+	PlanFile                   string            `config:"plan_file"`
 	UseListR                   bool              `config:"fast_list"`
 	BufferSize                 SizeSuffix        `config:"buffer_size"`
 	BwLimit                    BwTimetable       `config:"bwlimit"`
@@ -614,6 +642,8 @@ type ConfigInfo struct {
 	MultiThreadSet             bool              `config:"multi_thread_set"`        // whether MultiThreadStreams was set (set in fs/config/configflags)
 	MultiThreadChunkSize       SizeSuffix        `config:"multi_thread_chunk_size"` // Chunk size for multi-thread downloads / uploads, if not set by filesystem
 	MultiThreadWriteBufferSize SizeSuffix        `config:"multi_thread_write_buffer_size"`
+	MultiThreadResume          bool              `config:"multi_thread_resume"`
+	Delta                      bool              `config:"delta"`
 	OrderBy                    string            `config:"order_by"` // instructions on how to order the transfer
 	UploadHeaders              []*HTTPOption     `config:"upload_headers"`
 	DownloadHeaders            []*HTTPOption     `config:"download_headers"`
@@ -697,6 +697,7 @@ type ChunkWriterInfo struct {
 	ChunkSize         int64 // preferred chunk size
 	Concurrency       int   // how many chunks to write at once
 	LeavePartsOnError bool  // if set don't delete parts uploaded so far on error
+	ResumedChunks     []int // chunks already written if the upload was resumed
 }
 
 // OpenChunkWriter is an option interface for Fs to implement chunked writing
@@ -725,6 +726,18 @@ type ChunkWriter interface {
 	Abort(ctx context.Context) error
 }
 
+// ChunkWriterResumer is an optional interface for ChunkWriter
+//
+// It is implemented by ChunkWriters which can save the state of their
+// upload so it can be carried on by a later OpenChunkWriter called
+// with ResumeChunkWriterOption.
+type ChunkWriterResumer interface {
+	// ChunkWriterState returns the state of the upload, including
+	// the chunks written so far, in a form which can be passed to
+	// ResumeChunkWriterOption
+	ChunkWriterState() (state string, err error)
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
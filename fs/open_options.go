@@ -306,6 +306,32 @@ func (o *ChunkOption) String() string {
 	return fmt.Sprintf("ChunkOption(%v)", o.ChunkSize)
 }
 
+// ResumeChunkWriterOption asks OpenChunkWriter to carry on with the
+// upload described by State, as returned by ChunkWriterState, rather
+// than starting a new one.
+//
+// Backends which can't resume uploads ignore it. Those which can
+// should check the upload still exists and start a new one if not,
+// returning the chunks already written in ChunkWriterInfo.ResumedChunks.
+type ResumeChunkWriterOption struct {
+	State string
+}
+
+// Header formats the option as an http header
+func (o *ResumeChunkWriterOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ResumeChunkWriterOption) Mandatory() bool {
+	return false
+}
+
+// String formats the option into human-readable form
+func (o *ResumeChunkWriterOption) String() string {
+	return "ResumeChunkWriterOption"
+}
+
 // OpenOptionAddHeaders adds each header found in options to the
 // headers map provided the key was non empty.
 func OpenOptionAddHeaders(options []OpenOption, headers map[string]string) {
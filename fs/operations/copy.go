@@ -20,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/delta"
 	"github.com/rclone/rclone/lib/pacer"
 )
 
@@ -228,16 +229,77 @@ func (c *copy) updateOrPut(ctx context.Context, in io.ReadCloser, uploadOptions
 	return actionTaken, newDst, err
 }
 
-// Do a manual copy by reading the bytes and writing them
-func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
-	// Remove partial files on premature exit
-	if !c.inplace {
-		defer atexit.Unregister(atexit.Register(func() {
-			ctx := context.Background()
-			c.removeFailedPartialCopy(ctx, c.f, c.remoteForCopy)
-		}))
+// errNoDelta is returned by deltaCopy if the update can't be done
+// with a delta
+var errNoDelta = errors.New("can't delta copy")
+
+// deltaWriter accounts for the data sent by a delta copy
+type deltaWriter struct {
+	w       delta.Writer
+	acc     *accounting.Account
+	sent    int64
+	matched int64
+}
+
+// Write new data
+func (dw *deltaWriter) Write(p []byte) (n int, err error) {
+	n, err = dw.w.Write(p)
+	dw.sent += int64(n)
+	if accErr := dw.acc.AccountRead(n); err == nil {
+		err = accErr
+	}
+	return n, err
+}
+
+// Copy size bytes from offset in the old file
+func (dw *deltaWriter) Copy(offset, size int64) error {
+	err := dw.w.Copy(offset, size)
+	if err == nil {
+		dw.matched += size
+		dw.acc.ServerSideTransferEnd(size)
+	}
+	return err
+}
+
+// Update c.dst with c.src by sending only the blocks which have
+// changed or return errNoDelta if not possible
+func (c *copy) deltaCopy(ctx context.Context, uploadOptions, downloadOptions []fs.OpenOption) (actionTaken string, newDst fs.Object, err error) {
+	// Metadata is only written by a full upload
+	if c.ci.Metadata || c.src.Size() < 0 || c.dst.Size() <= 0 {
+		return actionTaken, nil, errNoDelta
+	}
+	do, ok := c.dst.(fs.DeltaUpdater)
+	if !ok {
+		return actionTaken, nil, errNoDelta
 	}
+	sig, err := do.DeltaSignature(ctx, delta.BlockSize(c.dst.Size()))
+	if errors.Is(err, fs.ErrorNotImplemented) {
+		fs.Debugf(c.dst, "delta copy: not supported: %v", err)
+		return actionTaken, nil, errNoDelta
+	} else if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta copy: failed to read signature: %w", err)
+	}
+	in, err := Open(ctx, c.src, downloadOptions...)
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("failed to open source object: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	dw := &deltaWriter{acc: c.tr.Account(ctx, nil)}
+	err = do.DeltaUpdate(ctx, c.src, func(w delta.Writer) error {
+		dw.w = w
+		return delta.Diff(sig, in, dw)
+	}, uploadOptions...)
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta copy: %w", err)
+	}
+	fs.Debugf(c.src, "delta copy: sent %v and reused %v of existing data", fs.SizeSuffix(dw.sent), fs.SizeSuffix(dw.matched))
+	// The object has been updated in place so doesn't need renaming
+	c.remoteForCopy = c.remote
+	return "Delta copied (replaced existing)", c.dst, nil
+}
 
+// Do a manual copy by reading the bytes and writing them
+func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
 	// Options for the upload
 	uploadOptions := []fs.OpenOption{c.hashOption}
 	for _, option := range c.ci.UploadHeaders {
@@ -253,6 +315,21 @@ func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Ob
 		downloadOptions = append(downloadOptions, option)
 	}
 
+	if c.ci.Delta && c.doUpdate {
+		actionTaken, newDst, err = c.deltaCopy(ctx, uploadOptions, downloadOptions)
+		if !errors.Is(err, errNoDelta) {
+			return actionTaken, newDst, err
+		}
+	}
+
+	// Remove partial files on premature exit
+	if !c.inplace {
+		defer atexit.Unregister(atexit.Register(func() {
+			ctx := context.Background()
+			c.removeFailedPartialCopy(ctx, c.f, c.remoteForCopy)
+		}))
+	}
+
 	if doMultiThreadCopy(ctx, c.f, c.src) {
 		return c.multiThreadCopy(ctx, uploadOptions)
 	}
@@ -16,6 +16,7 @@ import (
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/delta"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -394,6 +395,74 @@ func TestCopyInplace(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+// deltaCounter wraps an Object counting the new data written by a
+// delta update
+type deltaCounter struct {
+	fs.Object
+	written int64
+}
+
+func (o *deltaCounter) DeltaSignature(ctx context.Context, blockSize int) (*delta.Signature, error) {
+	return o.Object.(fs.DeltaUpdater).DeltaSignature(ctx, blockSize)
+}
+
+func (o *deltaCounter) DeltaUpdate(ctx context.Context, src fs.ObjectInfo, fn func(w delta.Writer) error, options ...fs.OpenOption) error {
+	return o.Object.(fs.DeltaUpdater).DeltaUpdate(ctx, src, func(w delta.Writer) error {
+		return fn(&deltaCountingWriter{Writer: w, o: o})
+	}, options...)
+}
+
+type deltaCountingWriter struct {
+	delta.Writer
+	o *deltaCounter
+}
+
+func (w *deltaCountingWriter) Write(p []byte) (int, error) {
+	w.o.written += int64(len(p))
+	return w.Writer.Write(p)
+}
+
+func TestCopyDelta(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.Delta = true
+
+	// disable server-side copies so the delta is used
+	r.Flocal.Features().Disable("Copy")
+	if r.Fremote.Features().IsLocal {
+		r.Fremote.Features().Disable("Copy")
+	}
+
+	data := make([]byte, 1024*1024+17)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	r.WriteObject(ctx, "file1", string(data), t1)
+	dst, err := r.Fremote.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	if _, ok := dst.(fs.DeltaUpdater); !ok {
+		t.Skip("Delta updates not supported")
+	}
+
+	// Change a few bytes in the middle of the file
+	data[500000] ^= 0xFF
+	data[500001] ^= 0xFF
+	file1 := r.WriteFile("file1", string(data), t2)
+	src, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+
+	counter := &deltaCounter{Object: dst}
+	_, err = operations.Copy(ctx, r.Fremote, counter, "file1", src)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, file1)
+
+	// Only the changed block should have been sent
+	blockSize := int64(delta.BlockSize(int64(len(data))))
+	assert.Greater(t, counter.written, int64(0))
+	assert.LessOrEqual(t, counter.written, 2*blockSize)
+}
+
 func TestCopyLongFileName(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -450,7 +519,7 @@ func TestCopyFileMaxTransfer(t *testing.T) {
 	ci.MaxTransfer = sizeCutoff
 	ci.CutoffMode = fs.CutoffModeHard
 
-	if runtime.GOOS == "darwin" {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
 		// disable server-side copies as they don't count towards transfer size stats
 		r.Flocal.Features().Disable("Copy")
 		if r.Fremote.Features().IsLocal {
@@ -62,6 +62,19 @@ type multiThreadCopyState struct {
 	noBuffering bool // set to read the input without buffering
 }
 
+// Return the size of chunk
+func (mc *multiThreadCopyState) chunkSize(chunk int) int64 {
+	start := int64(chunk) * mc.partSize
+	end := start + mc.partSize
+	if end > mc.size {
+		end = mc.size
+	}
+	if end < start {
+		return 0
+	}
+	return end - start
+}
+
 // Copy a single chunk into place
 func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer fs.ChunkWriter) (err error) {
 	defer func() {
@@ -73,11 +86,8 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 	if start >= mc.size {
 		return nil
 	}
-	end := start + mc.partSize
-	if end > mc.size {
-		end = mc.size
-	}
-	size := end - start
+	size := mc.chunkSize(chunk)
+	end := start + size
 
 	fs.Debugf(mc.src, "multi-thread copy: chunk %d/%d (%d-%d) size %v starting", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(size))
 
@@ -161,16 +171,48 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	// With --multi-thread-resume look for an upload to carry on with
+	var resume *multiThreadResume
+	if ci.MultiThreadResume && !usingOpenWriterAt {
+		resume = newMultiThreadResume(ctx, f, remote, src)
+	}
+	openOptions := options
+	if resume != nil {
+		if option := resume.option(src); option != nil {
+			openOptions = append(openOptions[:len(openOptions):len(openOptions)], option)
+		}
+	}
+
+	info, chunkWriter, err := openChunkWriter(ctx, remote, src, openOptions...)
 	if err != nil {
+		if resume != nil {
+			resume.close(src, false)
+		}
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
 
+	resumer, _ := chunkWriter.(fs.ChunkWriterResumer)
+	if resume != nil && resumer == nil {
+		fs.Debugf(src, "multi-thread copy: can't resume uploads to %v", f)
+		resume.close(src, true)
+		resume = nil
+	}
+	if resume != nil {
+		// Save the state now so the upload can be found if
+		// rclone is interrupted before any chunks are written
+		resume.save(src, resumer)
+	}
+
 	uploadCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	uploadedOK := false
 	defer atexit.OnError(&err, func() {
 		cancel()
+		if resume != nil {
+			// Leave the parts so the upload can be resumed
+			resume.close(src, uploadedOK)
+			return
+		}
 		if info.LeavePartsOnError || uploadedOK {
 			return
 		}
@@ -217,15 +259,35 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 	// Make accounting
 	mc.acc = tr.Account(gCtx, nil)
 
+	// Don't write the chunks a resumed upload already has
+	resumed := make(map[int]bool, len(info.ResumedChunks))
+	for _, chunk := range info.ResumedChunks {
+		if chunk >= 0 && chunk < mc.numChunks {
+			resumed[chunk] = true
+		}
+	}
+	if len(resumed) > 0 {
+		fs.Infof(src, "multi-thread copy: resuming upload with %d/%d chunks already written", len(resumed), mc.numChunks)
+	}
+
 	fs.Debugf(src, "Starting multi-thread copy with %d chunks of size %v with %v parallel streams", mc.numChunks, fs.SizeSuffix(mc.partSize), concurrency)
 	for chunk := 0; chunk < mc.numChunks; chunk++ {
 		// Fail fast, in case an errgroup managed function returns an error
 		if gCtx.Err() != nil {
 			break
 		}
+		if resumed[chunk] {
+			// Account for the chunk as if it was transferred
+			mc.acc.ServerSideTransferEnd(mc.chunkSize(chunk))
+			continue
+		}
 		chunk := chunk
 		g.Go(func() error {
-			return mc.copyChunk(gCtx, chunk, chunkWriter)
+			err := mc.copyChunk(gCtx, chunk, chunkWriter)
+			if err == nil && resume != nil {
+				resume.save(src, resumer)
+			}
+			return err
 		})
 	}
 
@@ -238,6 +300,10 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: failed to close object after copy: %w", err)
 	}
 	uploadedOK = true // file is definitely uploaded OK so no need to abort
+	if resume != nil {
+		resume.close(src, true)
+		resume = nil
+	}
 
 	obj, err := f.NewObject(ctx, remote)
 	if err != nil {
@@ -0,0 +1,146 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// multiThreadResumeFacility is the name of the database the state of
+// multi-thread uploads is kept in
+const multiThreadResumeFacility = "multithread-resume"
+
+// multiThreadResume saves the state of a multi-thread upload with
+// --multi-thread-resume so that if rclone is interrupted the next
+// copy of the same source object can carry on with it rather than
+// starting again.
+//
+// The state is kept in a database in the cache directory with one
+// record per destination object. The record has the fingerprint of
+// the source so it is only used if the source hasn't changed.
+type multiThreadResume struct {
+	db          *kv.DB
+	key         string
+	fingerprint string
+	mu          sync.Mutex
+}
+
+// multiThreadResumeRecord is saved for each upload in progress
+type multiThreadResumeRecord struct {
+	Fingerprint string // fingerprint of the source
+	State       string // state from ChunkWriterState
+}
+
+// newMultiThreadResume opens the resume state for uploading src to
+// (f, remote)
+//
+// It returns nil if the state can't be saved.
+func newMultiThreadResume(ctx context.Context, f fs.Fs, remote string, src fs.Object) *multiThreadResume {
+	if !kv.Supported() {
+		fs.Debugf(src, "multi-thread copy: can't resume uploads on this OS")
+		return nil
+	}
+	db, err := kv.Start(ctx, multiThreadResumeFacility, f)
+	if err != nil {
+		fs.Errorf(src, "multi-thread copy: failed to open resume state: %v", err)
+		return nil
+	}
+	return &multiThreadResume{
+		db:          db,
+		key:         fs.ConfigStringFull(f) + "\n" + remote,
+		fingerprint: fs.Fingerprint(ctx, src, true),
+	}
+}
+
+// option returns an option to resume the saved upload or nil if
+// there isn't one for this source
+func (r *multiThreadResume) option(src fs.Object) fs.OpenOption {
+	op := &mtrGet{key: r.key}
+	err := r.db.Do(false, op)
+	if err != nil {
+		if err != kv.ErrEmpty {
+			fs.Debugf(src, "multi-thread copy: failed to read resume state: %v", err)
+		}
+		return nil
+	}
+	if op.record == nil {
+		return nil
+	}
+	if op.record.Fingerprint != r.fingerprint {
+		fs.Debugf(src, "multi-thread copy: not resuming upload as the source has changed")
+		return nil
+	}
+	return &fs.ResumeChunkWriterOption{State: op.record.State}
+}
+
+// save the state of writer
+func (r *multiThreadResume) save(src fs.Object, writer fs.ChunkWriterResumer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, err := writer.ChunkWriterState()
+	if err == nil {
+		err = r.db.Do(true, &mtrPut{key: r.key, record: &multiThreadResumeRecord{
+			Fingerprint: r.fingerprint,
+			State:       state,
+		}})
+	}
+	if err != nil {
+		fs.Errorf(src, "multi-thread copy: failed to save resume state: %v", err)
+	}
+}
+
+// close the resume state removing the record if the upload finished
+func (r *multiThreadResume) close(src fs.Object, finished bool) {
+	if finished {
+		r.mu.Lock()
+		err := r.db.Do(true, &mtrPut{key: r.key})
+		r.mu.Unlock()
+		if err != nil {
+			fs.Errorf(src, "multi-thread copy: failed to remove resume state: %v", err)
+		}
+	} else {
+		fs.Infof(src, "multi-thread copy: saved state to resume upload from")
+	}
+	if err := r.db.Stop(false); err != nil {
+		fs.Debugf(src, "multi-thread copy: failed to close resume state: %v", err)
+	}
+}
+
+// mtrGet reads a record from the resume state
+type mtrGet struct {
+	key    string
+	record *multiThreadResumeRecord
+}
+
+func (op *mtrGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if data == nil {
+		return nil
+	}
+	op.record = new(multiThreadResumeRecord)
+	if err := json.Unmarshal(data, op.record); err != nil {
+		return fmt.Errorf("corrupted resume state: %w", err)
+	}
+	return nil
+}
+
+// mtrPut writes a record to the resume state, deleting it if nil
+type mtrPut struct {
+	key    string
+	record *multiThreadResumeRecord
+}
+
+func (op *mtrPut) Do(ctx context.Context, b kv.Bucket) error {
+	if op.record == nil {
+		return b.Delete([]byte(op.key))
+	}
+	data, err := json.Marshal(op.record)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(op.key), data)
+}
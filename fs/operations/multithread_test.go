@@ -1,7 +1,9 @@
 package operations
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +16,7 @@ import (
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fstest/mockfs"
 	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/kv"
 	"github.com/rclone/rclone/lib/random"
 
 	"github.com/rclone/rclone/fs"
@@ -333,3 +336,187 @@ func TestMultithreadCopyAbort(t *testing.T) {
 		require.NoError(t, o.Remove(ctx))
 	}
 }
+
+// size of the chunks resumeFs writes
+const resumeChunkSize = 1024
+
+// resumeFs is an fs.Fs with an OpenChunkWriter which can resume
+// uploads by keeping the parts written between uploads
+type resumeFs struct {
+	fs.Fs
+	mu        sync.Mutex
+	parts     map[int][]byte // parts written so far
+	written   []int          // chunks written by the last upload
+	resumed   bool           // set if the last upload was resumed
+	failChunk int            // fail writing this chunk if >= 0
+}
+
+// Features returns the optional features of this Fs
+func (f *resumeFs) Features() *fs.Features {
+	features := *f.Fs.Features()
+	features.OpenWriterAt = nil
+	features.OpenChunkWriter = f.OpenChunkWriter
+	return &features
+}
+
+// OpenChunkWriter returns the chunk size and a ChunkWriter
+func (f *resumeFs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info = fs.ChunkWriterInfo{
+		ChunkSize:   resumeChunkSize,
+		Concurrency: 1,
+	}
+	f.written = nil
+	f.resumed = false
+	for _, option := range options {
+		if resume, ok := option.(*fs.ResumeChunkWriterOption); ok {
+			var chunks []int
+			if err := json.Unmarshal([]byte(resume.State), &chunks); err != nil {
+				return info, nil, err
+			}
+			for _, chunk := range chunks {
+				if _, ok := f.parts[chunk]; ok {
+					info.ResumedChunks = append(info.ResumedChunks, chunk)
+				}
+			}
+			f.resumed = true
+		}
+	}
+	if !f.resumed {
+		f.parts = map[int][]byte{}
+	}
+	writer = &resumeChunkWriter{
+		f:      f,
+		remote: remote,
+		src:    src,
+		done:   append([]int(nil), info.ResumedChunks...),
+	}
+	return info, writer, nil
+}
+
+// resumeChunkWriter is the fs.ChunkWriter for resumeFs
+type resumeChunkWriter struct {
+	f      *resumeFs
+	remote string
+	src    fs.ObjectInfo
+	mu     sync.Mutex
+	done   []int
+}
+
+func (w *resumeChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return -1, err
+	}
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	if chunkNumber == w.f.failChunk {
+		return -1, errors.New("BOOM: simulated write failure")
+	}
+	w.f.parts[chunkNumber] = data
+	w.f.written = append(w.f.written, chunkNumber)
+	w.mu.Lock()
+	w.done = append(w.done, chunkNumber)
+	w.mu.Unlock()
+	return int64(len(data)), nil
+}
+
+func (w *resumeChunkWriter) ChunkWriterState() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, err := json.Marshal(w.done)
+	return string(data), err
+}
+
+func (w *resumeChunkWriter) Close(ctx context.Context) error {
+	w.f.mu.Lock()
+	var buf bytes.Buffer
+	for chunk := 0; chunk < len(w.f.parts); chunk++ {
+		buf.Write(w.f.parts[chunk])
+	}
+	w.f.mu.Unlock()
+	info := object.NewStaticObjectInfo(w.remote, w.src.ModTime(ctx), int64(buf.Len()), true, nil, w.f.Fs)
+	_, err := w.f.Fs.Put(ctx, &buf, info)
+	return err
+}
+
+func (w *resumeChunkWriter) Abort(ctx context.Context) error {
+	return nil
+}
+
+// Check an interrupted multi-thread upload is resumed with
+// --multi-thread-resume
+func TestMultithreadCopyResume(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("resuming uploads not supported on this OS")
+	}
+	r := fstest.NewRun(t)
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.MultiThreadResume = true
+	f := &resumeFs{Fs: r.Fremote, failChunk: 2}
+
+	// When testing kv removes the database when it is first
+	// opened, so keep it open for the test
+	db, err := kv.Start(ctx, multiThreadResumeFacility, f)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Stop(true)
+	})
+
+	const fileName = "test-multithread-resume"
+	contents := random.String(4*resumeChunkSize + 1)
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	t2 := fstest.Time("2011-12-25T12:59:59.123456789Z")
+	r.WriteFile(fileName, contents, t1)
+
+	accounting.GlobalStats().ResetCounters()
+	defer accounting.GlobalStats().ResetCounters()
+	upload := func() (fs.Object, error) {
+		src, err := r.Flocal.NewObject(ctx, fileName)
+		require.NoError(t, err)
+		tr := accounting.GlobalStats().NewTransfer(src, nil)
+		dst, err := multiThreadCopy(ctx, f, fileName, src, 1, tr)
+		tr.Done(ctx, err)
+		return dst, err
+	}
+
+	// The first upload fails part way through
+	_, err = upload()
+	require.Error(t, err)
+	assert.False(t, f.resumed)
+	assert.Subset(t, f.written, []int{0, 1})
+	assert.NotContains(t, f.written, 2)
+
+	// Changing the source means it isn't resumed
+	file1 := r.WriteFile(fileName, contents, t2)
+	f.failChunk = 3
+	_, err = upload()
+	require.Error(t, err)
+	assert.False(t, f.resumed)
+	assert.Subset(t, f.written, []int{0, 1, 2})
+	assert.NotContains(t, f.written, 3)
+
+	// This carries on from where the last upload stopped only
+	// writing the chunks which weren't written
+	var want []int
+	for chunk := 0; chunk < 5; chunk++ {
+		if _, ok := f.parts[chunk]; !ok {
+			want = append(want, chunk)
+		}
+	}
+	f.failChunk = -1
+	dst, err := upload()
+	require.NoError(t, err)
+	assert.True(t, f.resumed)
+	assert.Equal(t, want, f.written)
+	assert.Equal(t, file1.Size, dst.Size())
+	r.CheckRemoteItems(t, file1)
+
+	// The state was removed when the upload finished
+	_, err = upload()
+	require.NoError(t, err)
+	assert.False(t, f.resumed)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, f.written)
+}
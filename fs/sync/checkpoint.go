@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// checkpointBatch is the number of records saved in one go
+const checkpointBatch = 1000
+
+// checkpoint records the pairs of files a sync has found to be the
+// same, or made the same, so an interrupted sync can skip checking
+// them again.
+//
+// The records are kept in a database in the cache directory named
+// after everything which affects how a sync compares files, so a
+// checkpoint is only used by a sync with the same source,
+// destination, filters and comparison flags. Each record has the
+// fingerprints of both files so if either changes it is ignored.
+//
+// All the methods are safe to call on a nil *checkpoint.
+type checkpoint struct {
+	db      *kv.DB
+	handle  atexit.FnHandle
+	mu      sync.Mutex
+	pending map[string]string // records not saved yet
+}
+
+// checkpointName returns the name of the checkpoint database for a
+// sync of fsrc into fdst
+func checkpointName(ctx context.Context, fdst, fsrc fs.Fs, mode string) string {
+	ci := fs.GetConfig(ctx)
+	fi := filter.GetConfig(ctx)
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", mode, fs.ConfigStringFull(fsrc), fs.ConfigStringFull(fdst), fi.DumpFilters())
+	_, _ = fmt.Fprintf(h, "%v,%v,%v,%v,%v,%v,%v,%q,%q\n", ci.CheckSum, ci.SizeOnly, ci.IgnoreTimes, ci.IgnoreSize,
+		ci.UpdateOlder, ci.IgnoreExisting, ci.ModifyWindow, ci.CompareDest, ci.CopyDest)
+	return "checkpoint-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// newCheckpoint opens the checkpoint for a sync of fsrc into fdst
+func newCheckpoint(ctx context.Context, fdst, fsrc fs.Fs, mode string) (*checkpoint, error) {
+	if !kv.Supported() {
+		return nil, errors.New("not supported on this OS")
+	}
+	db, err := kv.Start(ctx, checkpointName(ctx, fdst, fsrc, mode), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	c := &checkpoint{
+		db:      db,
+		pending: make(map[string]string, checkpointBatch),
+	}
+	// Save the records if rclone is interrupted
+	c.handle = atexit.Register(func() {
+		if err := c.flush(); err != nil {
+			fs.Errorf(nil, "Failed to save checkpoint: %v", err)
+		}
+	})
+	fs.Infof(nil, "Using checkpoint %q", db.Path())
+	return c, nil
+}
+
+// record makes the record for src and dst
+func (c *checkpoint) record(ctx context.Context, src, dst fs.Object) string {
+	return fs.Fingerprint(ctx, src, true) + "\n" + fs.Fingerprint(ctx, dst, true)
+}
+
+// confirmed returns true if src and dst were found to be the same by
+// a previous run and haven't changed since
+func (c *checkpoint) confirmed(ctx context.Context, src, dst fs.Object) bool {
+	if c == nil || dst == nil || src.Remote() != dst.Remote() {
+		return false
+	}
+	op := &cpGet{key: src.Remote()}
+	err := c.db.Do(false, op)
+	if err != nil {
+		if err != kv.ErrEmpty {
+			fs.Debugf(src, "Failed to read checkpoint: %v", err)
+		}
+		return false
+	}
+	return op.value != "" && op.value == c.record(ctx, src, dst)
+}
+
+// add records that src and dst are the same
+func (c *checkpoint) add(ctx context.Context, src, dst fs.Object) {
+	if c == nil || dst == nil || src.Remote() != dst.Remote() {
+		return
+	}
+	record := c.record(ctx, src, dst)
+	c.mu.Lock()
+	c.pending[src.Remote()] = record
+	full := len(c.pending) >= checkpointBatch
+	c.mu.Unlock()
+	if full {
+		if err := c.flush(); err != nil {
+			fs.Errorf(nil, "Failed to save checkpoint: %v", err)
+		}
+	}
+}
+
+// flush saves the pending records
+func (c *checkpoint) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	err := c.db.Do(true, &cpPut{records: c.pending})
+	if err != nil {
+		return err
+	}
+	c.pending = make(map[string]string, checkpointBatch)
+	return nil
+}
+
+// close the checkpoint
+//
+// If the sync finished then it doesn't need resuming so the
+// checkpoint is removed, otherwise it is saved.
+func (c *checkpoint) close(finished bool) error {
+	if c == nil {
+		return nil
+	}
+	atexit.Unregister(c.handle)
+	if finished {
+		fs.Debugf(nil, "Removing checkpoint %q as the sync finished", c.db.Path())
+		return c.db.Stop(true)
+	}
+	err := c.flush()
+	if stopErr := c.db.Stop(false); err == nil {
+		err = stopErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	fs.Infof(nil, "Saved checkpoint %q to resume from", c.db.Path())
+	return nil
+}
+
+// cpGet reads a record from the checkpoint
+type cpGet struct {
+	key   string
+	value string
+}
+
+func (op *cpGet) Do(ctx context.Context, b kv.Bucket) error {
+	if data := b.Get([]byte(op.key)); data != nil {
+		op.value = string(data)
+	}
+	return nil
+}
+
+// cpPut writes records to the checkpoint
+type cpPut struct {
+	records map[string]string
+}
+
+func (op *cpPut) Do(ctx context.Context, b kv.Bucket) error {
+	for key, record := range op.records {
+		if err := b.Put([]byte(key), []byte(record)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Test checkpoints
+
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// holdCheckpoint keeps the checkpoint database for a sync open for
+// the rest of the test
+//
+// When testing kv removes the database when it is first opened, so
+// this keeps it open between the syncs being tested.
+func holdCheckpoint(ctx context.Context, t *testing.T, fdst, fsrc fs.Fs, mode string) {
+	if !kv.Supported() {
+		t.Skip("checkpoints not supported on this OS")
+	}
+	db, err := kv.Start(ctx, checkpointName(ctx, fdst, fsrc, mode), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Stop(true)
+	})
+}
+
+// addCheckpoint records src and dst in the checkpoint for a sync
+func addCheckpoint(ctx context.Context, t *testing.T, fdst, fsrc fs.Fs, mode string, remote string) {
+	cp, err := newCheckpoint(ctx, fdst, fsrc, mode)
+	require.NoError(t, err)
+	src, err := fsrc.NewObject(ctx, remote)
+	require.NoError(t, err)
+	dst, err := fdst.NewObject(ctx, remote)
+	require.NoError(t, err)
+	cp.add(ctx, src, dst)
+	require.NoError(t, cp.close(false))
+}
+
+// Check a pair confirmed by a checkpoint isn't checked again and the
+// checkpoint is removed once the sync finishes
+func TestCheckpointSkipsConfirmed(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.CheckSum = true
+	ci.Checkpoint = true
+
+	// Same size and modtime but different contents so
+	// --checksum would transfer it
+	file1 := r.WriteFile("file", "aaaa", t1)
+	file1dst := r.WriteObject(ctx, "file", "bbbb", t1)
+
+	holdCheckpoint(ctx, t, r.Fremote, r.Flocal, "sync")
+	addCheckpoint(ctx, t, r.Fremote, r.Flocal, "sync", "file")
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file1dst)
+
+	// The checkpoint was removed so this sync checks everything
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file1)
+}
+
+// Check a checkpoint isn't used if the files have changed
+func TestCheckpointStale(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.CheckSum = true
+	ci.Checkpoint = true
+
+	file1 := r.WriteFile("file", "aaaa", t1)
+	r.WriteObject(ctx, "file", "bbbb", t1)
+
+	holdCheckpoint(ctx, t, r.Fremote, r.Flocal, "copy")
+	addCheckpoint(ctx, t, r.Fremote, r.Flocal, "copy", "file")
+
+	// Change the modtime of the destination
+	r.WriteObject(ctx, "file", "bbbb", t2)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file1)
+}
+
+// Check the pairs a failed sync confirmed are kept in the checkpoint
+func TestCheckpointKeptOnError(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.Checkpoint = true
+
+	r.WriteBoth(ctx, "same", "same file", t1)
+	r.WriteFile("copied", "copied file", t1)
+	// A file over a directory makes the copy fail
+	r.WriteFile("conflict", "conflict file", t1)
+	r.WriteObject(ctx, "conflict/file", "file in directory", t1)
+
+	holdCheckpoint(ctx, t, r.Fremote, r.Flocal, "copy")
+	accounting.GlobalStats().ResetCounters()
+	defer accounting.GlobalStats().ResetCounters()
+	require.Error(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+
+	cp, err := newCheckpoint(ctx, r.Fremote, r.Flocal, "copy")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, cp.close(false))
+	}()
+	for _, remote := range []string{"same", "copied"} {
+		src, err := r.Flocal.NewObject(ctx, remote)
+		require.NoError(t, err)
+		dst, err := r.Fremote.NewObject(ctx, remote)
+		require.NoError(t, err)
+		assert.True(t, cp.confirmed(ctx, src, dst), remote)
+	}
+}
+
+// Check the reason --checkpoint is ignored is given when nothing is
+// transferred
+func TestCheckpointIgnoredWhenNotTransferring(t *testing.T) {
+	r := fstest.NewRun(t)
+	r.WriteFile("file", "file contents", t1)
+	for _, test := range []struct {
+		name   string
+		set    func(ci *fs.ConfigInfo)
+		reason string
+	}{
+		{"DryRun", func(ci *fs.ConfigInfo) { ci.DryRun = true }, "--dry-run"},
+		{"PlanFile", func(ci *fs.ConfigInfo) { ci.PlanFile = filepath.Join(t.TempDir(), "plan.json") }, "--plan-file"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, ci := fs.AddConfig(context.Background())
+			ci.Checkpoint = true
+			test.set(ci)
+			accounting.GlobalStats().ResetCounters()
+			output := bilib.CaptureOutput(func() {
+				require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+			})
+			assert.Contains(t, string(output), "Ignoring --checkpoint because of "+test.reason)
+			r.CheckRemoteItems(t)
+		})
+	}
+}
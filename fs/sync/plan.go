@@ -0,0 +1,501 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/errcount"
+	"golang.org/x/sync/errgroup"
+)
+
+// planVersion is the version of the plan file format
+const planVersion = 1
+
+// Actions which can be in a plan
+const (
+	PlanMkdir     = "mkdir"      // make directory Path on the destination
+	PlanRename    = "rename"     // rename From to Path on the destination
+	PlanCopy      = "copy"       // copy Path from the source to the destination
+	PlanUpdate    = "update"     // copy Path from the source over the destination
+	PlanMove      = "move"       // move Path from the source to the destination
+	PlanDeleteSrc = "delete_src" // delete Path from the source
+	PlanDelete    = "delete"     // delete Path from the destination
+	PlanRmdir     = "rmdir"      // remove directory Path from the destination if empty
+	PlanRmdirSrc  = "rmdir_src"  // remove directory Path from the source if empty
+)
+
+// The phases the actions are applied in. All the actions in a phase
+// are finished before the next phase starts.
+const (
+	phaseMkdir = iota
+	phaseRename
+	phaseTransfer
+	phaseDelete
+	phaseRmdir
+)
+
+// actionPhase is the phase each action is applied in
+var actionPhase = map[string]int{
+	PlanMkdir:     phaseMkdir,
+	PlanRename:    phaseRename,
+	PlanCopy:      phaseTransfer,
+	PlanUpdate:    phaseTransfer,
+	PlanMove:      phaseTransfer,
+	PlanDeleteSrc: phaseTransfer,
+	PlanDelete:    phaseDelete,
+	PlanRmdir:     phaseRmdir,
+	PlanRmdirSrc:  phaseRmdir,
+}
+
+// overriddenRe matches a remote with parameters given on the command
+// line, which fs.ConfigString shows as a {hash} suffix on its name
+var overriddenRe = regexp.MustCompile(`^:?[^:/\\{]*\{[^}]*\}:`)
+
+// errPlanChanged is returned when an object has changed since the
+// plan was made
+var errPlanChanged = errors.New("changed since the plan was made")
+
+// Plan is the list of actions a sync, copy or move would take, made
+// with --plan-file and carried out with Apply
+type Plan struct {
+	Version int          `json:"version"`
+	Created time.Time    `json:"created"`
+	Mode    string       `json:"mode"` // sync, copy or move
+	Src     string       `json:"src"`  // the source remote without any parameters given with it
+	Dst     string       `json:"dst"`  // the destination remote without any parameters given with it
+	Actions []PlanAction `json:"actions"`
+}
+
+// PlanAction is a single action in a Plan
+type PlanAction struct {
+	Action string      `json:"action"`
+	Path   string      `json:"path"`           // the file or directory acted on
+	From   string      `json:"from,omitempty"` // the old path for a rename
+	Src    *PlanObject `json:"src,omitempty"`  // the source object when planned
+	Dst    *PlanObject `json:"dst,omitempty"`  // the destination object when planned
+}
+
+// PlanObject describes an object when the plan was made so changes
+// to it can be detected when the plan is applied
+type PlanObject struct {
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"modtime"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// ReadPlan reads a plan written with --plan-file from the local file
+// at planPath
+func ReadPlan(planPath string) (*Plan, error) {
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	plan := new(Plan)
+	if err = json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan %q: %w", planPath, err)
+	}
+	if plan.Version > planVersion {
+		return nil, fmt.Errorf("plan %q is version %d but this rclone only understands up to version %d", planPath, plan.Version, planVersion)
+	}
+	for i := range plan.Actions {
+		if _, found := actionPhase[plan.Actions[i].Action]; !found {
+			return nil, fmt.Errorf("plan %q has unknown action %q", planPath, plan.Actions[i].Action)
+		}
+	}
+	return plan, nil
+}
+
+// Remotes returns the source and destination the plan was made with
+// for passing to fs.NewFs.
+//
+// The parameters of remotes configured on the command line, such as
+// ":s3,access_key_id=XXX:", aren't stored in the plan as they may be
+// secret. An error is returned if the plan was made with any of these
+// as they can't be made again from the plan alone.
+func (p *Plan) Remotes() (src, dst string, err error) {
+	if p.Src == "" || p.Dst == "" {
+		return "", "", errors.New("plan has no source or destination")
+	}
+	for _, remote := range []string{p.Src, p.Dst} {
+		if overriddenRe.MatchString(remote) {
+			return "", "", fmt.Errorf("plan was made with parameters for remote %q which aren't stored in the plan", remote)
+		}
+	}
+	return p.Src, p.Dst, nil
+}
+
+// sort the actions into the order they are applied in
+//
+// Directories are removed deepest first, everything else is sorted
+// by path.
+func (p *Plan) sort() {
+	sort.SliceStable(p.Actions, func(i, j int) bool {
+		a, b := &p.Actions[i], &p.Actions[j]
+		phaseA, phaseB := actionPhase[a.Action], actionPhase[b.Action]
+		if phaseA != phaseB {
+			return phaseA < phaseB
+		}
+		if phaseA == phaseRmdir {
+			return a.Path > b.Path
+		}
+		return a.Path < b.Path
+	})
+}
+
+// hasPhase returns true if the plan has any actions in phase
+func (p *Plan) hasPhase(phase int) bool {
+	for i := range p.Actions {
+		if actionPhase[p.Actions[i].Action] == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// write the plan to the local file at planPath
+func (p *Plan) write(planPath string) error {
+	p.sort()
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err = os.WriteFile(planPath, data, 0666); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	fs.Infof(nil, "Wrote plan with %d actions to %q", len(p.Actions), planPath)
+	return nil
+}
+
+// planRecorder collects the actions for a plan instead of a sync
+// carrying them out
+type planRecorder struct {
+	ci       *fs.ConfigInfo
+	hashType hash.Type // hash to record for the objects, may be None
+	mu       sync.Mutex
+	plan     Plan
+}
+
+// newPlanRecorder makes a planRecorder for a sync, copy or move of
+// fsrc into fdst
+func newPlanRecorder(ctx context.Context, fdst, fsrc fs.Fs, mode string) *planRecorder {
+	return &planRecorder{
+		ci:       fs.GetConfig(ctx),
+		hashType: fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
+		plan: Plan{
+			Version: planVersion,
+			Created: time.Now(),
+			Mode:    mode,
+			Src:     fs.ConfigString(fsrc),
+			Dst:     fs.ConfigString(fdst),
+			Actions: []PlanAction{},
+		},
+	}
+}
+
+// object describes o for the plan
+//
+// The hash is only recorded if it is cheap to read or --checksum is
+// in use, as otherwise the planning would read all the data.
+func (p *planRecorder) object(ctx context.Context, o fs.Object) *PlanObject {
+	if o == nil {
+		return nil
+	}
+	po := &PlanObject{
+		Size:    o.Size(),
+		ModTime: o.ModTime(ctx),
+	}
+	if p.hashType != hash.None && (p.ci.CheckSum || !o.Fs().Features().SlowHash) {
+		sum, err := o.Hash(ctx, p.hashType)
+		if err != nil {
+			fs.Debugf(o, "Failed to read hash for plan: %v", err)
+		} else if sum != "" {
+			po.Hashes = map[string]string{p.hashType.String(): sum}
+		}
+	}
+	return po
+}
+
+// add an action to the plan
+func (p *planRecorder) add(a PlanAction) {
+	if a.From != "" {
+		fs.Infof(a.Path, "Planned %s from %q", a.Action, a.From)
+	} else {
+		fs.Infof(a.Path, "Planned %s", a.Action)
+	}
+	p.mu.Lock()
+	p.plan.Actions = append(p.plan.Actions, a)
+	p.mu.Unlock()
+}
+
+// transfer records the copy or move of src over dst which may be nil
+func (p *planRecorder) transfer(ctx context.Context, doMove bool, src, dst fs.Object) {
+	action := PlanCopy
+	switch {
+	case doMove:
+		action = PlanMove
+	case dst != nil:
+		action = PlanUpdate
+	}
+	p.add(PlanAction{
+		Action: action,
+		Path:   src.Remote(),
+		Src:    p.object(ctx, src),
+		Dst:    p.object(ctx, dst),
+	})
+}
+
+// rename records the rename of dst to the name of src
+func (p *planRecorder) rename(ctx context.Context, src, dst fs.Object) {
+	p.add(PlanAction{
+		Action: PlanRename,
+		Path:   src.Remote(),
+		From:   dst.Remote(),
+		Src:    p.object(ctx, src),
+		Dst:    p.object(ctx, dst),
+	})
+}
+
+// delete records the deletion of dst from the destination
+func (p *planRecorder) delete(ctx context.Context, dst fs.Object) {
+	p.add(PlanAction{
+		Action: PlanDelete,
+		Path:   dst.Remote(),
+		Dst:    p.object(ctx, dst),
+	})
+}
+
+// deleteSrc records the deletion of src from the source
+func (p *planRecorder) deleteSrc(ctx context.Context, src fs.Object) {
+	p.add(PlanAction{
+		Action: PlanDeleteSrc,
+		Path:   src.Remote(),
+		Src:    p.object(ctx, src),
+	})
+}
+
+// mkdir records making dir on the destination
+func (p *planRecorder) mkdir(dir string) {
+	p.add(PlanAction{
+		Action: PlanMkdir,
+		Path:   dir,
+	})
+}
+
+// rmdir records removing dir from the destination, or the source if
+// onSrc is set
+func (p *planRecorder) rmdir(onSrc bool, dir string) {
+	action := PlanRmdir
+	if onSrc {
+		action = PlanRmdirSrc
+	}
+	p.add(PlanAction{
+		Action: action,
+		Path:   dir,
+	})
+}
+
+// write the plan to planPath
+func (p *planRecorder) write(planPath string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.plan.write(planPath)
+}
+
+// applier carries out the actions of a plan
+type applier struct {
+	ci        *fs.ConfigInfo
+	fdst      fs.Fs
+	fsrc      fs.Fs
+	backupDir fs.Fs // place to store overwrites/deletes
+}
+
+// Apply carries out the actions in plan, syncing fsrc into fdst
+//
+// Before each action the objects it acts on are checked against the
+// plan and if they have changed the action is refused with an error.
+// The other actions are carried on with, except the deletions on the
+// destination which are skipped after any error unless
+// --ignore-errors is set, like sync.
+func Apply(ctx context.Context, fdst, fsrc fs.Fs, plan *Plan) error {
+	ci := fs.GetConfig(ctx)
+	a := &applier{
+		ci:   ci,
+		fdst: fdst,
+		fsrc: fsrc,
+	}
+	if ci.BackupDir != "" || ci.Suffix != "" {
+		var err error
+		a.backupDir, err = operations.BackupDir(ctx, fdst, fsrc, "")
+		if err != nil {
+			return err
+		}
+	}
+	// The plan file is in order but sort it in case it was edited
+	plan.sort()
+	errCount := errcount.New()
+	for phase := phaseMkdir; phase <= phaseRmdir; phase++ {
+		if phase == phaseDelete && accounting.Stats(ctx).Errored() && !ci.IgnoreErrors {
+			if plan.hasPhase(phaseDelete) || plan.hasPhase(phaseRmdir) {
+				fs.Errorf(fdst, "%v", fs.ErrorNotDeleting)
+				errCount.Add(fs.ErrorNotDeleting)
+			}
+			break
+		}
+		limit := ci.Checkers
+		switch phase {
+		case phaseTransfer:
+			limit = ci.Transfers
+		case phaseMkdir, phaseRmdir:
+			// Parents must be made before children and removed after them
+			limit = 1
+		}
+		g, gCtx := errgroup.WithContext(ctx)
+		g.SetLimit(limit)
+		for i := range plan.Actions {
+			action := &plan.Actions[i]
+			if actionPhase[action.Action] != phase {
+				continue
+			}
+			if gCtx.Err() != nil {
+				break
+			}
+			g.Go(func() error {
+				errCount.Add(a.apply(gCtx, action))
+				return nil // don't return errors, just count them
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return errCount.Err("failed to apply plan")
+}
+
+// check finds the object at remote on f and checks it is the same as
+// want, or that it doesn't exist if want is nil
+//
+// It returns the object found, which will be nil if want is nil.
+func (a *applier) check(ctx context.Context, f fs.Fs, side string, remote string, want *PlanObject) (fs.Object, error) {
+	o, err := f.NewObject(ctx, remote)
+	if want == nil {
+		if err == nil {
+			return nil, fmt.Errorf("%s %w: %q exists", side, errPlanChanged, remote)
+		}
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, fmt.Errorf("%s %w: %q not found", side, errPlanChanged, remote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.Size() != want.Size {
+		return nil, fmt.Errorf("%s %w: size was %d now %d", side, errPlanChanged, want.Size, o.Size())
+	}
+	if window := fs.GetModifyWindow(ctx, f); window != fs.ModTimeNotSupported {
+		modTime := o.ModTime(ctx)
+		if dt := modTime.Sub(want.ModTime); dt >= window || dt <= -window {
+			return nil, fmt.Errorf("%s %w: modification time was %v now %v", side, errPlanChanged, want.ModTime, modTime)
+		}
+	}
+	for hashName, wantSum := range want.Hashes {
+		var hashType hash.Type
+		if hashType.Set(hashName) != nil || !f.Hashes().Contains(hashType) {
+			continue
+		}
+		sum, err := o.Hash(ctx, hashType)
+		if err != nil {
+			return nil, err
+		}
+		if sum != "" && sum != wantSum {
+			return nil, fmt.Errorf("%s %w: %v was %s now %s", side, errPlanChanged, hashType, wantSum, sum)
+		}
+	}
+	return o, nil
+}
+
+// apply carries out a single action
+func (a *applier) apply(ctx context.Context, action *PlanAction) error {
+	err := a.do(ctx, action)
+	if errors.Is(err, errPlanChanged) {
+		err = fs.CountError(ctx, err)
+		fs.Errorf(action.Path, "Refusing to %s: %v", action.Action, err)
+	}
+	return err
+}
+
+// do checks the objects for a single action then carries it out
+func (a *applier) do(ctx context.Context, action *PlanAction) (err error) {
+	var src, dst fs.Object
+	switch action.Action {
+	case PlanMkdir:
+		return operations.Mkdir(ctx, a.fdst, action.Path)
+	case PlanRename:
+		if dst, err = a.check(ctx, a.fdst, "destination", action.From, action.Dst); err != nil {
+			return err
+		}
+		if _, err = a.check(ctx, a.fdst, "destination", action.Path, nil); err != nil {
+			return err
+		}
+		_, err = operations.Move(ctx, a.fdst, nil, action.Path, dst)
+		return err
+	case PlanCopy, PlanUpdate, PlanMove:
+		if src, err = a.check(ctx, a.fsrc, "source", action.Path, action.Src); err != nil {
+			return err
+		}
+		if dst, err = a.check(ctx, a.fdst, "destination", action.Path, action.Dst); err != nil {
+			return err
+		}
+		// If destination already exists, then we must move it into --backup-dir if required
+		if dst != nil && a.backupDir != nil {
+			if err = operations.MoveBackupDir(ctx, a.backupDir, dst); err != nil {
+				return err
+			}
+			dst = nil
+		}
+		if action.Action == PlanMove {
+			_, err = operations.MoveTransfer(ctx, a.fdst, dst, action.Path, src)
+		} else {
+			_, err = operations.Copy(ctx, a.fdst, dst, action.Path, src)
+		}
+		return err
+	case PlanDeleteSrc:
+		if src, err = a.check(ctx, a.fsrc, "source", action.Path, action.Src); err != nil {
+			return err
+		}
+		return operations.DeleteFile(ctx, src)
+	case PlanDelete:
+		if dst, err = a.check(ctx, a.fdst, "destination", action.Path, action.Dst); err != nil {
+			return err
+		}
+		return operations.DeleteFileWithBackupDir(ctx, dst, a.backupDir)
+	case PlanRmdir, PlanRmdirSrc:
+		f := a.fdst
+		if action.Action == PlanRmdirSrc {
+			f = a.fsrc
+		}
+		// TryRmdir only deletes empty directories
+		if err = operations.TryRmdir(ctx, f, action.Path); err != nil {
+			fs.Debugf(fs.LogDirName(f, action.Path), "Failed to Rmdir: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown plan action %q", action.Action)
+}
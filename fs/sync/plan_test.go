@@ -0,0 +1,193 @@
+// Test plan/apply
+
+package sync
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planActions returns the action and path of each action in plan
+func planActions(plan *Plan) (actions []string) {
+	for _, action := range plan.Actions {
+		actions = append(actions, action.Action+" "+action.Path)
+	}
+	return actions
+}
+
+// makePlan runs fn with --plan-file set and reads the plan back
+func makePlan(ctx context.Context, t *testing.T, fn func(ctx context.Context) error) *Plan {
+	ctx, ci := fs.AddConfig(ctx)
+	ci.PlanFile = filepath.Join(t.TempDir(), "plan.json")
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, fn(ctx))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	plan, err := ReadPlan(ci.PlanFile)
+	require.NoError(t, err)
+	return plan
+}
+
+// Check a plan for a sync is made without changing anything then
+// applied
+func TestSyncPlanApply(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("new", "new file", t1)
+	file2 := r.WriteFile("sub dir/changed", "changed file contents", t2)
+	file2old := r.WriteObject(ctx, "sub dir/changed", "changed file", t1)
+	file3 := r.WriteObject(ctx, "deleted", "deleted file", t1)
+	file4 := r.WriteBoth(ctx, "same", "same file", t1)
+
+	plan := makePlan(ctx, t, func(ctx context.Context) error {
+		return Sync(ctx, r.Fremote, r.Flocal, false)
+	})
+	r.CheckRemoteItems(t, file2old, file3, file4)
+	assert.Equal(t, "sync", plan.Mode)
+	assert.Equal(t, fs.ConfigString(r.Flocal), plan.Src)
+	assert.Equal(t, fs.ConfigString(r.Fremote), plan.Dst)
+	assert.Equal(t, []string{
+		"copy new",
+		"update sub dir/changed",
+		"delete deleted",
+	}, planActions(plan))
+	update := plan.Actions[1]
+	require.NotNil(t, update.Src)
+	require.NotNil(t, update.Dst)
+	assert.Equal(t, file2.Size, update.Src.Size)
+	assert.Equal(t, file2old.Size, update.Dst.Size)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Apply(ctx, r.Fremote, r.Flocal, plan))
+	r.CheckLocalItems(t, file1, file2, file4)
+	r.CheckRemoteItems(t, file1, file2, file4)
+}
+
+// Check a plan for a move is made without changing anything then
+// applied
+func TestMovePlanApply(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("moved", "moved file", t1)
+	file2 := r.WriteBoth(ctx, "same", "same file", t1)
+
+	plan := makePlan(ctx, t, func(ctx context.Context) error {
+		return MoveDir(ctx, r.Fremote, r.Flocal, false, false)
+	})
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file2)
+	assert.Equal(t, "move", plan.Mode)
+	assert.Equal(t, []string{
+		"move moved",
+		"delete_src same",
+	}, planActions(plan))
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Apply(ctx, r.Fremote, r.Flocal, plan))
+	r.CheckLocalItems(t)
+	r.CheckRemoteItems(t, file1, file2)
+}
+
+// Check a plan with --track-renames has the renames in
+func TestSyncPlanApplyTrackRenames(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.TrackRenames = true
+
+	haveHash := r.Fremote.Hashes().Overlap(r.Flocal.Hashes()).GetOne() != hash.None
+	if !haveHash || !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Can't track renames")
+	}
+	file1 := r.WriteFile("renamed", "renamed file", t1)
+	file1old := r.WriteObject(ctx, "original", "renamed file", t1)
+
+	plan := makePlan(ctx, t, func(ctx context.Context) error {
+		return Sync(ctx, r.Fremote, r.Flocal, false)
+	})
+	r.CheckRemoteItems(t, file1old)
+	require.Equal(t, []string{"rename renamed"}, planActions(plan))
+	assert.Equal(t, "original", plan.Actions[0].From)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Apply(ctx, r.Fremote, r.Flocal, plan))
+	r.CheckRemoteItems(t, file1)
+	assert.NotZero(t, accounting.GlobalStats().Renames(0))
+}
+
+// Check apply refuses actions whose files changed after planning
+func TestApplyRefusesChanged(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	r.WriteFile("changed", "changed file", t1)
+	r.WriteFile("appeared", "appeared file", t1)
+	file3 := r.WriteFile("unchanged", "unchanged file", t1)
+	r.Mkdir(ctx, r.Fremote)
+
+	plan := makePlan(ctx, t, func(ctx context.Context) error {
+		return CopyDir(ctx, r.Fremote, r.Flocal, false)
+	})
+	assert.Equal(t, "copy", plan.Mode)
+	assert.Equal(t, []string{
+		"copy appeared",
+		"copy changed",
+		"copy unchanged",
+	}, planActions(plan))
+
+	// Change the source of one and make the destination of another
+	r.WriteFile("changed", "changed file with new contents", t2)
+	file2 := r.WriteObject(ctx, "appeared", "appeared on the destination", t2)
+
+	accounting.GlobalStats().ResetCounters()
+	defer accounting.GlobalStats().ResetCounters()
+	err := Apply(ctx, r.Fremote, r.Flocal, plan)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errPlanChanged))
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetErrors())
+	r.CheckRemoteItems(t, file2, file3)
+}
+
+// Check options which can't be planned are refused
+func TestSyncPlanRefusesOptions(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.PlanFile = filepath.Join(t.TempDir(), "plan.json")
+	ci.FixCase = true
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--plan-file")
+}
+
+// Check the parameters of remotes given on the command line aren't
+// stored in the plan as they may be secret
+func TestSyncPlanRemoteParameters(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	r.WriteFile("file", "file contents", t1)
+
+	src, dst, err := makePlan(ctx, t, func(ctx context.Context) error {
+		return Sync(ctx, r.Fremote, r.Flocal, false)
+	}).Remotes()
+	require.NoError(t, err)
+	assert.Equal(t, fs.ConfigString(r.Flocal), src)
+	assert.Equal(t, fs.ConfigString(r.Fremote), dst)
+
+	fdst, err := fs.NewFs(ctx, ":local,copy_links=true:"+t.TempDir())
+	require.NoError(t, err)
+	plan := makePlan(ctx, t, func(ctx context.Context) error {
+		return Sync(ctx, fdst, r.Flocal, false)
+	})
+	assert.NotContains(t, plan.Dst, "copy_links")
+	_, _, err = plan.Remotes()
+	assert.ErrorContains(t, err, "parameters")
+}
@@ -0,0 +1,254 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// renameIndexFacility is the name of the database the index is kept in
+const renameIndexFacility = "track-renames-index"
+
+// renameIndexBatch is the number of records saved in one go
+const renameIndexBatch = 1000
+
+// renameIndex is a persistent index of the hashes of the files on
+// the destination for --track-renames-index.
+//
+// It is kept in a database in the cache directory, one per remote,
+// with a record for each file holding its size, modification time and
+// the hash of the source it was copied from. A record is only used if
+// the size and modification time of the file still match, so the
+// destination never needs hashing to find renames even if it doesn't
+// support the hash.
+//
+// All the methods are safe to call on a nil *renameIndex.
+type renameIndex struct {
+	db        *kv.DB
+	fdst      fs.Fs
+	hashType  hash.Type
+	precision time.Duration
+	handle    atexit.FnHandle
+	loadOnce  sync.Once
+	mu        sync.Mutex
+	records   map[string]*renameIndexRecord // records read from the index
+	pending   map[string]*renameIndexRecord // records not saved yet - nil to delete
+}
+
+// renameIndexRecord is saved for each file on the destination
+type renameIndexRecord struct {
+	Size     int64
+	ModTime  time.Time
+	HashType string
+	Hash     string
+}
+
+// newRenameIndex opens the index for fdst using hashType
+func newRenameIndex(ctx context.Context, fdst fs.Fs, hashType hash.Type, precision time.Duration) (*renameIndex, error) {
+	if !kv.Supported() {
+		return nil, errors.New("not supported on this OS")
+	}
+	db, err := kv.Start(ctx, renameIndexFacility, fdst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	ri := &renameIndex{
+		db:        db,
+		fdst:      fdst,
+		hashType:  hashType,
+		precision: precision,
+		pending:   make(map[string]*renameIndexRecord, renameIndexBatch),
+	}
+	// Save the records if rclone is interrupted
+	ri.handle = atexit.Register(func() {
+		if err := ri.flush(); err != nil {
+			fs.Errorf(fdst, "Failed to save --track-renames-index: %v", err)
+		}
+	})
+	fs.Debugf(fdst, "Using --track-renames-index %q with %v hashes", db.Path(), hashType)
+	return ri, nil
+}
+
+// key returns the key in the index for remote
+//
+// The key is the path from the root of the remote so the index can
+// be shared by syncs to different directories.
+func (ri *renameIndex) key(remote string) string {
+	return path.Join(ri.fdst.Root(), remote)
+}
+
+// load reads the whole index into memory
+func (ri *renameIndex) load() {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	op := &riLoad{records: make(map[string]*renameIndexRecord)}
+	err := ri.db.Do(false, op)
+	if err != nil && err != kv.ErrEmpty {
+		fs.Errorf(ri.fdst, "Failed to read --track-renames-index: %v", err)
+	}
+	fs.Debugf(ri.fdst, "Read %d records from --track-renames-index", len(op.records))
+	ri.records = op.records
+}
+
+// lookup returns the hash of dst from the index or "" if it isn't
+// in the index or has changed since it was added
+func (ri *renameIndex) lookup(ctx context.Context, dst fs.Object) string {
+	if ri == nil {
+		return ""
+	}
+	ri.loadOnce.Do(ri.load)
+	key := ri.key(dst.Remote())
+	ri.mu.Lock()
+	record, ok := ri.pending[key]
+	if !ok {
+		record = ri.records[key]
+	}
+	ri.mu.Unlock()
+	if record == nil || record.HashType != ri.hashType.String() || record.Size != dst.Size() {
+		return ""
+	}
+	if ri.precision != fs.ModTimeNotSupported {
+		dt := dst.ModTime(ctx).Sub(record.ModTime)
+		if dt >= ri.precision || dt <= -ri.precision {
+			return ""
+		}
+	}
+	return record.Hash
+}
+
+// add records that dst has the same contents as src
+//
+// This reads the hash of src if it isn't already known.
+func (ri *renameIndex) add(ctx context.Context, src, dst fs.Object) {
+	if ri == nil || dst == nil {
+		return
+	}
+	hashValue, err := src.Hash(ctx, ri.hashType)
+	if err != nil || hashValue == "" {
+		fs.Debugf(src, "Not adding to --track-renames-index as couldn't read hash: %v", err)
+		return
+	}
+	ri.put(ri.key(dst.Remote()), &renameIndexRecord{
+		Size:     dst.Size(),
+		ModTime:  dst.ModTime(ctx),
+		HashType: ri.hashType.String(),
+		Hash:     hashValue,
+	})
+}
+
+// addIfMissing adds dst to the index unless it is there already
+//
+// This is used for files which are unchanged so only need hashing
+// the first time they are seen.
+func (ri *renameIndex) addIfMissing(ctx context.Context, src, dst fs.Object) {
+	if ri == nil || dst == nil || ri.lookup(ctx, dst) != "" {
+		return
+	}
+	ri.add(ctx, src, dst)
+}
+
+// remove the record for remote from the index
+func (ri *renameIndex) remove(remote string) {
+	if ri == nil {
+		return
+	}
+	ri.put(ri.key(remote), nil)
+}
+
+// put saves a record in the index, saving the pending records if
+// there are enough of them
+func (ri *renameIndex) put(key string, record *renameIndexRecord) {
+	ri.mu.Lock()
+	ri.pending[key] = record
+	full := len(ri.pending) >= renameIndexBatch
+	ri.mu.Unlock()
+	if full {
+		if err := ri.flush(); err != nil {
+			fs.Errorf(ri.fdst, "Failed to save --track-renames-index: %v", err)
+		}
+	}
+}
+
+// flush saves the pending records
+func (ri *renameIndex) flush() error {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if len(ri.pending) == 0 {
+		return nil
+	}
+	err := ri.db.Do(true, &riPut{records: ri.pending})
+	if err != nil {
+		return err
+	}
+	if ri.records != nil {
+		for key, record := range ri.pending {
+			ri.records[key] = record
+		}
+	}
+	ri.pending = make(map[string]*renameIndexRecord, renameIndexBatch)
+	return nil
+}
+
+// close saves the index
+func (ri *renameIndex) close() {
+	if ri == nil {
+		return
+	}
+	atexit.Unregister(ri.handle)
+	if err := ri.flush(); err != nil {
+		fs.Errorf(ri.fdst, "Failed to save --track-renames-index: %v", err)
+	}
+	if err := ri.db.Stop(false); err != nil {
+		fs.Errorf(ri.fdst, "Failed to close --track-renames-index: %v", err)
+	}
+}
+
+// riLoad reads all the records from the index
+type riLoad struct {
+	records map[string]*renameIndexRecord
+}
+
+func (op *riLoad) Do(ctx context.Context, b kv.Bucket) error {
+	return b.ForEach(func(key, data []byte) error {
+		record := new(renameIndexRecord)
+		if err := json.Unmarshal(data, record); err != nil {
+			fs.Debugf(nil, "Ignoring corrupted --track-renames-index record for %q: %v", key, err)
+			return nil
+		}
+		op.records[string(key)] = record
+		return nil
+	})
+}
+
+// riPut writes records to the index, deleting the nil ones
+type riPut struct {
+	records map[string]*renameIndexRecord
+}
+
+func (op *riPut) Do(ctx context.Context, b kv.Bucket) error {
+	for key, record := range op.records {
+		if record == nil {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Test the --track-renames-index
+
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// holdRenameIndex keeps the rename index database for fdst open for
+// the rest of the test
+//
+// When testing kv removes the database when it is first opened, so
+// this keeps it open between the syncs being tested.
+func holdRenameIndex(ctx context.Context, t *testing.T, fdst fs.Fs) {
+	if !kv.Supported() {
+		t.Skip("rename index not supported on this OS")
+	}
+	db, err := kv.Start(ctx, renameIndexFacility, fdst)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Stop(true)
+	})
+}
+
+func TestRenameIndex(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	holdRenameIndex(ctx, t, r.Fremote)
+
+	r.WriteFile("file", "contents", t1)
+	r.WriteObject(ctx, "file", "contents", t1)
+	src, err := r.Flocal.NewObject(ctx, "file")
+	require.NoError(t, err)
+	dst, err := r.Fremote.NewObject(ctx, "file")
+	require.NoError(t, err)
+	srcHash, err := src.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+
+	ri, err := newRenameIndex(ctx, r.Fremote, hash.MD5, fs.GetModifyWindow(ctx, r.Fremote))
+	require.NoError(t, err)
+	assert.Equal(t, "", ri.lookup(ctx, dst))
+	ri.addIfMissing(ctx, src, dst)
+	assert.Equal(t, srcHash, ri.lookup(ctx, dst))
+	ri.close()
+
+	// Check the record is saved
+	ri, err = newRenameIndex(ctx, r.Fremote, hash.MD5, fs.GetModifyWindow(ctx, r.Fremote))
+	require.NoError(t, err)
+	assert.Equal(t, srcHash, ri.lookup(ctx, dst))
+
+	// Check the record isn't used for a different hash
+	ri.hashType = hash.SHA1
+	assert.Equal(t, "", ri.lookup(ctx, dst))
+	ri.hashType = hash.MD5
+
+	// Check the record isn't used if the file has changed
+	require.NoError(t, dst.SetModTime(ctx, t2))
+	assert.Equal(t, "", ri.lookup(ctx, dst))
+	require.NoError(t, dst.SetModTime(ctx, t1))
+	assert.Equal(t, srcHash, ri.lookup(ctx, dst))
+
+	ri.remove("file")
+	assert.Equal(t, "", ri.lookup(ctx, dst))
+	ri.close()
+
+	// Check the removal is saved
+	ri, err = newRenameIndex(ctx, r.Fremote, hash.MD5, fs.GetModifyWindow(ctx, r.Fremote))
+	require.NoError(t, err)
+	assert.Equal(t, "", ri.lookup(ctx, dst))
+	ri.close()
+
+	// Check the nil index does nothing
+	var nilIndex *renameIndex
+	assert.Equal(t, "", nilIndex.lookup(ctx, dst))
+	nilIndex.add(ctx, src, dst)
+	nilIndex.remove("file")
+	nilIndex.close()
+}
+
+func TestSyncWithTrackRenamesIndex(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.TrackRenames = true
+	ci.TrackRenamesIndex = true
+	holdRenameIndex(ctx, t, r.Fremote)
+
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Can't track renames without server-side move")
+	}
+
+	f1 := r.WriteFile("potato", "Potato Content", t1)
+	f2 := r.WriteFile("yam", "Yam Content", t2)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, f1, f2)
+
+	// Rename locally and check the rename is found
+	f2 = r.RenameFile(f2, "yaml")
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, f1, f2)
+	assert.Equal(t, int64(1), accounting.GlobalStats().Renames(0))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+
+	// Check the index was updated with the rename
+	hashType := r.Flocal.Hashes().Overlap(r.Fremote.Hashes()).GetOne()
+	srcHash, err := fstest.NewObject(ctx, t, r.Flocal, "yaml").Hash(ctx, hashType)
+	require.NoError(t, err)
+	ri, err := newRenameIndex(ctx, r.Fremote, hashType, fs.GetModifyWindow(ctx, r.Fremote))
+	require.NoError(t, err)
+	dst := fstest.NewObject(ctx, t, r.Fremote, "yaml")
+	assert.Equal(t, srcHash, ri.lookup(ctx, dst))
+	ri.load()
+	assert.Nil(t, ri.records[ri.key("yam")])
+
+	// Corrupt the record for the destination to show the index is
+	// used rather than hashing the destination
+	ri.put(ri.key("yaml"), &renameIndexRecord{
+		Size:     dst.Size(),
+		ModTime:  dst.ModTime(ctx),
+		HashType: hashType.String(),
+		Hash:     "00000000000000000000000000000000",
+	})
+	ri.close()
+
+	f2 = r.RenameFile(f2, "yam2")
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, f1, f2)
+	assert.Equal(t, int64(0), accounting.GlobalStats().Renames(0))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+}
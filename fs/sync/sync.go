@@ -73,6 +73,8 @@ type syncCopyMove struct {
 	noRetryErr             error                  // error with NoRetry set
 	fatalErr               error                  // fatal error
 	commonHash             hash.Type              // common hash type between src and dst
+	renameHash             hash.Type              // hash type used to track renames
+	renameIndex            *renameIndex           // if set the persistent index of dst hashes for --track-renames-index
 	modifyWindow           time.Duration          // modify window between fsrc, fdst
 	renameMapMu            sync.Mutex             // mutex to protect the below
 	renameMap              map[string][]fs.Object // dst files by hash - only used by trackRenames
@@ -94,6 +96,8 @@ type syncCopyMove struct {
 	setDirModTimes         []setDirModTime        // directories that need their modtime set
 	setDirModTimesMaxLevel int                    // max level of the directories to set
 	modifiedDirs           map[string]struct{}    // dirs with changed contents (if s.setDirModTimeAfter)
+	plan                   *planRecorder          // if set record the actions here instead of doing them
+	checkpoint             *checkpoint            // if set skip the pairs confirmed by an earlier run
 }
 
 // For keeping track of delayed modtime sets
@@ -239,8 +243,17 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			fs.Errorf(fdst, "Ignoring --track-renames as the destination does not support server-side move or copy")
 			s.trackRenames = false
 		}
-		if s.trackRenamesStrategy.hash() && s.commonHash == hash.None {
-			fs.Errorf(fdst, "Ignoring --track-renames as the source and destination do not have a common hash")
+		s.renameHash = s.commonHash
+		if ci.TrackRenamesIndex && s.renameHash == hash.None {
+			// The index means the destination doesn't need the hash
+			s.renameHash = fsrc.Hashes().GetOne()
+		}
+		if s.trackRenamesStrategy.hash() && s.renameHash == hash.None {
+			if ci.TrackRenamesIndex {
+				fs.Errorf(fdst, "Ignoring --track-renames as the source does not support any hashes")
+			} else {
+				fs.Errorf(fdst, "Ignoring --track-renames as the source and destination do not have a common hash")
+			}
 			s.trackRenames = false
 		}
 
@@ -376,7 +389,14 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		tr := accounting.Stats(s.ctx).NewCheckingTransfer(src, "checking")
 		// Check to see if can store this
 		if src.Storable() {
-			needTransfer := operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
+			needTransfer := false
+			confirmed := s.checkpoint.confirmed(s.ctx, pair.Src, pair.Dst)
+			if confirmed {
+				fs.Debugf(src, "Unchanged skipping as confirmed by checkpoint")
+				s.logger(s.ctx, operations.Match, pair.Src, pair.Dst, nil)
+			} else {
+				needTransfer = operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
+			}
 			if needTransfer {
 				NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir)
 				if err != nil {
@@ -410,7 +430,9 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 						s.markDirModifiedObject(src)
 					}
 					// If destination already exists, then we must move it into --backup-dir if required
-					if pair.Dst != nil && s.backupDir != nil {
+					//
+					// If planning this is done when the plan is applied
+					if pair.Dst != nil && s.backupDir != nil && s.plan == nil {
 						err := operations.MoveBackupDir(s.ctx, s.backupDir, pair.Dst)
 						if err != nil {
 							s.processError(err)
@@ -431,6 +453,10 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 					}
 				}
 			} else {
+				if !confirmed {
+					s.checkpoint.add(s.ctx, src, pair.Dst)
+				}
+				s.renameIndex.addIfMissing(s.ctx, src, pair.Dst)
 				// If moving need to delete the files we don't need to copy
 				if s.DoMove {
 					// Delete src if no error on copy
@@ -438,6 +464,8 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 						fs.Logf(src, "Not removing source file as it is the same file as the destination")
 					} else if s.ci.IgnoreExisting {
 						fs.Debugf(src, "Not removing source file as destination file exists and --ignore-existing is set")
+					} else if s.plan != nil {
+						s.plan.deleteSrc(s.ctx, src)
 					} else if s.checkFirst && s.ci.OrderBy != "" {
 						// If we want perfect ordering then use the transfers to delete the file
 						//
@@ -490,6 +518,10 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		}
 		src := pair.Src
 		dst := pair.Dst
+		if s.plan != nil {
+			s.plan.transfer(ctx, s.DoMove, src, dst)
+			continue
+		}
 		if s.DoMove {
 			if src != dst {
 				_, err = operations.MoveTransfer(ctx, fdst, dst, src.Remote(), src)
@@ -498,7 +530,12 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 				err = operations.DeleteFile(ctx, src)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			var newDst fs.Object
+			newDst, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			if err == nil {
+				s.checkpoint.add(ctx, src, newDst)
+				s.renameIndex.add(ctx, src, newDst)
+			}
 		}
 		s.processError(err)
 		if err != nil {
@@ -592,7 +629,7 @@ func (s *syncCopyMove) startDeleters() {
 	s.deletersWg.Add(1)
 	go func() {
 		defer s.deletersWg.Done()
-		err := operations.DeleteFilesWithBackupDir(s.ctx, s.deleteFilesCh, s.backupDir)
+		err := s.deleteObjects(s.deleteFilesCh)
 		s.processError(err)
 	}()
 }
@@ -649,7 +686,19 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 		}
 		close(toDelete)
 	}()
-	return operations.DeleteFilesWithBackupDir(s.ctx, toDelete, s.backupDir)
+	return s.deleteObjects(toDelete)
+}
+
+// deleteObjects deletes the objects read from toBeDeleted, or records
+// them in the plan if planning
+func (s *syncCopyMove) deleteObjects(toBeDeleted fs.ObjectsChan) error {
+	if s.plan != nil {
+		for o := range toBeDeleted {
+			s.plan.delete(s.ctx, o)
+		}
+		return nil
+	}
+	return operations.DeleteFilesWithBackupDir(s.ctx, toBeDeleted, s.backupDir)
 }
 
 // This deletes the empty directories in the slice passed in.  It
@@ -674,7 +723,9 @@ func (s *syncCopyMove) deleteEmptyDirectories(ctx context.Context, f fs.Fs, entr
 	for i := len(entries) - 1; i >= 0; i-- {
 		entry := entries[i]
 		dir, ok := entry.(fs.Directory)
-		if ok {
+		if ok && s.plan != nil {
+			s.plan.rmdir(f == s.fsrc, dir.Remote())
+		} else if ok {
 			// TryRmdir only deletes empty directories
 			err := operations.TryRmdir(ctx, f, dir.Remote())
 			if err != nil {
@@ -756,17 +807,41 @@ func parseTrackRenamesStrategy(strategies string) (strategy trackRenamesStrategy
 	return strategy, nil
 }
 
+// renameHashOf returns the hash used to track renames for obj
+//
+// If dst is set then obj is on the destination so its hash is read
+// from the --track-renames-index if possible.
+func (s *syncCopyMove) renameHashOf(obj fs.Object, dst bool) (string, error) {
+	if !dst || s.renameIndex == nil {
+		return obj.Hash(s.ctx, s.renameHash)
+	}
+	if hashValue := s.renameIndex.lookup(s.ctx, obj); hashValue != "" {
+		return hashValue, nil
+	}
+	if s.commonHash != s.renameHash {
+		// Can't hash the destination so can only use the index
+		return "", nil
+	}
+	hashValue, err := obj.Hash(s.ctx, s.renameHash)
+	if err == nil && hashValue != "" {
+		s.renameIndex.add(s.ctx, obj, obj)
+	}
+	return hashValue, err
+}
+
 // renameID makes a string with the size and the other identifiers of the requested rename strategies
 //
+// If dst is set then obj is on the destination.
+//
 // it may return an empty string in which case no hash could be made
-func (s *syncCopyMove) renameID(obj fs.Object, renamesStrategy trackRenamesStrategy, precision time.Duration) string {
+func (s *syncCopyMove) renameID(obj fs.Object, dst bool, renamesStrategy trackRenamesStrategy, precision time.Duration) string {
 	var builder strings.Builder
 
 	fmt.Fprintf(&builder, "%d", obj.Size())
 
 	if renamesStrategy.hash() {
 		var err error
-		hash, err := obj.Hash(s.ctx, s.commonHash)
+		hash, err := s.renameHashOf(obj, dst)
 		if err != nil {
 			fs.Debugf(obj, "Hash failed: %v", err)
 			return ""
@@ -863,7 +938,7 @@ func (s *syncCopyMove) makeRenameMap() {
 				// only create hash for dst fs.Object if its size could match
 				if _, found := possibleSizes[obj.Size()]; found {
 					tr := accounting.Stats(s.ctx).NewCheckingTransfer(obj, "renaming")
-					hash := s.renameID(obj, s.trackRenamesStrategy, s.modifyWindow)
+					hash := s.renameID(obj, true, s.trackRenamesStrategy, s.modifyWindow)
 
 					if hash != "" {
 						s.pushRenameMap(hash, obj)
@@ -882,7 +957,7 @@ func (s *syncCopyMove) makeRenameMap() {
 // possible, it returns true if the object was renamed.
 func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	// Calculate the hash of the src object
-	hash := s.renameID(src, s.trackRenamesStrategy, fs.GetModifyWindow(s.ctx, s.fsrc, s.fdst))
+	hash := s.renameID(src, false, s.trackRenamesStrategy, fs.GetModifyWindow(s.ctx, s.fsrc, s.fdst))
 
 	if hash == "" {
 		return false
@@ -894,22 +969,29 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 		return false
 	}
 
-	// Find dst object we are about to overwrite if it exists
-	dstOverwritten, _ := s.fdst.NewObject(s.ctx, src.Remote())
+	if s.plan != nil {
+		s.plan.rename(s.ctx, src, dst)
+	} else {
+		// Find dst object we are about to overwrite if it exists
+		dstOverwritten, _ := s.fdst.NewObject(s.ctx, src.Remote())
 
-	// Rename dst to have name src.Remote()
-	_, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
-	if err != nil {
-		fs.Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
-		return false
+		// Rename dst to have name src.Remote()
+		newDst, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
+		if err != nil {
+			fs.Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
+			return false
+		}
+		fs.Infof(src, "Renamed from %q", dst.Remote())
+		if newDst != nil {
+			s.renameIndex.remove(dst.Remote())
+			s.renameIndex.add(s.ctx, src, newDst)
+		}
 	}
 
 	// remove file from dstFiles if present
 	s.dstFilesMu.Lock()
 	delete(s.dstFiles, dst.Remote())
 	s.dstFilesMu.Unlock()
-
-	fs.Infof(src, "Renamed from %q", dst.Remote())
 	return true
 }
 
@@ -926,6 +1008,17 @@ func (s *syncCopyMove) run() error {
 		return nil
 	}
 
+	if s.trackRenames && s.ci.TrackRenamesIndex {
+		if !s.trackRenamesStrategy.hash() {
+			fs.Errorf(s.fdst, "Ignoring --track-renames-index as --track-renames-strategy doesn't use the hash")
+		} else if ri, err := newRenameIndex(s.ctx, s.fdst, s.renameHash, fs.GetModifyWindow(s.ctx, s.fdst)); err != nil {
+			fs.Errorf(s.fdst, "Ignoring --track-renames-index: %v", err)
+		} else {
+			s.renameIndex = ri
+			defer s.renameIndex.close()
+		}
+	}
+
 	// Start background checking and transferring pipeline
 	s.startCheckers()
 	s.startRenamers()
@@ -979,7 +1072,13 @@ func (s *syncCopyMove) run() error {
 		if s.currentError() != nil && !s.ci.IgnoreErrors {
 			fs.Errorf(s.fdst, "%v", fs.ErrorNotDeleting)
 		} else {
-			s.processError(s.deleteFiles(false))
+			err := s.deleteFiles(false)
+			if err == nil && !s.ci.DryRun {
+				for remote := range s.dstFiles {
+					s.renameIndex.remove(remote)
+				}
+			}
+			s.processError(err)
 		}
 	}
 
@@ -1120,6 +1219,8 @@ func (s *syncCopyMove) copyDirMetadata(ctx context.Context, f fs.Fs, dst fs.Dire
 			} else {
 				newDst, err = operations.SetDirModTime(ctx, f, dst, dir, src.ModTime(ctx))
 			}
+		} else if dst == nil && s.plan != nil {
+			s.plan.mkdir(dir)
 		} else if dst == nil {
 			// Create the directory if it doesn't exist
 			err = operations.Mkdir(ctx, f, dir)
@@ -1337,6 +1438,47 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
+	mode := syncMode(deleteMode, DoMove)
+	var plan *planRecorder
+	if ci.PlanFile != "" {
+		if ci.FixCase {
+			return fserrors.FatalError(errors.New("can't use --fix-case with --plan-file"))
+		}
+		if len(ci.CopyDest) > 0 {
+			return fserrors.FatalError(errors.New("can't use --copy-dest with --plan-file"))
+		}
+		plan = newPlanRecorder(ctx, fdst, fsrc, mode)
+		// Set --dry-run so nothing we don't record is changed
+		ctx, ci = fs.AddConfig(ctx)
+		ci.DryRun = true
+	}
+	var cp *checkpoint
+	if ci.Checkpoint {
+		if DoMove {
+			fs.Errorf(fdst, "Ignoring --checkpoint as it doesn't work with move, only sync or copy")
+		} else if plan != nil {
+			fs.Errorf(fdst, "Ignoring --checkpoint because of --plan-file as nothing is transferred")
+		} else if ci.DryRun {
+			fs.Errorf(fdst, "Ignoring --checkpoint because of --dry-run as nothing is transferred")
+		} else if c, err := newCheckpoint(ctx, fdst, fsrc, mode); err != nil {
+			fs.Errorf(fdst, "Ignoring --checkpoint: %v", err)
+		} else {
+			cp = c
+		}
+	}
+	err := runSyncCopyMovePasses(ctx, fdst, fsrc, deleteMode, DoMove, deleteEmptySrcDirs, copyEmptySrcDirs, plan, cp)
+	if closeErr := cp.close(err == nil); closeErr != nil {
+		fs.Errorf(fdst, "%v", closeErr)
+	}
+	if err == nil && plan != nil {
+		err = plan.write(ci.PlanFile)
+	}
+	return err
+}
+
+// runSyncCopyMovePasses runs the passes of runSyncCopyMove
+func runSyncCopyMovePasses(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool, plan *planRecorder, cp *checkpoint) error {
+	ci := fs.GetConfig(ctx)
 	// Run an extra pass to delete only
 	if deleteMode == fs.DeleteModeBefore {
 		if ci.TrackRenames {
@@ -1347,6 +1489,8 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		if err != nil {
 			return err
 		}
+		do.setPlan(plan)
+		do.checkpoint = cp
 		err = do.run()
 		if err != nil {
 			return err
@@ -1358,9 +1502,34 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if err != nil {
 		return err
 	}
+	do.setPlan(plan)
+	do.checkpoint = cp
 	return do.run()
 }
 
+// syncMode returns the name of the kind of sync being done
+func syncMode(deleteMode fs.DeleteMode, DoMove bool) string {
+	switch {
+	case deleteMode != fs.DeleteModeOff:
+		return "sync"
+	case DoMove:
+		return "move"
+	}
+	return "copy"
+}
+
+// setPlan makes s record its actions in plan instead of doing them if
+// plan is set
+func (s *syncCopyMove) setPlan(plan *planRecorder) {
+	if plan == nil {
+		return
+	}
+	s.plan = plan
+	// Directory modtimes and metadata aren't part of the plan
+	s.setDirMetadata = false
+	s.setDirModTime = false
+}
+
 // Sync fsrc into fdst
 func Sync(ctx context.Context, fdst, fsrc fs.Fs, copyEmptySrcDirs bool) error {
 	ci := fs.GetConfig(ctx)
@@ -1386,7 +1555,9 @@ func MoveDir(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool, cop
 	}
 
 	// First attempt to use DirMover if exists, same Fs and no filters are active
-	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() {
+	//
+	// This isn't done if making a plan so it lists each file
+	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() && fs.GetConfig(ctx).PlanFile == "" {
 		if operations.SkipDestructive(ctx, fdst, "server-side directory move") {
 			return nil
 		}
@@ -1484,10 +1484,10 @@ func testSyncWithMaxDuration(t *testing.T, cutoffMode fs.CutoffMode) {
 	r.CheckLocalItems(t, file1, file2)
 	r.CheckRemoteItems(t)
 
-	if runtime.GOOS == "darwin" {
-		r.Flocal.Features().Disable("Copy") // macOS cloning is too fast for this test!
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
+		r.Flocal.Features().Disable("Copy") // cloning is too fast for this test!
 		if r.Fremote.Features().IsLocal {
-			r.Fremote.Features().Disable("Copy") // macOS cloning is too fast for this test!
+			r.Fremote.Features().Disable("Copy") // cloning is too fast for this test!
 		}
 	}
 	accounting.GlobalStats().ResetCounters()
@@ -2681,7 +2681,7 @@ func TestMaxTransfer(t *testing.T) {
 		r.CheckLocalItems(t, file1, file2, file3)
 		r.CheckRemoteItems(t)
 
-		if runtime.GOOS == "darwin" {
+		if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
 			// disable server-side copies as they don't count towards transfer size stats
 			r.Flocal.Features().Disable("Copy")
 			if r.Fremote.Features().IsLocal {
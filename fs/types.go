@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/delta"
 )
 
 // Fs is the interface a cloud storage system must provide
@@ -210,6 +211,26 @@ type SetMetadataer interface {
 	SetMetadata(ctx context.Context, metadata Metadata) error
 }
 
+// DeltaUpdater is an optional interface for Object
+//
+// It is used by --delta to update an existing object by sending only
+// the parts of the new data which have changed.
+type DeltaUpdater interface {
+	// DeltaSignature returns the block checksums of the existing
+	// object using the blockSize given.
+	//
+	// It should return fs.ErrorNotImplemented if it can't make one.
+	DeltaSignature(ctx context.Context, blockSize int) (*delta.Signature, error)
+
+	// DeltaUpdate updates the object with the new data described
+	// by the calls fn makes to the delta.Writer and the ModTime
+	// from src.
+	//
+	// The object should be replaced atomically if possible and
+	// left unchanged if fn returns an error.
+	DeltaUpdate(ctx context.Context, src ObjectInfo, fn func(w delta.Writer) error, options ...OpenOption) error
+}
+
 // SetModTimer is an optional interface for Directory.
 //
 // Object implements this as part of its requires set of interfaces.
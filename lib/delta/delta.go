@@ -0,0 +1,396 @@
+// Package delta implements rsync style delta transfers.
+//
+// The receiver makes a Signature of the file it already has by
+// checksumming it in blocks. The sender runs Diff over the new file
+// using the Signature to find the blocks the receiver already has and
+// writes a list of instructions to a Writer - either copy a range of
+// the old file or write some new data. The receiver follows the
+// instructions to make the new file, so only the parts of the file
+// which have changed need to be sent.
+package delta
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Limits for the block size
+const (
+	MinBlockSize = 4 * 1024
+	MaxBlockSize = 1024 * 1024
+)
+
+// BlockSize returns a good block size to use for a file of size
+//
+// This is roughly the square root of the size, rounded up to a power
+// of two, which balances the size of the Signature against how much
+// data is resent for each change.
+func BlockSize(size int64) int {
+	blockSize := MinBlockSize
+	target := int(math.Sqrt(float64(size)))
+	for blockSize < target && blockSize < MaxBlockSize {
+		blockSize *= 2
+	}
+	return blockSize
+}
+
+// Block is the checksum of one block of a file
+type Block struct {
+	Weak   uint32         // rolling checksum of the block
+	Strong [md5.Size]byte // MD5 of the block
+}
+
+// Signature describes a file as a list of block checksums
+//
+// Aligned signatures can only match blocks which start at a multiple
+// of the block size in the new file. This is what you get if the
+// receiver can't calculate the Weak checksums, and works well for
+// files which are modified in place, like databases and disk images,
+// but not for files with data inserted or removed.
+type Signature struct {
+	BlockSize int     // size of each block - the last may be shorter
+	Size      int64   // size of the file
+	Blocks    []Block // checksums of each block
+	Aligned   bool    // set if only the Strong checksums are valid
+}
+
+// lastBlockSize returns the size of the last block in the Signature
+func (sig *Signature) lastBlockSize() int {
+	if len(sig.Blocks) == 0 {
+		return 0
+	}
+	return int(sig.Size - int64(len(sig.Blocks)-1)*int64(sig.BlockSize))
+}
+
+// check the Signature is consistent
+func (sig *Signature) check() error {
+	if sig.BlockSize <= 0 {
+		return fmt.Errorf("delta: invalid block size %d", sig.BlockSize)
+	}
+	blocks := (sig.Size + int64(sig.BlockSize) - 1) / int64(sig.BlockSize)
+	if sig.Size < 0 || blocks != int64(len(sig.Blocks)) {
+		return fmt.Errorf("delta: signature has %d blocks but expecting %d for size %d", len(sig.Blocks), blocks, sig.Size)
+	}
+	return nil
+}
+
+// weakSum is the rolling checksum used to find candidate blocks. It
+// is the one from rsync which is based on Adler-32.
+type weakSum struct {
+	a, b uint32
+	n    uint32
+}
+
+// init the checksum with the data in p
+func (w *weakSum) init(p []byte) {
+	w.a, w.b, w.n = 0, 0, uint32(len(p))
+	for i, c := range p {
+		w.a += uint32(c)
+		w.b += uint32(len(p)-i) * uint32(c)
+	}
+}
+
+// roll the checksum on one byte removing out and adding in
+func (w *weakSum) roll(out, in byte) {
+	w.a += uint32(in) - uint32(out)
+	w.b += w.a - w.n*uint32(out)
+}
+
+// sum returns the current value of the checksum
+func (w *weakSum) sum() uint32 {
+	return w.a&0xffff | w.b<<16
+}
+
+// Sign makes the Signature of the data read from in using blockSize
+func Sign(in io.Reader, blockSize int) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("delta: invalid block size %d", blockSize)
+	}
+	sig := &Signature{
+		BlockSize: blockSize,
+	}
+	buf := make([]byte, blockSize)
+	var weak weakSum
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			weak.init(buf[:n])
+			sig.Blocks = append(sig.Blocks, Block{
+				Weak:   weak.sum(),
+				Strong: md5.Sum(buf[:n]),
+			})
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// Writer receives the instructions to make the new file
+//
+// The new file is made sequentially, so each call adds data to the
+// end of it.
+type Writer interface {
+	// Write new data
+	io.Writer
+	// Copy size bytes from offset in the old file
+	Copy(offset, size int64) error
+}
+
+// Diff reads the new file from in and writes the instructions to
+// make it from the old file described by sig to w.
+//
+// Adjacent copies are coalesced into one and new data is written in
+// chunks no bigger than a few blocks.
+func Diff(sig *Signature, in io.Reader, w Writer) error {
+	if err := sig.check(); err != nil {
+		return err
+	}
+	d := &differ{
+		sig:  sig,
+		in:   in,
+		w:    w,
+		bs:   sig.BlockSize,
+		buf:  make([]byte, 4*sig.BlockSize),
+		weak: make(map[uint32][]int, len(sig.Blocks)),
+	}
+	d.index()
+	return d.diff()
+}
+
+// differ holds the state of a Diff
+//
+// The data in buf[lit:pos] is new data which hasn't been written yet
+// and buf[pos:end] is the data still to be matched.
+type differ struct {
+	sig      *Signature
+	in       io.Reader
+	w        Writer
+	bs       int
+	buf      []byte
+	lit      int
+	pos      int
+	end      int
+	eof      bool
+	weak     map[uint32][]int       // weak checksum to block numbers
+	strong   map[[md5.Size]byte]int // strong checksum to block number for Aligned signatures
+	copyOff  int64                  // offset of pending copy
+	copySize int64                  // size of pending copy
+}
+
+// index the full sized blocks of the Signature
+func (d *differ) index() {
+	n := len(d.sig.Blocks)
+	if d.sig.lastBlockSize() != d.bs {
+		n-- // the short last block is matched separately
+	}
+	if d.sig.Aligned {
+		d.strong = make(map[[md5.Size]byte]int, n)
+		for i := n - 1; i >= 0; i-- {
+			d.strong[d.sig.Blocks[i].Strong] = i
+		}
+		return
+	}
+	for i := 0; i < n; i++ {
+		weak := d.sig.Blocks[i].Weak
+		d.weak[weak] = append(d.weak[weak], i)
+	}
+}
+
+// fill reads data into the buffer until there are at least need
+// bytes to match or the input is exhausted
+func (d *differ) fill(need int) error {
+	for !d.eof && d.end-d.pos < need {
+		if d.end == len(d.buf) {
+			// Make room by writing the pending data and
+			// moving the unmatched data to the start
+			if err := d.flushLiteral(); err != nil {
+				return err
+			}
+			d.end = copy(d.buf, d.buf[d.pos:d.end])
+			d.pos, d.lit = 0, 0
+		}
+		n, err := d.in.Read(d.buf[d.end:])
+		d.end += n
+		if err == io.EOF {
+			d.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushCopy writes the pending copy if any
+func (d *differ) flushCopy() error {
+	if d.copySize == 0 {
+		return nil
+	}
+	err := d.w.Copy(d.copyOff, d.copySize)
+	d.copySize = 0
+	return err
+}
+
+// flushLiteral writes the pending new data if any
+func (d *differ) flushLiteral() error {
+	if d.lit == d.pos {
+		return nil
+	}
+	if err := d.flushCopy(); err != nil {
+		return err
+	}
+	_, err := d.w.Write(d.buf[d.lit:d.pos])
+	d.lit = d.pos
+	return err
+}
+
+// matched records that size bytes at pos match the old file at
+// offset
+func (d *differ) matched(offset int64, size int) error {
+	if err := d.flushLiteral(); err != nil {
+		return err
+	}
+	if d.copySize != 0 && d.copyOff+d.copySize == offset {
+		d.copySize += int64(size)
+	} else {
+		if err := d.flushCopy(); err != nil {
+			return err
+		}
+		d.copyOff, d.copySize = offset, int64(size)
+	}
+	d.pos += size
+	d.lit = d.pos
+	return nil
+}
+
+// find returns the block number matching the block at pos or -1
+func (d *differ) find(weak uint32) int {
+	block := d.buf[d.pos : d.pos+d.bs]
+	if d.sig.Aligned {
+		if i, ok := d.strong[md5.Sum(block)]; ok {
+			return i
+		}
+		return -1
+	}
+	candidates := d.weak[weak]
+	if len(candidates) == 0 {
+		return -1
+	}
+	strong := md5.Sum(block)
+	for _, i := range candidates {
+		if d.sig.Blocks[i].Strong == strong {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchTail matches the end of the new file against the short last
+// block of the old file
+func (d *differ) matchTail() (bool, error) {
+	n := d.sig.lastBlockSize()
+	tail := d.end - n
+	if n == 0 || n == d.bs || tail < d.pos {
+		return false, nil
+	}
+	last := len(d.sig.Blocks) - 1
+	if md5.Sum(d.buf[tail:d.end]) != d.sig.Blocks[last].Strong {
+		return false, nil
+	}
+	d.pos = tail
+	return true, d.matched(int64(last)*int64(d.bs), n)
+}
+
+// diff runs the main loop
+func (d *differ) diff() error {
+	var weak weakSum
+	rolling := false
+	for {
+		// Need one more byte than the block to roll the checksum
+		if err := d.fill(d.bs + 1); err != nil {
+			return err
+		}
+		if d.end-d.pos < d.bs {
+			break
+		}
+		if !d.sig.Aligned && !rolling {
+			weak.init(d.buf[d.pos : d.pos+d.bs])
+			rolling = true
+		}
+		if i := d.find(weak.sum()); i >= 0 {
+			if err := d.matched(int64(i)*int64(d.bs), d.bs); err != nil {
+				return err
+			}
+			rolling = false
+			continue
+		}
+		if d.sig.Aligned {
+			// Only look for matches on block boundaries
+			d.pos += d.bs
+		} else {
+			if d.end-d.pos == d.bs {
+				// At the end of the input
+				break
+			}
+			weak.roll(d.buf[d.pos], d.buf[d.pos+d.bs])
+			d.pos++
+		}
+		// Don't let the pending data get too large
+		if d.pos-d.lit >= 2*d.bs {
+			if err := d.flushLiteral(); err != nil {
+				return err
+			}
+		}
+	}
+	matched, err := d.matchTail()
+	if err != nil {
+		return err
+	}
+	if !matched {
+		d.pos = d.end
+	}
+	if err := d.flushLiteral(); err != nil {
+		return err
+	}
+	return d.flushCopy()
+}
+
+// ErrShortCopy is returned by the patcher if the old file is too short
+var ErrShortCopy = errors.New("delta: copy beyond the end of the old file")
+
+// patcher is a Writer which makes the new file from the old one
+type patcher struct {
+	old io.ReaderAt
+	out io.Writer
+}
+
+// NewPatcher returns a Writer which makes the new file by writing
+// to out, copying ranges from old
+func NewPatcher(old io.ReaderAt, out io.Writer) Writer {
+	return &patcher{old: old, out: out}
+}
+
+// Write new data
+func (p *patcher) Write(b []byte) (int, error) {
+	return p.out.Write(b)
+}
+
+// Copy size bytes from offset in the old file
+func (p *patcher) Copy(offset, size int64) error {
+	n, err := io.Copy(p.out, io.NewSectionReader(p.old, offset, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return ErrShortCopy
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package delta
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockSize(t *testing.T) {
+	for _, test := range []struct {
+		size int64
+		want int
+	}{
+		{0, MinBlockSize},
+		{1024, MinBlockSize},
+		{100 * 1024 * 1024, 16 * 1024},
+		{1 << 40, MaxBlockSize},
+	} {
+		assert.Equal(t, test.want, BlockSize(test.size), fmt.Sprint(test.size))
+	}
+}
+
+func TestWeakSumRoll(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	const n = 100
+	var rolling, fresh weakSum
+	rolling.init(data[:n])
+	for i := 1; i+n <= len(data); i++ {
+		rolling.roll(data[i-1], data[i-1+n])
+		fresh.init(data[i : i+n])
+		require.Equal(t, fresh.sum(), rolling.sum(), i)
+	}
+}
+
+func TestSign(t *testing.T) {
+	data := []byte("0123456789abcdefXYZ")
+	sig, err := Sign(bytes.NewReader(data), 8)
+	require.NoError(t, err)
+	assert.Equal(t, 8, sig.BlockSize)
+	assert.Equal(t, int64(len(data)), sig.Size)
+	assert.False(t, sig.Aligned)
+	require.Equal(t, 3, len(sig.Blocks))
+	assert.Equal(t, md5.Sum(data[:8]), sig.Blocks[0].Strong)
+	assert.Equal(t, md5.Sum(data[8:16]), sig.Blocks[1].Strong)
+	assert.Equal(t, md5.Sum(data[16:]), sig.Blocks[2].Strong)
+	assert.Equal(t, 3, sig.lastBlockSize())
+
+	sig, err = Sign(bytes.NewReader(nil), 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), sig.Size)
+	assert.Equal(t, 0, len(sig.Blocks))
+
+	_, err = Sign(bytes.NewReader(data), 0)
+	assert.Error(t, err)
+}
+
+// recorder is a Writer which records what it is asked to do and
+// patches the old file
+type recorder struct {
+	Writer
+	copied  int64
+	written int64
+	copies  int
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.written += int64(len(p))
+	return r.Writer.Write(p)
+}
+
+func (r *recorder) Copy(offset, size int64) error {
+	r.copied += size
+	r.copies++
+	return r.Writer.Copy(offset, size)
+}
+
+// roundTrip diffs newData against oldData and checks the result
+func roundTrip(t *testing.T, oldData, newData []byte, blockSize int, aligned bool) *recorder {
+	sig, err := Sign(bytes.NewReader(oldData), blockSize)
+	require.NoError(t, err)
+	if aligned {
+		sig.Aligned = true
+		for i := range sig.Blocks {
+			sig.Blocks[i].Weak = 0
+		}
+	}
+	var out bytes.Buffer
+	r := &recorder{Writer: NewPatcher(bytes.NewReader(oldData), &out)}
+	require.NoError(t, Diff(sig, bytes.NewReader(newData), r))
+	require.Equal(t, newData, out.Bytes())
+	assert.Equal(t, int64(len(newData)), r.copied+r.written)
+	return r
+}
+
+func TestDiff(t *testing.T) {
+	const bs = 64
+	rng := rand.New(rand.NewSource(42))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	join := func(bs ...[]byte) []byte {
+		return bytes.Join(bs, nil)
+	}
+	old := random(100*bs + 17)
+	modified := append([]byte(nil), old...)
+	modified[10*bs+5] ^= 0xFF
+	modified[50*bs] ^= 0xFF
+
+	for _, test := range []struct {
+		name       string
+		old        []byte
+		new        []byte
+		maxWritten int64
+		minWritten int64
+	}{
+		{name: "Identical", old: old, new: old, maxWritten: 0},
+		{name: "Empty old", old: nil, new: old, minWritten: int64(len(old))},
+		{name: "Empty new", old: old, new: nil, maxWritten: 0},
+		{name: "Both empty", old: nil, new: nil, maxWritten: 0},
+		{name: "Modified", old: old, new: modified, maxWritten: 2 * bs},
+		{name: "Truncated", old: old, new: old[:60*bs+3], maxWritten: bs},
+		{name: "Appended", old: old, new: join(old, random(1000)), maxWritten: 1000 + bs},
+		{name: "Unrelated", old: old, new: random(len(old)), minWritten: int64(len(old))},
+		{name: "Short", old: old[:10], new: old[:10], maxWritten: 0},
+		{name: "Inserted", old: old, new: join(old[:20*bs+7], random(33), old[20*bs+7:]), maxWritten: 33 + bs},
+		{name: "Removed", old: old, new: join(old[:20*bs+7], old[30*bs+11:]), maxWritten: bs},
+		{name: "Moved", old: old, new: join(old[50*bs:], old[:50*bs]), maxWritten: bs},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := roundTrip(t, test.old, test.new, bs, false)
+			assert.LessOrEqual(t, r.written, test.maxWritten+test.minWritten)
+			assert.GreaterOrEqual(t, r.written, test.minWritten)
+		})
+		t.Run(test.name+"/Aligned", func(t *testing.T) {
+			roundTrip(t, test.old, test.new, bs, true)
+		})
+	}
+}
+
+func TestDiffCoalesce(t *testing.T) {
+	old := make([]byte, 1000*64+1)
+	rand.New(rand.NewSource(1)).Read(old)
+	r := roundTrip(t, old, old, 64, false)
+	assert.Equal(t, 1, r.copies)
+	r = roundTrip(t, old, old, 64, true)
+	assert.Equal(t, 1, r.copies)
+}
+
+func TestDiffAligned(t *testing.T) {
+	const bs = 64
+	old := make([]byte, 100*bs)
+	rand.New(rand.NewSource(1)).Read(old)
+	modified := append([]byte(nil), old...)
+	modified[10*bs+5] ^= 0xFF
+	r := roundTrip(t, old, modified, bs, true)
+	assert.Equal(t, int64(bs), r.written)
+}
+
+func TestDiffBadSignature(t *testing.T) {
+	err := Diff(&Signature{BlockSize: 8, Size: 100}, bytes.NewReader(nil), &recorder{})
+	assert.ErrorContains(t, err, "signature has 0 blocks but expecting 13")
+	err = Diff(&Signature{}, bytes.NewReader(nil), &recorder{})
+	assert.ErrorContains(t, err, "invalid block size")
+}
+
+func TestPatcherShortCopy(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPatcher(bytes.NewReader([]byte("hello")), &out)
+	assert.NoError(t, p.Copy(1, 3))
+	assert.Equal(t, ErrShortCopy, p.Copy(3, 3))
+}
@@ -97,7 +97,8 @@ func TestRcPollInterval(t *testing.T) {
 	}
 	out, err := call.Fn(context.Background(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, rc.Params{}, out)
+	assert.Equal(t, true, out["enabled"])
+	assert.Equal(t, true, out["supported"])
 	// FIXME needs more tests
 }
 